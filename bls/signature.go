@@ -290,6 +290,11 @@ func (publicKey *PublicKey) IsEmpty() bool {
 	return publicKey == nil || publicKey.flowPublicKeyBytes == nil
 }
 
+// IsValid returns true if the public key's bytes decode to a valid BLS public key.
+func (publicKey *PublicKey) IsValid() bool {
+	return !publicKey.IsEmpty() && publicKey.loadFlowPublicKey() == nil
+}
+
 type SerializedPublicKey string
 
 func (publicKey *PublicKey) Serialize() SerializedPublicKey {
@@ -285,6 +285,12 @@ func TestVerifyingBLSSignatures(t *testing.T) {
 	require.Nil(t, nilPublicKey.Copy())
 	// IsEmpty
 	require.True(t, (&PublicKey{}).IsEmpty())
+	// IsValid
+	require.False(t, (&PublicKey{}).IsValid())
+	invalidPublicKey, err := (&PublicKey{}).FromBytes([]byte{1, 2, 3, 4})
+	require.NoError(t, err)
+	require.False(t, invalidPublicKey.IsValid())
+	require.True(t, _generateRandomBLSPrivateKey(t).PublicKey().IsValid())
 
 	// Test SerializedPublicKey
 	serializedPublicKey := blsPublicKey1.Serialize()
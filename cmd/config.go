@@ -36,8 +36,16 @@ type Config struct {
 	MaxInboundPeers   uint32
 	OneInboundPerIp   bool
 
+	// Peer bans
+	PeerBanThreshold        uint64
+	PeerBanDurationSeconds  uint64
+	PeerBanAPIListenAddress string
+
 	// NetworkingManager config
 	PeerConnectionRefreshIntervalMillis uint64
+	EncryptedTransport                  bool
+	RequireEncryptedValidatorTransport  bool
+	MessageCompression                  bool
 
 	// Snapshot
 	HyperSync                 bool
@@ -55,6 +63,9 @@ type Config struct {
 	MempoolBackupIntervalMillis                uint64
 	MempoolMaxValidationViewConnects           uint64
 	TransactionValidationRefreshIntervalMillis uint64
+	MempoolMaxTxnsPerPublicKey                 uint64
+	MempoolMaxBytesPerPublicKey                uint64
+	MempoolFairShareEviction                   bool
 
 	// Mining
 	MinerPublicKeys  []string
@@ -83,9 +94,14 @@ type Config struct {
 	// State Syncer
 	StateChangeDir                 string
 	StateSyncerMempoolTxnSyncLimit uint64
+	StateChangeSocketPath          string
+	StateChangeSQLitePath          string
 
 	// PoS Checkpoint Syncing
 	CheckpointSyncingProviders []string
+
+	// State API
+	StateAPIListenAddress string
 }
 
 // Viper doesn't work when you have environment variables. This is the
@@ -144,6 +160,9 @@ func LoadConfig() *Config {
 	config.MempoolBackupIntervalMillis = viper.GetUint64("mempool-backup-time-millis")
 	config.MempoolMaxValidationViewConnects = viper.GetUint64("mempool-max-validation-view-connects")
 	config.TransactionValidationRefreshIntervalMillis = viper.GetUint64("transaction-validation-refresh-interval-millis")
+	config.MempoolMaxTxnsPerPublicKey = viper.GetUint64("mempool-max-txns-per-public-key")
+	config.MempoolMaxBytesPerPublicKey = viper.GetUint64("mempool-max-bytes-per-public-key")
+	config.MempoolFairShareEviction = viper.GetBool("mempool-fair-share-eviction")
 
 	// Peers
 	config.ConnectIPs = GetStringSliceWorkaround("connect-ips")
@@ -161,8 +180,16 @@ func LoadConfig() *Config {
 	config.MaxInboundPeers = viper.GetUint32("max-inbound-peers")
 	config.OneInboundPerIp = viper.GetBool("one-inbound-per-ip")
 
+	// Peer bans
+	config.PeerBanThreshold = viper.GetUint64("peer-ban-threshold")
+	config.PeerBanDurationSeconds = viper.GetUint64("peer-ban-duration-seconds")
+	config.PeerBanAPIListenAddress = viper.GetString("peer-ban-api-listen-address")
+
 	// NetworkManager config
 	config.PeerConnectionRefreshIntervalMillis = viper.GetUint64("peer-connection-refresh-interval-millis")
+	config.EncryptedTransport = viper.GetBool("encrypted-transport")
+	config.RequireEncryptedValidatorTransport = viper.GetBool("require-encrypted-validator-transport")
+	config.MessageCompression = viper.GetBool("message-compression")
 
 	// Mining + Admin
 	config.MinerPublicKeys = GetStringSliceWorkaround("miner-public-keys")
@@ -196,6 +223,14 @@ func LoadConfig() *Config {
 	// State Syncer
 	config.StateChangeDir = viper.GetString("state-change-dir")
 	config.StateSyncerMempoolTxnSyncLimit = viper.GetUint64("state-syncer-mempool-txn-sync-limit")
+	config.StateChangeSocketPath = viper.GetString("state-change-socket-path")
+	config.StateChangeSQLitePath = viper.GetString("state-change-sqlite-path")
+	if config.StateChangeDir == "" && (config.StateChangeSocketPath != "" || config.StateChangeSQLitePath != "") {
+		glog.Fatalf("--state-change-socket-path and --state-change-sqlite-path require --state-change-dir to be set")
+	}
+
+	// State API
+	config.StateAPIListenAddress = viper.GetString("state-api-listen-address")
 
 	// PoS Checkpoint Syncing
 	config.CheckpointSyncingProviders = GetStringSliceWorkaround("checkpoint-syncing-providers")
@@ -297,6 +332,22 @@ func (config *Config) Print() {
 		glog.Infof("Mining with public keys: %s", config.MinerPublicKeys)
 	}
 
+	if config.StateAPIListenAddress != "" {
+		glog.Infof("State API listening on %s", config.StateAPIListenAddress)
+	}
+
+	if config.PeerBanAPIListenAddress != "" {
+		glog.Infof("Peer ban API listening on %s", config.PeerBanAPIListenAddress)
+	}
+
+	if config.StateChangeSocketPath != "" {
+		glog.Infof("State Change Socket Path: %s", config.StateChangeSocketPath)
+	}
+
+	if config.StateChangeSQLitePath != "" {
+		glog.Infof("State Change SQLite Path: %s", config.StateChangeSQLitePath)
+	}
+
 	glog.Infof("Rate Limit Feerate: %d", config.RateLimitFeerate)
 	glog.Infof("Min Feerate: %d", config.MinFeerate)
 }
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var mempoolCmd = &cobra.Command{
+	Use:   "mempool",
+	Short: "Export and import PoS mempool snapshots",
+	Long: `Tools for copying the transactions in a node's PoS mempool to another node, e.g. to replay an
+incident or to seed a testnet. Snapshots are JSON files that contain each transaction along with the time
+it was added to the mempool and whether it was validated.`,
+}
+
+var mempoolExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write a node's PoS mempool to a snapshot file",
+	Long: `Write a node's PoS mempool to a snapshot file. Pass --state-api to export the mempool of a running
+node through its read-only state API, or --mempool-dump-dir to export the mempool persisted by a stopped
+node. Validated flags are only available from a running node.`,
+	RunE: runMempoolExport,
+}
+
+var mempoolImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Inject the transactions in a snapshot file into a node",
+	Long: `Inject the transactions in a snapshot file into a node, in the order they were added to the source
+mempool. Pass --node to relay them to a running node over its protocol port, in which case the node stamps
+them with the time they arrive, or --mempool-dump-dir to write them, with their original timestamps, to the
+mempool of a stopped node. Either way, the node validates the transactions against its own tip.`,
+	RunE: runMempoolImport,
+}
+
+func init() {
+	mempoolExportCmd.Flags().String("state-api", "", "The address of a running node's state API, "+
+		"e.g. http://127.0.0.1:17002.")
+	mempoolExportCmd.Flags().String("mempool-dump-dir", "", "The --mempool-dump-dir of a stopped node.")
+	mempoolExportCmd.Flags().String("file", "", "The snapshot file to write. Defaults to stdout.")
+	mempoolExportCmd.Flags().Bool("testnet", false, "Whether the node is on testnet.")
+
+	mempoolImportCmd.Flags().String("node", "", "The protocol address of a running node, e.g. 127.0.0.1:18000.")
+	mempoolImportCmd.Flags().String("mempool-dump-dir", "", "The --mempool-dump-dir of a stopped node.")
+	mempoolImportCmd.Flags().String("file", "", "The snapshot file to read.")
+	mempoolImportCmd.Flags().Int("batch-size", lib.DefaultMempoolSnapshotInjectBatchSize, "The number of "+
+		"transactions to send per message when injecting into a running node.")
+	mempoolImportCmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for a running node to "+
+		"receive every transaction.")
+	mempoolImportCmd.Flags().Bool("testnet", false, "Whether the node is on testnet.")
+	cobra.CheckErr(mempoolImportCmd.MarkFlagRequired("file"))
+
+	mempoolCmd.AddCommand(mempoolExportCmd)
+	mempoolCmd.AddCommand(mempoolImportCmd)
+	rootCmd.AddCommand(mempoolCmd)
+}
+
+func mempoolCmdParams(cmd *cobra.Command) *lib.DeSoParams {
+	if testnet, _ := cmd.Flags().GetBool("testnet"); testnet {
+		return &lib.DeSoTestnetParams
+	}
+	return &lib.DeSoMainnetParams
+}
+
+func runMempoolExport(cmd *cobra.Command, args []string) error {
+	stateAPI, _ := cmd.Flags().GetString("state-api")
+	mempoolDumpDir, _ := cmd.Flags().GetString("mempool-dump-dir")
+	file, _ := cmd.Flags().GetString("file")
+	if (stateAPI == "") == (mempoolDumpDir == "") {
+		return fmt.Errorf("exactly one of --state-api and --mempool-dump-dir must be set")
+	}
+	params := mempoolCmdParams(cmd)
+
+	var snapshot *lib.MempoolSnapshot
+	var err error
+	if stateAPI != "" {
+		snapshot, err = fetchMempoolSnapshot(stateAPI)
+	} else {
+		snapshot, err = lib.ReadPersistedMempoolSnapshot(params, mempoolDumpDir)
+	}
+	if err != nil {
+		return err
+	}
+	if snapshot.Network != params.NetworkType.String() {
+		return fmt.Errorf("node is on %v but --testnet=%v", snapshot.Network, params.NetworkType == lib.NetworkType_TESTNET)
+	}
+
+	out := io.Writer(os.Stdout)
+	if file != "" {
+		outFile, err := os.Create(file)
+		if err != nil {
+			return errors.Wrapf(err, "Problem creating %v", file)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	if err = lib.WriteMempoolSnapshot(out, snapshot); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d transactions at block height %d\n",
+		len(snapshot.Transactions), snapshot.BlockHeight)
+	return nil
+}
+
+// fetchMempoolSnapshot fetches a mempool snapshot from the state API of a running node.
+func fetchMempoolSnapshot(stateAPI string) (*lib.MempoolSnapshot, error) {
+	resp, err := http.Get(strings.TrimSuffix(stateAPI, "/") + "/api/v0/mempool/snapshot")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Problem fetching mempool snapshot")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errorResponse := &lib.StateAPIErrorResponse{}
+		if err = json.NewDecoder(resp.Body).Decode(errorResponse); err != nil {
+			return nil, fmt.Errorf("fetching mempool snapshot failed with status %v", resp.Status)
+		}
+		return nil, fmt.Errorf("fetching mempool snapshot failed with status %v: %v", resp.Status, errorResponse.Error)
+	}
+	response := &struct {
+		Data *lib.MempoolSnapshot
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, errors.Wrapf(err, "Problem decoding mempool snapshot")
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("state API returned an empty mempool snapshot")
+	}
+	return response.Data, nil
+}
+
+func runMempoolImport(cmd *cobra.Command, args []string) error {
+	node, _ := cmd.Flags().GetString("node")
+	mempoolDumpDir, _ := cmd.Flags().GetString("mempool-dump-dir")
+	file, _ := cmd.Flags().GetString("file")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if (node == "") == (mempoolDumpDir == "") {
+		return fmt.Errorf("exactly one of --node and --mempool-dump-dir must be set")
+	}
+	params := mempoolCmdParams(cmd)
+
+	inFile, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "Problem opening %v", file)
+	}
+	defer inFile.Close()
+	snapshot, err := lib.ReadMempoolSnapshot(inFile, params)
+	if err != nil {
+		return err
+	}
+
+	if node != "" {
+		if err = lib.InjectMempoolSnapshot(params, node, snapshot, batchSize, timeout); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Sent %d transactions to %v\n", len(snapshot.Transactions), node)
+		return nil
+	}
+	numWritten, err := lib.WritePersistedMempoolSnapshot(mempoolDumpDir, snapshot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d transactions to %v\n", numWritten, mempoolDumpDir)
+	return nil
+}
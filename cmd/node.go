@@ -27,13 +27,15 @@ import (
 )
 
 type Node struct {
-	Server    *lib.Server
-	ChainDB   *badger.DB
-	TXIndex   *lib.TXIndex
-	Params    *lib.DeSoParams
-	Config    *Config
-	Postgres  *lib.Postgres
-	Listeners []net.Listener
+	Server     *lib.Server
+	ChainDB    *badger.DB
+	TXIndex    *lib.TXIndex
+	Params     *lib.DeSoParams
+	Config     *Config
+	Postgres   *lib.Postgres
+	StateAPI   *lib.StateAPIServer
+	PeerBanAPI *lib.PeerBanAPIServer
+	Listeners  []net.Listener
 
 	// IsRunning is false when a NewNode is created, set to true on Start(), set to false
 	// after Stop() is called. Mainly used in testing.
@@ -156,11 +158,8 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	// Validate that we weren't passed incompatible Hypersync flags
 	lib.ValidateHyperSyncFlags(node.Config.HyperSync, node.Config.SyncType)
 
-	// Setup postgres using a remote URI. Postgres is not currently supported when we're in hypersync mode.
-	if node.Config.HyperSync && node.Config.PostgresURI != "" {
-		glog.Fatal("--postgres-uri is not supported when --hypersync=true. We're " +
-			"working on Hypersync support for Postgres though!")
-	}
+	// Setup postgres using a remote URI. When hypersync is enabled, snapshot chunks are loaded into
+	// postgres as they're received, after which the node continues syncing block-by-block.
 	var db *pg.DB
 	if node.Config.PostgresURI != "" {
 		options, err := pg.ParseURL(node.Config.PostgresURI)
@@ -242,8 +241,20 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 		node.Config.MempoolBackupIntervalMillis,
 		node.Config.MempoolMaxValidationViewConnects,
 		node.Config.TransactionValidationRefreshIntervalMillis,
+		lib.PosMempoolPublicKeyLimits{
+			MaxTxnsPerPublicKey:  node.Config.MempoolMaxTxnsPerPublicKey,
+			MaxBytesPerPublicKey: node.Config.MempoolMaxBytesPerPublicKey,
+			FairShareEviction:    node.Config.MempoolFairShareEviction,
+		},
 		node.Config.StateSyncerMempoolTxnSyncLimit,
+		node.Config.StateChangeSocketPath,
+		node.Config.StateChangeSQLitePath,
 		node.Config.CheckpointSyncingProviders,
+		node.Config.EncryptedTransport,
+		node.Config.RequireEncryptedValidatorTransport,
+		node.Config.PeerBanThreshold,
+		node.Config.PeerBanDurationSeconds,
+		node.Config.MessageCompression,
 	)
 	if err != nil {
 		// shouldRestart can be true if, on the previous run, we did not finish flushing all ancestral
@@ -261,8 +272,9 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 	if !shouldRestart {
 		node.Server.Start()
 
-		// Setup TXIndex - not compatible with postgres
-		if node.Config.TXIndex && node.Postgres == nil {
+		// Setup TXIndex. The TXIndex keeps its own Badger DB and reads blocks from the chain's Badger DB,
+		// which stores blocks even when the rest of the state is in postgres, so it works with either.
+		if node.Config.TXIndex {
 			node.TXIndex, err = lib.NewTXIndex(node.Server.GetBlockchain(), node.Params, node.Config.DataDirectory)
 			if err != nil {
 				glog.Fatal(err)
@@ -272,6 +284,23 @@ func (node *Node) Start(exitChannels ...*chan struct{}) {
 				node.TXIndex.Start()
 			}
 		}
+
+		// Setup the read-only state API
+		if node.Config.StateAPIListenAddress != "" {
+			node.StateAPI = lib.NewStateAPIServer(node.Server.GetBlockchain(), node.Params, node.Config.StateAPIListenAddress)
+			node.StateAPI.SetPosMempool(node.Server.GetPosMempool())
+			if err = node.StateAPI.Start(); err != nil {
+				glog.Fatal(err)
+			}
+		}
+
+		// Setup the peer ban API
+		if node.Config.PeerBanAPIListenAddress != "" {
+			node.PeerBanAPI = lib.NewPeerBanAPIServer(node.Server.GetNetworkManager(), node.Config.PeerBanAPIListenAddress)
+			if err = node.PeerBanAPI.Start(); err != nil {
+				glog.Fatal(err)
+			}
+		}
 	}
 	node.IsRunning = true
 
@@ -317,6 +346,22 @@ func (node *Node) Stop() {
 	glog.Infof(lib.CLog(lib.Yellow, "Node is shutting down. This might take a minute. Please don't "+
 		"close the node now or else you might corrupt the state."))
 
+	// State API
+	if node.StateAPI != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping state API..."))
+		node.StateAPI.Stop()
+		node.StateAPI = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: State API successfully stopped."))
+	}
+
+	// Peer ban API
+	if node.PeerBanAPI != nil {
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping peer ban API..."))
+		node.PeerBanAPI.Stop()
+		node.PeerBanAPI = nil
+		glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Peer ban API successfully stopped."))
+	}
+
 	// Server
 	glog.Infof(lib.CLog(lib.Yellow, "Node.Stop: Stopping server..."))
 	if node.Server != nil {
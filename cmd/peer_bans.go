@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var peerBansCmd = &cobra.Command{
+	Use:   "peer-bans",
+	Short: "List, add, and remove peer bans on a running node",
+	Long: `Tools for managing the IP addresses and validator public keys that a running node refuses to connect
+to. They talk to the node's peer ban API, which is enabled with --peer-ban-api-listen-address. Bans are
+persisted to the node's data directory, so they survive restarts.`,
+}
+
+var peerBansListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the active peer bans",
+	RunE:  runPeerBansList,
+}
+
+var peerBansBanCmd = &cobra.Command{
+	Use:   "ban <ip|validator> <key>",
+	Short: "Ban an IP address or validator public key",
+	Long: `Ban an IP address or validator public key, and disconnect any peers matching it, including
+persistent peers. An existing ban on the same key is replaced.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runPeerBansBan,
+}
+
+var peerBansUnbanCmd = &cobra.Command{
+	Use:   "unban <ip|validator> <key>",
+	Short: "Remove the ban on an IP address or validator public key",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runPeerBansUnban,
+}
+
+func init() {
+	peerBansCmd.PersistentFlags().String("peer-ban-api", "http://127.0.0.1:17003", "The address of a running "+
+		"node's peer ban API.")
+	peerBansBanCmd.Flags().Duration("duration", lib.DefaultPeerBanDuration, "How long the ban lasts.")
+	peerBansBanCmd.Flags().String("reason", "manual", "The reason recorded in the ban list.")
+
+	peerBansCmd.AddCommand(peerBansListCmd)
+	peerBansCmd.AddCommand(peerBansBanCmd)
+	peerBansCmd.AddCommand(peerBansUnbanCmd)
+	rootCmd.AddCommand(peerBansCmd)
+}
+
+func runPeerBansList(cmd *cobra.Command, args []string) error {
+	var bans []*lib.PeerBanEntry
+	if err := doPeerBanAPIRequest(cmd, http.MethodGet, "", nil, &bans); err != nil {
+		return err
+	}
+	printPeerBans(bans)
+	return nil
+}
+
+func runPeerBansBan(cmd *cobra.Command, args []string) error {
+	duration, _ := cmd.Flags().GetDuration("duration")
+	reason, _ := cmd.Flags().GetString("reason")
+	banRequest := &lib.PeerBanAPIBanRequest{
+		KeyType:  lib.PeerBanKeyType(args[0]),
+		Key:      args[1],
+		Duration: duration.String(),
+		Reason:   reason,
+	}
+	var bans []*lib.PeerBanEntry
+	if err := doPeerBanAPIRequest(cmd, http.MethodPost, "", banRequest, &bans); err != nil {
+		return err
+	}
+	printPeerBans(bans)
+	return nil
+}
+
+func runPeerBansUnban(cmd *cobra.Command, args []string) error {
+	unbanResponse := &lib.PeerBanAPIUnbanResponse{}
+	path := "/" + url.PathEscape(args[0]) + "/" + url.PathEscape(args[1])
+	if err := doPeerBanAPIRequest(cmd, http.MethodDelete, path, nil, unbanResponse); err != nil {
+		return err
+	}
+	if !unbanResponse.Unbanned {
+		fmt.Fprintf(os.Stderr, "%v %v was not banned\n", args[0], args[1])
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Unbanned %v %v\n", args[0], args[1])
+	return nil
+}
+
+// doPeerBanAPIRequest sends a request to the peer ban API of a running node and decodes the response into response.
+func doPeerBanAPIRequest(cmd *cobra.Command, method string, path string, request interface{}, response interface{}) error {
+	peerBanAPI, _ := cmd.Flags().GetString("peer-ban-api")
+	var body bytes.Buffer
+	if request != nil {
+		if err := json.NewEncoder(&body).Encode(request); err != nil {
+			return errors.Wrapf(err, "Problem encoding request")
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(peerBanAPI, "/")+"/api/v0/peer-bans"+path, &body)
+	if err != nil {
+		return errors.Wrapf(err, "Problem creating request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Problem sending request to peer ban API")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errorResponse := &lib.StateAPIErrorResponse{}
+		if err = json.NewDecoder(resp.Body).Decode(errorResponse); err != nil {
+			return fmt.Errorf("peer ban API request failed with status %v", resp.Status)
+		}
+		return fmt.Errorf("peer ban API request failed with status %v: %v", resp.Status, errorResponse.Error)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return errors.Wrapf(err, "Problem decoding peer ban API response")
+	}
+	return nil
+}
+
+func printPeerBans(bans []*lib.PeerBanEntry) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TYPE\tKEY\tBANNED UNTIL\tREASON")
+	for _, ban := range bans {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\n", ban.KeyType, ban.Key, ban.BannedUntil.Local().Format(time.RFC3339), ban.Reason)
+	}
+	writer.Flush()
+}
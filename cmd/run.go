@@ -101,6 +101,16 @@ func SetupRunFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().Uint64("transaction-validation-refresh-interval-millis", 10,
 		"The frequency in milliseconds with which the transaction validation routine is run in mempool. "+
 			"The default value is 10 milliseconds.")
+	cmd.PersistentFlags().Uint64("mempool-max-txns-per-public-key", 0,
+		"The maximum number of transactions a single public key can have in the PoS mempool. Once a public key "+
+			"reaches the limit, a new transaction from it is only accepted if it pays a higher fee rate than the "+
+			"public key's lowest fee transaction, which is evicted. The default value of 0 means no limit.")
+	cmd.PersistentFlags().Uint64("mempool-max-bytes-per-public-key", 0,
+		"The maximum number of transaction bytes a single public key can have in the PoS mempool. "+
+			"The default value of 0 means no limit.")
+	cmd.PersistentFlags().Bool("mempool-fair-share-eviction", false,
+		"When the PoS mempool is full, evict transactions from the public key using the most bytes, as long as "+
+			"it's using more than an equal share of the mempool, before evicting the lowest fee transactions.")
 
 	// Peers
 	cmd.PersistentFlags().StringSlice("connect-ips", []string{},
@@ -136,11 +146,31 @@ func SetupRunFlags(cmd *cobra.Command) {
 			"our connections and potentially make onerous requests as well. Useful to "+
 			"disable this flag when testing locally to allow multiple inbound connections "+
 			"from test servers")
+	cmd.PersistentFlags().Uint64("peer-ban-threshold", lib.DefaultPeerBanThreshold,
+		"The ban score at which a misbehaving peer's IP address or validator key is banned. Each misbehavior, "+
+			"such as sending an invalid header or snapshot chunk, adds to the ban score. Set to 0 to never ban "+
+			"peers automatically.")
+	cmd.PersistentFlags().Uint64("peer-ban-duration-seconds", uint64(lib.DefaultPeerBanDuration.Seconds()),
+		"How long, in seconds, a misbehaving peer's IP address or validator key stays banned. The ban list "+
+			"is persisted to the data directory.")
+	cmd.PersistentFlags().String("peer-ban-api-listen-address", "",
+		"When set, the node serves an HTTP/JSON API for listing, adding, and removing peer bans on this address, "+
+			"e.g. 127.0.0.1:17003. It's used by the peer-bans command. It has no authentication, so it should "+
+			"only listen on a loopback or otherwise private address.")
 
 	cmd.PersistentFlags().Uint64("peer-connection-refresh-interval-millis", 10000,
 		"The frequency in milliseconds with which the node will refresh its peer connections. This applies to"+
 			"both outbound validators and outbound persistent non-validators",
 	)
+	cmd.PersistentFlags().Bool("encrypted-transport", false,
+		"When set, the node negotiates an encrypted transport with peers that also support it. Messages "+
+			"sent after the handshake are encrypted, and validators bind the session to their BLS key.")
+	cmd.PersistentFlags().Bool("require-encrypted-validator-transport", false,
+		"When set on a validator, the node only completes the handshake with other validators if the encrypted "+
+			"transport was negotiated. Implies --encrypted-transport.")
+	cmd.PersistentFlags().Bool("message-compression", true,
+		"When set, the node compresses large snapshot and block bundle messages sent to peers that also "+
+			"support compression. This significantly reduces the bandwidth used by hypersync and block sync.")
 
 	// Listeners
 	cmd.PersistentFlags().Uint64("protocol-port", 0,
@@ -225,11 +255,23 @@ func SetupRunFlags(cmd *cobra.Command) {
 		"from an empty string to a non-empty string (or from a non-empty string to the empty string) requires a resync.")
 	cmd.PersistentFlags().Uint("state-syncer-mempool-txn-sync-limit", 10000, "The maximum number of transactions to "+
 		"process in the mempool tx state syncer at a time.")
+	cmd.PersistentFlags().String("state-change-socket-path", "", "If set, state changes are also streamed to "+
+		"consumers connected to a Unix socket at this path. Requires --state-change-dir.")
+	cmd.PersistentFlags().String("state-change-sqlite-path", "", "If set, state changes are also written to a "+
+		"SQLite database at this path. Requires --state-change-dir. The database only receives state changes from "+
+		"the point it's created, so it should be set when the state change dir is first created.")
+
+	// State API
+	cmd.PersistentFlags().String("state-api-listen-address", "",
+		"When set, the node serves a read-only HTTP/JSON API over its committed state on this address, "+
+			"e.g. 127.0.0.1:17002. The API exposes balances, profiles, posts, NFTs, DAO coin orders, validators, "+
+			"stakes, and locked balances. It has no authentication, so it should not be exposed publicly.")
 
 	// PoS Checkpoint Syncing
 	cmd.PersistentFlags().StringSlice("checkpoint-syncing-providers", []string{}, fmt.Sprintf("A comma-separated list of URLs that "+
 		"supports the committed tip block info endpoint to be used for checkpoint syncing. "+
-		"If unset, the field will default to %v on mainnet and %v on testnet",
+		"If unset, the field will default to %v on mainnet and %v on testnet. Nodes that already know the "+
+		"PoS validator set also request checkpoints from their peers, verified against the validator set.",
 		lib.DefaultMainnetCheckpointProvider, lib.DefaultTestnetCheckpointProvider))
 	cmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
 		viper.BindPFlag(flag.Name, flag)
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stateChangeCmd = &cobra.Command{
+	Use:   "statechange",
+	Short: "Inspect the state change files written by a node",
+	Long: `Tools for inspecting the state change files that a node writes to its --state-change-dir.
+These are intended for debugging, and can be run while the node is running.`,
+}
+
+var stateChangeDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the state change entries in a state change dir",
+	Long: `Print the state change entries in a state change dir, starting at --from-index. Entries are
+printed one per line, either as a short text summary or as a JSON object that includes the decoded encoder.`,
+	RunE: runStateChangeDump,
+}
+
+func init() {
+	stateChangeDumpCmd.Flags().String("state-change-dir", "", "The state change dir to read from.")
+	stateChangeDumpCmd.Flags().Uint64("from-index", 0, "The index of the first entry to print.")
+	stateChangeDumpCmd.Flags().Uint64("limit", 0, "The maximum number of entries to print. 0 means no limit.")
+	stateChangeDumpCmd.Flags().Bool("mempool", false, "Read the mempool state change files rather than the "+
+		"committed ones.")
+	stateChangeDumpCmd.Flags().String("format", "text", "The output format, either text or json.")
+	cobra.CheckErr(stateChangeDumpCmd.MarkFlagRequired("state-change-dir"))
+
+	stateChangeCmd.AddCommand(stateChangeDumpCmd)
+	rootCmd.AddCommand(stateChangeCmd)
+}
+
+// stateChangeEntryJSON is the JSON representation of a StateChangeEntry printed by the dump command.
+type stateChangeEntryJSON struct {
+	Index               uint64
+	SequenceNumber      uint64
+	OperationType       string
+	IsReverted          bool
+	EncoderType         lib.EncoderType
+	EncoderName         string
+	KeyHex              string
+	BlockHeight         uint64
+	FlushId             string
+	Encoder             lib.DeSoEncoder `json:",omitempty"`
+	AncestralRecord     lib.DeSoEncoder `json:",omitempty"`
+	EncoderBytesHex     string          `json:",omitempty"`
+	EncoderMarshalError string          `json:",omitempty"`
+}
+
+// errStateChangeDumpLimitReached is used to stop iterating once --limit entries have been printed.
+var errStateChangeDumpLimitReached = errors.New("limit reached")
+
+func runStateChangeDump(cmd *cobra.Command, args []string) error {
+	stateChangeDir, _ := cmd.Flags().GetString("state-change-dir")
+	fromIndex, _ := cmd.Flags().GetUint64("from-index")
+	limit, _ := cmd.Flags().GetUint64("limit")
+	isMempool, _ := cmd.Flags().GetBool("mempool")
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("--format must be text or json, got %v", format)
+	}
+
+	reader, err := lib.OpenStateChangeFileReader(stateChangeDir, isMempool)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	numPrinted := uint64(0)
+	err = reader.Iterate(fromIndex, func(index uint64, entry *lib.StateChangeEntry) error {
+		if limit != 0 && numPrinted >= limit {
+			return errStateChangeDumpLimitReached
+		}
+		numPrinted++
+
+		if format == "text" {
+			_, err := fmt.Fprintf(out, "%d\tseq=%d\t%v\treverted=%v\theight=%d\tencoder=%s(%d)\tkey=%x\tflush=%v\n",
+				index, entry.SequenceNumber, entry.OperationType, entry.IsReverted, entry.BlockHeight,
+				encoderName(entry.EncoderType), entry.EncoderType, entry.KeyBytes, entry.FlushId)
+			return err
+		}
+
+		entryJSON := &stateChangeEntryJSON{
+			Index:           index,
+			SequenceNumber:  entry.SequenceNumber,
+			OperationType:   entry.OperationType.String(),
+			IsReverted:      entry.IsReverted,
+			EncoderType:     entry.EncoderType,
+			EncoderName:     encoderName(entry.EncoderType),
+			KeyHex:          hex.EncodeToString(entry.KeyBytes),
+			BlockHeight:     entry.BlockHeight,
+			FlushId:         entry.FlushId.String(),
+			Encoder:         entry.Encoder,
+			AncestralRecord: entry.AncestralRecord,
+		}
+		entryJSONBytes, err := json.Marshal(entryJSON)
+		if err != nil {
+			// Some encoders can't be represented as JSON, so fall back to printing their raw bytes.
+			entryJSON.Encoder = nil
+			entryJSON.AncestralRecord = nil
+			entryJSON.EncoderBytesHex = hex.EncodeToString(entry.EncoderBytes)
+			entryJSON.EncoderMarshalError = err.Error()
+			if entryJSONBytes, err = json.Marshal(entryJSON); err != nil {
+				return errors.Wrapf(err, "Error marshaling entry %d", index)
+			}
+		}
+		_, err = fmt.Fprintln(out, string(entryJSONBytes))
+		return err
+	})
+	if err != nil && err != errStateChangeDumpLimitReached {
+		return err
+	}
+	return nil
+}
+
+// encoderName returns the name of the concrete DeSoEncoder for the encoder type, e.g. PostEntry.
+func encoderName(encoderType lib.EncoderType) string {
+	encoder := encoderType.New()
+	if encoder == nil {
+		return "Unknown"
+	}
+	encoderReflectType := reflect.TypeOf(encoder)
+	if encoderReflectType.Kind() == reflect.Ptr {
+		encoderReflectType = encoderReflectType.Elem()
+	}
+	return encoderReflectType.Name()
+}
@@ -3823,6 +3823,13 @@ func (bav *UtxoView) _connectSingleTxn(
 		return nil, 0, 0, 0, errors.Wrapf(err, "_connectTransaction: ")
 	}
 
+	// Don't allow scheduled transactions to be connected before their min inclusion block height.
+	if blockHeight >= bav.Params.ForkHeights.ScheduledTransactionsBlockHeight {
+		if err := ValidateDeSoTxnMinInclusionBlockHeight(txn, uint64(blockHeight)); err != nil {
+			return nil, 0, 0, 0, errors.Wrapf(err, "_connectTransaction: ")
+		}
+	}
+
 	// Don't allow transactions that take up more than half of the block.
 	txnBytes, err := txn.ToBytes(false)
 	if err != nil {
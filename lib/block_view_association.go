@@ -937,12 +937,12 @@ func (bav *UtxoView) CountUserAssociationsByAttributes(associationQuery *UserAss
 	// we can track all association IDs from the view and can properly limit
 	// the number of entries retrieved from the database.
 	newUtxoViewAssociationEntries, allUtxoViewAssociationIds := bav._getUtxoViewUserAssociationEntriesByAttributes(associationQuery)
-	// Pull matching association IDs from the db.
-	dbAssociationIds, _, err := bav.GetDbAdapter().GetUserAssociationIdsByAttributes(associationQuery, allUtxoViewAssociationIds)
+	// Count matching associations in the db.
+	dbAssociationCount, err := bav.GetDbAdapter().CountUserAssociationsByAttributes(associationQuery, allUtxoViewAssociationIds)
 	if err != nil {
 		return 0, errors.Wrapf(err, "CountUserAssociationsByAttributes: ")
 	}
-	return uint64(len(newUtxoViewAssociationEntries) + dbAssociationIds.Size()), nil
+	return uint64(len(newUtxoViewAssociationEntries)) + dbAssociationCount, nil
 }
 
 func (bav *UtxoView) _getUtxoViewUserAssociationEntriesByAttributes(
@@ -1051,12 +1051,12 @@ func (bav *UtxoView) CountPostAssociationsByAttributes(associationQuery *PostAss
 	// we can track all association IDs from the view and can properly limit
 	// the number of entries retrieved from the database.
 	newUtxoViewAssociationEntries, allUtxoViewAssociationIds := bav._getUtxoViewPostAssociationEntriesByAttributes(associationQuery)
-	// Pull matching association IDs from the db.
-	dbAssociationIds, _, err := bav.GetDbAdapter().GetPostAssociationIdsByAttributes(associationQuery, allUtxoViewAssociationIds)
+	// Count matching associations in the db.
+	dbAssociationCount, err := bav.GetDbAdapter().CountPostAssociationsByAttributes(associationQuery, allUtxoViewAssociationIds)
 	if err != nil {
 		return 0, errors.Wrapf(err, "CountPostAssociationsByAttributes: ")
 	}
-	return uint64(len(newUtxoViewAssociationEntries) + dbAssociationIds.Size()), nil
+	return uint64(len(newUtxoViewAssociationEntries)) + dbAssociationCount, nil
 }
 
 func (bav *UtxoView) _getUtxoViewPostAssociationEntriesByAttributes(
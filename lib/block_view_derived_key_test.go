@@ -4184,3 +4184,86 @@ func _createSignedAuthorizeDerivedKeyTransaction(t *testing.T, chain *Blockchain
 	}
 	return txn, nil
 }
+
+func TestRevokeDerivedKeysAtomicTxnsWrapper(t *testing.T) {
+	require := require.New(t)
+
+	testMeta := _setUpMinerAndTestMetaForAtomicTransactionTests(t)
+	_setUpUsersForAtomicTransactionsTesting(testMeta)
+	chain, db, params := testMeta.chain, testMeta.db, testMeta.params
+	blockHeight := uint64(chain.blockTip().Height) + 1
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	// Give m0 three active derived keys, plus one that's expired and one that's already revoked.
+	putDerivedKey := func(expirationBlock uint64, operationType AuthorizeDerivedKeyOperationType) []byte {
+		derivedPrivKey, err := btcec.NewPrivateKey()
+		require.NoError(err)
+		derivedPublicKey := derivedPrivKey.PubKey().SerializeCompressed()
+		derivedKeyEntry := &DerivedKeyEntry{
+			OwnerPublicKey:   *NewPublicKey(m0PubBytes),
+			DerivedPublicKey: *NewPublicKey(derivedPublicKey),
+			ExpirationBlock:  expirationBlock,
+			OperationType:    operationType,
+			TransactionSpendingLimitTracker: &TransactionSpendingLimit{
+				GlobalDESOLimit:          100,
+				TransactionCountLimitMap: map[TxnType]uint64{TxnTypeBasicTransfer: 1},
+			},
+		}
+		require.NoError(DBPutDerivedKeyMapping(db, nil, blockHeight, derivedKeyEntry.OwnerPublicKey,
+			derivedKeyEntry.DerivedPublicKey, derivedKeyEntry, nil))
+		return derivedPublicKey
+	}
+	activeDerivedPublicKeys := [][]byte{
+		putDerivedKey(blockHeight+10, AuthorizeDerivedKeyOperationValid),
+		putDerivedKey(blockHeight+20, AuthorizeDerivedKeyOperationValid),
+		putDerivedKey(blockHeight+30, AuthorizeDerivedKeyOperationValid),
+	}
+	putDerivedKey(blockHeight, AuthorizeDerivedKeyOperationValid)
+	putDerivedKey(blockHeight+10, AuthorizeDerivedKeyOperationNotValid)
+
+	// Only the active keys are listed, soonest to expire first, with their remaining limits.
+	getActiveDerivedPublicKeys := func(utxoView *UtxoView) [][]byte {
+		derivedKeyEntries, err := utxoView.GetActiveDerivedKeysForOwner(m0PubBytes, blockHeight)
+		require.NoError(err)
+		var derivedPublicKeys [][]byte
+		for _, derivedKeyEntry := range derivedKeyEntries {
+			require.Equal(uint64(100), derivedKeyEntry.TransactionSpendingLimitTracker.GlobalDESOLimit)
+			derivedPublicKeys = append(derivedPublicKeys, derivedKeyEntry.DerivedPublicKey.ToBytes())
+		}
+		return derivedPublicKeys
+	}
+	utxoView := NewUtxoView(db, params, chain.postgres, chain.snapshot, nil)
+	require.Equal(activeDerivedPublicKeys, getActiveDerivedPublicKeys(utxoView))
+
+	// Revoke every key except the first one in a single atomic txn.
+	atomicTxn, revokedDerivedPublicKeys, fees, err := chain.CreateRevokeDerivedKeysAtomicTxnsWrapper(
+		m0PubBytes, activeDerivedPublicKeys[0], nil, testMeta.feeRateNanosPerKb, testMeta.mempool)
+	require.NoError(err)
+	require.Equal(activeDerivedPublicKeys[1:], revokedDerivedPublicKeys)
+	require.Equal(atomicTxn.TxnFeeNanos, fees)
+	innerTxns := atomicTxn.TxnMeta.(*AtomicTxnsWrapperMetadata).Txns
+	require.Equal(2, len(innerTxns))
+	for _, innerTxn := range innerTxns {
+		require.Equal(AuthorizeDerivedKeyOperationNotValid, innerTxn.TxnMeta.(*AuthorizeDerivedKeyMetadata).OperationType)
+		_signTxn(t, innerTxn, m0Priv)
+	}
+	_, _, _, _, err = utxoView.ConnectTransaction(
+		atomicTxn, atomicTxn.Hash(), uint32(blockHeight), 0, true, false)
+	require.NoError(err)
+	require.Equal(activeDerivedPublicKeys[:1], getActiveDerivedPublicKeys(utxoView))
+
+	// Revoking all the keys covers the one that was kept above too.
+	_, revokedDerivedPublicKeys, _, err = chain.CreateRevokeDerivedKeysAtomicTxnsWrapper(
+		m0PubBytes, nil, nil, testMeta.feeRateNanosPerKb, testMeta.mempool)
+	require.NoError(err)
+	require.Equal(activeDerivedPublicKeys, revokedDerivedPublicKeys)
+
+	// The key to keep has to be one of the owner's active keys, and there has to be something to revoke.
+	_, _, _, err = chain.CreateRevokeDerivedKeysAtomicTxnsWrapper(
+		m0PubBytes, m1PubBytes, nil, testMeta.feeRateNanosPerKb, testMeta.mempool)
+	require.Error(err)
+	_, _, _, err = chain.CreateRevokeDerivedKeysAtomicTxnsWrapper(
+		m1PubBytes, nil, nil, testMeta.feeRateNanosPerKb, testMeta.mempool)
+	require.Error(err)
+}
@@ -546,7 +546,7 @@ func (bav *UtxoView) _connectPrivateMessage(
 	if bav.Postgres != nil {
 		//TODO: Fix Postgres
 		message := &PGMessage{
-			MessageHash:        txn.Hash(),
+			MessageHash:        _pgMessageHash(txn.PublicKey, txMeta.RecipientPublicKey, txMeta.TimestampNanos),
 			SenderPublicKey:    txn.PublicKey,
 			RecipientPublicKey: txMeta.RecipientPublicKey,
 			EncryptedText:      txMeta.EncryptedText,
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -371,20 +372,10 @@ func (bav *UtxoView) GetAllDerivedKeyMappingsForOwner(ownerPublicKey []byte) (
 	}
 
 	// Check for entries in DB.
-	var dbMappings []*DerivedKeyEntry
-	ownerPk := NewPublicKey(ownerPublicKey)
-	if bav.Postgres != nil {
-		pgMappings := bav.Postgres.GetAllDerivedKeysForOwner(ownerPk)
-		for _, entry := range pgMappings {
-			dbMappings = append(dbMappings, entry.NewDerivedKeyEntry())
-		}
-	} else {
-		var err error
-		dbMappings, err = DBGetAllOwnerToDerivedKeyMappings(bav.Handle, *ownerPk)
-		if err != nil {
-			return nil, errors.Wrapf(err, "GetAllDerivedKeyMappingsForOwner: problem looking up"+
-				"entries in the DB.")
-		}
+	dbMappings, err := bav.GetDbAdapter().GetAllOwnerToDerivedKeyMappings(*NewPublicKey(ownerPublicKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetAllDerivedKeyMappingsForOwner: problem looking up"+
+			"entries in the DB.")
 	}
 
 	// Add entries from the DB that aren't already present.
@@ -406,6 +397,32 @@ func (bav *UtxoView) GetAllDerivedKeyMappingsForOwner(ownerPublicKey []byte) (
 	return derivedKeyMappings, nil
 }
 
+// GetActiveDerivedKeysForOwner returns the owner's derived keys that are authorized and haven't expired at
+// blockHeight, along with their expiration blocks and remaining spending limits. The keys are sorted by expiration
+// block, soonest first, and then by derived public key.
+func (bav *UtxoView) GetActiveDerivedKeysForOwner(ownerPublicKey []byte, blockHeight uint64) (
+	[]*DerivedKeyEntry, error) {
+
+	derivedKeyMappings, err := bav.GetAllDerivedKeyMappingsForOwner(ownerPublicKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetActiveDerivedKeysForOwner: ")
+	}
+	var activeDerivedKeys []*DerivedKeyEntry
+	for _, entry := range derivedKeyMappings {
+		if entry.IsActive(blockHeight) {
+			activeDerivedKeys = append(activeDerivedKeys, entry)
+		}
+	}
+	sort.Slice(activeDerivedKeys, func(ii, jj int) bool {
+		if activeDerivedKeys[ii].ExpirationBlock != activeDerivedKeys[jj].ExpirationBlock {
+			return activeDerivedKeys[ii].ExpirationBlock < activeDerivedKeys[jj].ExpirationBlock
+		}
+		return bytes.Compare(activeDerivedKeys[ii].DerivedPublicKey.ToBytes(),
+			activeDerivedKeys[jj].DerivedPublicKey.ToBytes()) < 0
+	})
+	return activeDerivedKeys, nil
+}
+
 // _setDerivedKeyMapping sets a derived key mapping in the utxoView.
 func (bav *UtxoView) _setDerivedKeyMapping(derivedKeyEntry *DerivedKeyEntry) {
 	// If the derivedKeyEntry is nil then there's nothing to do.
@@ -471,10 +488,11 @@ func (bav *UtxoView) setProfileMappings(profile *PGProfile) (*ProfileEntry, *PKI
 				MintingDisabled:         profile.MintingDisabled,
 			},
 			DAOCoinEntry: CoinEntry{
-				NumberOfHolders:           profile.DAOCoinNumberOfHolders,
-				CoinsInCirculationNanos:   *daoCoinsInCirculationNanos,
-				MintingDisabled:           profile.DAOCoinMintingDisabled,
-				TransferRestrictionStatus: profile.DAOCoinTransferRestrictionStatus,
+				NumberOfHolders:                 profile.DAOCoinNumberOfHolders,
+				CoinsInCirculationNanos:         *daoCoinsInCirculationNanos,
+				MintingDisabled:                 profile.DAOCoinMintingDisabled,
+				TransferRestrictionStatus:       profile.DAOCoinTransferRestrictionStatus,
+				LockupTransferRestrictionStatus: profile.DAOCoinLockupTransferRestrictionStatus,
 			},
 			ExtraData: profile.ExtraData,
 		}
@@ -3857,6 +3857,11 @@ func (dk *DerivedKeyEntry) Copy() *DerivedKeyEntry {
 	return &newEntry
 }
 
+// IsActive returns true if the derived key is authorized and hasn't expired at blockHeight.
+func (dk *DerivedKeyEntry) IsActive(blockHeight uint64) bool {
+	return !dk.isDeleted && dk.OperationType == AuthorizeDerivedKeyOperationValid && dk.ExpirationBlock > blockHeight
+}
+
 type DerivedKeyMapKey struct {
 	// Owner public key
 	OwnerPublicKey PublicKey
@@ -596,11 +596,17 @@ type Blockchain struct {
 	// the committed tip block info for the chain we are syncing.
 	checkpointSyncingProviders []string
 	// checkpointBlockInfo is the latest checkpoint block info that we have received from the checkpoint syncing
-	// providers.
+	// providers or from our peers.
 	checkpointBlockInfo *CheckpointBlockInfo
 	//
 	checkpointBlockInfoLock sync.RWMutex
 
+	// committedTipCheckpoint is the checkpoint for our committed tip that we send to peers. It's cached until the
+	// committed tip changes.
+	committedTipCheckpoint     *MsgDeSoCheckpoint
+	committedTipCheckpointHash *BlockHash
+	committedTipCheckpointLock sync.Mutex
+
 	timer *Timer
 }
 
@@ -652,11 +658,16 @@ func (bc *Blockchain) updateCheckpointBlockInfo() {
 		glog.Errorf("updateCheckpointBlockInfo: No valid checkpoint block info found.")
 		return
 	}
-	glog.V(2).Infof("updateCheckpointBlockInfo: Setting checkpoint block info to: %v", highestHeightCheckpointBlockInfo)
 	bc.checkpointBlockInfoLock.Lock()
+	defer bc.checkpointBlockInfoLock.Unlock()
+	// Keep the current checkpoint block if it's higher, e.g. if we got it from a peer.
+	if bc.checkpointBlockInfo != nil && bc.checkpointBlockInfo.Hash != nil &&
+		bc.checkpointBlockInfo.Height > highestHeightCheckpointBlockInfo.Height {
+		highestHeightCheckpointBlockInfo = bc.checkpointBlockInfo
+	}
+	glog.V(2).Infof("updateCheckpointBlockInfo: Setting checkpoint block info to: %v", highestHeightCheckpointBlockInfo)
 	bc.checkpointBlockInfo = highestHeightCheckpointBlockInfo
 	bc.checkpointBlockInfo.LatestView = highestView
-	bc.checkpointBlockInfoLock.Unlock()
 }
 
 func (bc *Blockchain) GetCheckpointBlockInfo() *CheckpointBlockInfo {
@@ -851,6 +862,19 @@ func (bc *Blockchain) _initChain() error {
 	}
 	bc.blockIndexByHeight = bc.constructBlockIndexByHeight()
 
+	// commitBlockPoS writes a committed block to badger before postgres. If badger's best hash
+	// is a block postgres has never stored, the postgres write failed after the badger commit and
+	// the two stores disagree about which block was committed.
+	if bc.postgres != nil {
+		badgerBestHash := DbGetBestHash(bc.db, bc.snapshot, ChainTypeDeSoBlock)
+		if badgerBestHash != nil {
+			if _, exists := bc.blockIndexByHash.Get(*badgerBestHash); !exists {
+				return fmt.Errorf("_initChain: Block %v was committed to badger but is missing from "+
+					"postgres; postgres needs to be resynced", badgerBestHash)
+			}
+		}
+	}
+
 	// At this point the blockIndexByHash should contain a full node tree with all
 	// nodes pointing to valid parent nodes.
 	{
@@ -4921,6 +4945,69 @@ func (bc *Blockchain) CreateAuthorizeDerivedKeyTxn(
 	return txn, totalInput, changeAmount, fees, nil
 }
 
+// CreateRevokeDerivedKeysAtomicTxnsWrapper creates an atomic txn that revokes all of the owner's active derived
+// keys at once, e.g. after a key leaks. If keepDerivedPublicKey is set, that derived key is left authorized, which
+// makes it possible to rotate to a freshly authorized key. The wrapper holds one AuthorizeDerivedKey txn per revoked
+// key, each of which must be signed by the owner, and the revoked derived public keys are returned in the same order.
+func (bc *Blockchain) CreateRevokeDerivedKeysAtomicTxnsWrapper(
+	ownerPublicKey []byte,
+	keepDerivedPublicKey []byte,
+	extraData map[string][]byte,
+	// Standard transaction fields
+	minFeeRateNanosPerKB uint64, mempool Mempool) (
+	_txn *MsgDeSoTxn, _revokedDerivedPublicKeys [][]byte, _fees uint64, _err error) {
+
+	blockHeight := uint64(bc.blockTip().Height) + 1
+
+	utxoView, err := mempool.GetAugmentedUniversalView()
+	if err != nil {
+		return nil, nil, 0, errors.Wrapf(err,
+			"Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: Problem getting augmented universal view")
+	}
+	activeDerivedKeys, err := utxoView.GetActiveDerivedKeysForOwner(ownerPublicKey, blockHeight)
+	if err != nil {
+		return nil, nil, 0, errors.Wrapf(err,
+			"Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: Problem getting derived keys")
+	}
+
+	var revokeTxns []*MsgDeSoTxn
+	var revokedDerivedPublicKeys [][]byte
+	keptDerivedKey := false
+	for _, derivedKeyEntry := range activeDerivedKeys {
+		derivedPublicKey := derivedKeyEntry.DerivedPublicKey.ToBytes()
+		if len(keepDerivedPublicKey) != 0 && bytes.Equal(derivedPublicKey, keepDerivedPublicKey) {
+			keptDerivedKey = true
+			continue
+		}
+		// The owner signs the revocations, so no access signature is needed. Reusing the key's expiration
+		// block leaves the rest of its entry as it was.
+		revokeTxn, _, _, _, err := bc.CreateAuthorizeDerivedKeyTxn(
+			ownerPublicKey, derivedPublicKey, derivedKeyEntry.ExpirationBlock, nil, true, false, nil, nil, "",
+			minFeeRateNanosPerKB, mempool, nil)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: "+
+				"Problem creating txn to revoke derived key %v", PkToString(derivedPublicKey, bc.params))
+		}
+		revokeTxns = append(revokeTxns, revokeTxn)
+		revokedDerivedPublicKeys = append(revokedDerivedPublicKeys, derivedPublicKey)
+	}
+	if len(keepDerivedPublicKey) != 0 && !keptDerivedKey {
+		return nil, nil, 0, fmt.Errorf("Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: Derived key %v "+
+			"to keep isn't an active derived key of the owner", PkToString(keepDerivedPublicKey, bc.params))
+	}
+	if len(revokeTxns) == 0 {
+		return nil, nil, 0, fmt.Errorf("Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: Owner %v has no "+
+			"active derived keys to revoke", PkToString(ownerPublicKey, bc.params))
+	}
+
+	atomicTxn, fees, err := bc.CreateAtomicTxnsWrapper(revokeTxns, extraData, mempool, minFeeRateNanosPerKB)
+	if err != nil {
+		return nil, nil, 0, errors.Wrapf(err,
+			"Blockchain.CreateRevokeDerivedKeysAtomicTxnsWrapper: Problem creating atomic txn")
+	}
+	return atomicTxn, revokedDerivedPublicKeys, fees, nil
+}
+
 func (bc *Blockchain) CreateMessagingKeyTxn(
 	senderPublicKey []byte,
 	messagingPublicKey []byte,
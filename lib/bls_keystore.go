@@ -22,7 +22,8 @@ import (
 // up of the following tuples:
 // - PoS Validator Vote:        (0x01, view uint64, blockHash consensus.BlockHash)
 // - PoS Validator Timeout:     (0x02, view uint64, highQCView uint64)
-// - PoS Validator Handshake:   (0x04, peer's random nonce, our node's random nonce)
+// - PoS Validator Handshake:   (0x03, peer's random nonce, our node's random nonce)
+// - PoS Validator Transport:   (0x04, our node's random nonce, peer's random nonce, timestamp, handshake binding)
 // - PoS Random Seed Signature: (previous block's random seed hash)
 
 type BLSSignatureOpCode byte
@@ -31,6 +32,7 @@ const (
 	BLSSignatureOpCodeValidatorVote         BLSSignatureOpCode = BLSSignatureOpCode(consensus.SignatureOpCodeValidatorVote)
 	BLSSignatureOpCodeValidatorTimeout      BLSSignatureOpCode = BLSSignatureOpCode(consensus.SignatureOpCodeValidatorTimeout)
 	BLSSignatureOpCodePoSValidatorHandshake BLSSignatureOpCode = 3
+	BLSSignatureOpCodePoSValidatorTransport BLSSignatureOpCode = 4
 )
 
 func GetAllBLSSignatureOpCodes() []BLSSignatureOpCode {
@@ -38,6 +40,7 @@ func GetAllBLSSignatureOpCodes() []BLSSignatureOpCode {
 		BLSSignatureOpCodeValidatorVote,
 		BLSSignatureOpCodeValidatorTimeout,
 		BLSSignatureOpCodePoSValidatorHandshake,
+		BLSSignatureOpCodePoSValidatorTransport,
 	}
 }
 
@@ -135,6 +138,32 @@ func (signer *BLSSigner) SignPoSValidatorHandshake(nonceSent uint64, nonceReceiv
 	return signer.privateKey.Sign(getPoSValidatorHandshakePayload(nonceSent, nonceReceived, tstampMicro))
 }
 
+// getPoSValidatorTransportPayload extends the handshake payload with the handshake binding, which covers the services
+// and transport keys exchanged in the unsigned version messages, and the session binding of the encrypted transport if
+// one was negotiated. Signing it proves that the validator is the one that holds the transport's session keys, and that
+// the version messages weren't tampered with, so a man in the middle can neither relay the handshake between two
+// validators while terminating the encrypted transport on both ends, nor downgrade the connection to plaintext.
+func getPoSValidatorTransportPayload(
+	nonceSent uint64,
+	nonceReceived uint64,
+	tstampMicro uint64,
+	handshakeBinding []byte,
+) []byte {
+	payload := []byte{byte(BLSSignatureOpCodePoSValidatorTransport)}
+	payload = append(payload, getPoSValidatorHandshakePayload(nonceSent, nonceReceived, tstampMicro)...)
+	payload = append(payload, handshakeBinding...)
+	return payload
+}
+
+func (signer *BLSSigner) SignPoSValidatorTransport(
+	nonceSent uint64,
+	nonceReceived uint64,
+	tstampMicro uint64,
+	handshakeBinding []byte,
+) (*bls.Signature, error) {
+	return signer.privateKey.Sign(getPoSValidatorTransportPayload(nonceSent, nonceReceived, tstampMicro, handshakeBinding))
+}
+
 //////////////////////////////////////////////////////////
 // BLS Verification
 //////////////////////////////////////////////////////////
@@ -163,3 +192,15 @@ func BLSVerifyPoSValidatorHandshake(
 	payload := getPoSValidatorHandshakePayload(nonceSent, nonceReceived, tstampMicro)
 	return _blsVerify(payload[:], signature, publicKey)
 }
+
+func BLSVerifyPoSValidatorTransport(
+	nonceSent uint64,
+	nonceReceived uint64,
+	tstampMicro uint64,
+	handshakeBinding []byte,
+	signature *bls.Signature,
+	publicKey *bls.PublicKey,
+) (bool, error) {
+	payload := getPoSValidatorTransportPayload(nonceSent, nonceReceived, tstampMicro, handshakeBinding)
+	return _blsVerify(payload, signature, publicKey)
+}
@@ -291,7 +291,7 @@ func (cmgr *ConnectionManager) _dialOutboundConnection(addr *wire.NetAddressV2,
 // the addrmgr to randomly select addrs and create OUTBOUND connections
 // with them until we find a worthy peer.
 func (cmgr *ConnectionManager) ConnectPeer(id uint64, conn net.Conn, na *wire.NetAddressV2, isOutbound bool,
-	isPersistent bool) *Peer {
+	isPersistent bool, encryptedTransport bool, messageCompression bool) *Peer {
 
 	// At this point Conn is set so create a peer object to do a version negotiation.
 	peer := NewPeer(id, conn, isOutbound, na, isPersistent,
@@ -301,6 +301,17 @@ func (cmgr *ConnectionManager) ConnectPeer(id uint64, conn net.Conn, na *wire.Ne
 		cmgr.srv.incomingMessages, cmgr, cmgr.srv, cmgr.SyncType,
 		cmgr.peerDisconnectedChan)
 
+	// The encrypted transport has to be enabled before the peer starts reading messages, so that it can negotiate
+	// the session keys as soon as the peer's version message arrives. If it fails, we fall back to plaintext.
+	if encryptedTransport {
+		if err := peer.EnableEncryptedTransport(); err != nil {
+			glog.Errorf("ConnectionManager.ConnectPeer: Problem enabling encrypted transport for peer (id= %d): %v", id, err)
+		}
+	}
+	if messageCompression {
+		peer.EnableMessageCompression()
+	}
+
 	// Now we can add the peer to our data structures.
 	peer._logAddPeer()
 	cmgr.addPeer(peer)
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -167,6 +168,22 @@ const (
 	MsgValidatorTimeoutVersion0 MsgValidatorTimeoutVersion = 0
 )
 
+// Versioning for the MsgCompactBlock, MsgGetBlockTxns, and MsgBlockTxns message types. This
+// type alias is equivalent to a uint8, and supports the same byte encoders/decoders.
+type MsgCompactBlockVersion = byte
+
+const (
+	MsgCompactBlockVersion0 MsgCompactBlockVersion = 0
+)
+
+// Versioning for the MsgGetCheckpoint and MsgCheckpoint message types. This type alias is
+// equivalent to a uint8, and supports the same byte encoders/decoders.
+type MsgCheckpointVersion = byte
+
+const (
+	MsgCheckpointVersion0 MsgCheckpointVersion = 0
+)
+
 var (
 	MaxUint256, _ = uint256.FromHex("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
 
@@ -360,6 +377,13 @@ type ForkHeights struct {
 	// from PoW consensus to PoS consensus.
 	ProofOfStake2ConsensusCutoverBlockHeight uint32
 
+	// ScheduledTransactionsBlockHeight defines the height at which we begin enforcing the
+	// MinInclusionBlockHeightKey in a transaction's ExtraData. From this height on, a
+	// transaction that declares a minimum inclusion block height can't be connected in a
+	// block below that height, which allows transactions to be signed ahead of time and
+	// scheduled for a future block.
+	ScheduledTransactionsBlockHeight uint32
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -881,6 +905,8 @@ var RegtestForkHeights = ForkHeights{
 
 	LockupsBlockHeight: uint32(1),
 
+	ScheduledTransactionsBlockHeight: uint32(0),
+
 	BlockRewardPatchBlockHeight: uint32(0),
 
 	// Be sure to update EncoderMigrationHeights as well via
@@ -1094,6 +1120,9 @@ var MainnetForkHeights = ForkHeights{
 	// Tues July 2 2024 @ 12pm PST
 	LockupsBlockHeight: uint32(349167),
 
+	// TODO: Set to a real block height once the fork is scheduled.
+	ScheduledTransactionsBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1497,6 +1526,9 @@ var TestnetForkHeights = ForkHeights{
 	// Wed May 1 2024 @ 12pm PT
 	LockupsBlockHeight: uint32(1113866),
 
+	// TODO: Set to a real block height once the fork is scheduled.
+	ScheduledTransactionsBlockHeight: uint32(math.MaxUint32),
+
 	// Be sure to update EncoderMigrationHeights as well via
 	// GetEncoderMigrationHeights if you're modifying schema.
 }
@@ -1801,6 +1833,10 @@ const (
 	// Key in transaction's extra data map containing the derived key used in signing the txn.
 	DerivedPublicKey = "DerivedPublicKey"
 
+	// Key in transaction's extra data map. If present, the value is the uvarint-encoded minimum block height that
+	// the txn can be included in. The txn can't be connected in a block below that height.
+	MinInclusionBlockHeightKey = "MinInclusionBlockHeight"
+
 	// Messaging keys
 	MessagingPublicKey             = "MessagingPublicKey"
 	SenderMessagingPublicKey       = "SenderMessagingPublicKey"
@@ -103,6 +103,34 @@ func (adapter *DbAdapter) GetPostAssociationIdsByAttributes(
 	return DBGetPostAssociationIdsByAttributes(adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
 }
 
+func (adapter *DbAdapter) CountUserAssociationsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (uint64, error) {
+	if adapter.postgresDb != nil {
+		return adapter.postgresDb.CountUserAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
+	}
+	associationIds, _, err := DBGetUserAssociationIdsByAttributes(
+		adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(associationIds.Size()), nil
+}
+
+func (adapter *DbAdapter) CountPostAssociationsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (uint64, error) {
+	if adapter.postgresDb != nil {
+		return adapter.postgresDb.CountPostAssociationsByAttributes(associationQuery, utxoViewAssociationIds)
+	}
+	associationIds, _, err := DBGetPostAssociationIdsByAttributes(
+		adapter.badgerDb, adapter.snapshot, associationQuery, utxoViewAssociationIds)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(associationIds.Size()), nil
+}
+
 func (adapter *DbAdapter) SortUserAssociationEntriesByPrefix(
 	associationEntries []*UserAssociationEntry,
 	prefixType []byte,
@@ -221,6 +249,18 @@ func (adapter *DbAdapter) GetOwnerToDerivedKeyMapping(ownerPublicKey PublicKey,
 	return DBGetOwnerToDerivedKeyMapping(adapter.badgerDb, adapter.snapshot, ownerPublicKey, derivedPublicKey)
 }
 
+func (adapter *DbAdapter) GetAllOwnerToDerivedKeyMappings(ownerPublicKey PublicKey) ([]*DerivedKeyEntry, error) {
+	if adapter.postgresDb != nil {
+		var entries []*DerivedKeyEntry
+		for _, pgDerivedKey := range adapter.postgresDb.GetAllDerivedKeysForOwner(&ownerPublicKey) {
+			entries = append(entries, pgDerivedKey.NewDerivedKeyEntry())
+		}
+		return entries, nil
+	}
+
+	return DBGetAllOwnerToDerivedKeyMappings(adapter.badgerDb, ownerPublicKey)
+}
+
 //
 // DAO coin limit order
 //
@@ -604,7 +604,26 @@ type DBPrefixes struct {
 	// When reading and writing data to this prefixes, please acquire the snapshotDbMutex in the snapshot.
 	PrefixHypersyncSnapshotDBPrefix []byte `prefix_id:"[97]"`
 
-	// NEXT_TAG: 98
+	// PrefixTxindexTxnTypeAndHeightToTxID: Range query transactions by type and block height.
+	// <prefix_id, TxnType uint8, BlockHeight uint64, TxnIndexInBlock uint64, TxID BlockHash> -> <>
+	PrefixTxindexTxnTypeAndHeightToTxID []byte `prefix_id:"[98]" is_txindex:"true"`
+
+	// PrefixTxindexCoinActivityToTxID: Transactions involving a creator's creator coin or DAO coin, by
+	// type and block height. This covers buys, sells, transfers, mints, burns, limit orders and lockups.
+	// <prefix_id, CreatorPublicKey [33]byte, TxnType uint8, BlockHeight uint64, TxnIndexInBlock uint64,
+	// TxID BlockHash> -> <>
+	PrefixTxindexCoinActivityToTxID []byte `prefix_id:"[99]" is_txindex:"true"`
+
+	// PrefixTxindexNFTActivityToTxID: Transactions involving the NFTs of a post, by block height.
+	// <prefix_id, NFTPostHash BlockHash, BlockHeight uint64, TxnIndexInBlock uint64, TxID BlockHash> -> <>
+	PrefixTxindexNFTActivityToTxID []byte `prefix_id:"[100]" is_txindex:"true"`
+
+	// PrefixTxindexSecondaryIndexesBuilt: Set once the three txindex prefixes above have been built for every
+	// transaction in the txindex. Txindexes created before these prefixes existed are backfilled on startup.
+	// <prefix_id> -> <>
+	PrefixTxindexSecondaryIndexesBuilt []byte `prefix_id:"[101]" is_txindex:"true"`
+
+	// NEXT_TAG: 102
 }
 
 // DecodeStateKey decodes a state key into a DeSoEncoder type. This is useful for encoders which don't have a stored
@@ -7685,6 +7704,11 @@ func DbPutTxindexTransactionMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blo
 		}
 	}
 
+	// Add the txn to the secondary indexes.
+	if err := DbPutTxindexSecondaryIndexMappingsWithTxn(txn, snap, blockHeight, desoTxn, txnMeta, eventManager); err != nil {
+		return err
+	}
+
 	// If we get here, it means everything went smoothly.
 	return nil
 }
@@ -7700,6 +7724,8 @@ func DbPutTxindexTransactionMappings(handle *badger.DB, snap *Snapshot, blockHei
 	return err
 }
 
+// DbDeleteTxindexTransactionMappingsWithTxn removes a transaction from the txindex. The blockHeight must be the
+// height of the block containing the transaction, since it's part of the secondary index keys.
 func DbDeleteTxindexTransactionMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64,
 	desoTxn *MsgDeSoTxn, params *DeSoParams, eventManager *EventManager, entryIsDeleted bool) error {
 
@@ -7722,6 +7748,12 @@ func DbDeleteTxindexTransactionMappingsWithTxn(txn *badger.Txn, snap *Snapshot,
 		}
 	}
 
+	// Delete the txn from the secondary indexes.
+	if err := DbDeleteTxindexSecondaryIndexMappingsWithTxn(
+		txn, snap, blockHeight, desoTxn, txnMeta, eventManager, entryIsDeleted); err != nil {
+		return err
+	}
+
 	// Delete the metadata
 	transactionIndexKey := DbTxindexTxIDKey(txID)
 	if err := DBDeleteWithTxn(txn, snap, transactionIndexKey, eventManager, entryIsDeleted); err != nil {
@@ -7740,6 +7772,344 @@ func DbDeleteTxindexTransactionMappings(handle *badger.DB, snap *Snapshot, block
 	})
 }
 
+// -------------------------------------------------------------------------------------
+// Txindex secondary indexes
+// -------------------------------------------------------------------------------------
+
+func _dbTxindexHeightAndTxIDSuffix(blockHeight uint64, txnIndexInBlock uint64, txID *BlockHash) []byte {
+	var key []byte
+	key = append(key, EncodeUint64(blockHeight)...)
+	key = append(key, EncodeUint64(txnIndexInBlock)...)
+	key = append(key, txID[:]...)
+	return key
+}
+
+func DbTxindexTxnTypePrefix(txnType TxnType) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexTxnTypeAndHeightToTxID...), byte(txnType))
+}
+
+func DbTxindexTxnTypeAndHeightKey(txnType TxnType, blockHeight uint64, txnIndexInBlock uint64, txID *BlockHash) []byte {
+	return append(DbTxindexTxnTypePrefix(txnType), _dbTxindexHeightAndTxIDSuffix(blockHeight, txnIndexInBlock, txID)...)
+}
+
+func DbTxindexCoinActivityPrefix(creatorPublicKey []byte, txnType TxnType) []byte {
+	prefix := append([]byte{}, Prefixes.PrefixTxindexCoinActivityToTxID...)
+	prefix = append(prefix, creatorPublicKey...)
+	return append(prefix, byte(txnType))
+}
+
+func DbTxindexCoinActivityKey(creatorPublicKey []byte, txnType TxnType, blockHeight uint64, txnIndexInBlock uint64,
+	txID *BlockHash) []byte {
+	return append(DbTxindexCoinActivityPrefix(creatorPublicKey, txnType),
+		_dbTxindexHeightAndTxIDSuffix(blockHeight, txnIndexInBlock, txID)...)
+}
+
+func DbTxindexNFTActivityPrefix(nftPostHash *BlockHash) []byte {
+	return append(append([]byte{}, Prefixes.PrefixTxindexNFTActivityToTxID...), nftPostHash[:]...)
+}
+
+func DbTxindexNFTActivityKey(nftPostHash *BlockHash, blockHeight uint64, txnIndexInBlock uint64, txID *BlockHash) []byte {
+	return append(DbTxindexNFTActivityPrefix(nftPostHash), _dbTxindexHeightAndTxIDSuffix(blockHeight, txnIndexInBlock, txID)...)
+}
+
+// _getTxindexActivityForTxn returns the creator public keys whose coins are involved in a transaction,
+// and the posts whose NFTs are involved in a transaction. The transactions inside an atomic transaction
+// wrapper are attributed to the wrapper, since the wrapper's txID is the one stored in the txindex.
+func _getTxindexActivityForTxn(desoTxn *MsgDeSoTxn) (
+	_creatorPublicKeys []*PublicKey, _nftPostHashes []*BlockHash) {
+
+	var creatorPublicKeys []*PublicKey
+	var nftPostHashes []*BlockHash
+	addCreatorPublicKey := func(publicKey []byte) {
+		if len(publicKey) != PublicKeyLenCompressed {
+			return
+		}
+		creatorPublicKey := NewPublicKey(publicKey)
+		// DAO coin limit orders use the ZeroPublicKey to represent DESO.
+		if creatorPublicKey.IsZeroPublicKey() {
+			return
+		}
+		creatorPublicKeys = append(creatorPublicKeys, creatorPublicKey)
+	}
+	addNFTPostHash := func(nftPostHash *BlockHash) {
+		if nftPostHash != nil {
+			nftPostHashes = append(nftPostHashes, nftPostHash)
+		}
+	}
+
+	switch txnMeta := desoTxn.TxnMeta.(type) {
+	case *CreatorCoinMetadataa:
+		addCreatorPublicKey(txnMeta.ProfilePublicKey)
+	case *CreatorCoinTransferMetadataa:
+		addCreatorPublicKey(txnMeta.ProfilePublicKey)
+	case *DAOCoinMetadata:
+		addCreatorPublicKey(txnMeta.ProfilePublicKey)
+	case *DAOCoinTransferMetadata:
+		addCreatorPublicKey(txnMeta.ProfilePublicKey)
+	case *DAOCoinLimitOrderMetadata:
+		if txnMeta.BuyingDAOCoinCreatorPublicKey != nil {
+			addCreatorPublicKey(txnMeta.BuyingDAOCoinCreatorPublicKey.ToBytes())
+		}
+		if txnMeta.SellingDAOCoinCreatorPublicKey != nil {
+			addCreatorPublicKey(txnMeta.SellingDAOCoinCreatorPublicKey.ToBytes())
+		}
+	case *CoinLockupMetadata:
+		if txnMeta.ProfilePublicKey != nil {
+			addCreatorPublicKey(txnMeta.ProfilePublicKey.ToBytes())
+		}
+	case *CoinLockupTransferMetadata:
+		if txnMeta.ProfilePublicKey != nil {
+			addCreatorPublicKey(txnMeta.ProfilePublicKey.ToBytes())
+		}
+	case *CoinUnlockMetadata:
+		if txnMeta.ProfilePublicKey != nil {
+			addCreatorPublicKey(txnMeta.ProfilePublicKey.ToBytes())
+		}
+	case *CreateNFTMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *UpdateNFTMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *NFTBidMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *AcceptNFTBidMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *NFTTransferMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *AcceptNFTTransferMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *BurnNFTMetadata:
+		addNFTPostHash(txnMeta.NFTPostHash)
+	case *AtomicTxnsWrapperMetadata:
+		for _, innerTxn := range txnMeta.Txns {
+			innerCreatorPublicKeys, innerNFTPostHashes := _getTxindexActivityForTxn(innerTxn)
+			creatorPublicKeys = append(creatorPublicKeys, innerCreatorPublicKeys...)
+			nftPostHashes = append(nftPostHashes, innerNFTPostHashes...)
+		}
+	}
+	return creatorPublicKeys, nftPostHashes
+}
+
+// _getTxindexSecondaryIndexKeys returns the keys in all the txindex secondary indexes for a transaction.
+func _getTxindexSecondaryIndexKeys(blockHeight uint64, desoTxn *MsgDeSoTxn, txnMeta *TransactionMetadata) [][]byte {
+	txID := desoTxn.Hash()
+	txnType := desoTxn.TxnMeta.GetTxnType()
+	keys := [][]byte{DbTxindexTxnTypeAndHeightKey(txnType, blockHeight, txnMeta.TxnIndexInBlock, txID)}
+
+	// A key is only added once per creator or post, even if it appears in several inner transactions of an
+	// atomic transaction wrapper.
+	keysSeen := NewSet([]string{})
+	addKey := func(key []byte) {
+		if !keysSeen.Includes(string(key)) {
+			keysSeen.Add(string(key))
+			keys = append(keys, key)
+		}
+	}
+	creatorPublicKeys, nftPostHashes := _getTxindexActivityForTxn(desoTxn)
+	for _, creatorPublicKey := range creatorPublicKeys {
+		addKey(DbTxindexCoinActivityKey(creatorPublicKey.ToBytes(), txnType, blockHeight, txnMeta.TxnIndexInBlock, txID))
+	}
+	for _, nftPostHash := range nftPostHashes {
+		addKey(DbTxindexNFTActivityKey(nftPostHash, blockHeight, txnMeta.TxnIndexInBlock, txID))
+	}
+	return keys
+}
+
+// DbPutTxindexSecondaryIndexMappingsWithTxn adds a transaction to the txindex secondary indexes. The
+// blockHeight must be the height of the block containing the transaction.
+func DbPutTxindexSecondaryIndexMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64,
+	desoTxn *MsgDeSoTxn, txnMeta *TransactionMetadata, eventManager *EventManager) error {
+
+	for _, key := range _getTxindexSecondaryIndexKeys(blockHeight, desoTxn, txnMeta) {
+		if err := DBSetWithTxn(txn, snap, key, []byte{}, eventManager); err != nil {
+			return errors.Wrapf(err, "DbPutTxindexSecondaryIndexMappingsWithTxn: Problem adding mapping for txn %v",
+				desoTxn.Hash())
+		}
+	}
+	return nil
+}
+
+// DbDeleteTxindexSecondaryIndexMappingsWithTxn removes a transaction from the txindex secondary indexes. The
+// blockHeight must be the height of the block containing the transaction.
+func DbDeleteTxindexSecondaryIndexMappingsWithTxn(txn *badger.Txn, snap *Snapshot, blockHeight uint64,
+	desoTxn *MsgDeSoTxn, txnMeta *TransactionMetadata, eventManager *EventManager, entryIsDeleted bool) error {
+
+	for _, key := range _getTxindexSecondaryIndexKeys(blockHeight, desoTxn, txnMeta) {
+		if err := DBDeleteWithTxn(txn, snap, key, eventManager, entryIsDeleted); err != nil {
+			return errors.Wrapf(err, "DbDeleteTxindexSecondaryIndexMappingsWithTxn: Problem deleting mapping for txn %v",
+				desoTxn.Hash())
+		}
+	}
+	return nil
+}
+
+func DbGetTxindexSecondaryIndexesBuilt(handle *badger.DB, snap *Snapshot) bool {
+	var built bool
+	handle.View(func(txn *badger.Txn) error {
+		_, err := DBGetWithTxn(txn, snap, Prefixes.PrefixTxindexSecondaryIndexesBuilt)
+		built = err == nil
+		return nil
+	})
+	return built
+}
+
+func DbPutTxindexSecondaryIndexesBuilt(handle *badger.DB, snap *Snapshot, eventManager *EventManager) error {
+	return handle.Update(func(txn *badger.Txn) error {
+		return DBSetWithTxn(txn, snap, Prefixes.PrefixTxindexSecondaryIndexesBuilt, []byte{}, eventManager)
+	})
+}
+
+// _enumerateTxindexKeysPaginatedWithTxn returns up to limit keys and values with the given prefix, starting at
+// seekKey. In reverse order, the first key returned is the largest key that is less than or equal to seekKey.
+// If isInRange is provided, iteration stops at the first key for which it returns false. If there are more
+// keys after the last one returned, the next key is returned as _nextStartKey. Passing it as the seekKey of
+// the next call returns the next page.
+func _enumerateTxindexKeysPaginatedWithTxn(txn *badger.Txn, prefix []byte, seekKey []byte, limit int, reverse bool,
+	isInRange func(key []byte) bool) (_keysFound [][]byte, _valsFound [][]byte, _nextStartKey []byte, _err error) {
+
+	if limit <= 0 {
+		return nil, nil, nil, fmt.Errorf("_enumerateTxindexKeysPaginatedWithTxn: Limit must be positive, got %d", limit)
+	}
+	if !bytes.HasPrefix(seekKey, prefix) {
+		return nil, nil, nil, fmt.Errorf("_enumerateTxindexKeysPaginatedWithTxn: Seek key %v doesn't have "+
+			"prefix %v", seekKey, prefix)
+	}
+
+	keysFound := [][]byte{}
+	valsFound := [][]byte{}
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = reverse
+	opts.Prefix = prefix
+	nodeIterator := txn.NewIterator(opts)
+	defer nodeIterator.Close()
+
+	for nodeIterator.Seek(seekKey); nodeIterator.ValidForPrefix(prefix); nodeIterator.Next() {
+		key := nodeIterator.Item().KeyCopy(nil)
+		if isInRange != nil && !isInRange(key) {
+			break
+		}
+		if len(keysFound) == limit {
+			return keysFound, valsFound, key, nil
+		}
+		val, err := nodeIterator.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "_enumerateTxindexKeysPaginatedWithTxn: Problem copying value")
+		}
+		keysFound = append(keysFound, key)
+		valsFound = append(valsFound, val)
+	}
+	return keysFound, valsFound, nil, nil
+}
+
+// _getTxindexTxIDsPaginated enumerates keys that end in a txID, and returns the txIDs.
+func _getTxindexTxIDsPaginated(handle *badger.DB, prefix []byte, seekKey []byte, limit int, reverse bool,
+	isInRange func(key []byte) bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+
+	var keysFound [][]byte
+	var nextStartKey []byte
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		keysFound, _, nextStartKey, err = _enumerateTxindexKeysPaginatedWithTxn(
+			txn, prefix, seekKey, limit, reverse, isInRange)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txIDs := []*BlockHash{}
+	for _, key := range keysFound {
+		if len(key) < len(prefix)+HashSizeBytes {
+			return nil, nil, fmt.Errorf("_getTxindexTxIDsPaginated: Invalid key length %d", len(key))
+		}
+		txIDs = append(txIDs, NewBlockHash(key[len(key)-HashSizeBytes:]))
+	}
+	return txIDs, nextStartKey, nil
+}
+
+// _getTxindexSeekKey returns startKey if it's provided, and otherwise the key at which iteration over prefix
+// starts in the given direction.
+func _getTxindexSeekKey(prefix []byte, startKey []byte, reverse bool) []byte {
+	if startKey != nil {
+		return startKey
+	}
+	seekKey := append([]byte{}, prefix...)
+	if reverse {
+		seekKey = append(seekKey, 0xff)
+	}
+	return seekKey
+}
+
+// DbGetTxindexTxnsByTypeAndHeight returns the txIDs of transactions of the given type with block heights in
+// [minHeight, maxHeight], ordered by block height and position in the block. Pass the returned nextStartKey as
+// the startKey of the next call to get the next page, with the same other arguments. A nil nextStartKey means
+// there are no more transactions in the range.
+func DbGetTxindexTxnsByTypeAndHeight(handle *badger.DB, txnType TxnType, minHeight uint64, maxHeight uint64,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+
+	prefix := DbTxindexTxnTypePrefix(txnType)
+	seekKey := startKey
+	if seekKey == nil {
+		if reverse {
+			seekKey = append(append(append([]byte{}, prefix...), EncodeUint64(maxHeight)...), 0xff)
+		} else {
+			seekKey = append(append([]byte{}, prefix...), EncodeUint64(minHeight)...)
+		}
+	}
+	isInRange := func(key []byte) bool {
+		if len(key) < len(prefix)+8 {
+			return false
+		}
+		blockHeight := DecodeUint64(key[len(prefix) : len(prefix)+8])
+		return blockHeight >= minHeight && blockHeight <= maxHeight
+	}
+	return _getTxindexTxIDsPaginated(handle, prefix, seekKey, limit, reverse, isInRange)
+}
+
+// DbGetTxindexCoinActivity returns the txIDs of transactions of the given type that involve the creator coin or DAO
+// coin of the given creator, ordered by block height and position in the block. The creator is identified by the
+// public key used in the transactions, and activity from before a swap identity stays under the old public key.
+// Pagination works as in DbGetTxindexTxnsByTypeAndHeight.
+func DbGetTxindexCoinActivity(handle *badger.DB, creatorPublicKey []byte, txnType TxnType,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+
+	prefix := DbTxindexCoinActivityPrefix(creatorPublicKey, txnType)
+	return _getTxindexTxIDsPaginated(handle, prefix, _getTxindexSeekKey(prefix, startKey, reverse), limit, reverse, nil)
+}
+
+// DbGetTxindexNFTActivity returns the txIDs of transactions involving the NFTs of the given post, ordered by block
+// height and position in the block. Pagination works as in DbGetTxindexTxnsByTypeAndHeight.
+func DbGetTxindexNFTActivity(handle *badger.DB, nftPostHash *BlockHash,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+
+	prefix := DbTxindexNFTActivityPrefix(nftPostHash)
+	return _getTxindexTxIDsPaginated(handle, prefix, _getTxindexSeekKey(prefix, startKey, reverse), limit, reverse, nil)
+}
+
+// DbGetTxindexTxnsForPublicKeyPaginated returns the txIDs of the transactions that affected the given public key,
+// in the order in which they were added to the txindex. Pagination works as in DbGetTxindexTxnsByTypeAndHeight.
+func DbGetTxindexTxnsForPublicKeyPaginated(handle *badger.DB, publicKey []byte,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+
+	prefix := DbTxindexPublicKeyPrefix(publicKey)
+	var valsFound [][]byte
+	var nextStartKey []byte
+	err := handle.View(func(txn *badger.Txn) error {
+		var err error
+		_, valsFound, nextStartKey, err = _enumerateTxindexKeysPaginatedWithTxn(
+			txn, prefix, _getTxindexSeekKey(prefix, startKey, reverse), limit, reverse, nil)
+		return err
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "DbGetTxindexTxnsForPublicKeyPaginated: Problem fetching txIDs")
+	}
+
+	txIDs := []*BlockHash{}
+	for _, txIDBytes := range valsFound {
+		txIDs = append(txIDs, NewBlockHash(txIDBytes))
+	}
+	return txIDs, nextStartKey, nil
+}
+
 // DbGetTxindexFullTransactionByTxID
 // TODO: This makes lookups inefficient when blocks are large. Shouldn't be a
 // problem for a while, but keep an eye on it.
@@ -635,3 +635,108 @@ func TestEncodeUint8(t *testing.T) {
 		require.Equal(t, num, decoded2)
 	}
 }
+
+func TestTxindexSecondaryIndexes(t *testing.T) {
+	require := require.New(t)
+
+	db, _ := GetTestBadgerDb()
+	defer CleanUpBadger(db)
+	params := &DeSoTestnetParams
+
+	transactorPk, _, err := Base58CheckDecode(m0Pub)
+	require.NoError(err)
+	creatorPk, _, err := Base58CheckDecode(m1Pub)
+	require.NoError(err)
+	receiverPk, _, err := Base58CheckDecode(m2Pub)
+	require.NoError(err)
+	nftPostHash := NewBlockHash(RandomBytes(HashSizeBytes))
+
+	// Add a few transactions to the txindex at different heights.
+	putTxn := func(txnMeta DeSoTxnMetadata, blockHeight uint64, txnIndexInBlock uint64) *BlockHash {
+		txn := &MsgDeSoTxn{
+			TxInputs:  []*DeSoInput{},
+			TxOutputs: []*DeSoOutput{},
+			TxnMeta:   txnMeta,
+			PublicKey: transactorPk,
+		}
+		require.NoError(DbPutTxindexTransactionMappings(db, nil, blockHeight, txn, params, &TransactionMetadata{
+			TransactorPublicKeyBase58Check: PkToString(transactorPk, params),
+			TxnIndexInBlock:                txnIndexInBlock,
+			TxnType:                        txnMeta.GetTxnType().String(),
+		}, nil))
+		return txn.Hash()
+	}
+	transferTxID1 := putTxn(&CreatorCoinTransferMetadataa{
+		ProfilePublicKey: creatorPk, CreatorCoinToTransferNanos: 1, ReceiverPublicKey: receiverPk}, 10, 0)
+	bidTxID1 := putTxn(&NFTBidMetadata{NFTPostHash: nftPostHash, SerialNumber: 1, BidAmountNanos: 1}, 10, 1)
+	buyTxID := putTxn(&CreatorCoinMetadataa{ProfilePublicKey: creatorPk, DeSoToSellNanos: 1}, 15, 0)
+	putTxn(&BasicTransferMetadata{}, 15, 1)
+	transferTxID2 := putTxn(&CreatorCoinTransferMetadataa{
+		ProfilePublicKey: creatorPk, CreatorCoinToTransferNanos: 2, ReceiverPublicKey: receiverPk}, 20, 0)
+	bidTxID2 := putTxn(&NFTBidMetadata{NFTPostHash: nftPostHash, SerialNumber: 1, BidAmountNanos: 2}, 20, 1)
+
+	// Page through transactions by type, one at a time.
+	txIDs, nextStartKey, err := DbGetTxindexTxnsByTypeAndHeight(
+		db, TxnTypeCreatorCoinTransfer, 0, math.MaxUint64, nil, 1, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID1}, txIDs)
+	require.NotNil(nextStartKey)
+	txIDs, nextStartKey, err = DbGetTxindexTxnsByTypeAndHeight(
+		db, TxnTypeCreatorCoinTransfer, 0, math.MaxUint64, nextStartKey, 1, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID2}, txIDs)
+	require.Nil(nextStartKey)
+
+	// Height ranges are inclusive, and can be iterated in reverse.
+	txIDs, nextStartKey, err = DbGetTxindexTxnsByTypeAndHeight(db, TxnTypeCreatorCoinTransfer, 11, 20, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID2}, txIDs)
+	require.Nil(nextStartKey)
+	txIDs, _, err = DbGetTxindexTxnsByTypeAndHeight(db, TxnTypeCreatorCoinTransfer, 0, 19, nil, 10, true)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID1}, txIDs)
+	txIDs, _, err = DbGetTxindexTxnsByTypeAndHeight(db, TxnTypeNFTBid, 0, math.MaxUint64, nil, 10, true)
+	require.NoError(err)
+	require.Equal([]*BlockHash{bidTxID2, bidTxID1}, txIDs)
+
+	// Coin activity is split by txn type.
+	txIDs, _, err = DbGetTxindexCoinActivity(db, creatorPk, TxnTypeCreatorCoinTransfer, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID1, transferTxID2}, txIDs)
+	txIDs, _, err = DbGetTxindexCoinActivity(db, creatorPk, TxnTypeCreatorCoin, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{buyTxID}, txIDs)
+	txIDs, _, err = DbGetTxindexCoinActivity(db, receiverPk, TxnTypeCreatorCoinTransfer, nil, 10, false)
+	require.NoError(err)
+	require.Empty(txIDs)
+
+	// NFT activity is ordered by height.
+	txIDs, _, err = DbGetTxindexNFTActivity(db, nftPostHash, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{bidTxID1, bidTxID2}, txIDs)
+
+	// The public key index can be paged through too.
+	txIDs, nextStartKey, err = DbGetTxindexTxnsForPublicKeyPaginated(db, transactorPk, nil, 4, false)
+	require.NoError(err)
+	require.Len(txIDs, 4)
+	require.Equal(transferTxID1, txIDs[0])
+	txIDs, nextStartKey, err = DbGetTxindexTxnsForPublicKeyPaginated(db, transactorPk, nextStartKey, 4, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID2, bidTxID2}, txIDs)
+	require.Nil(nextStartKey)
+
+	// Deleting a transaction removes it from the secondary indexes.
+	require.NoError(DbDeleteTxindexTransactionMappings(db, nil, 20, &MsgDeSoTxn{
+		TxInputs:  []*DeSoInput{},
+		TxOutputs: []*DeSoOutput{},
+		TxnMeta: &CreatorCoinTransferMetadataa{
+			ProfilePublicKey: creatorPk, CreatorCoinToTransferNanos: 2, ReceiverPublicKey: receiverPk},
+		PublicKey: transactorPk,
+	}, params, nil, true))
+	txIDs, _, err = DbGetTxindexCoinActivity(db, creatorPk, TxnTypeCreatorCoinTransfer, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID1}, txIDs)
+	txIDs, _, err = DbGetTxindexTxnsByTypeAndHeight(db, TxnTypeCreatorCoinTransfer, 0, math.MaxUint64, nil, 10, false)
+	require.NoError(err)
+	require.Equal([]*BlockHash{transferTxID1}, txIDs)
+}
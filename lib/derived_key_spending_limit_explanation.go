@@ -0,0 +1,539 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/pkg/errors"
+)
+
+// DerivedKeySpendingLimitName is the name of a field of TransactionSpendingLimit that a derived key txn can be
+// checked against.
+type DerivedKeySpendingLimitName string
+
+const (
+	DerivedKeySpendingLimitGlobalDESO        DerivedKeySpendingLimitName = "GlobalDESOLimit"
+	DerivedKeySpendingLimitTransactionCount  DerivedKeySpendingLimitName = "TransactionCountLimitMap"
+	DerivedKeySpendingLimitCreatorCoin       DerivedKeySpendingLimitName = "CreatorCoinOperationLimitMap"
+	DerivedKeySpendingLimitDAOCoin           DerivedKeySpendingLimitName = "DAOCoinOperationLimitMap"
+	DerivedKeySpendingLimitNFT               DerivedKeySpendingLimitName = "NFTOperationLimitMap"
+	DerivedKeySpendingLimitDAOCoinLimitOrder DerivedKeySpendingLimitName = "DAOCoinLimitOrderLimitMap"
+	DerivedKeySpendingLimitAssociation       DerivedKeySpendingLimitName = "AssociationLimitMap"
+	DerivedKeySpendingLimitAccessGroup       DerivedKeySpendingLimitName = "AccessGroupMap"
+	DerivedKeySpendingLimitAccessGroupMember DerivedKeySpendingLimitName = "AccessGroupMemberMap"
+	DerivedKeySpendingLimitLockup            DerivedKeySpendingLimitName = "LockupLimitMap"
+	DerivedKeySpendingLimitStake             DerivedKeySpendingLimitName = "StakeLimitMap"
+	DerivedKeySpendingLimitUnstake           DerivedKeySpendingLimitName = "UnstakeLimitMap"
+	DerivedKeySpendingLimitUnlockStake       DerivedKeySpendingLimitName = "UnlockStakeLimitMap"
+)
+
+// DerivedKeySpendingLimitsForTxnType returns the limits that a txn of the given type is checked against when it's
+// signed by a derived key that isn't unlimited. Every txn is checked against the GlobalDESOLimit, and then against
+// the limit map that governs its type, mirroring the switch in _checkAndUpdateDerivedKeySpendingLimit.
+func DerivedKeySpendingLimitsForTxnType(txnType TxnType) []DerivedKeySpendingLimitName {
+	var limit DerivedKeySpendingLimitName
+	switch txnType {
+	case TxnTypeCreatorCoin, TxnTypeCreatorCoinTransfer:
+		limit = DerivedKeySpendingLimitCreatorCoin
+	case TxnTypeDAOCoin, TxnTypeDAOCoinTransfer:
+		limit = DerivedKeySpendingLimitDAOCoin
+	case TxnTypeDAOCoinLimitOrder:
+		limit = DerivedKeySpendingLimitDAOCoinLimitOrder
+	case TxnTypeUpdateNFT, TxnTypeAcceptNFTBid, TxnTypeNFTBid, TxnTypeAcceptNFTTransfer, TxnTypeNFTTransfer,
+		TxnTypeBurnNFT:
+		limit = DerivedKeySpendingLimitNFT
+	case TxnTypeCreateUserAssociation, TxnTypeDeleteUserAssociation, TxnTypeCreatePostAssociation,
+		TxnTypeDeletePostAssociation:
+		limit = DerivedKeySpendingLimitAssociation
+	case TxnTypeAccessGroup:
+		limit = DerivedKeySpendingLimitAccessGroup
+	case TxnTypeAccessGroupMembers:
+		limit = DerivedKeySpendingLimitAccessGroupMember
+	case TxnTypeCoinLockup, TxnTypeUpdateCoinLockupParams, TxnTypeCoinLockupTransfer, TxnTypeCoinUnlock:
+		limit = DerivedKeySpendingLimitLockup
+	case TxnTypeStake:
+		limit = DerivedKeySpendingLimitStake
+	case TxnTypeUnstake:
+		limit = DerivedKeySpendingLimitUnstake
+	case TxnTypeUnlockStake:
+		limit = DerivedKeySpendingLimitUnlockStake
+	default:
+		limit = DerivedKeySpendingLimitTransactionCount
+	}
+	return []DerivedKeySpendingLimitName{DerivedKeySpendingLimitGlobalDESO, limit}
+}
+
+// derivedKeySpendingLimitRuleErrors maps the RuleErrors returned when a txn is over one of a derived key's spending
+// limits to that limit. Association limits fail with a plain error rather than a RuleError, so they're missing here.
+var derivedKeySpendingLimitRuleErrors = map[RuleError]DerivedKeySpendingLimitName{
+	RuleErrorDerivedKeyTxnSpendsMoreThanGlobalDESOLimit:  DerivedKeySpendingLimitGlobalDESO,
+	RuleErrorDerivedKeyTxnTypeNotAuthorized:              DerivedKeySpendingLimitTransactionCount,
+	RuleErrorDerivedKeyCreatorCoinOperationNotAuthorized: DerivedKeySpendingLimitCreatorCoin,
+	RuleErrorDerivedKeyDAOCoinOperationNotAuthorized:     DerivedKeySpendingLimitDAOCoin,
+	RuleErrorDerivedKeyNFTOperationNotAuthorized:         DerivedKeySpendingLimitNFT,
+	RuleErrorDerivedKeyDAOCoinLimitOrderNotAuthorized:    DerivedKeySpendingLimitDAOCoinLimitOrder,
+	RuleErrorAccessGroupTransactionSpendingLimitInvalid:  DerivedKeySpendingLimitAccessGroup,
+	RuleErrorAccessGroupMemberSpendingLimitInvalid:       DerivedKeySpendingLimitAccessGroupMember,
+	RuleErrorDerivedKeyCoinLockupOperationNotAuthorized:  DerivedKeySpendingLimitLockup,
+	RuleErrorStakeTransactionSpendingLimitExceeded:       DerivedKeySpendingLimitStake,
+	RuleErrorStakeTransactionSpendingLimitNotFound:       DerivedKeySpendingLimitStake,
+	RuleErrorUnstakeTransactionSpendingLimitExceeded:     DerivedKeySpendingLimitUnstake,
+	RuleErrorUnstakeTransactionSpendingLimitNotFound:     DerivedKeySpendingLimitUnstake,
+	RuleErrorUnlockStakeTransactionSpendingLimitNotFound: DerivedKeySpendingLimitUnlockStake,
+}
+
+// DerivedKeySpendingLimitChange is an entry of a derived key's TransactionSpendingLimit that a txn uses up.
+type DerivedKeySpendingLimitChange struct {
+	Limit DerivedKeySpendingLimitName
+	// Key describes the entry of the limit map, e.g. "creator coin operations (buy) on @alice". It's empty for
+	// the GlobalDESOLimit.
+	Key string
+	// Before is the value of the entry before the txn, and Decrement is how much of it the txn uses up. The
+	// values are $DESO nanos for the GlobalDESOLimit, the StakeLimitMap and the UnstakeLimitMap, and txn counts
+	// for the other limits. The txn is over the limit if Decrement is greater than Before.
+	Before    *uint256.Int
+	Decrement *uint256.Int
+}
+
+// DerivedKeySpendingLimitExplanation explains how a derived key's TransactionSpendingLimit applies to a txn.
+type DerivedKeySpendingLimitExplanation struct {
+	TxnType TxnType
+	// IsUnlimited is set if the derived key is unlimited, in which case no limits apply.
+	IsUnlimited bool
+	// ApplicableLimits are the limits the txn is checked against, in the order they're checked.
+	ApplicableLimits []DerivedKeySpendingLimitName
+	// Changes are the limit entries the txn uses up. If the txn fails because it spends more than the
+	// GlobalDESOLimit, Changes still reports how much it would spend.
+	Changes []*DerivedKeySpendingLimitChange
+
+	// Err is set if the txn can't be connected with the derived key, and FailedLimit is the limit that blocks it.
+	// FailedLimit is only set when Err is one of the spending limit RuleErrors and the txn would connect if it was
+	// signed by the owner, so that failures that have nothing to do with the derived key's limits, such as an
+	// insufficient balance or an invalid access signature, aren't blamed on them.
+	Err         error
+	FailedLimit DerivedKeySpendingLimitName
+}
+
+// ExplainDerivedKeySpendingLimit reports which of derivedKeyEntry's spending limits apply to txn, how much of each
+// the txn would use up, and which one, if any, blocks it. The txn is connected to a copy of view in which
+// derivedKeyEntry is the owner's entry for the derived key, so the real spending limit checks are run. The txn
+// doesn't need to be signed, and view isn't modified.
+//
+// A txn that fails is reported in the explanation rather than as an error. The returned error is only set if the
+// explanation itself couldn't be computed.
+func ExplainDerivedKeySpendingLimit(view *UtxoView, derivedKeyEntry *DerivedKeyEntry, txn *MsgDeSoTxn,
+	blockHeight uint64, blockTimestampNanoSecs int64) (*DerivedKeySpendingLimitExplanation, error) {
+
+	if view == nil || derivedKeyEntry == nil || txn == nil {
+		return nil, errors.New("ExplainDerivedKeySpendingLimit: view, derivedKeyEntry, and txn must be set")
+	}
+	if derivedKeyEntry.TransactionSpendingLimitTracker == nil {
+		return nil, errors.New("ExplainDerivedKeySpendingLimit: derivedKeyEntry has no TransactionSpendingLimitTracker")
+	}
+	if !bytes.Equal(txn.PublicKey, derivedKeyEntry.OwnerPublicKey.ToBytes()) {
+		return nil, errors.Errorf("ExplainDerivedKeySpendingLimit: Txn public key %v doesn't match derived key "+
+			"owner %v", PkToString(txn.PublicKey, view.Params),
+			PkToString(derivedKeyEntry.OwnerPublicKey.ToBytes(), view.Params))
+	}
+
+	txnType := txn.TxnMeta.GetTxnType()
+	tracker := derivedKeyEntry.TransactionSpendingLimitTracker
+	explanation := &DerivedKeySpendingLimitExplanation{
+		TxnType:     txnType,
+		IsUnlimited: tracker.IsUnlimited,
+	}
+	if !tracker.IsUnlimited {
+		explanation.ApplicableLimits = DerivedKeySpendingLimitsForTxnType(txnType)
+	}
+
+	// The derived key has to be valid before any of its limits are checked.
+	if derivedKeyEntry.OperationType != AuthorizeDerivedKeyOperationValid || derivedKeyEntry.ExpirationBlock <= blockHeight {
+		explanation.Err = errors.Wrapf(RuleErrorDerivedKeyNotAuthorized, "ExplainDerivedKeySpendingLimit: "+
+			"Derived key EITHER deactivated or block height expired. Deactivation status: %v, Expiration block "+
+			"height: %v, Current block height: %v",
+			derivedKeyEntry.OperationType, derivedKeyEntry.ExpirationBlock, blockHeight)
+		return explanation, nil
+	}
+
+	derivedTxn, ownerTxn, err := makeDerivedKeyExplanationTxns(txn, derivedKeyEntry.DerivedPublicKey.ToBytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "ExplainDerivedKeySpendingLimit: ")
+	}
+	describer := &spendingLimitDescriber{params: view.Params, utxoView: view}
+
+	afterTracker, err := connectDerivedKeyExplanationTxn(view, derivedKeyEntry, derivedTxn, blockHeight,
+		blockTimestampNanoSecs)
+	if err == nil {
+		explanation.Changes = describer.diffTransactionSpendingLimits(tracker, afterTracker)
+		return explanation, nil
+	}
+	explanation.Err = err
+
+	// Only blame the derived key's limits if the txn is over one of them, and the owner could have connected it.
+	ruleErr, _ := errors.Cause(err).(RuleError)
+	failedLimit, isSpendingLimitErr := derivedKeySpendingLimitRuleErrors[ruleErr]
+	if !isSpendingLimitErr {
+		return explanation, nil
+	}
+	if _, _, _, _, ownerErr := view.CopyUtxoView().ConnectTransaction(
+		ownerTxn, ownerTxn.Hash(), uint32(blockHeight), blockTimestampNanoSecs, false, true); ownerErr != nil {
+		return explanation, nil
+	}
+	explanation.FailedLimit = failedLimit
+	if failedLimit != DerivedKeySpendingLimitGlobalDESO {
+		return explanation, nil
+	}
+
+	// Lift the GlobalDESOLimit to find out how much the txn would spend, and which other limits it would use up.
+	liftedEntry := derivedKeyEntry.Copy()
+	liftedEntry.TransactionSpendingLimitTracker.GlobalDESOLimit = math.MaxUint64
+	liftedTracker, err := connectDerivedKeyExplanationTxn(view, liftedEntry, derivedTxn, blockHeight,
+		blockTimestampNanoSecs)
+	if err != nil {
+		// The txn is over more than one limit. The GlobalDESOLimit is checked first, so it's the one reported.
+		return explanation, nil
+	}
+	explanation.Changes = describer.diffTransactionSpendingLimits(liftedEntry.TransactionSpendingLimitTracker,
+		liftedTracker)
+	for _, change := range explanation.Changes {
+		if change.Limit == DerivedKeySpendingLimitGlobalDESO {
+			change.Before = uint256.NewInt(tracker.GlobalDESOLimit)
+		}
+	}
+	return explanation, nil
+}
+
+// makeDerivedKeyExplanationTxns returns unsigned copies of txn. The first names the derived key in its ExtraData so
+// that it's treated as signed by the derived key, and the second is treated as signed by the owner.
+func makeDerivedKeyExplanationTxns(txn *MsgDeSoTxn, derivedPublicKey []byte) (
+	_derivedTxn *MsgDeSoTxn, _ownerTxn *MsgDeSoTxn, _err error) {
+
+	derivedTxn, err := txn.Copy()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "makeDerivedKeyExplanationTxns: Problem copying txn")
+	}
+	derivedTxn.Signature = DeSoSignature{}
+	extraData := make(map[string][]byte)
+	for key, value := range txn.ExtraData {
+		extraData[key] = value
+	}
+	extraData[DerivedPublicKey] = derivedPublicKey
+	derivedTxn.ExtraData = extraData
+
+	ownerTxn, err := txn.Copy()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "makeDerivedKeyExplanationTxns: Problem copying txn")
+	}
+	ownerTxn.Signature = DeSoSignature{}
+	if _, exists := ownerTxn.ExtraData[DerivedPublicKey]; exists {
+		ownerExtraData := make(map[string][]byte)
+		for key, value := range txn.ExtraData {
+			if key != DerivedPublicKey {
+				ownerExtraData[key] = value
+			}
+		}
+		ownerTxn.ExtraData = ownerExtraData
+	}
+	return derivedTxn, ownerTxn, nil
+}
+
+// connectDerivedKeyExplanationTxn connects derivedTxn to a copy of view in which derivedKeyEntry is the owner's entry
+// for the derived key, and returns the derived key's spending limit after the txn.
+func connectDerivedKeyExplanationTxn(view *UtxoView, derivedKeyEntry *DerivedKeyEntry, derivedTxn *MsgDeSoTxn,
+	blockHeight uint64, blockTimestampNanoSecs int64) (*TransactionSpendingLimit, error) {
+
+	explanationView := view.CopyUtxoView()
+	explanationView._setDerivedKeyMapping(derivedKeyEntry.Copy())
+	if _, _, _, _, err := explanationView.ConnectTransaction(
+		derivedTxn, derivedTxn.Hash(), uint32(blockHeight), blockTimestampNanoSecs, false, true); err != nil {
+		return nil, err
+	}
+	afterEntry := explanationView.GetDerivedKeyMappingForOwner(
+		derivedKeyEntry.OwnerPublicKey.ToBytes(), derivedKeyEntry.DerivedPublicKey.ToBytes())
+	if afterEntry == nil || afterEntry.isDeleted || afterEntry.TransactionSpendingLimitTracker == nil {
+		// An AuthorizeDerivedKey txn that revokes the derived key it's signed with replaces the entry, so
+		// there's nothing left to diff against.
+		return derivedKeyEntry.TransactionSpendingLimitTracker, nil
+	}
+	return afterEntry.TransactionSpendingLimitTracker, nil
+}
+
+// diffTransactionSpendingLimits returns the entries of before that are lower, or gone, in after.
+func (describer *spendingLimitDescriber) diffTransactionSpendingLimits(
+	before *TransactionSpendingLimit, after *TransactionSpendingLimit) []*DerivedKeySpendingLimitChange {
+
+	var changes []*DerivedKeySpendingLimitChange
+	if after.GlobalDESOLimit < before.GlobalDESOLimit {
+		changes = append(changes, &DerivedKeySpendingLimitChange{
+			Limit:     DerivedKeySpendingLimitGlobalDESO,
+			Before:    uint256.NewInt(before.GlobalDESOLimit),
+			Decrement: uint256.NewInt(before.GlobalDESOLimit - after.GlobalDESOLimit),
+		})
+	}
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitTransactionCount,
+		before.TransactionCountLimitMap, after.TransactionCountLimitMap, describer.txnCount)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitCreatorCoin,
+		before.CreatorCoinOperationLimitMap, after.CreatorCoinOperationLimitMap, describer.creatorCoin)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitDAOCoin,
+		before.DAOCoinOperationLimitMap, after.DAOCoinOperationLimitMap, describer.daoCoin)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitNFT,
+		before.NFTOperationLimitMap, after.NFTOperationLimitMap, describer.nft)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitDAOCoinLimitOrder,
+		before.DAOCoinLimitOrderLimitMap, after.DAOCoinLimitOrderLimitMap, describer.daoCoinLimitOrder)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitAssociation,
+		before.AssociationLimitMap, after.AssociationLimitMap, describer.association)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitAccessGroup,
+		before.AccessGroupMap, after.AccessGroupMap, describer.accessGroup)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitAccessGroupMember,
+		before.AccessGroupMemberMap, after.AccessGroupMemberMap, describer.accessGroupMember)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitLockup,
+		before.LockupLimitMap, after.LockupLimitMap, describer.lockup)...)
+	changes = append(changes, diffSpendingLimitAmountMap(DerivedKeySpendingLimitStake,
+		before.StakeLimitMap, after.StakeLimitMap, describer.stake)...)
+	changes = append(changes, diffSpendingLimitAmountMap(DerivedKeySpendingLimitUnstake,
+		before.UnstakeLimitMap, after.UnstakeLimitMap, describer.unstake)...)
+	changes = append(changes, diffSpendingLimitCountMap(DerivedKeySpendingLimitUnlockStake,
+		before.UnlockStakeLimitMap, after.UnlockStakeLimitMap, describer.unlockStake)...)
+	return changes
+}
+
+func diffSpendingLimitCountMap[K comparable](limit DerivedKeySpendingLimitName, before map[K]uint64,
+	after map[K]uint64, describe func(K) string) []*DerivedKeySpendingLimitChange {
+
+	var changes []*DerivedKeySpendingLimitChange
+	for key, beforeCount := range before {
+		// Entries that are used up are deleted, so a missing entry has a count of zero.
+		if afterCount := after[key]; afterCount < beforeCount {
+			changes = append(changes, &DerivedKeySpendingLimitChange{
+				Limit:     limit,
+				Key:       describe(key),
+				Before:    uint256.NewInt(beforeCount),
+				Decrement: uint256.NewInt(beforeCount - afterCount),
+			})
+		}
+	}
+	sortDerivedKeySpendingLimitChanges(changes)
+	return changes
+}
+
+func diffSpendingLimitAmountMap[K comparable](limit DerivedKeySpendingLimitName, before map[K]*uint256.Int,
+	after map[K]*uint256.Int, describe func(K) string) []*DerivedKeySpendingLimitChange {
+
+	var changes []*DerivedKeySpendingLimitChange
+	for key, beforeAmount := range before {
+		if beforeAmount == nil {
+			continue
+		}
+		afterAmount := uint256.NewInt(0)
+		if after[key] != nil {
+			afterAmount = after[key]
+		}
+		if afterAmount.Lt(beforeAmount) {
+			changes = append(changes, &DerivedKeySpendingLimitChange{
+				Limit:     limit,
+				Key:       describe(key),
+				Before:    beforeAmount.Clone(),
+				Decrement: uint256.NewInt(0).Sub(beforeAmount, afterAmount),
+			})
+		}
+	}
+	sortDerivedKeySpendingLimitChanges(changes)
+	return changes
+}
+
+func sortDerivedKeySpendingLimitChanges(changes []*DerivedKeySpendingLimitChange) {
+	sort.Slice(changes, func(ii, jj int) bool {
+		return changes[ii].Key < changes[jj].Key
+	})
+}
+
+// ToHumanReadableStrings renders the spending limit as one plain sentence per limit, e.g. "Spend up to 1.5 $DESO,
+// including transaction fees" or "Up to 3 creator coin operations (buy) on @alice", for apps to show on consent
+// screens before a user authorizes a derived key. If utxoView is set, it's used to show usernames instead of public
+// keys. Unlike ToMetamaskString, the output is meant for users rather than for signature verification, so it may
+// change between versions.
+func (tsl *TransactionSpendingLimit) ToHumanReadableStrings(params *DeSoParams, utxoView *UtxoView) []string {
+	if tsl.IsUnlimited {
+		return []string{"Unlimited: any transaction, with no limit on the amount of $DESO spent"}
+	}
+	describer := &spendingLimitDescriber{params: params, utxoView: utxoView}
+
+	limitStrs := []string{fmt.Sprintf("Spend up to %v $DESO, including transaction fees",
+		formatNanosAsDESO(new(big.Int).SetUint64(tsl.GlobalDESOLimit)))}
+	// Each map's lines are sorted lexicographically so that the output is deterministic.
+	addSorted := func(strs []string) {
+		sort.Strings(strs)
+		limitStrs = append(limitStrs, strs...)
+	}
+	addSorted(humanReadableCountLimits(tsl.TransactionCountLimitMap, describer.txnCount))
+	addSorted(humanReadableCountLimits(tsl.CreatorCoinOperationLimitMap, describer.creatorCoin))
+	addSorted(humanReadableCountLimits(tsl.DAOCoinOperationLimitMap, describer.daoCoin))
+	addSorted(humanReadableCountLimits(tsl.NFTOperationLimitMap, describer.nft))
+	addSorted(humanReadableCountLimits(tsl.DAOCoinLimitOrderLimitMap, describer.daoCoinLimitOrder))
+	addSorted(humanReadableCountLimits(tsl.AssociationLimitMap, describer.association))
+	addSorted(humanReadableCountLimits(tsl.AccessGroupMap, describer.accessGroup))
+	addSorted(humanReadableCountLimits(tsl.AccessGroupMemberMap, describer.accessGroupMember))
+	addSorted(humanReadableCountLimits(tsl.LockupLimitMap, describer.lockup))
+
+	var stakeStrs []string
+	for limitKey, limit := range tsl.StakeLimitMap {
+		stakeStrs = append(stakeStrs, fmt.Sprintf("Stake up to %v $DESO with %v",
+			formatNanosAsDESO(limit.ToBig()), describer.validator(limitKey.ValidatorPKID)))
+	}
+	addSorted(stakeStrs)
+	var unstakeStrs []string
+	for limitKey, limit := range tsl.UnstakeLimitMap {
+		unstakeStrs = append(unstakeStrs, fmt.Sprintf("Unstake up to %v $DESO from %v",
+			formatNanosAsDESO(limit.ToBig()), describer.validator(limitKey.ValidatorPKID)))
+	}
+	addSorted(unstakeStrs)
+	addSorted(humanReadableCountLimits(tsl.UnlockStakeLimitMap, describer.unlockStake))
+	return limitStrs
+}
+
+func humanReadableCountLimits[K comparable](limitMap map[K]uint64, describe func(K) string) []string {
+	var strs []string
+	for key, count := range limitMap {
+		strs = append(strs, fmt.Sprintf("Up to %d %v", count, describe(key)))
+	}
+	return strs
+}
+
+func formatNanosAsDESO(nanos *big.Int) string {
+	return FormatScaledUint256AsDecimalString(nanos, new(big.Int).SetUint64(NanosPerUnit))
+}
+
+// spendingLimitDescriber describes the keys of a TransactionSpendingLimit's maps in plain words.
+type spendingLimitDescriber struct {
+	params *DeSoParams
+	// utxoView is optional. If it's set, it's used to look up usernames.
+	utxoView *UtxoView
+}
+
+func (describer *spendingLimitDescriber) pkid(pkid PKID) string {
+	if describer.utxoView != nil {
+		profileEntry := describer.utxoView.GetProfileEntryForPKID(&pkid)
+		if profileEntry != nil && !profileEntry.isDeleted && len(profileEntry.Username) > 0 {
+			return "@" + string(profileEntry.Username)
+		}
+	}
+	return Base58CheckEncode(pkid.ToBytes(), false, describer.params)
+}
+
+func (describer *spendingLimitDescriber) publicKey(publicKey PublicKey) string {
+	if describer.utxoView != nil {
+		if pkidEntry := describer.utxoView.GetPKIDForPublicKey(publicKey.ToBytes()); pkidEntry != nil {
+			return describer.pkid(*pkidEntry.PKID)
+		}
+	}
+	return Base58CheckEncode(publicKey.ToBytes(), false, describer.params)
+}
+
+func (describer *spendingLimitDescriber) creator(pkid PKID) string {
+	if pkid.Eq(&ZeroPKID) {
+		return "any creator"
+	}
+	return describer.pkid(pkid)
+}
+
+func (describer *spendingLimitDescriber) validator(pkid PKID) string {
+	if pkid.Eq(&ZeroPKID) {
+		return "any validator"
+	}
+	return describer.pkid(pkid)
+}
+
+func (describer *spendingLimitDescriber) accessGroupName(
+	ownerPublicKey PublicKey, scopeType AccessGroupScopeType, groupKeyName GroupKeyName) string {
+
+	owner := describer.publicKey(ownerPublicKey)
+	if scopeType == AccessGroupScopeTypeAny {
+		return "any group owned by " + owner
+	}
+	return fmt.Sprintf("group %q owned by %v", string(bytes.TrimRight(groupKeyName.ToBytes(), "\x00")), owner)
+}
+
+func (describer *spendingLimitDescriber) txnCount(txnType TxnType) string {
+	return txnType.String() + " transactions"
+}
+
+func (describer *spendingLimitDescriber) creatorCoin(key CreatorCoinOperationLimitKey) string {
+	return fmt.Sprintf("creator coin operations (%v) on %v", key.Operation.ToString(), describer.creator(key.CreatorPKID))
+}
+
+func (describer *spendingLimitDescriber) daoCoin(key DAOCoinOperationLimitKey) string {
+	return fmt.Sprintf("DAO coin operations (%v) on %v", key.Operation.ToString(), describer.creator(key.CreatorPKID))
+}
+
+func (describer *spendingLimitDescriber) nft(key NFTOperationLimitKey) string {
+	var nft string
+	if key.BlockHash == ZeroBlockHash {
+		nft = "any NFT"
+	} else if key.SerialNumber == 0 {
+		nft = "any serial number of post " + hex.EncodeToString(key.BlockHash[:])
+	} else {
+		nft = fmt.Sprintf("serial number %d of post %v", key.SerialNumber, hex.EncodeToString(key.BlockHash[:]))
+	}
+	return fmt.Sprintf("NFT operations (%v) on %v", key.Operation.ToString(), nft)
+}
+
+func (describer *spendingLimitDescriber) daoCoinLimitOrder(key DAOCoinLimitOrderLimitKey) string {
+	// The ZeroPKID stands for $DESO in DAO coin limit orders.
+	coin := func(pkid PKID) string {
+		if pkid.Eq(&ZeroPKID) {
+			return "$DESO"
+		}
+		return describer.pkid(pkid)
+	}
+	return fmt.Sprintf("DAO coin limit orders buying %v and selling %v",
+		coin(key.BuyingDAOCoinCreatorPKID), coin(key.SellingDAOCoinCreatorPKID))
+}
+
+func (describer *spendingLimitDescriber) association(key AssociationLimitKey) string {
+	associationType := "any type"
+	if key.AssociationType != "" {
+		associationType = fmt.Sprintf("type %q", key.AssociationType)
+	}
+	app := "any app"
+	if key.AppScopeType != AssociationAppScopeTypeAny {
+		app = describer.pkid(key.AppPKID)
+	}
+	return fmt.Sprintf("%v association operations (%v) of %v for %v",
+		strings.ToLower(key.AssociationClass.ToString()), key.Operation.ToString(), associationType, app)
+}
+
+func (describer *spendingLimitDescriber) accessGroup(key AccessGroupLimitKey) string {
+	return fmt.Sprintf("access group operations (%v) on %v", key.OperationType.ToString(),
+		describer.accessGroupName(key.AccessGroupOwnerPublicKey, key.AccessGroupScopeType, key.AccessGroupKeyName))
+}
+
+func (describer *spendingLimitDescriber) accessGroupMember(key AccessGroupMemberLimitKey) string {
+	return fmt.Sprintf("access group member operations (%v) on %v", key.OperationType.ToString(),
+		describer.accessGroupName(key.AccessGroupOwnerPublicKey, key.AccessGroupScopeType, key.AccessGroupKeyName))
+}
+
+func (describer *spendingLimitDescriber) lockup(key LockupLimitKey) string {
+	coin := "any coin"
+	if key.ScopeType != LockupLimitScopeTypeAnyCoins {
+		coin = describer.pkid(key.ProfilePKID)
+	}
+	return fmt.Sprintf("coin lockup operations (%v) on %v", key.Operation.ToString(), coin)
+}
+
+func (describer *spendingLimitDescriber) stake(key StakeLimitKey) string {
+	return "stake with " + describer.validator(key.ValidatorPKID)
+}
+
+func (describer *spendingLimitDescriber) unstake(key StakeLimitKey) string {
+	return "unstake from " + describer.validator(key.ValidatorPKID)
+}
+
+func (describer *spendingLimitDescriber) unlockStake(key StakeLimitKey) string {
+	return "unlock stake transactions from " + describer.validator(key.ValidatorPKID)
+}
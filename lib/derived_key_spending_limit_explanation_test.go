@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/deso-protocol/uint256"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainDerivedKeySpendingLimit(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1091)
+	rand := rand.New(rand.NewSource(seed))
+	feeMin := uint64(1000)
+	feeMax := uint64(2000)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	params.ForkHeights.BalanceModelBlockHeight = 1
+	params.ForkHeights.NFTTransferOrBurnAndDerivedKeysBlockHeight = 0
+	params.ForkHeights.DerivedKeyTrackSpendingLimitsBlockHeight = 0
+	params.ForkHeights.DerivedKeySetSpendingLimitsBlockHeight = 0
+	oldPool, miner := NewTestMiner(t, chain, params, true)
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, oldPool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, oldPool)
+	require.NoError(err)
+
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	_, _, _ = _doBasicTransferWithViewFlush(t, chain, db, params, senderPkString,
+		Base58CheckEncode(m0PubBytes, false, params), senderPrivString, 200000, 11)
+
+	derivedPrivKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	blockHeight := uint64(chain.BlockTip().Height) + 1
+	makeDerivedKeyEntry := func(globalDESOLimit uint64, txnCountLimitMap map[TxnType]uint64) *DerivedKeyEntry {
+		return &DerivedKeyEntry{
+			OwnerPublicKey:   *NewPublicKey(m0PubBytes),
+			DerivedPublicKey: *NewPublicKey(derivedPrivKey.PubKey().SerializeCompressed()),
+			ExpirationBlock:  blockHeight + 100,
+			OperationType:    AuthorizeDerivedKeyOperationValid,
+			TransactionSpendingLimitTracker: &TransactionSpendingLimit{
+				GlobalDESOLimit:          globalDESOLimit,
+				TransactionCountLimitMap: txnCountLimitMap,
+			},
+		}
+	}
+	view, err := chain.GetUncommittedTipView()
+	require.NoError(err)
+	explain := func(derivedKeyEntry *DerivedKeyEntry, txn *MsgDeSoTxn) *DerivedKeySpendingLimitExplanation {
+		explanation, err := ExplainDerivedKeySpendingLimit(view, derivedKeyEntry, txn, blockHeight, 0)
+		require.NoError(err)
+		return explanation
+	}
+
+	// m0 sends 1000 nanos to m1, which spends the amount plus the fee.
+	txn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 1000}})
+	spendAmount := 1000 + txn.TxnFeeNanos
+
+	// A derived key with enough of both limits uses up part of each.
+	explanation := explain(makeDerivedKeyEntry(100000, map[TxnType]uint64{TxnTypeBasicTransfer: 2}), txn)
+	require.NoError(explanation.Err)
+	require.Empty(explanation.FailedLimit)
+	require.Equal([]DerivedKeySpendingLimitName{
+		DerivedKeySpendingLimitGlobalDESO, DerivedKeySpendingLimitTransactionCount,
+	}, explanation.ApplicableLimits)
+	require.Equal([]*DerivedKeySpendingLimitChange{
+		{
+			Limit:     DerivedKeySpendingLimitGlobalDESO,
+			Before:    uint256.NewInt(100000),
+			Decrement: uint256.NewInt(spendAmount),
+		},
+		{
+			Limit:     DerivedKeySpendingLimitTransactionCount,
+			Key:       "BASIC_TRANSFER transactions",
+			Before:    uint256.NewInt(2),
+			Decrement: uint256.NewInt(1),
+		},
+	}, explanation.Changes)
+
+	// Spending more than the GlobalDESOLimit is blamed on it, and the explanation says how much would be spent.
+	explanation = explain(makeDerivedKeyEntry(500, map[TxnType]uint64{TxnTypeBasicTransfer: 2}), txn)
+	require.Error(explanation.Err)
+	require.Equal(DerivedKeySpendingLimitGlobalDESO, explanation.FailedLimit)
+	require.Equal(2, len(explanation.Changes))
+	require.Equal(uint256.NewInt(500), explanation.Changes[0].Before)
+	require.Equal(uint256.NewInt(spendAmount), explanation.Changes[0].Decrement)
+
+	// A derived key that isn't allowed to send basic transfers is blocked by the TransactionCountLimitMap.
+	explanation = explain(makeDerivedKeyEntry(100000, map[TxnType]uint64{TxnTypeSubmitPost: 2}), txn)
+	require.Error(explanation.Err)
+	require.Equal(DerivedKeySpendingLimitTransactionCount, explanation.FailedLimit)
+	require.Empty(explanation.Changes)
+
+	// Failures that the owner would hit too aren't blamed on the derived key's limits.
+	overspendTxn := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 1000000}})
+	explanation = explain(makeDerivedKeyEntry(10000000, map[TxnType]uint64{TxnTypeBasicTransfer: 2}), overspendTxn)
+	require.Error(explanation.Err)
+	require.Empty(explanation.FailedLimit)
+
+	// Expired derived keys can't be used at all.
+	expiredEntry := makeDerivedKeyEntry(100000, map[TxnType]uint64{TxnTypeBasicTransfer: 2})
+	expiredEntry.ExpirationBlock = blockHeight
+	explanation = explain(expiredEntry, txn)
+	require.Error(explanation.Err)
+	require.Empty(explanation.Changes)
+
+	// Unlimited derived keys aren't checked against any limits.
+	unlimitedEntry := makeDerivedKeyEntry(0, nil)
+	unlimitedEntry.TransactionSpendingLimitTracker.IsUnlimited = true
+	explanation = explain(unlimitedEntry, txn)
+	require.NoError(explanation.Err)
+	require.True(explanation.IsUnlimited)
+	require.Empty(explanation.ApplicableLimits)
+	require.Empty(explanation.Changes)
+
+	// An unlimited derived key can't re-authorize itself with an invalid access signature, although the owner can.
+	// The failure has nothing to do with spending limits, so none is blamed.
+	unlimitedLimitBytes, err := (&TransactionSpendingLimit{IsUnlimited: true}).ToBytes(blockHeight)
+	require.NoError(err)
+	authorizeTxn, _, _, _, err := chain.CreateAuthorizeDerivedKeyTxn(m0PubBytes,
+		derivedPrivKey.PubKey().SerializeCompressed(), blockHeight+100, []byte{1, 2, 3}, false, false, nil, nil,
+		hex.EncodeToString(unlimitedLimitBytes), 100, oldPool, nil)
+	require.NoError(err)
+	explanation = explain(unlimitedEntry, authorizeTxn)
+	require.Error(explanation.Err)
+	require.Equal(RuleErrorAuthorizeDerivedKeyAccessSignatureNotValid, errors.Cause(explanation.Err))
+	require.True(explanation.IsUnlimited)
+	require.Empty(explanation.FailedLimit)
+	require.Empty(explanation.Changes)
+
+	// Explaining doesn't touch the view.
+	require.Nil(view.GetDerivedKeyMappingForOwner(m0PubBytes, derivedPrivKey.PubKey().SerializeCompressed()))
+
+	// Txns can only be explained for the derived key's owner.
+	m1Txn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 0)
+	_, err = ExplainDerivedKeySpendingLimit(view, makeDerivedKeyEntry(100000, nil), m1Txn, blockHeight, 0)
+	require.Error(err)
+}
+
+func TestTransactionSpendingLimitToHumanReadableStrings(t *testing.T) {
+	require := require.New(t)
+	params := &DeSoTestnetParams
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m0PKID := *NewPKID(m0PubBytes)
+
+	tsl := &TransactionSpendingLimit{
+		GlobalDESOLimit: 1500000000,
+		TransactionCountLimitMap: map[TxnType]uint64{
+			TxnTypeSubmitPost: 5,
+			TxnTypeFollow:     2,
+		},
+		CreatorCoinOperationLimitMap: map[CreatorCoinOperationLimitKey]uint64{
+			MakeCreatorCoinOperationLimitKey(ZeroPKID, BuyCreatorCoinOperation): 3,
+		},
+		NFTOperationLimitMap: map[NFTOperationLimitKey]uint64{
+			MakeNFTOperationLimitKey(ZeroBlockHash, 0, AnyNFTOperation): 1,
+		},
+		DAOCoinLimitOrderLimitMap: map[DAOCoinLimitOrderLimitKey]uint64{
+			MakeDAOCoinLimitOrderLimitKey(m0PKID, ZeroPKID): 4,
+		},
+		StakeLimitMap: map[StakeLimitKey]*uint256.Int{
+			MakeStakeLimitKey(&ZeroPKID): uint256.NewInt(2000000000),
+		},
+	}
+	require.Equal([]string{
+		"Spend up to 1.5 $DESO, including transaction fees",
+		"Up to 2 FOLLOW transactions",
+		"Up to 5 SUBMIT_POST transactions",
+		"Up to 3 creator coin operations (buy) on any creator",
+		"Up to 1 NFT operations (any) on any NFT",
+		"Up to 4 DAO coin limit orders buying " + m0Pub + " and selling $DESO",
+		"Stake up to 2.0 $DESO with any validator",
+	}, tsl.ToHumanReadableStrings(params, nil))
+
+	tsl.IsUnlimited = true
+	require.Equal([]string{"Unlimited: any transaction, with no limit on the amount of $DESO spent"},
+		tsl.ToHumanReadableStrings(params, nil))
+}
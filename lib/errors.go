@@ -569,6 +569,11 @@ const (
 	RuleErrorAtomicTxnsHasNonAtomicInnerTxn                  RuleError = "RuleErrorAtomicTxnsHasNonAtomicInnerTxn"
 	RuleErrorAtomicTxnsHasBrokenChain                        RuleError = "RuleErrorAtomicTxnsHasBrokenChain"
 
+	// Scheduled Transactions
+	RuleErrorInvalidMinInclusionBlockHeight       RuleError = "RuleErrorInvalidMinInclusionBlockHeight"
+	RuleErrorTxnBeforeMinInclusionBlockHeight     RuleError = "RuleErrorTxnBeforeMinInclusionBlockHeight"
+	RuleErrorNonceExpiresBeforeMinInclusionHeight RuleError = "RuleErrorNonceExpiresBeforeMinInclusionHeight"
+
 	HeaderErrorDuplicateHeader                                                   RuleError = "HeaderErrorDuplicateHeader"
 	HeaderErrorNilPrevHash                                                       RuleError = "HeaderErrorNilPrevHash"
 	HeaderErrorInvalidParent                                                     RuleError = "HeaderErrorInvalidParent"
@@ -592,8 +597,12 @@ const (
 	TxErrorNoNonceAfterBalanceModelBlockHeight      RuleError = "TxErrorNoNonceAfterBalanceModelBlockHeight"
 
 	// Mempool
-	MempoolErrorNotRunning          RuleError = "MempoolErrorNotRunning"
-	MempoolFailedReplaceByHigherFee RuleError = "MempoolFailedReplaceByHigherFee"
+	MempoolErrorNotRunning             RuleError = "MempoolErrorNotRunning"
+	MempoolFailedReplaceByHigherFee    RuleError = "MempoolFailedReplaceByHigherFee"
+	MempoolErrorInvalidPackage         RuleError = "MempoolErrorInvalidPackage"
+	MempoolErrorPackageTooLarge        RuleError = "MempoolErrorPackageTooLarge"
+	MempoolErrorPublicKeyLimitExceeded RuleError = "MempoolErrorPublicKeyLimitExceeded"
+	MempoolErrorScheduledTxnNotAllowed RuleError = "MempoolErrorScheduledTxnNotAllowed"
 )
 
 func (e RuleError) Error() string {
@@ -243,6 +243,10 @@ func (mp *DeSoMempool) AddTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) e
 	return errors.New("Not implemented")
 }
 
+func (mp *DeSoMempool) AddTransactionPackage(txns []*MsgDeSoTxn, txnTimestamp time.Time) error {
+	return errors.New("Not implemented")
+}
+
 func (mp *DeSoMempool) RemoveTransaction(txnHash *BlockHash) error {
 	return errors.New("Not implemented")
 }
@@ -259,6 +263,10 @@ func (mp *DeSoMempool) GetTransactions() []*MempoolTx {
 	return mp.GetOrderedTransactions()
 }
 
+func (mp *DeSoMempool) GetPackageParentHash(txnHash *BlockHash) *BlockHash {
+	return nil
+}
+
 func (mp *DeSoMempool) UpdateLatestBlock(blockView *UtxoView, blockHeight uint64) {
 	//TODO implement me
 	panic("implement me")
@@ -2533,6 +2541,22 @@ func (mp *DeSoMempool) EstimateFeeRate(minFeeRateNanosPerKB uint64) uint64 {
 	return minFeeRateNanosPerKB
 }
 
+// EstimateFeeRateForTarget is not supported by the legacy mempool, which doesn't track inclusion latencies. It
+// returns the same fee rate as EstimateFeeRate.
+func (mp *DeSoMempool) EstimateFeeRateForTarget(targetBlocks uint64, confidenceBasisPoints uint64) (uint64, error) {
+	return mp.EstimateFeeRate(0), nil
+}
+
+func (mp *DeSoMempool) GetFeeRateHistogram() []*FeeRateHistogramBucket {
+	return []*FeeRateHistogramBucket{}
+}
+
+// Subscribe is not supported by the legacy mempool. The returned subscription never receives any events and is
+// only closed by Unsubscribe.
+func (mp *DeSoMempool) Subscribe(bufferSize int) *MempoolSubscription {
+	return newMempoolSubscriptionManager().subscribe(bufferSize)
+}
+
 func convertMempoolTxsToSummaryStats(mempoolTxs []*MempoolTx) map[string]*SummaryStats {
 	transactionSummaryStats := make(map[string]*SummaryStats)
 	for _, mempoolTx := range mempoolTxs {
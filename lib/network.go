@@ -108,7 +108,21 @@ const (
 	MsgTypeValidatorVote    MsgType = 20
 	MsgTypeValidatorTimeout MsgType = 21
 
-	// NEXT_TAG = 23
+	// Proof of stake compact block relay messages. A MsgTypeCompactBlock carries a block's header and short
+	// IDs for its txns, and MsgTypeGetBlockTxns and MsgTypeBlockTxns fetch the txns missing from our mempool.
+	MsgTypeCompactBlock MsgType = 23
+	MsgTypeGetBlockTxns MsgType = 24
+	MsgTypeBlockTxns    MsgType = 25
+
+	// MsgTypeCompressed wraps a compressed message. It's only sent to peers that negotiated SFMessageCompression.
+	MsgTypeCompressed MsgType = 26
+
+	// Proof of stake checkpoint messages. A MsgTypeCheckpoint carries a peer's committed tip along with the QC
+	// proving that it's committed, and is sent in response to a MsgTypeGetCheckpoint.
+	MsgTypeGetCheckpoint MsgType = 27
+	MsgTypeCheckpoint    MsgType = 28
+
+	// NEXT_TAG = 29
 
 	// Below are control messages used to signal to the Server from other parts of
 	// the code but not actually sent among peers.
@@ -122,8 +136,9 @@ const (
 	MsgTypeBitcoinManagerUpdate  MsgType = ControlMessagesStart + 3 // Deprecated
 	MsgTypePeerHandshakeComplete MsgType = ControlMessagesStart + 4
 	MsgTypeNewConnection         MsgType = ControlMessagesStart + 5
+	MsgTypeCompactBlockTimeout   MsgType = ControlMessagesStart + 7
 
-	// NEXT_TAG = 7
+	// NEXT_TAG = 8
 )
 
 // IsControlMessage is used by functions to determine whether a particular message
@@ -191,10 +206,24 @@ func (msgType MsgType) String() string {
 		return "PEER_HANDSHAKE_COMPLETE"
 	case MsgTypeNewConnection:
 		return "NEW_CONNECTION"
+	case MsgTypeCompactBlockTimeout:
+		return "COMPACT_BLOCK_TIMEOUT"
 	case MsgTypeGetSnapshot:
 		return "GET_SNAPSHOT"
 	case MsgTypeSnapshotData:
 		return "SNAPSHOT_DATA"
+	case MsgTypeCompactBlock:
+		return "COMPACT_BLOCK"
+	case MsgTypeGetBlockTxns:
+		return "GET_BLOCK_TXNS"
+	case MsgTypeBlockTxns:
+		return "BLOCK_TXNS"
+	case MsgTypeCompressed:
+		return "COMPRESSED"
+	case MsgTypeGetCheckpoint:
+		return "GET_CHECKPOINT"
+	case MsgTypeCheckpoint:
+		return "CHECKPOINT"
 	default:
 		return fmt.Sprintf("UNRECOGNIZED(%d) - make sure String() is up to date", msgType)
 	}
@@ -833,6 +862,18 @@ func NewMessage(msgType MsgType) DeSoMessage {
 		return &MsgDeSoGetSnapshot{}
 	case MsgTypeSnapshotData:
 		return &MsgDeSoSnapshotData{}
+	case MsgTypeCompactBlock:
+		return &MsgDeSoCompactBlock{}
+	case MsgTypeGetBlockTxns:
+		return &MsgDeSoGetBlockTxns{}
+	case MsgTypeBlockTxns:
+		return &MsgDeSoBlockTxns{}
+	case MsgTypeCompressed:
+		return &MsgDeSoCompressed{}
+	case MsgTypeGetCheckpoint:
+		return &MsgDeSoGetCheckpoint{}
+	case MsgTypeCheckpoint:
+		return &MsgDeSoCheckpoint{}
 	default:
 		{
 			return nil
@@ -902,6 +943,28 @@ func (msg *MsgDeSoNewConnection) FromBytes(data []byte) error {
 	return fmt.Errorf("MsgDeSoNewConnection.FromBytes not implemented")
 }
 
+// MsgDeSoCompactBlockTimeout is sent to the Server once a compact block has waited CompactBlockTxnsTimeout for the
+// missing txns that we requested from the peer.
+type MsgDeSoCompactBlockTimeout struct {
+	BlockHash *BlockHash
+
+	// reconstruction is the pending compact block that timed out. It's used to tell it apart from a later compact
+	// block for the same hash.
+	reconstruction *compactBlockReconstruction
+}
+
+func (msg *MsgDeSoCompactBlockTimeout) GetMsgType() MsgType {
+	return MsgTypeCompactBlockTimeout
+}
+
+func (msg *MsgDeSoCompactBlockTimeout) ToBytes(preSignature bool) ([]byte, error) {
+	return nil, fmt.Errorf("MsgDeSoCompactBlockTimeout.ToBytes: Not implemented")
+}
+
+func (msg *MsgDeSoCompactBlockTimeout) FromBytes(data []byte) error {
+	return fmt.Errorf("MsgDeSoCompactBlockTimeout.FromBytes not implemented")
+}
+
 // ==================================================================
 // GET_HEADERS message
 // ==================================================================
@@ -1667,6 +1730,18 @@ const (
 	SFArchivalNode ServiceFlag = 1 << 2
 	// SFPosValidator is a flag used to indicate that the peer is running a PoS validator.
 	SFPosValidator ServiceFlag = 1 << 3
+	// SFEncryptedTransport is a flag used to indicate that the peer supports the encrypted transport. A node that
+	// sets this flag must also send an ephemeral TransportPublicKey in its version message.
+	SFEncryptedTransport ServiceFlag = 1 << 4
+	// SFCompactBlocks is a flag used to indicate that the peer supports compact block relay. PoS blocks are only
+	// relayed as compact blocks to peers that set this flag.
+	SFCompactBlocks ServiceFlag = 1 << 5
+	// SFMessageCompression is a flag used to indicate that the peer supports message compression. Large messages,
+	// such as snapshot chunks and block bundles, are compressed if both peers set this flag.
+	SFMessageCompression ServiceFlag = 1 << 6
+	// SFCheckpoints is a flag used to indicate that the peer serves checkpoints for its committed tip. Syncing nodes
+	// only request checkpoints from peers that set this flag.
+	SFCheckpoints ServiceFlag = 1 << 7
 )
 
 func (sf ServiceFlag) HasService(serviceFlag ServiceFlag) bool {
@@ -1701,6 +1776,12 @@ type MsgDeSoVersion struct {
 	// MinFeeRateNanosPerKB is the minimum feerate that a peer will
 	// accept from other peers when validating transactions.
 	MinFeeRateNanosPerKB uint64
+
+	// TransportPublicKey is the ephemeral X25519 public key used to
+	// negotiate the encrypted transport. It's only set by nodes that
+	// advertise SFEncryptedTransport, and it's appended to the end of
+	// the message so that older nodes simply ignore it.
+	TransportPublicKey []byte
 }
 
 func (msg *MsgDeSoVersion) ToBytes(preSignature bool) ([]byte, error) {
@@ -1737,6 +1818,11 @@ func (msg *MsgDeSoVersion) ToBytes(preSignature bool) ([]byte, error) {
 	// JSONAPIPort - deprecated
 	retBytes = append(retBytes, UintToBuf(uint64(0))...)
 
+	// TransportPublicKey
+	if len(msg.TransportPublicKey) > 0 {
+		retBytes = append(retBytes, EncodeByteArray(msg.TransportPublicKey)...)
+	}
+
 	return retBytes, nil
 }
 
@@ -1832,6 +1918,18 @@ func (msg *MsgDeSoVersion) FromBytes(data []byte) error {
 		}
 	}
 
+	// TransportPublicKey
+	//
+	// Version messages from nodes that don't support the encrypted
+	// transport end after the JSONAPIPort.
+	if rr.Len() > 0 {
+		transportPublicKey, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoVersion.FromBytes: Problem reading msg.TransportPublicKey")
+		}
+		retVer.TransportPublicKey = transportPublicKey
+	}
+
 	*msg = retVer
 	return nil
 }
@@ -50,9 +50,14 @@ type NetworkManager struct {
 	cmgr     *ConnectionManager
 	keystore *BLSKeystore
 
+	// banManager keeps track of the ban scores of misbehaving peers, and the IPs and validator keys that are banned.
+	banManager *PeerBanManager
+
 	// configs
 	minTxFeeRateNanosPerKB uint64
 	nodeServices           ServiceFlag
+	// requireEncryptedValidatorTransport is passed to every RemoteNode. See RemoteNode.requireEncryptedValidatorTransport.
+	requireEncryptedValidatorTransport bool
 
 	// Used to set remote node ids. Must be incremented atomically.
 	remoteNodeNextId uint64
@@ -120,6 +125,8 @@ func NewNetworkManager(
 	peerConnectionRefreshIntervalMillis uint64,
 	minTxFeeRateNanosPerKB uint64,
 	nodeServices ServiceFlag,
+	requireEncryptedValidatorTransport bool,
+	banManager *PeerBanManager,
 ) *NetworkManager {
 
 	return &NetworkManager{
@@ -128,9 +135,11 @@ func NewNetworkManager(
 		bc:                                    bc,
 		cmgr:                                  cmgr,
 		keystore:                              blsKeystore,
+		banManager:                            banManager,
 		AddrMgr:                               addrMgr,
 		minTxFeeRateNanosPerKB:                minTxFeeRateNanosPerKB,
 		nodeServices:                          nodeServices,
+		requireEncryptedValidatorTransport:    requireEncryptedValidatorTransport,
 		AllRemoteNodes:                        collections.NewConcurrentMap[RemoteNodeId, *RemoteNode](),
 		ValidatorInboundIndex:                 collections.NewConcurrentMap[bls.SerializedPublicKey, *RemoteNode](),
 		ValidatorOutboundIndex:                collections.NewConcurrentMap[bls.SerializedPublicKey, *RemoteNode](),
@@ -385,6 +394,12 @@ func (nm *NetworkManager) processInboundConnection(conn Connection) (*RemoteNode
 			"ConvertIPStringToNetAddress for addr: (%s)", ic.connection.RemoteAddr().String())
 	}
 
+	// Reject connections from banned IP addresses.
+	if nm.banManager.IsIPBanned(na.ToLegacy().IP) {
+		return nil, fmt.Errorf("NetworkManager.handleInboundConnection: Rejecting INBOUND peer (%s) because "+
+			"its IP address is banned", ic.connection.RemoteAddr().String())
+	}
+
 	remoteNode, err := nm.AttachInboundConnection(ic.connection, na)
 	if remoteNode == nil || err != nil {
 		return nil, errors.Wrapf(err, "NetworkManager.handleInboundConnection: Problem calling "+
@@ -435,6 +450,13 @@ func (nm *NetworkManager) processOutboundConnection(conn Connection) (*RemoteNod
 	// If we get here, it means we're dealing with a non-persistent or non-validator remote node. We perform additional
 	// connection validation.
 
+	// We don't connect to banned IP addresses. The address manager may still hand them out, and the address may have
+	// been banned since we started dialing it.
+	if nm.banManager.IsIPBanned(na.ToLegacy().IP) {
+		return nil, fmt.Errorf("NetworkManager.handleOutboundConnection: Rejecting OUTBOUND NON-PERSISTENT "+
+			"connection to banned IP address (%s)", oc.connection.RemoteAddr().String())
+	}
+
 	// If the group key overlaps with another peer we're already connected to then abort mission. We only connect to
 	// one peer per IP group in order to prevent Sybil attacks.
 	if nm.cmgr.IsFromRedundantOutboundIPAddress(oc.address) {
@@ -595,6 +617,11 @@ func (nm *NetworkManager) connectValidators() {
 			continue
 		}
 
+		// If the validator is banned, continue.
+		if nm.banManager.IsValidatorBanned(publicKey) {
+			continue
+		}
+
 		// For now, we only dial the first domain in the validator's domain list.
 		if len(validator.GetDomains()) == 0 {
 			continue
@@ -812,6 +839,10 @@ func (nm *NetworkManager) getRandomUnconnectedAddress() *wire.NetAddressV2 {
 			continue
 		}
 
+		if nm.banManager.IsIPBanned(addr.NetAddress().ToLegacy().IP) {
+			continue
+		}
+
 		return addr.NetAddress()
 	}
 
@@ -950,6 +981,7 @@ func (nm *NetworkManager) newRemoteNode(validatorPublicKey *bls.PublicKey, isOut
 		nm.minTxFeeRateNanosPerKB,
 		latestBlockHeight,
 		nm.nodeServices,
+		nm.requireEncryptedValidatorTransport,
 	)
 }
 
@@ -1055,6 +1087,11 @@ func (nm *NetworkManager) Cleanup() {
 			nm.Disconnect(rn, "cleanup")
 		}
 	}
+
+	// Forget the ban scores that have decayed or that belong to peers we're no longer connected to.
+	if numRemoved := nm.banManager.SweepScores(nm.isBanKeyConnected); numRemoved > 0 {
+		glog.V(2).Infof("NetworkManager.Cleanup: Removed %d ban scores", numRemoved)
+	}
 }
 
 // ###########################
@@ -1284,6 +1321,11 @@ func (nm *NetworkManager) handleHandshakeCompletePoSMessage(remoteNode *RemoteNo
 		return nil
 	}
 
+	// We don't keep connections to banned validators, unless the node operator explicitly asked for them.
+	if !remoteNode.IsPersistent() && nm.banManager.IsValidatorBanned(validatorPk) {
+		return fmt.Errorf("NetworkManager.handleHandshakeCompletePoSMessage: Validator public key is banned")
+	}
+
 	// For inbound RemoteNodes, we should ensure that there isn't an existing validator connected with the same public key.
 	// Inbound nodes are not initiated by us, so we shouldn't have added the RemoteNode to the ValidatorInboundIndex yet.
 	if remoteNode.IsInbound() {
@@ -1315,6 +1357,102 @@ func (nm *NetworkManager) handleHandshakeCompletePoSMessage(remoteNode *RemoteNo
 	return nil
 }
 
+// ###########################
+// ## Peer Bans
+// ###########################
+
+// Misbehaving adds the misbehavior's penalty to the ban scores of the peer's IP address and, if the peer is a
+// validator, of its validator public key. If either ban score reaches the ban threshold, the IP or validator key is
+// banned and all remote nodes matching it are disconnected. Persistent remote nodes are never penalized, since they
+// were explicitly configured by the node operator. The caller is responsible for disconnecting the peer itself.
+func (nm *NetworkManager) Misbehaving(peer *Peer, misbehavior PeerMisbehavior, reason string) {
+	rn := nm.GetRemoteNodeFromPeer(peer)
+	if rn == nil || rn.IsPersistent() {
+		return
+	}
+	reason = fmt.Sprintf("%v: %v", misbehavior, reason)
+	glog.V(1).Infof("NetworkManager.Misbehaving: Penalizing peer (id= %v) for %v", rn.GetId(), reason)
+
+	if netAddr := peer.NetAddress(); netAddr != nil {
+		nm.addPenalty(PeerBanKeyTypeIP, netAddr.ToLegacy().IP.String(), misbehavior.Penalty(), reason)
+	}
+	if validatorPk := rn.GetValidatorPublicKey(); validatorPk != nil {
+		nm.addPenalty(PeerBanKeyTypeValidator, validatorPk.ToString(), misbehavior.Penalty(), reason)
+	}
+}
+
+func (nm *NetworkManager) addPenalty(keyType PeerBanKeyType, key string, penalty uint64, reason string) {
+	banned, err := nm.banManager.AddPenalty(keyType, key, penalty, reason)
+	if err != nil {
+		glog.Errorf("NetworkManager.addPenalty: Problem adding penalty for %v %v: %v", keyType, key, err)
+	}
+	if banned {
+		nm.disconnectBanned(keyType, key)
+	}
+}
+
+// BanPeer bans the IP address or validator public key for the given duration, and disconnects all remote nodes
+// matching it, including persistent ones.
+func (nm *NetworkManager) BanPeer(keyType PeerBanKeyType, key string, duration time.Duration, reason string) error {
+	if err := nm.banManager.Ban(keyType, key, duration, reason); err != nil {
+		return errors.Wrapf(err, "NetworkManager.BanPeer: ")
+	}
+	nm.disconnectBanned(keyType, key)
+	return nil
+}
+
+// UnbanPeer removes the IP address or validator public key from the ban list. It returns true if it was banned.
+func (nm *NetworkManager) UnbanPeer(keyType PeerBanKeyType, key string) (bool, error) {
+	unbanned, err := nm.banManager.Unban(keyType, key)
+	if err != nil {
+		return unbanned, errors.Wrapf(err, "NetworkManager.UnbanPeer: ")
+	}
+	return unbanned, nil
+}
+
+// GetPeerBans returns the active bans.
+func (nm *NetworkManager) GetPeerBans() []*PeerBanEntry {
+	return nm.banManager.GetBans()
+}
+
+// disconnectBanned disconnects all remote nodes whose IP address or validator public key matches the banned key.
+func (nm *NetworkManager) disconnectBanned(keyType PeerBanKeyType, key string) {
+	for _, rn := range nm.GetAllRemoteNodes().GetAll() {
+		if !nm.remoteNodeMatchesBanKey(rn, keyType, key) {
+			continue
+		}
+		nm.Disconnect(rn, fmt.Sprintf("banned %v %v", keyType, key))
+	}
+}
+
+// isBanKeyConnected returns true if any remote node's IP address or validator public key matches the key.
+func (nm *NetworkManager) isBanKeyConnected(keyType PeerBanKeyType, key string) bool {
+	for _, rn := range nm.GetAllRemoteNodes().GetAll() {
+		if nm.remoteNodeMatchesBanKey(rn, keyType, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (nm *NetworkManager) remoteNodeMatchesBanKey(rn *RemoteNode, keyType PeerBanKeyType, key string) bool {
+	switch keyType {
+	case PeerBanKeyTypeIP:
+		peer := rn.GetPeer()
+		if peer == nil || peer.NetAddress() == nil {
+			return false
+		}
+		bannedIP := net.ParseIP(key)
+		return bannedIP != nil && bannedIP.Equal(peer.NetAddress().ToLegacy().IP)
+	case PeerBanKeyTypeValidator:
+		validatorPk := rn.GetValidatorPublicKey()
+		bannedPk, err := (&bls.PublicKey{}).FromString(key)
+		return validatorPk != nil && err == nil && bannedPk != nil && validatorPk.Eq(bannedPk)
+	default:
+		return false
+	}
+}
+
 // ###########################
 // ## Helper Functions
 // ###########################
@@ -64,7 +64,22 @@ func TestVersionConversion(t *testing.T) {
 		assert.Equal(expectedVer, testVer)
 	}
 
-	assert.Equalf(7, reflect.TypeOf(expectedVer).Elem().NumField(),
+	// The TransportPublicKey is only encoded when it's set.
+	{
+		expectedVerWithTransportKey := *expectedVer
+		expectedVerWithTransportKey.Services |= SFEncryptedTransport
+		expectedVerWithTransportKey.TransportPublicKey = bytes.Repeat([]byte{7}, PeerTransportPublicKeyLen)
+		data, err := expectedVerWithTransportKey.ToBytes(false)
+		assert.NoError(err)
+
+		testVer := NewMessage(MsgTypeVersion)
+		err = testVer.FromBytes(data)
+		assert.NoError(err)
+
+		assert.Equal(&expectedVerWithTransportKey, testVer)
+	}
+
+	assert.Equalf(8, reflect.TypeOf(expectedVer).Elem().NumField(),
 		"Number of fields in VERSION message is different from expected. "+
 			"Did you add a new field? If so, make sure the serialization code "+
 			"works, add the new field to the test case, and fix this error.")
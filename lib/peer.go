@@ -127,6 +127,14 @@ type Peer struct {
 
 	requestedBlocks map[BlockHash]bool
 
+	// pendingCompactBlocks holds the compact blocks we've received from this peer that are waiting for the
+	// missing txns we've requested. It's only accessed from the Server's message handling goroutine.
+	pendingCompactBlocks map[BlockHash]*compactBlockReconstruction
+
+	// checkpointRequestInFlight is true if we've sent the peer a GetCheckpoint message that it hasn't responded to
+	// yet. It's only accessed from the Server's message handling goroutine.
+	checkpointRequestInFlight bool
+
 	// We will only allow peer fetch one snapshot chunk at a time so we will keep
 	// track whether this peer has a get snapshot request in flight.
 	snapshotChunkRequestInFlight bool
@@ -137,6 +145,16 @@ type Peer struct {
 
 	// startGroup ensures that all the Peer's go routines are started when we call Start().
 	startGroup sync.WaitGroup
+
+	// transport is the state of the encrypted transport with the peer. It's nil if our node doesn't support the
+	// encrypted transport, in which case all messages are sent in plaintext.
+	transport *peerTransport
+
+	// messageCompression is true if our node supports message compression, in which case we accept compressed
+	// messages from the peer. compressMessages is set once the peer negotiates compression during the handshake,
+	// at which point we start compressing the large messages we send it.
+	messageCompression bool
+	compressMessages   int32
 }
 
 func (pp *Peer) GetId() uint64 {
@@ -417,7 +435,8 @@ func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
 				// GetHeaders request.
 				glog.Errorf("Server._handleGetBlocks: Disconnecting peer %v because "+
 					"she asked for a block with hash %v that we don't have", pp, msg.HashList[0])
-				pp.Disconnect("handleGetBlocks - requested block with hash we don't have. protocolV2")
+				pp.Misbehaving(PeerMisbehaviorInvalidBlockRequest,
+					"handleGetBlocks - requested block with hash we don't have. protocolV2")
 				return
 			}
 			allBlocks.Blocks = append(allBlocks.Blocks, blockToSend)
@@ -446,7 +465,8 @@ func (pp *Peer) HandleGetBlocks(msg *MsgDeSoGetBlocks) {
 				// GetHeaders request.
 				glog.Errorf("Server._handleGetBlocks: Disconnecting peer %v because "+
 					"she asked for a block with hash %v that we don't have", pp, msg.HashList[0])
-				pp.Disconnect("handleGetBlocks - requested block with hash we don't have. protocol < v2")
+				pp.Misbehaving(PeerMisbehaviorInvalidBlockRequest,
+					"handleGetBlocks - requested block with hash we don't have. protocol < v2")
 				return
 			}
 			pp.AddDeSoMessage(blockToSend, false)
@@ -662,6 +682,7 @@ func NewPeer(_id uint64, _conn net.Conn, _isOutbound bool, _netAddr *wire.NetAdd
 		Params:                 params,
 		MessageChan:            messageChan,
 		requestedBlocks:        make(map[BlockHash]bool),
+		pendingCompactBlocks:   make(map[BlockHash]*compactBlockReconstruction),
 		syncType:               _syncType,
 	}
 
@@ -958,6 +979,53 @@ func (pp *Peer) SetNegotiatedProtocolVersion(negotiatedProtocolVersion ProtocolV
 	pp.NegotiatedProtocolVersion = negotiatedProtocolVersion
 }
 
+// EnableEncryptedTransport makes the Peer negotiate the encrypted transport during the handshake. It must be called
+// before the Peer is started.
+func (pp *Peer) EnableEncryptedTransport() error {
+	transport, err := newPeerTransport(pp.isOutbound)
+	if err != nil {
+		return errors.Wrapf(err, "Peer.EnableEncryptedTransport: ")
+	}
+	pp.transport = transport
+	return nil
+}
+
+// GetTransportPublicKey returns the ephemeral public key to send in our version message, or nil if the encrypted
+// transport isn't enabled.
+func (pp *Peer) GetTransportPublicKey() []byte {
+	if pp.transport == nil {
+		return nil
+	}
+	return pp.transport.GetPublicKey()
+}
+
+// GetTransportSessionBinding returns the session binding of the encrypted transport, and whether the encrypted
+// transport was negotiated with the peer. The result is only meaningful after the peer's version message is read.
+func (pp *Peer) GetTransportSessionBinding() ([]byte, bool) {
+	if pp.transport == nil {
+		return nil, false
+	}
+	return pp.transport.GetSessionBinding()
+}
+
+// EnableMessageCompression makes the Peer accept compressed messages. It must be called before the Peer is started.
+func (pp *Peer) EnableMessageCompression() {
+	pp.messageCompression = true
+}
+
+// StartCompressingMessages makes the Peer compress the large messages it sends. It's called once the peer
+// negotiates message compression during the handshake.
+func (pp *Peer) StartCompressingMessages() {
+	if pp.messageCompression {
+		atomic.StoreInt32(&pp.compressMessages, 1)
+	}
+}
+
+// IsCompressingMessages returns true if the Peer compresses the large messages it sends.
+func (pp *Peer) IsCompressingMessages() bool {
+	return atomic.LoadInt32(&pp.compressMessages) != 0
+}
+
 func (pp *Peer) outHandler() {
 	pp.startGroup.Done()
 	glog.V(1).Infof("Peer.outHandler: Starting outHandler for Peer %v", pp)
@@ -1212,6 +1280,7 @@ out:
 		// blocks now.
 		if err := pp._maybeAddBlocksToSend(rmsg); err != nil {
 			glog.Errorf(err.Error())
+			pp.Misbehaving(PeerMisbehaviorInvalidBlockRequest, "inHandler - requested too many blocks")
 			break out
 		}
 
@@ -1307,7 +1376,25 @@ func (pp *Peer) IsSyncCandidate() bool {
 }
 
 func (pp *Peer) WriteDeSoMessage(msg DeSoMessage) error {
-	payload, err := WriteMessage(pp.Conn, msg, pp.Params.NetworkType)
+	// Large messages are compressed if the peer negotiated compression.
+	wireMsg := msg
+	if pp.IsCompressingMessages() {
+		compressedMsg, err := CompressMessage(msg)
+		if err != nil {
+			return errors.Wrapf(err, "WriteDeSoMessage: ")
+		}
+		if compressedMsg != nil {
+			wireMsg = compressedMsg
+		}
+	}
+
+	var payload []byte
+	var err error
+	if pp.transport != nil {
+		payload, err = pp.transport.WriteMessage(pp.Conn, wireMsg, pp.Params.NetworkType)
+	} else {
+		payload, err = WriteMessage(pp.Conn, wireMsg, pp.Params.NetworkType)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "WriteDeSoMessage: ")
 	}
@@ -1326,13 +1413,35 @@ func (pp *Peer) WriteDeSoMessage(msg DeSoMessage) error {
 }
 
 func (pp *Peer) ReadDeSoMessage() (DeSoMessage, error) {
-	msg, payload, err := ReadMessage(pp.Conn, pp.Params.NetworkType)
+	var msg DeSoMessage
+	var payload []byte
+	var err error
+	if pp.transport != nil {
+		msg, payload, err = pp.transport.ReadMessage(pp.Conn, pp.Params.NetworkType)
+	} else {
+		msg, payload, err = ReadMessage(pp.Conn, pp.Params.NetworkType)
+	}
 	if err != nil {
 		err := errors.Wrapf(err, "ReadDeSoMessage: ")
 		glog.Error(err)
 		return nil, err
 	}
 
+	// Compressed messages are only accepted if our node supports compression.
+	if compressedMsg, ok := msg.(*MsgDeSoCompressed); ok {
+		if !pp.messageCompression {
+			err = fmt.Errorf("ReadDeSoMessage: Received compressed message but compression isn't enabled")
+			glog.Error(err)
+			return nil, err
+		}
+		msg, err = compressedMsg.Decompress()
+		if err != nil {
+			err = errors.Wrapf(err, "ReadDeSoMessage: ")
+			glog.Error(err)
+			return nil, err
+		}
+	}
+
 	// Only track the payload received in the statistics we track.
 	msgLen := uint64(len(payload))
 	atomic.AddUint64(&pp.bytesReceived, msgLen)
@@ -1375,6 +1484,15 @@ func (pp *Peer) Disconnect(reason string) {
 	pp.peerDisconnectedChan <- pp
 }
 
+// Misbehaving penalizes the peer for the misbehavior and disconnects it. Peers that misbehave repeatedly are banned
+// by the NetworkManager, so that they can't reconnect right away.
+func (pp *Peer) Misbehaving(misbehavior PeerMisbehavior, reason string) {
+	if pp.srv != nil && pp.srv.networkManager != nil {
+		pp.srv.networkManager.Misbehaving(pp, misbehavior, reason)
+	}
+	pp.Disconnect(reason)
+}
+
 func (pp *Peer) _logVersionSuccess() {
 	inboundStr := "INBOUND"
 	if pp.isOutbound {
@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// PeerBanAPIServer serves an HTTP/JSON API for listing, adding, and removing peer bans on a running node. Unlike the
+// state API, it changes the node's behavior, so it should only listen on a loopback or otherwise private address.
+// Responses are encoded the same way as state API responses, and errors are returned as a StateAPIErrorResponse.
+type PeerBanAPIServer struct {
+	peerBanner    peerBanner
+	listenAddress string
+
+	httpServer *http.Server
+}
+
+// peerBanner is the part of the NetworkManager that the PeerBanAPIServer uses.
+type peerBanner interface {
+	BanPeer(keyType PeerBanKeyType, key string, duration time.Duration, reason string) error
+	UnbanPeer(keyType PeerBanKeyType, key string) (bool, error)
+	GetPeerBans() []*PeerBanEntry
+}
+
+// PeerBanAPIBanRequest is the body of a request to ban an IP address or validator public key. Duration is parsed
+// with time.ParseDuration, e.g. "24h".
+type PeerBanAPIBanRequest struct {
+	KeyType  PeerBanKeyType
+	Key      string
+	Duration string
+	Reason   string
+}
+
+type PeerBanAPIUnbanResponse struct {
+	// Unbanned is false if the key wasn't banned.
+	Unbanned bool
+}
+
+func NewPeerBanAPIServer(networkManager *NetworkManager, listenAddress string) *PeerBanAPIServer {
+	return &PeerBanAPIServer{
+		peerBanner:    networkManager,
+		listenAddress: listenAddress,
+	}
+}
+
+// Start binds the listen address and serves requests in the background.
+func (api *PeerBanAPIServer) Start() error {
+	listener, err := net.Listen("tcp", api.listenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "PeerBanAPIServer.Start: Problem listening on %v", api.listenAddress)
+	}
+	api.httpServer = &http.Server{Handler: api.Router()}
+
+	go func() {
+		glog.Infof("PeerBanAPIServer.Start: Serving peer ban API on %v", listener.Addr())
+		if err := api.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("PeerBanAPIServer.Start: Problem serving peer ban API: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (api *PeerBanAPIServer) Stop() {
+	if api.httpServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateAPIShutdownTimeout)
+	defer cancel()
+	if err := api.httpServer.Shutdown(ctx); err != nil {
+		glog.Errorf("PeerBanAPIServer.Stop: Problem shutting down peer ban API: %v", err)
+	}
+	api.httpServer = nil
+}
+
+// Router returns the handler for all peer ban API routes.
+func (api *PeerBanAPIServer) Router() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v0/peer-bans", api.getPeerBans)
+	mux.HandleFunc("POST /api/v0/peer-bans", api.banPeer)
+	mux.HandleFunc("DELETE /api/v0/peer-bans/{keyType}/{key}", api.unbanPeer)
+	return mux
+}
+
+func (api *PeerBanAPIServer) getPeerBans(ww http.ResponseWriter, rr *http.Request) {
+	bans := api.peerBanner.GetPeerBans()
+	if bans == nil {
+		bans = []*PeerBanEntry{}
+	}
+	writePeerBanAPIResponse(ww, bans)
+}
+
+func (api *PeerBanAPIServer) banPeer(ww http.ResponseWriter, rr *http.Request) {
+	banRequest := &PeerBanAPIBanRequest{}
+	if err := json.NewDecoder(rr.Body).Decode(banRequest); err != nil {
+		writePeerBanAPIError(ww, newStateAPIError(http.StatusBadRequest, "Problem decoding request: %v", err))
+		return
+	}
+	// Validate the request up front, so that only failures to persist the ban list are reported as server errors.
+	if _, err := normalizePeerBanKey(banRequest.KeyType, banRequest.Key); err != nil {
+		writePeerBanAPIError(ww, newStateAPIError(http.StatusBadRequest, "%v", err))
+		return
+	}
+	duration, err := time.ParseDuration(banRequest.Duration)
+	if err != nil || duration <= 0 {
+		writePeerBanAPIError(ww, newStateAPIError(http.StatusBadRequest,
+			"Duration must be positive, got %q", banRequest.Duration))
+		return
+	}
+
+	if err = api.peerBanner.BanPeer(banRequest.KeyType, banRequest.Key, duration, banRequest.Reason); err != nil {
+		writePeerBanAPIError(ww, err)
+		return
+	}
+	writePeerBanAPIResponse(ww, api.peerBanner.GetPeerBans())
+}
+
+func (api *PeerBanAPIServer) unbanPeer(ww http.ResponseWriter, rr *http.Request) {
+	keyType := PeerBanKeyType(rr.PathValue("keyType"))
+	key := rr.PathValue("key")
+	if _, err := normalizePeerBanKey(keyType, key); err != nil {
+		writePeerBanAPIError(ww, newStateAPIError(http.StatusBadRequest, "%v", err))
+		return
+	}
+
+	unbanned, err := api.peerBanner.UnbanPeer(keyType, key)
+	if err != nil {
+		writePeerBanAPIError(ww, err)
+		return
+	}
+	writePeerBanAPIResponse(ww, &PeerBanAPIUnbanResponse{Unbanned: unbanned})
+}
+
+func writePeerBanAPIResponse(ww http.ResponseWriter, response interface{}) {
+	statusCode, responseBytes := encodeStateAPIResponse(http.StatusOK, response)
+	writeStateAPIResponseBytes(ww, statusCode, responseBytes)
+}
+
+func writePeerBanAPIError(ww http.ResponseWriter, err error) {
+	statusCode, responseBytes := encodeStateAPIError(err)
+	writeStateAPIResponseBytes(ww, statusCode, responseBytes)
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPeerBanner serves the peer ban API straight from a PeerBanManager, without a NetworkManager.
+type testPeerBanner struct {
+	*PeerBanManager
+}
+
+func (banner *testPeerBanner) BanPeer(keyType PeerBanKeyType, key string, duration time.Duration, reason string) error {
+	return banner.Ban(keyType, key, duration, reason)
+}
+
+func (banner *testPeerBanner) UnbanPeer(keyType PeerBanKeyType, key string) (bool, error) {
+	return banner.Unban(keyType, key)
+}
+
+func (banner *testPeerBanner) GetPeerBans() []*PeerBanEntry {
+	return banner.GetBans()
+}
+
+func TestPeerBanAPIServer(t *testing.T) {
+	require := require.New(t)
+	validatorKey := _newTestPeerBanValidatorKey(t)
+	bm, _ := _newTestPeerBanManager(t, DefaultPeerBanThreshold, "")
+	router := (&PeerBanAPIServer{peerBanner: &testPeerBanner{bm}}).Router()
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+	getBans := func() []*PeerBanEntry {
+		recorder := do(http.MethodGet, "/api/v0/peer-bans", "")
+		require.Equal(http.StatusOK, recorder.Code)
+		var bans []*PeerBanEntry
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), &bans))
+		return bans
+	}
+
+	require.Empty(getBans())
+
+	// Ban an IP address and a validator key.
+	recorder := do(http.MethodPost, "/api/v0/peer-bans", `{"KeyType": "ip", "Key": "1.2.3.4", "Duration": "1h", "Reason": "manual"}`)
+	require.Equal(http.StatusOK, recorder.Code)
+	recorder = do(http.MethodPost, "/api/v0/peer-bans",
+		`{"KeyType": "validator", "Key": "`+validatorKey+`", "Duration": "2h", "Reason": "manual"}`)
+	require.Equal(http.StatusOK, recorder.Code)
+	bans := getBans()
+	require.Len(bans, 2)
+	require.Equal("1.2.3.4", bans[0].Key)
+	require.Equal("manual", bans[0].Reason)
+	require.Equal(validatorKey, bans[1].Key)
+	require.True(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+
+	// Invalid requests are rejected.
+	for _, body := range []string{
+		`{`,
+		`{"KeyType": "ip", "Key": "not an ip", "Duration": "1h"}`,
+		`{"KeyType": "nonsense", "Key": "1.2.3.4", "Duration": "1h"}`,
+		`{"KeyType": "ip", "Key": "1.2.3.4", "Duration": "0s"}`,
+		`{"KeyType": "ip", "Key": "1.2.3.4"}`,
+	} {
+		recorder = do(http.MethodPost, "/api/v0/peer-bans", body)
+		require.Equal(http.StatusBadRequest, recorder.Code, body)
+		errorResponse := &StateAPIErrorResponse{}
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), errorResponse))
+		require.NotEmpty(errorResponse.Error)
+	}
+	require.Equal(http.StatusBadRequest, do(http.MethodDelete, "/api/v0/peer-bans/ip/nonsense", "").Code)
+
+	// Unban the IP address. Unbanning it again reports that it wasn't banned.
+	for _, expectedUnbanned := range []bool{true, false} {
+		recorder = do(http.MethodDelete, "/api/v0/peer-bans/ip/1.2.3.4", "")
+		require.Equal(http.StatusOK, recorder.Code)
+		unbanResponse := &PeerBanAPIUnbanResponse{}
+		require.NoError(json.Unmarshal(recorder.Body.Bytes(), unbanResponse))
+		require.Equal(expectedUnbanned, unbanResponse.Unbanned)
+	}
+	bans = getBans()
+	require.Len(bans, 1)
+	require.Equal(PeerBanKeyTypeValidator, bans[0].KeyType)
+}
@@ -0,0 +1,422 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// peer_ban_manager.go implements the ban-score subsystem used by the NetworkManager. Whenever a peer misbehaves, e.g.
+// by sending us an invalid snapshot chunk or header, we disconnect it and add a penalty to the ban score of its IP
+// address and, if the peer is a validator, of its validator BLS public key. Once a ban score reaches the ban threshold,
+// the IP or validator key is banned for the ban duration, which means that we won't accept connections from it nor
+// connect to it. A ban score is forgotten if the peer doesn't misbehave again for PeerBanScoreResetDuration, or for
+// PeerBanScoreDisconnectedRetention if we're no longer connected to it.
+//
+// The ban list is persisted to the node's data directory, so that bans survive restarts. Ban scores are kept in memory.
+
+// PeerMisbehavior is the type of misbehavior that a peer is penalized for. Each misbehavior carries a penalty that
+// reflects how likely it is to be malicious, rather than the result of a benign race between our node and the peer.
+type PeerMisbehavior uint8
+
+const (
+	PeerMisbehaviorInvalidHeader        PeerMisbehavior = 0
+	PeerMisbehaviorUnconnectedHeaders   PeerMisbehavior = 1
+	PeerMisbehaviorInvalidBlock         PeerMisbehavior = 2
+	PeerMisbehaviorUnrequestedBlock     PeerMisbehavior = 3
+	PeerMisbehaviorInvalidSnapshotChunk PeerMisbehavior = 4
+	PeerMisbehaviorInvalidBlockRequest  PeerMisbehavior = 5
+	PeerMisbehaviorLowFeeTransaction    PeerMisbehavior = 6
+	PeerMisbehaviorInvalidCheckpoint    PeerMisbehavior = 7
+)
+
+func (misbehavior PeerMisbehavior) String() string {
+	switch misbehavior {
+	case PeerMisbehaviorInvalidHeader:
+		return "InvalidHeader"
+	case PeerMisbehaviorUnconnectedHeaders:
+		return "UnconnectedHeaders"
+	case PeerMisbehaviorInvalidBlock:
+		return "InvalidBlock"
+	case PeerMisbehaviorUnrequestedBlock:
+		return "UnrequestedBlock"
+	case PeerMisbehaviorInvalidSnapshotChunk:
+		return "InvalidSnapshotChunk"
+	case PeerMisbehaviorInvalidBlockRequest:
+		return "InvalidBlockRequest"
+	case PeerMisbehaviorLowFeeTransaction:
+		return "LowFeeTransaction"
+	case PeerMisbehaviorInvalidCheckpoint:
+		return "InvalidCheckpoint"
+	default:
+		return fmt.Sprintf("PeerMisbehavior(%d)", misbehavior)
+	}
+}
+
+// Penalty returns the ban score added for the misbehavior. With the default ban threshold of 100, invalid headers,
+// blocks, and snapshot chunks are banned after two offenses, and the rest after five or ten.
+func (misbehavior PeerMisbehavior) Penalty() uint64 {
+	switch misbehavior {
+	case PeerMisbehaviorInvalidHeader, PeerMisbehaviorInvalidSnapshotChunk, PeerMisbehaviorInvalidBlock:
+		return 50
+	case PeerMisbehaviorUnconnectedHeaders, PeerMisbehaviorUnrequestedBlock, PeerMisbehaviorInvalidBlockRequest,
+		PeerMisbehaviorInvalidCheckpoint:
+		return 20
+	case PeerMisbehaviorLowFeeTransaction:
+		return 10
+	default:
+		return 0
+	}
+}
+
+// PeerBanKeyType is the type of key that a ban score or ban applies to.
+type PeerBanKeyType string
+
+const (
+	PeerBanKeyTypeIP        PeerBanKeyType = "ip"
+	PeerBanKeyTypeValidator PeerBanKeyType = "validator"
+)
+
+const (
+	// DefaultPeerBanThreshold is the ban score at which an IP or validator key is banned.
+	DefaultPeerBanThreshold = 100
+	// DefaultPeerBanDuration is how long an IP or validator key stays banned.
+	DefaultPeerBanDuration = 24 * time.Hour
+	// PeerBanScoreResetDuration is how long a peer has to behave for its ban score to be forgotten.
+	PeerBanScoreResetDuration = 24 * time.Hour
+	// PeerBanScoreDisconnectedRetention is how long the ban score of a key that no remote node is connected with is
+	// kept. It's long enough that a peer can't clear its ban score by quickly reconnecting after being disconnected.
+	PeerBanScoreDisconnectedRetention = time.Hour
+	// PeerBanListFileName is the name of the file that the ban list is persisted to in the data directory.
+	PeerBanListFileName = "peer_bans.json"
+)
+
+// PeerBanEntry is a single entry in the ban list.
+type PeerBanEntry struct {
+	KeyType     PeerBanKeyType `json:"keyType"`
+	Key         string         `json:"key"`
+	Reason      string         `json:"reason"`
+	BannedAt    time.Time      `json:"bannedAt"`
+	BannedUntil time.Time      `json:"bannedUntil"`
+}
+
+type peerBanKey struct {
+	keyType PeerBanKeyType
+	key     string
+}
+
+type peerBanScore struct {
+	score       uint64
+	lastPenalty time.Time
+}
+
+// PeerBanManager keeps track of the ban scores and the ban list. It's safe for concurrent use.
+type PeerBanManager struct {
+	mtx sync.Mutex
+
+	// banThreshold is the ban score at which a key is banned. If it's zero, misbehaving peers are never banned
+	// automatically, although they can still be banned manually.
+	banThreshold uint64
+	// banDuration is how long a key stays banned once its ban score reaches the ban threshold.
+	banDuration time.Duration
+	// banListPath is the file the ban list is persisted to. If it's empty, the ban list is only kept in memory.
+	banListPath string
+
+	scores map[peerBanKey]*peerBanScore
+	bans   map[peerBanKey]*PeerBanEntry
+
+	// timeNow returns the current time. It's overridden in tests.
+	timeNow func() time.Time
+}
+
+// NewPeerBanManager creates a PeerBanManager and loads the ban list from banListPath, if it exists.
+func NewPeerBanManager(banThreshold uint64, banDuration time.Duration, banListPath string) (*PeerBanManager, error) {
+	if banThreshold > 0 && banDuration <= 0 {
+		return nil, fmt.Errorf("NewPeerBanManager: Ban duration must be positive, got %v", banDuration)
+	}
+	bm := &PeerBanManager{
+		banThreshold: banThreshold,
+		banDuration:  banDuration,
+		banListPath:  banListPath,
+		scores:       make(map[peerBanKey]*peerBanScore),
+		bans:         make(map[peerBanKey]*PeerBanEntry),
+		timeNow:      time.Now,
+	}
+	if err := bm.load(); err != nil {
+		return nil, errors.Wrapf(err, "NewPeerBanManager: Problem loading ban list")
+	}
+	return bm, nil
+}
+
+// normalizePeerBanKey validates the key and converts it to its canonical string, so that different spellings of
+// the same IP or validator key map to the same ban.
+func normalizePeerBanKey(keyType PeerBanKeyType, key string) (peerBanKey, error) {
+	switch keyType {
+	case PeerBanKeyTypeIP:
+		ip := net.ParseIP(key)
+		if ip == nil {
+			return peerBanKey{}, fmt.Errorf("normalizePeerBanKey: Invalid IP address %v", key)
+		}
+		return peerBanKey{keyType: keyType, key: ip.String()}, nil
+	case PeerBanKeyTypeValidator:
+		publicKey, err := (&bls.PublicKey{}).FromString(key)
+		if err != nil || !publicKey.IsValid() {
+			return peerBanKey{}, fmt.Errorf("normalizePeerBanKey: Invalid validator public key %v", key)
+		}
+		return peerBanKey{keyType: keyType, key: publicKey.ToString()}, nil
+	default:
+		return peerBanKey{}, fmt.Errorf("normalizePeerBanKey: Unknown key type %v", keyType)
+	}
+}
+
+// AddPenalty adds the penalty to the key's ban score, and bans the key if its ban score reaches the ban threshold.
+// It returns true if the key got banned.
+func (bm *PeerBanManager) AddPenalty(keyType PeerBanKeyType, key string, penalty uint64, reason string) (bool, error) {
+	banKey, err := normalizePeerBanKey(keyType, key)
+	if err != nil {
+		return false, errors.Wrapf(err, "PeerBanManager.AddPenalty: ")
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	if bm.banThreshold == 0 || penalty == 0 || bm._isBanned(banKey) {
+		return false, nil
+	}
+
+	now := bm.timeNow()
+	score, exists := bm.scores[banKey]
+	if !exists || now.Sub(score.lastPenalty) > PeerBanScoreResetDuration {
+		score = &peerBanScore{}
+		bm.scores[banKey] = score
+	}
+	score.score += penalty
+	score.lastPenalty = now
+	glog.V(1).Infof("PeerBanManager.AddPenalty: Ban score for %v %v is now %d (penalty: %d, reason: %v)",
+		keyType, banKey.key, score.score, penalty, reason)
+	if score.score < bm.banThreshold {
+		return false, nil
+	}
+
+	delete(bm.scores, banKey)
+	if err = bm._ban(banKey, bm.banDuration, reason); err != nil {
+		return true, errors.Wrapf(err, "PeerBanManager.AddPenalty: ")
+	}
+	return true, nil
+}
+
+// GetBanScore returns the key's current ban score.
+func (bm *PeerBanManager) GetBanScore(keyType PeerBanKeyType, key string) uint64 {
+	banKey, err := normalizePeerBanKey(keyType, key)
+	if err != nil {
+		return 0
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	score, exists := bm.scores[banKey]
+	if !exists || bm.timeNow().Sub(score.lastPenalty) > PeerBanScoreResetDuration {
+		return 0
+	}
+	return score.score
+}
+
+// SweepScores removes the ban scores that have decayed, and the ban scores of keys that isConnected reports no
+// remote node is connected with and that haven't been penalized for PeerBanScoreDisconnectedRetention. It returns
+// the number of ban scores removed.
+func (bm *PeerBanManager) SweepScores(isConnected func(keyType PeerBanKeyType, key string) bool) int {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	now := bm.timeNow()
+	numRemoved := 0
+	for banKey, score := range bm.scores {
+		sinceLastPenalty := now.Sub(score.lastPenalty)
+		if sinceLastPenalty <= PeerBanScoreResetDuration &&
+			(sinceLastPenalty <= PeerBanScoreDisconnectedRetention || isConnected(banKey.keyType, banKey.key)) {
+			continue
+		}
+		delete(bm.scores, banKey)
+		numRemoved++
+	}
+	return numRemoved
+}
+
+// Ban bans the key for the given duration, replacing any existing ban.
+func (bm *PeerBanManager) Ban(keyType PeerBanKeyType, key string, duration time.Duration, reason string) error {
+	banKey, err := normalizePeerBanKey(keyType, key)
+	if err != nil {
+		return errors.Wrapf(err, "PeerBanManager.Ban: ")
+	}
+	if duration <= 0 {
+		return fmt.Errorf("PeerBanManager.Ban: Ban duration must be positive, got %v", duration)
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	delete(bm.scores, banKey)
+	return bm._ban(banKey, duration, reason)
+}
+
+func (bm *PeerBanManager) _ban(banKey peerBanKey, duration time.Duration, reason string) error {
+	now := bm.timeNow()
+	bm.bans[banKey] = &PeerBanEntry{
+		KeyType:     banKey.keyType,
+		Key:         banKey.key,
+		Reason:      reason,
+		BannedAt:    now,
+		BannedUntil: now.Add(duration),
+	}
+	glog.Infof(CLog(Yellow, fmt.Sprintf("PeerBanManager: Banned %v %v until %v for: %v",
+		banKey.keyType, banKey.key, now.Add(duration), reason)))
+	return bm._save()
+}
+
+// Unban removes the key from the ban list and resets its ban score. It returns true if the key was banned.
+func (bm *PeerBanManager) Unban(keyType PeerBanKeyType, key string) (bool, error) {
+	banKey, err := normalizePeerBanKey(keyType, key)
+	if err != nil {
+		return false, errors.Wrapf(err, "PeerBanManager.Unban: ")
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	delete(bm.scores, banKey)
+	if !bm._isBanned(banKey) {
+		return false, nil
+	}
+	delete(bm.bans, banKey)
+	return true, bm._save()
+}
+
+// IsBanned returns true if the key is currently banned.
+func (bm *PeerBanManager) IsBanned(keyType PeerBanKeyType, key string) bool {
+	banKey, err := normalizePeerBanKey(keyType, key)
+	if err != nil {
+		return false
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	return bm._isBanned(banKey)
+}
+
+// IsIPBanned returns true if the IP address is currently banned.
+func (bm *PeerBanManager) IsIPBanned(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	return bm.IsBanned(PeerBanKeyTypeIP, ip.String())
+}
+
+// IsValidatorBanned returns true if the validator public key is currently banned.
+func (bm *PeerBanManager) IsValidatorBanned(publicKey *bls.PublicKey) bool {
+	if publicKey == nil || publicKey.IsEmpty() {
+		return false
+	}
+	return bm.IsBanned(PeerBanKeyTypeValidator, publicKey.ToString())
+}
+
+// _isBanned returns true if the key is currently banned, and lazily removes the ban if it has expired.
+func (bm *PeerBanManager) _isBanned(banKey peerBanKey) bool {
+	entry, exists := bm.bans[banKey]
+	if !exists {
+		return false
+	}
+	if bm.timeNow().Before(entry.BannedUntil) {
+		return true
+	}
+	delete(bm.bans, banKey)
+	return false
+}
+
+// GetBans returns the active bans, ordered by the time they expire.
+func (bm *PeerBanManager) GetBans() []*PeerBanEntry {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	var bans []*PeerBanEntry
+	for banKey, entry := range bm.bans {
+		if !bm._isBanned(banKey) {
+			continue
+		}
+		entryCopy := *entry
+		bans = append(bans, &entryCopy)
+	}
+	sort.Slice(bans, func(ii, jj int) bool {
+		if !bans[ii].BannedUntil.Equal(bans[jj].BannedUntil) {
+			return bans[ii].BannedUntil.Before(bans[jj].BannedUntil)
+		}
+		return bans[ii].Key < bans[jj].Key
+	})
+	return bans
+}
+
+// _save persists the active bans to the ban list file.
+func (bm *PeerBanManager) _save() error {
+	if bm.banListPath == "" {
+		return nil
+	}
+	bans := []*PeerBanEntry{}
+	for banKey, entry := range bm.bans {
+		if bm._isBanned(banKey) {
+			bans = append(bans, entry)
+		}
+	}
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "PeerBanManager._save: Problem encoding ban list")
+	}
+	if err = writeFileAtomically(bm.banListPath, data); err != nil {
+		return errors.Wrapf(err, "PeerBanManager._save: Problem writing ban list to %v", bm.banListPath)
+	}
+	return nil
+}
+
+// load reads the ban list file, skipping bans that have expired since it was written.
+func (bm *PeerBanManager) load() error {
+	if bm.banListPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(bm.banListPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "PeerBanManager.load: Problem reading ban list from %v", bm.banListPath)
+	}
+	var bans []*PeerBanEntry
+	if err = json.Unmarshal(data, &bans); err != nil {
+		return errors.Wrapf(err, "PeerBanManager.load: Problem decoding ban list from %v", bm.banListPath)
+	}
+
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	now := bm.timeNow()
+	for _, entry := range bans {
+		banKey, err := normalizePeerBanKey(entry.KeyType, entry.Key)
+		if err != nil {
+			glog.Errorf("PeerBanManager.load: Skipping invalid ban list entry: %v", err)
+			continue
+		}
+		if !now.Before(entry.BannedUntil) {
+			continue
+		}
+		entry.Key = banKey.key
+		bm.bans[banKey] = entry
+	}
+	return nil
+}
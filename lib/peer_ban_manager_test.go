@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _newTestPeerBanManager(t *testing.T, banThreshold uint64, banListPath string) (*PeerBanManager, *time.Time) {
+	bm, err := NewPeerBanManager(banThreshold, time.Hour, banListPath)
+	require.NoError(t, err)
+	// The time is rounded to drop the monotonic clock reading, which isn't persisted in the ban list.
+	now := time.Now().UTC().Round(0)
+	bm.timeNow = func() time.Time { return now }
+	return bm, &now
+}
+
+func TestPeerBanManagerPenalties(t *testing.T) {
+	require := require.New(t)
+	bm, now := _newTestPeerBanManager(t, DefaultPeerBanThreshold, "")
+
+	// Penalties accumulate until the ban threshold is reached.
+	banned, err := bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorInvalidHeader.Penalty(), "test")
+	require.NoError(err)
+	require.False(banned)
+	require.Equal(uint64(50), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.4"))
+	banned, err = bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorUnrequestedBlock.Penalty(), "test")
+	require.NoError(err)
+	require.False(banned)
+	require.False(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+	banned, err = bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorInvalidSnapshotChunk.Penalty(), "test")
+	require.NoError(err)
+	require.True(banned)
+	require.True(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+	require.Equal(uint64(0), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.4"))
+
+	// Other IPs aren't affected.
+	require.False(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.5"))
+
+	// The ban expires after the ban duration.
+	*now = now.Add(time.Hour)
+	require.False(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+	require.Empty(bm.GetBans())
+
+	// Ban scores are forgotten if the peer behaves for long enough.
+	_, err = bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorInvalidBlock.Penalty(), "test")
+	require.NoError(err)
+	*now = now.Add(PeerBanScoreResetDuration + time.Second)
+	require.Equal(uint64(0), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.4"))
+	banned, err = bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorInvalidBlock.Penalty(), "test")
+	require.NoError(err)
+	require.False(banned)
+	require.Equal(uint64(50), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.4"))
+
+	// A ban threshold of zero disables automatic bans.
+	bm, _ = _newTestPeerBanManager(t, 0, "")
+	for ii := 0; ii < 10; ii++ {
+		banned, err = bm.AddPenalty(PeerBanKeyTypeIP, "1.2.3.4", PeerMisbehaviorInvalidBlock.Penalty(), "test")
+		require.NoError(err)
+		require.False(banned)
+	}
+	require.False(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+}
+
+func _newTestPeerBanValidatorKey(t *testing.T) string {
+	keystore, err := NewBLSKeystore("0x13b5febb384a3d3dec5c579724872607cd0ddb97adef592efaf144f6d25a70d7")
+	require.NoError(t, err)
+	return keystore.GetSigner().GetPublicKey().ToString()
+}
+
+func TestPeerBanManagerBanAndUnban(t *testing.T) {
+	require := require.New(t)
+	validatorKey := _newTestPeerBanValidatorKey(t)
+	bm, _ := _newTestPeerBanManager(t, DefaultPeerBanThreshold, "")
+
+	// Keys are normalized, so different spellings of the same IP map to the same ban.
+	require.NoError(bm.Ban(PeerBanKeyTypeIP, "::ffff:1.2.3.4", time.Hour, "manual"))
+	require.True(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+	require.NoError(bm.Ban(PeerBanKeyTypeValidator, validatorKey, time.Minute, "manual"))
+	require.True(bm.IsBanned(PeerBanKeyTypeValidator, validatorKey))
+
+	bans := bm.GetBans()
+	require.Len(bans, 2)
+	require.Equal(PeerBanKeyTypeValidator, bans[0].KeyType)
+	require.Equal(PeerBanKeyTypeIP, bans[1].KeyType)
+	require.Equal("1.2.3.4", bans[1].Key)
+	require.Equal("manual", bans[1].Reason)
+
+	// Invalid keys are rejected.
+	require.Error(bm.Ban(PeerBanKeyTypeIP, "not an ip", time.Hour, "manual"))
+	require.Error(bm.Ban(PeerBanKeyTypeValidator, "0x1234", time.Hour, "manual"))
+	require.Error(bm.Ban("nonsense", "1.2.3.4", time.Hour, "manual"))
+	require.Error(bm.Ban(PeerBanKeyTypeIP, "1.2.3.4", 0, "manual"))
+	_, err := bm.AddPenalty(PeerBanKeyTypeIP, "", 10, "test")
+	require.Error(err)
+
+	unbanned, err := bm.Unban(PeerBanKeyTypeIP, "1.2.3.4")
+	require.NoError(err)
+	require.True(unbanned)
+	require.False(bm.IsBanned(PeerBanKeyTypeIP, "1.2.3.4"))
+	unbanned, err = bm.Unban(PeerBanKeyTypeIP, "1.2.3.4")
+	require.NoError(err)
+	require.False(unbanned)
+	require.Len(bm.GetBans(), 1)
+
+	// Ban durations must be positive if automatic bans are enabled.
+	_, err = NewPeerBanManager(DefaultPeerBanThreshold, 0, "")
+	require.Error(err)
+}
+
+func TestPeerBanManagerSweepScores(t *testing.T) {
+	require := require.New(t)
+	bm, now := _newTestPeerBanManager(t, DefaultPeerBanThreshold, "")
+	connectedIPs := map[string]bool{"1.2.3.4": true, "1.2.3.5": true}
+	isConnected := func(keyType PeerBanKeyType, key string) bool {
+		return keyType == PeerBanKeyTypeIP && connectedIPs[key]
+	}
+	addPenalty := func(ip string) {
+		_, err := bm.AddPenalty(PeerBanKeyTypeIP, ip, PeerMisbehaviorLowFeeTransaction.Penalty(), "test")
+		require.NoError(err)
+	}
+
+	addPenalty("1.2.3.4")
+	addPenalty("1.2.3.5")
+	addPenalty("1.2.3.6")
+	require.Equal(0, bm.SweepScores(isConnected))
+	require.Len(bm.scores, 3)
+
+	// Once the retention has passed, the ban scores of disconnected keys are removed.
+	*now = now.Add(PeerBanScoreDisconnectedRetention + time.Minute)
+	addPenalty("1.2.3.5")
+	require.Equal(1, bm.SweepScores(isConnected))
+	require.Len(bm.scores, 2)
+	require.Equal(uint64(0), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.6"))
+	require.Equal(uint64(20), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.5"))
+
+	// Decayed ban scores are removed even if the key is still connected.
+	*now = now.Add(PeerBanScoreResetDuration - PeerBanScoreDisconnectedRetention)
+	require.Equal(1, bm.SweepScores(isConnected))
+	require.Equal(uint64(20), bm.GetBanScore(PeerBanKeyTypeIP, "1.2.3.5"))
+	*now = now.Add(PeerBanScoreDisconnectedRetention + time.Minute)
+	require.Equal(1, bm.SweepScores(isConnected))
+	require.Empty(bm.scores)
+}
+
+func TestPeerBanManagerPersistence(t *testing.T) {
+	require := require.New(t)
+	validatorKey := _newTestPeerBanValidatorKey(t)
+	banListPath := filepath.Join(t.TempDir(), PeerBanListFileName)
+	bm, now := _newTestPeerBanManager(t, DefaultPeerBanThreshold, banListPath)
+
+	require.NoError(bm.Ban(PeerBanKeyTypeIP, "1.2.3.4", time.Hour, "manual"))
+	require.NoError(bm.Ban(PeerBanKeyTypeIP, "1.2.3.5", 2*time.Hour, "manual"))
+	require.NoError(bm.Ban(PeerBanKeyTypeValidator, validatorKey, 3*time.Hour, "manual"))
+	unbanned, err := bm.Unban(PeerBanKeyTypeIP, "1.2.3.5")
+	require.NoError(err)
+	require.True(unbanned)
+
+	// The ban list is reloaded on restart.
+	reloadedBm, err := NewPeerBanManager(DefaultPeerBanThreshold, time.Hour, banListPath)
+	require.NoError(err)
+	require.Equal(bm.GetBans(), reloadedBm.GetBans())
+
+	// Bans that expired while the node was down are dropped.
+	reloadedBm, err = NewPeerBanManager(DefaultPeerBanThreshold, time.Hour, "")
+	require.NoError(err)
+	reloadedBm.banListPath = banListPath
+	reloadedBm.timeNow = func() time.Time { return now.Add(2 * time.Hour) }
+	require.NoError(reloadedBm.load())
+	bans := reloadedBm.GetBans()
+	require.Len(bans, 1)
+	require.Equal(validatorKey, bans[0].Key)
+
+	// A corrupted ban list is an error.
+	require.NoError(os.WriteFile(banListPath, []byte("{"), 0644))
+	_, err = NewPeerBanManager(DefaultPeerBanThreshold, time.Hour, banListPath)
+	require.Error(err)
+}
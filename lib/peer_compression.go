@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// peer_compression.go implements message compression between peers. Compression is negotiated during the handshake:
+// if both nodes set SFMessageCompression in their Version messages and negotiate ProtocolVersion2 or later, then large
+// messages of the compressible types are sent wrapped in a MsgDeSoCompressed, which holds the zstd-compressed payload
+// of the inner message. Compression is transparent to the rest of the node, as the Peer compresses messages in
+// WriteDeSoMessage and decompresses them in ReadDeSoMessage.
+//
+// A malicious peer could send a small compressed message that decompresses to a huge payload. To guard against such
+// decompression bombs, the decompressed length is declared up front and bounded both by MaxMessagePayload and by
+// MaxMessageCompressionRatio times the compressed length. The payload is decompressed into a buffer of the declared
+// length, and anything that doesn't decompress to exactly that length is rejected.
+
+const (
+	// MinCompressedMessagePayload is the payload size in bytes below which messages aren't worth compressing.
+	MinCompressedMessagePayload = 1024
+
+	// MaxMessageCompressionRatio is the maximum ratio between the decompressed and compressed payload sizes of a
+	// MsgDeSoCompressed. Snapshot chunks and block bundles compress far less than this.
+	MaxMessageCompressionRatio = 64
+)
+
+// compressibleMsgTypes are the message types that are compressed when sent to peers that support compression.
+var compressibleMsgTypes = map[MsgType]bool{
+	MsgTypeSnapshotData: true,
+	MsgTypeBlockBundle:  true,
+}
+
+// IsCompressibleMsgType returns true if messages of the type are compressed when sent to peers that support it.
+func IsCompressibleMsgType(msgType MsgType) bool {
+	return compressibleMsgTypes[msgType]
+}
+
+var (
+	messageCompressorOnce sync.Once
+	messageCompressor     *zstd.Encoder
+	messageCompressorErr  error
+)
+
+// getMessageCompressor returns the shared zstd encoder. EncodeAll is safe for concurrent use.
+func getMessageCompressor() (*zstd.Encoder, error) {
+	messageCompressorOnce.Do(func() {
+		messageCompressor, messageCompressorErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	})
+	return messageCompressor, messageCompressorErr
+}
+
+// ==================================================================
+// Compressed Message
+// ==================================================================
+
+type MsgDeSoCompressed struct {
+	// The type of the compressed message.
+	InnerMsgType MsgType
+
+	// The length of the compressed message's payload once decompressed.
+	DecompressedLen uint64
+
+	// The zstd-compressed payload of the message.
+	CompressedPayload []byte
+}
+
+// CompressMessage compresses the message. It returns nil if the message isn't of a compressible type, or if its
+// payload is too small or doesn't compress well enough to be worth it.
+func CompressMessage(msg DeSoMessage) (*MsgDeSoCompressed, error) {
+	if !IsCompressibleMsgType(msg.GetMsgType()) {
+		return nil, nil
+	}
+	payload, err := msg.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CompressMessage: Problem encoding message")
+	}
+	if len(payload) < MinCompressedMessagePayload {
+		return nil, nil
+	}
+	compressor, err := getMessageCompressor()
+	if err != nil {
+		return nil, errors.Wrapf(err, "CompressMessage: Problem creating compressor")
+	}
+	compressedPayload := compressor.EncodeAll(payload, nil)
+	if len(compressedPayload) >= len(payload) ||
+		uint64(len(payload)) > uint64(len(compressedPayload))*MaxMessageCompressionRatio {
+		return nil, nil
+	}
+	return &MsgDeSoCompressed{
+		InnerMsgType:      msg.GetMsgType(),
+		DecompressedLen:   uint64(len(payload)),
+		CompressedPayload: compressedPayload,
+	}, nil
+}
+
+// Decompress decompresses and parses the inner message.
+func (msg *MsgDeSoCompressed) Decompress() (DeSoMessage, error) {
+	if err := msg.validate(); err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.Decompress: ")
+	}
+
+	decompressor, err := zstd.NewReader(bytes.NewReader(msg.CompressedPayload),
+		zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MaxMessagePayload))
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.Decompress: Problem creating decompressor")
+	}
+	defer decompressor.Close()
+
+	// Decompress into a buffer of the declared length, and make sure that there's nothing left over.
+	payload, err := SafeMakeSliceWithLength[byte](msg.DecompressedLen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.Decompress: Problem creating payload slice")
+	}
+	if _, err = io.ReadFull(decompressor, payload); err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.Decompress: Problem decompressing payload")
+	}
+	if extraBytes, err := decompressor.Read(make([]byte, 1)); extraBytes != 0 || err != io.EOF {
+		return nil, fmt.Errorf("MsgDeSoCompressed.Decompress: Payload is longer than the declared "+
+			"length %d", msg.DecompressedLen)
+	}
+
+	innerMsg := NewMessage(msg.InnerMsgType)
+	if err = innerMsg.FromBytes(payload); err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.Decompress: Problem parsing message "+
+			"payload for message type (%s)", msg.InnerMsgType)
+	}
+	return innerMsg, nil
+}
+
+// validate checks that the inner message type is compressible, and that the declared decompressed length is within
+// the limits.
+func (msg *MsgDeSoCompressed) validate() error {
+	if !IsCompressibleMsgType(msg.InnerMsgType) {
+		return fmt.Errorf("MsgDeSoCompressed.validate: Message type (%s) isn't compressible", msg.InnerMsgType)
+	}
+	if msg.DecompressedLen > MaxMessagePayload {
+		return fmt.Errorf("MsgDeSoCompressed.validate: Decompressed length %d exceeds max %d",
+			msg.DecompressedLen, MaxMessagePayload)
+	}
+	if msg.DecompressedLen > uint64(len(msg.CompressedPayload))*MaxMessageCompressionRatio {
+		return fmt.Errorf("MsgDeSoCompressed.validate: Decompressed length %d exceeds %d times the "+
+			"compressed length %d", msg.DecompressedLen, MaxMessageCompressionRatio, len(msg.CompressedPayload))
+	}
+	return nil
+}
+
+func (msg *MsgDeSoCompressed) GetMsgType() MsgType {
+	return MsgTypeCompressed
+}
+
+func (msg *MsgDeSoCompressed) ToBytes(bool) ([]byte, error) {
+	if err := msg.validate(); err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompressed.ToBytes: ")
+	}
+
+	data := []byte{}
+	data = append(data, UintToBuf(uint64(msg.InnerMsgType))...)
+	data = append(data, UintToBuf(msg.DecompressedLen)...)
+	data = append(data, EncodeByteArray(msg.CompressedPayload)...)
+	return data, nil
+}
+
+func (msg *MsgDeSoCompressed) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	retMsg := &MsgDeSoCompressed{}
+
+	innerMsgType, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompressed.FromBytes: Problem decoding inner message type")
+	}
+	retMsg.InnerMsgType = MsgType(innerMsgType)
+
+	retMsg.DecompressedLen, err = ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompressed.FromBytes: Problem decoding decompressed length")
+	}
+
+	retMsg.CompressedPayload, err = DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompressed.FromBytes: Problem decoding compressed payload")
+	}
+
+	if err = retMsg.validate(); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompressed.FromBytes: ")
+	}
+
+	*msg = *retMsg
+	return nil
+}
+
+func (msg *MsgDeSoCompressed) String() string {
+	return fmt.Sprintf("{InnerMsgType: %v, DecompressedLen: %d, CompressedLen: %d}",
+		msg.InnerMsgType, msg.DecompressedLen, len(msg.CompressedPayload))
+}
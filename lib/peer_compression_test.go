@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+// _newTestSnapshotData returns a snapshot chunk with numEntries repetitive entries, which compress well.
+func _newTestSnapshotData(numEntries int) *MsgDeSoSnapshotData {
+	msg := &MsgDeSoSnapshotData{
+		SnapshotMetadata: &SnapshotEpochMetadata{
+			SnapshotBlockHeight:       1000,
+			FirstSnapshotBlockHeight:  1000,
+			CurrentEpochChecksumBytes: bytes.Repeat([]byte{0x01}, 33),
+			CurrentEpochBlockHash:     &BlockHash{0x02},
+		},
+		SnapshotChunkFull: true,
+		Prefix:            []byte{0x03},
+	}
+	for ii := 0; ii < numEntries; ii++ {
+		key := append([]byte{0x03}, []byte(fmt.Sprintf("key-%08d", ii))...)
+		msg.SnapshotChunk = append(msg.SnapshotChunk, NewDBEntry(key, bytes.Repeat([]byte{byte(ii)}, 100)))
+	}
+	return msg
+}
+
+func TestMessageCompression(t *testing.T) {
+	require := require.New(t)
+	snapshotData := _newTestSnapshotData(100)
+	snapshotDataBytes, err := snapshotData.ToBytes(false)
+	require.NoError(err)
+
+	// Large messages of compressible types are compressed, and round-trip through the wire format.
+	compressedMsg, err := CompressMessage(snapshotData)
+	require.NoError(err)
+	require.NotNil(compressedMsg)
+	require.Equal(MsgTypeSnapshotData, compressedMsg.InnerMsgType)
+	require.Equal(uint64(len(snapshotDataBytes)), compressedMsg.DecompressedLen)
+	require.Less(len(compressedMsg.CompressedPayload), len(snapshotDataBytes))
+
+	var buf bytes.Buffer
+	_, err = WriteMessage(&buf, compressedMsg, NetworkType_TESTNET)
+	require.NoError(err)
+	decodedMsg, _, err := ReadMessage(&buf, NetworkType_TESTNET)
+	require.NoError(err)
+	innerMsg, err := decodedMsg.(*MsgDeSoCompressed).Decompress()
+	require.NoError(err)
+	innerMsgBytes, err := innerMsg.ToBytes(false)
+	require.NoError(err)
+	require.Equal(snapshotDataBytes, innerMsgBytes)
+
+	// Small messages and messages of other types aren't compressed.
+	compressedMsg, err = CompressMessage(_newTestSnapshotData(1))
+	require.NoError(err)
+	require.Nil(compressedMsg)
+	compressedMsg, err = CompressMessage(&MsgDeSoGetSnapshot{SnapshotStartKey: bytes.Repeat([]byte{0x03}, 2000)})
+	require.NoError(err)
+	require.Nil(compressedMsg)
+}
+
+func TestMessageCompressionLimits(t *testing.T) {
+	require := require.New(t)
+	snapshotData := _newTestSnapshotData(100)
+	snapshotDataBytes, err := snapshotData.ToBytes(false)
+	require.NoError(err)
+	compressedMsg, err := CompressMessage(snapshotData)
+	require.NoError(err)
+
+	// Only compressible message types can be wrapped.
+	badMsg := *compressedMsg
+	badMsg.InnerMsgType = MsgTypeCompressed
+	_, err = badMsg.ToBytes(false)
+	require.Error(err)
+	_, err = badMsg.Decompress()
+	require.Error(err)
+	badMsg.InnerMsgType = MsgTypeVersion
+	_, err = badMsg.Decompress()
+	require.Error(err)
+
+	// The declared length is bounded by the compression ratio and the max message size.
+	badMsg = *compressedMsg
+	badMsg.DecompressedLen = uint64(len(badMsg.CompressedPayload))*MaxMessageCompressionRatio + 1
+	_, err = badMsg.Decompress()
+	require.Error(err)
+	badMsgBytes := append(UintToBuf(uint64(MsgTypeSnapshotData)), UintToBuf(badMsg.DecompressedLen)...)
+	badMsgBytes = append(badMsgBytes, EncodeByteArray(badMsg.CompressedPayload)...)
+	require.Error((&MsgDeSoCompressed{}).FromBytes(badMsgBytes))
+	badMsg.CompressedPayload = make([]byte, MaxMessagePayload/MaxMessageCompressionRatio+1)
+	badMsg.DecompressedLen = MaxMessagePayload + 1
+	_, err = badMsg.Decompress()
+	require.Error(err)
+
+	// The payload must decompress to exactly the declared length.
+	badMsg = *compressedMsg
+	badMsg.DecompressedLen--
+	_, err = badMsg.Decompress()
+	require.Error(err)
+	badMsg.DecompressedLen += 2
+	_, err = badMsg.Decompress()
+	require.Error(err)
+
+	// A payload that decompresses to far more than the declared length is rejected.
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(err)
+	bomb := encoder.EncodeAll(make([]byte, 10*len(snapshotDataBytes)*MaxMessageCompressionRatio), nil)
+	badMsg = MsgDeSoCompressed{
+		InnerMsgType:      MsgTypeSnapshotData,
+		DecompressedLen:   uint64(len(bomb)),
+		CompressedPayload: bomb,
+	}
+	_, err = badMsg.Decompress()
+	require.Error(err)
+
+	// Corrupted payloads are rejected.
+	badMsg = *compressedMsg
+	badMsg.CompressedPayload = bytes.Repeat([]byte{0xff}, len(compressedMsg.CompressedPayload))
+	_, err = badMsg.Decompress()
+	require.Error(err)
+}
+
+func TestPeerMessageCompression(t *testing.T) {
+	require := require.New(t)
+	snapshotData := _newTestSnapshotData(100)
+	snapshotDataBytes, err := snapshotData.ToBytes(false)
+	require.NoError(err)
+
+	// sendMessage writes the message from the sender to the receiver, returning the message read by the receiver
+	// and the number of bytes sent.
+	sendMessage := func(sender *Peer, receiver *Peer, msg DeSoMessage) (DeSoMessage, uint64, error) {
+		senderConn, receiverConn := net.Pipe()
+		defer senderConn.Close()
+		defer receiverConn.Close()
+		sender.Conn = senderConn
+		receiver.Conn = receiverConn
+		bytesSent := sender.bytesSent
+		writeErr := make(chan error, 1)
+		go func() {
+			writeErr <- sender.WriteDeSoMessage(msg)
+		}()
+		receivedMsg, err := receiver.ReadDeSoMessage()
+		require.NoError(<-writeErr)
+		return receivedMsg, sender.bytesSent - bytesSent, err
+	}
+
+	// Messages aren't compressed until the peer negotiates compression.
+	sender := &Peer{Params: &DeSoTestnetParams}
+	receiver := &Peer{Params: &DeSoTestnetParams}
+	receivedMsg, uncompressedBytesSent, err := sendMessage(sender, receiver, snapshotData)
+	require.NoError(err)
+	require.Equal(MsgTypeSnapshotData, receivedMsg.GetMsgType())
+	sender.StartCompressingMessages()
+	require.False(sender.IsCompressingMessages())
+
+	// Once it does, compression is transparent to the receiver.
+	sender.EnableMessageCompression()
+	sender.StartCompressingMessages()
+	require.True(sender.IsCompressingMessages())
+	receiver.EnableMessageCompression()
+	receivedMsg, compressedBytesSent, err := sendMessage(sender, receiver, snapshotData)
+	require.NoError(err)
+	require.Equal(MsgTypeSnapshotData, receivedMsg.GetMsgType())
+	receivedMsgBytes, err := receivedMsg.ToBytes(false)
+	require.NoError(err)
+	require.Equal(snapshotDataBytes, receivedMsgBytes)
+	require.Less(compressedBytesSent, uncompressedBytesSent)
+
+	// Compressed messages are rejected by peers that don't support compression.
+	receiver = &Peer{Params: &DeSoTestnetParams}
+	_, _, err = sendMessage(sender, receiver, snapshotData)
+	require.Error(err)
+}
@@ -0,0 +1,277 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// peer_transport.go implements the optional encrypted transport between peers. The transport is negotiated during
+// the Version and Verack exchange:
+//
+//  1. A node that supports the encrypted transport sets the SFEncryptedTransport service flag and attaches an
+//     ephemeral X25519 public key to its Version message.
+//  2. Once both nodes have received each other's Version message with the flag set, they each derive the same pair
+//     of ChaCha20-Poly1305 session keys, one per direction, from the X25519 shared secret. The keys are bound to the
+//     session's transcript, which is the pair of ephemeral public keys.
+//  3. Each node sends its Verack message in plaintext, and then encrypts every message it sends after it. Similarly,
+//     every message received after the peer's Verack message is decrypted.
+//
+// The transcript hash doubles as the session binding. Validators sign it, along with the handshake nonces, in their
+// Verack message using their BLS key, which ties the encrypted session to the validator's identity. A man in the middle
+// would have to terminate the transport on both ends with its own ephemeral keys, resulting in different bindings that
+// it can't produce signatures for. Non-validators don't sign anything, so for them the transport only protects against
+// passive observers.
+//
+// Once active, each message is written as a frame made up of a 4-byte big-endian ciphertext length followed by the
+// ciphertext of the message, as encoded by WriteMessage. Nonces are per-direction message counters.
+
+const (
+	// PeerTransportPublicKeyLen is the length of the ephemeral X25519 public key sent in the Version message.
+	PeerTransportPublicKeyLen = 32
+	// peerTransportMaxFrameLen is the maximum length of an encrypted frame. It fits the largest message payload, the
+	// message header, and the AEAD tag.
+	peerTransportMaxFrameLen = MaxMessagePayload + 1024
+)
+
+var (
+	peerTransportTranscriptDomain = []byte("DeSoPeerTransportTranscript")
+	peerTransportKeyInfo          = []byte("DeSoPeerTransportKeys")
+)
+
+// peerTransport holds the state of a Peer's encrypted transport. The handshake state is guarded by mtx, while the
+// send and receive directions are guarded by their own mutexes, so that a blocking read never holds up a write.
+type peerTransport struct {
+	mtx sync.RWMutex
+	// isOutbound determines the direction of the session keys. The outbound node is the initiator.
+	isOutbound bool
+	// privateKey is our ephemeral X25519 private key. It's dropped once the session keys are derived.
+	privateKey *ecdh.PrivateKey
+	publicKey  []byte
+	// versionReceived is set once we've read the peer's Version message. The transport is only negotiated once.
+	versionReceived bool
+	// sessionBinding is set if both nodes negotiated the encrypted transport.
+	sessionBinding []byte
+	// The session keys derived during the negotiation. They're moved to the send and receive directions once
+	// the respective Verack message is sent or received.
+	negotiatedSendCipher cipher.AEAD
+	negotiatedRecvCipher cipher.AEAD
+
+	sendMtx    sync.Mutex
+	sendCipher cipher.AEAD
+	sendNonce  uint64
+
+	recvMtx    sync.Mutex
+	recvCipher cipher.AEAD
+	recvNonce  uint64
+}
+
+func newPeerTransport(isOutbound bool) (*peerTransport, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "newPeerTransport: Problem generating ephemeral key")
+	}
+	return &peerTransport{
+		isOutbound: isOutbound,
+		privateKey: privateKey,
+		publicKey:  privateKey.PublicKey().Bytes(),
+	}, nil
+}
+
+// GetPublicKey returns our ephemeral public key to be sent in the Version message.
+func (pt *peerTransport) GetPublicKey() []byte {
+	return pt.publicKey
+}
+
+// GetSessionBinding returns the session binding, and whether the encrypted transport was negotiated.
+func (pt *peerTransport) GetSessionBinding() ([]byte, bool) {
+	pt.mtx.RLock()
+	defer pt.mtx.RUnlock()
+
+	return pt.sessionBinding, pt.sessionBinding != nil
+}
+
+// handleRemoteVersion negotiates the encrypted transport with the peer's Version message. If the peer doesn't
+// advertise SFEncryptedTransport, the connection stays in plaintext.
+func (pt *peerTransport) handleRemoteVersion(verMsg *MsgDeSoVersion) error {
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
+	if pt.versionReceived {
+		return fmt.Errorf("peerTransport.handleRemoteVersion: Received more than one version message")
+	}
+	pt.versionReceived = true
+
+	if !verMsg.Services.HasService(SFEncryptedTransport) {
+		pt.privateKey = nil
+		return nil
+	}
+	if len(verMsg.TransportPublicKey) != PeerTransportPublicKeyLen {
+		return fmt.Errorf("peerTransport.handleRemoteVersion: Invalid transport public key length %d, expected %d",
+			len(verMsg.TransportPublicKey), PeerTransportPublicKeyLen)
+	}
+	remotePublicKey, err := ecdh.X25519().NewPublicKey(verMsg.TransportPublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "peerTransport.handleRemoteVersion: Problem parsing transport public key")
+	}
+	sharedSecret, err := pt.privateKey.ECDH(remotePublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "peerTransport.handleRemoteVersion: Problem computing shared secret")
+	}
+	pt.privateKey = nil
+
+	// The transcript orders the public keys from the initiator's to the responder's, so that both nodes agree on it.
+	initiatorPublicKey, responderPublicKey := pt.publicKey, verMsg.TransportPublicKey
+	if !pt.isOutbound {
+		initiatorPublicKey, responderPublicKey = responderPublicKey, initiatorPublicKey
+	}
+	transcript := sha256.New()
+	transcript.Write(peerTransportTranscriptDomain)
+	transcript.Write(initiatorPublicKey)
+	transcript.Write(responderPublicKey)
+	sessionBinding := transcript.Sum(nil)
+
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, sharedSecret, sessionBinding, peerTransportKeyInfo), keys); err != nil {
+		return errors.Wrapf(err, "peerTransport.handleRemoteVersion: Problem deriving session keys")
+	}
+	initiatorCipher, err := chacha20poly1305.New(keys[:chacha20poly1305.KeySize])
+	if err != nil {
+		return errors.Wrapf(err, "peerTransport.handleRemoteVersion: Problem creating initiator cipher")
+	}
+	responderCipher, err := chacha20poly1305.New(keys[chacha20poly1305.KeySize:])
+	if err != nil {
+		return errors.Wrapf(err, "peerTransport.handleRemoteVersion: Problem creating responder cipher")
+	}
+	if pt.isOutbound {
+		pt.negotiatedSendCipher, pt.negotiatedRecvCipher = initiatorCipher, responderCipher
+	} else {
+		pt.negotiatedSendCipher, pt.negotiatedRecvCipher = responderCipher, initiatorCipher
+	}
+	pt.sessionBinding = sessionBinding
+	return nil
+}
+
+// WriteMessage writes the message to the writer, encrypting it if our Verack message has already been sent. Writing
+// our Verack message activates encryption for all subsequent messages if the transport was negotiated.
+func (pt *peerTransport) WriteMessage(ww io.Writer, msg DeSoMessage, networkType NetworkType) ([]byte, error) {
+	pt.sendMtx.Lock()
+	defer pt.sendMtx.Unlock()
+
+	if pt.sendCipher == nil {
+		payload, err := WriteMessage(ww, msg, networkType)
+		if err != nil {
+			return nil, err
+		}
+		if msg.GetMsgType() == MsgTypeVerack {
+			pt.mtx.RLock()
+			pt.sendCipher = pt.negotiatedSendCipher
+			pt.mtx.RUnlock()
+		}
+		return payload, nil
+	}
+
+	var plaintext bytes.Buffer
+	payload, err := WriteMessage(&plaintext, msg, networkType)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := _peerTransportNonce(pt.sendNonce)
+	if err != nil {
+		return nil, errors.Wrapf(err, "peerTransport.WriteMessage: ")
+	}
+	pt.sendNonce++
+	ciphertext := pt.sendCipher.Seal(nil, nonce, plaintext.Bytes(), nil)
+
+	frame := make([]byte, 4, 4+len(ciphertext))
+	binary.BigEndian.PutUint32(frame, uint32(len(ciphertext)))
+	frame = append(frame, ciphertext...)
+	if _, err = ww.Write(frame); err != nil {
+		return nil, errors.Wrapf(err, "peerTransport.WriteMessage: Problem writing frame")
+	}
+	return payload, nil
+}
+
+// ReadMessage reads a message from the reader, decrypting it if the peer's Verack message has already been received.
+// Reading the peer's Version message negotiates the transport, and reading its Verack message activates decryption
+// for all subsequent messages.
+func (pt *peerTransport) ReadMessage(rr io.Reader, networkType NetworkType) (DeSoMessage, []byte, error) {
+	pt.recvMtx.Lock()
+	defer pt.recvMtx.Unlock()
+
+	if pt.recvCipher == nil {
+		msg, payload, err := ReadMessage(rr, networkType)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch msg.GetMsgType() {
+		case MsgTypeVersion:
+			if err = pt.handleRemoteVersion(msg.(*MsgDeSoVersion)); err != nil {
+				return nil, nil, err
+			}
+		case MsgTypeVerack:
+			pt.mtx.RLock()
+			pt.recvCipher = pt.negotiatedRecvCipher
+			pt.mtx.RUnlock()
+		}
+		return msg, payload, nil
+	}
+
+	frameLenBytes := make([]byte, 4)
+	if _, err := io.ReadFull(rr, frameLenBytes); err != nil {
+		return nil, nil, errors.Wrapf(err, "peerTransport.ReadMessage: Problem reading frame length")
+	}
+	frameLen := binary.BigEndian.Uint32(frameLenBytes)
+	if frameLen > peerTransportMaxFrameLen {
+		return nil, nil, fmt.Errorf("peerTransport.ReadMessage: Frame length %d exceeds max %d",
+			frameLen, peerTransportMaxFrameLen)
+	}
+	ciphertext := make([]byte, frameLen)
+	if _, err := io.ReadFull(rr, ciphertext); err != nil {
+		return nil, nil, errors.Wrapf(err, "peerTransport.ReadMessage: Problem reading frame")
+	}
+	nonce, err := _peerTransportNonce(pt.recvNonce)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "peerTransport.ReadMessage: ")
+	}
+	pt.recvNonce++
+	plaintext, err := pt.recvCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "peerTransport.ReadMessage: Problem decrypting frame")
+	}
+
+	plaintextReader := bytes.NewReader(plaintext)
+	msg, payload, err := ReadMessage(plaintextReader, networkType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if plaintextReader.Len() != 0 {
+		return nil, nil, fmt.Errorf("peerTransport.ReadMessage: Frame has %d trailing bytes", plaintextReader.Len())
+	}
+	// The handshake messages are only ever sent in plaintext.
+	if msg.GetMsgType() == MsgTypeVersion || msg.GetMsgType() == MsgTypeVerack {
+		return nil, nil, fmt.Errorf("peerTransport.ReadMessage: Received %v after the handshake", msg.GetMsgType())
+	}
+	return msg, payload, nil
+}
+
+// _peerTransportNonce encodes the message counter as a ChaCha20-Poly1305 nonce.
+func _peerTransportNonce(counter uint64) ([]byte, error) {
+	if counter == math.MaxUint64 {
+		return nil, fmt.Errorf("Nonce counter exhausted")
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha20poly1305.NonceSize-8:], counter)
+	return nonce, nil
+}
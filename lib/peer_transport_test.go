@@ -0,0 +1,260 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _newTestTransportVersion(transport *peerTransport, nonce uint64) *MsgDeSoVersion {
+	verMsg := &MsgDeSoVersion{
+		Version:  ProtocolVersion2.ToUint64(),
+		Services: SFFullNodeDeprecated,
+		Nonce:    nonce,
+	}
+	if transport != nil {
+		verMsg.Services |= SFEncryptedTransport
+		verMsg.TransportPublicKey = transport.GetPublicKey()
+	}
+	return verMsg
+}
+
+// _writeTestTransportMessage writes the message using the transport, or in plaintext if the transport is nil.
+func _writeTestTransportMessage(t *testing.T, transport *peerTransport, ww *bytes.Buffer, msg DeSoMessage) {
+	var err error
+	if transport != nil {
+		_, err = transport.WriteMessage(ww, msg, NetworkType_TESTNET)
+	} else {
+		_, err = WriteMessage(ww, msg, NetworkType_TESTNET)
+	}
+	require.NoError(t, err)
+}
+
+func _readTestTransportMessage(t *testing.T, transport *peerTransport, rr *bytes.Buffer) DeSoMessage {
+	var msg DeSoMessage
+	var err error
+	if transport != nil {
+		msg, _, err = transport.ReadMessage(rr, NetworkType_TESTNET)
+	} else {
+		msg, _, err = ReadMessage(rr, NetworkType_TESTNET)
+	}
+	require.NoError(t, err)
+	return msg
+}
+
+// _exchangeTestTransportHandshake runs the version and verack exchange between an outbound and an inbound transport.
+// A nil transport stands for a node that doesn't support the encrypted transport.
+func _exchangeTestTransportHandshake(
+	t *testing.T,
+	outbound *peerTransport,
+	inbound *peerTransport,
+) (_outboundToInbound *bytes.Buffer, _inboundToOutbound *bytes.Buffer) {
+	outboundToInbound, inboundToOutbound := &bytes.Buffer{}, &bytes.Buffer{}
+
+	// The outbound node sends its version, and the inbound node responds with its own version and verack.
+	_writeTestTransportMessage(t, outbound, outboundToInbound, _newTestTransportVersion(outbound, 1))
+	require.Equal(t, MsgTypeVersion, _readTestTransportMessage(t, inbound, outboundToInbound).GetMsgType())
+	_writeTestTransportMessage(t, inbound, inboundToOutbound, _newTestTransportVersion(inbound, 2))
+	_writeTestTransportMessage(t, inbound, inboundToOutbound, &MsgDeSoVerack{Version: VerackVersion0, NonceReceived: 1})
+
+	// The outbound node reads both, and sends its verack.
+	require.Equal(t, MsgTypeVersion, _readTestTransportMessage(t, outbound, inboundToOutbound).GetMsgType())
+	require.Equal(t, MsgTypeVerack, _readTestTransportMessage(t, outbound, inboundToOutbound).GetMsgType())
+	_writeTestTransportMessage(t, outbound, outboundToInbound, &MsgDeSoVerack{Version: VerackVersion0, NonceReceived: 2})
+	require.Equal(t, MsgTypeVerack, _readTestTransportMessage(t, inbound, outboundToInbound).GetMsgType())
+	return outboundToInbound, inboundToOutbound
+}
+
+func TestPeerTransport(t *testing.T) {
+	require := require.New(t)
+
+	outbound, err := newPeerTransport(true)
+	require.NoError(err)
+	inbound, err := newPeerTransport(false)
+	require.NoError(err)
+	outboundToInbound, inboundToOutbound := _exchangeTestTransportHandshake(t, outbound, inbound)
+
+	// Both nodes derived the same session binding.
+	outboundBinding, ok := outbound.GetSessionBinding()
+	require.True(ok)
+	inboundBinding, ok := inbound.GetSessionBinding()
+	require.True(ok)
+	require.Len(outboundBinding, 32)
+	require.Equal(outboundBinding, inboundBinding)
+
+	// Messages after the verack are encrypted in both directions.
+	ping := &MsgDeSoPing{Nonce: 12345}
+	var plaintext bytes.Buffer
+	_, err = WriteMessage(&plaintext, ping, NetworkType_TESTNET)
+	require.NoError(err)
+	_writeTestTransportMessage(t, outbound, outboundToInbound, ping)
+	require.NotContains(string(outboundToInbound.Bytes()), string(plaintext.Bytes()))
+	require.Equal(ping, _readTestTransportMessage(t, inbound, outboundToInbound))
+	pong := &MsgDeSoPong{Nonce: 12345}
+	_writeTestTransportMessage(t, inbound, inboundToOutbound, pong)
+	require.Equal(pong, _readTestTransportMessage(t, outbound, inboundToOutbound))
+
+	// Tampered frames are rejected.
+	_writeTestTransportMessage(t, outbound, outboundToInbound, ping)
+	outboundToInbound.Bytes()[outboundToInbound.Len()-1] ^= 0xff
+	_, _, err = inbound.ReadMessage(outboundToInbound, NetworkType_TESTNET)
+	require.Error(err)
+
+	// Replayed frames are rejected, since the nonce has moved on.
+	_writeTestTransportMessage(t, inbound, inboundToOutbound, pong)
+	frame := append([]byte{}, inboundToOutbound.Bytes()...)
+	require.Equal(pong, _readTestTransportMessage(t, outbound, inboundToOutbound))
+	inboundToOutbound.Write(frame)
+	_, _, err = outbound.ReadMessage(inboundToOutbound, NetworkType_TESTNET)
+	require.Error(err)
+
+	// Handshake messages can't be sent over the encrypted transport.
+	_writeTestTransportMessage(t, inbound, inboundToOutbound, &MsgDeSoVerack{Version: VerackVersion0, NonceReceived: 1})
+	_, _, err = outbound.ReadMessage(inboundToOutbound, NetworkType_TESTNET)
+	require.Error(err)
+}
+
+func TestPeerTransportPlaintextFallback(t *testing.T) {
+	require := require.New(t)
+
+	// If the inbound node doesn't support the encrypted transport, both directions stay in plaintext.
+	outbound, err := newPeerTransport(true)
+	require.NoError(err)
+	outboundToInbound, inboundToOutbound := _exchangeTestTransportHandshake(t, outbound, nil)
+	_, ok := outbound.GetSessionBinding()
+	require.False(ok)
+
+	ping := &MsgDeSoPing{Nonce: 12345}
+	_writeTestTransportMessage(t, outbound, outboundToInbound, ping)
+	require.Equal(ping, _readTestTransportMessage(t, nil, outboundToInbound))
+	pong := &MsgDeSoPong{Nonce: 12345}
+	_writeTestTransportMessage(t, nil, inboundToOutbound, pong)
+	require.Equal(pong, _readTestTransportMessage(t, outbound, inboundToOutbound))
+
+	// A peer advertising the encrypted transport without a valid key is rejected.
+	inbound, err := newPeerTransport(false)
+	require.NoError(err)
+	verMsg := _newTestTransportVersion(outbound, 1)
+	verMsg.TransportPublicKey = verMsg.TransportPublicKey[:16]
+	require.Error(inbound.handleRemoteVersion(verMsg))
+	// And so is a second version message.
+	require.Error(inbound.handleRemoteVersion(_newTestTransportVersion(nil, 1)))
+}
+
+func TestRemoteNodeVerackTransportBinding(t *testing.T) {
+	require := require.New(t)
+
+	keystore, err := NewBLSKeystore("0x13b5febb384a3d3dec5c579724872607cd0ddb97adef592efaf144f6d25a70d7")
+	require.NoError(err)
+	newTransportPair := func() (*peerTransport, *peerTransport) {
+		outbound, err := newPeerTransport(true)
+		require.NoError(err)
+		inbound, err := newPeerTransport(false)
+		require.NoError(err)
+		_exchangeTestTransportHandshake(t, outbound, inbound)
+		return outbound, inbound
+	}
+	validatorServices := SFFullNodeDeprecated | SFPosValidator | SFEncryptedTransport
+	nodeServices := SFFullNodeDeprecated | SFEncryptedTransport
+	// The outbound validator signs its verack for the version messages it exchanged and the session it negotiated.
+	newValidatorVerack := func(transport *peerTransport, servicesReceived ServiceFlag, transportKeyReceived []byte,
+	) *MsgDeSoVerack {
+		rn := NewRemoteNode(NewRemoteNodeId(1), nil, false, true, nil, nil, keystore, &DeSoTestnetParams,
+			0, 0, validatorServices, false)
+		rn.peer = &Peer{transport: transport}
+		rn.handshakeMetadata.negotiatedProtocolVersion = ProtocolVersion2
+		rn.handshakeMetadata.versionNonceSent = 1
+		rn.handshakeMetadata.versionNonceReceived = 2
+		rn.handshakeMetadata.servicesSent = validatorServices
+		rn.handshakeMetadata.serviceFlag = servicesReceived
+		if transport != nil {
+			rn.handshakeMetadata.transportPublicKeySent = transport.GetPublicKey()
+		}
+		rn.handshakeMetadata.transportPublicKeyReceived = transportKeyReceived
+		verack, err := rn.newVerackMessage()
+		require.NoError(err)
+		return verack
+	}
+	// The inbound node validates the verack against the version messages it exchanged and the session it negotiated.
+	validateVerack := func(transport *peerTransport, ourServices ServiceFlag, servicesReceived ServiceFlag,
+		transportKeyReceived []byte, verack *MsgDeSoVerack) (*RemoteNode, error) {
+		rn := NewRemoteNode(NewRemoteNodeId(2), nil, false, false, nil, nil, nil, &DeSoTestnetParams,
+			0, 0, ourServices, true)
+		rn.peer = &Peer{transport: transport}
+		rn.handshakeMetadata.negotiatedProtocolVersion = ProtocolVersion2
+		rn.handshakeMetadata.versionNonceSent = 2
+		rn.handshakeMetadata.versionNonceReceived = 1
+		rn.handshakeMetadata.servicesSent = ourServices
+		rn.handshakeMetadata.serviceFlag = servicesReceived
+		if transport != nil {
+			rn.handshakeMetadata.transportPublicKeySent = transport.GetPublicKey()
+		}
+		rn.handshakeMetadata.transportPublicKeyReceived = transportKeyReceived
+		return rn, rn.validateVerackPoS(verack)
+	}
+
+	outbound, inbound := newTransportPair()
+	rn, err := validateVerack(inbound, nodeServices, validatorServices, outbound.GetPublicKey(),
+		newValidatorVerack(outbound, nodeServices, inbound.GetPublicKey()))
+	require.NoError(err)
+	require.True(rn.IsEncryptedTransport())
+	require.Equal(keystore.GetSigner().GetPublicKey().Serialize(), rn.GetValidatorPublicKey().Serialize())
+
+	// A verack signed for a different session is rejected. This is what a man in the middle would have to relay.
+	otherOutbound, otherInbound := newTransportPair()
+	_, err = validateVerack(inbound, nodeServices, validatorServices, outbound.GetPublicKey(),
+		newValidatorVerack(otherOutbound, nodeServices, otherInbound.GetPublicKey()))
+	require.Error(err)
+
+	// So is a verack signed without the session binding.
+	_, err = validateVerack(inbound, nodeServices, validatorServices, outbound.GetPublicKey(),
+		newValidatorVerack(nil, nodeServices, inbound.GetPublicKey()))
+	require.Error(err)
+
+	// A man in the middle that strips the encrypted transport from only the validator's version message leaves the
+	// validator signing the handshake binding and the other node verifying the legacy signature, so it's rejected.
+	strippedServices := validatorServices &^ SFEncryptedTransport
+	_, err = validateVerack(nil, nodeServices, strippedServices, nil, newValidatorVerack(nil, nodeServices, nil))
+	require.Error(err)
+
+	// Without any tampering, a validator that doesn't support the encrypted transport completes the handshake in
+	// plaintext with a non-validator that requires the encrypted transport between validators.
+	plaintextVerack := func(servicesReceived ServiceFlag) *MsgDeSoVerack {
+		rn := NewRemoteNode(NewRemoteNodeId(1), nil, false, true, nil, nil, keystore, &DeSoTestnetParams,
+			0, 0, strippedServices, false)
+		rn.peer = &Peer{}
+		rn.handshakeMetadata.negotiatedProtocolVersion = ProtocolVersion2
+		rn.handshakeMetadata.versionNonceSent = 1
+		rn.handshakeMetadata.versionNonceReceived = 2
+		rn.handshakeMetadata.servicesSent = strippedServices
+		rn.handshakeMetadata.serviceFlag = servicesReceived
+		verack, err := rn.newVerackMessage()
+		require.NoError(err)
+		return verack
+	}
+	rn, err = validateVerack(nil, nodeServices, strippedServices, nil, plaintextVerack(nodeServices))
+	require.NoError(err)
+	require.False(rn.IsEncryptedTransport())
+
+	// But a validator that requires the encrypted transport between validators rejects it.
+	_, err = validateVerack(nil, validatorServices, strippedServices, nil, plaintextVerack(validatorServices))
+	require.Error(err)
+
+	// A validator that predates the encrypted transport signs the legacy handshake payload, which we accept.
+	legacyVerack := plaintextVerack(nodeServices)
+	legacyVerack.Signature, err = keystore.GetSigner().SignPoSValidatorHandshake(legacyVerack.NonceSent,
+		legacyVerack.NonceReceived, legacyVerack.TstampMicro)
+	require.NoError(err)
+	rn, err = validateVerack(nil, nodeServices, strippedServices, nil, legacyVerack)
+	require.NoError(err)
+	require.Equal(keystore.GetSigner().GetPublicKey().Serialize(), rn.GetValidatorPublicKey().Serialize())
+
+	// And a validator that supports the encrypted transport signs the legacy handshake payload for a node that
+	// predates it, so that node can verify it.
+	upgradedVerack := newValidatorVerack(nil, nodeServices&^SFEncryptedTransport, nil)
+	ok, err := BLSVerifyPoSValidatorHandshake(upgradedVerack.NonceSent, upgradedVerack.NonceReceived,
+		upgradedVerack.TstampMicro, upgradedVerack.Signature, upgradedVerack.PublicKey)
+	require.NoError(err)
+	require.True(ok)
+}
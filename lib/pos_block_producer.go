@@ -283,7 +283,11 @@ func (pbp *PosBlockProducer) createBlockWithoutHeader(
 	return block, nil
 }
 
-// getBlockTransactions is used to retrieve fee-time ordered transactions from the mempool.
+// getBlockTransactions is used to retrieve fee-time ordered transactions from the mempool. Transactions in a package
+// are ordered by their package fee rate, with ancestors ahead of their descendants, so a high fee child moves its
+// parents up with it. Transactions are still selected one at a time, though, so a package isn't guaranteed to make it
+// into the block whole: the block size limit can cut it off partway. If a transaction in a package is skipped, its
+// descendants are skipped as well, since their fees were only meant to pay for it.
 func (pbp *PosBlockProducer) getBlockTransactions(
 	blockProducerPublicKey *PublicKey,
 	latestBlockView *UtxoView,
@@ -305,6 +309,8 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 
 	// Create an instance of SafeUtxoView to connect transactions to.
 	safeUtxoView := NewSafeUtxoView(latestBlockView)
+	// The hashes of transactions we've skipped, so that we can skip their package descendants too.
+	skippedTxnHashes := NewSet([]BlockHash{})
 
 	for _, txn := range feeTimeTxns {
 		// If we've exceeded the soft max block size, we exit. We want to allow at least one txn that moves the
@@ -317,9 +323,20 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 			return nil, 0, errors.Wrapf(err, "Error getting transaction size: ")
 		}
 
+		// Skip over transactions whose package parent was skipped. Ancestors are always ordered ahead of their
+		// descendants, so the parent has already been considered.
+		if skippedTxnHashes.Size() > 0 {
+			parentHash := pbp.mp.GetPackageParentHash(txn.Hash)
+			if parentHash != nil && skippedTxnHashes.Includes(*parentHash) {
+				skippedTxnHashes.Add(*txn.Hash)
+				continue
+			}
+		}
+
 		// Skip over transactions that are too big. The block would be too large
 		// to be accepted by the network.
 		if currentBlockSize+uint64(len(txnBytes)) > hardMaxBlockSizeBytes {
+			skippedTxnHashes.Add(*txn.Hash)
 			continue
 		}
 
@@ -330,6 +347,7 @@ func (pbp *PosBlockProducer) getBlockTransactions(
 
 		// If the transaction fails to connect, then we skip it.
 		if err != nil {
+			skippedTxnHashes.Add(*txn.Hash)
 			continue
 		}
 
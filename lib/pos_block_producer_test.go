@@ -173,6 +173,61 @@ func TestCreateBlockWithoutHeader(t *testing.T) {
 	}
 }
 
+func TestGetBlockTransactionsSkipsPackageDescendants(t *testing.T) {
+	require := require.New(t)
+	seed := int64(391)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetupWithBalances(t, 200000, 200000)
+	params.ForkHeights.ProofOfStake2ConsensusCutoverBlockHeight = 1
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 10000, 100,
+	))
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+
+	generateTxn := func(pk []byte, priv string, feeNanos uint64, partialID uint64, extraDataSize int) *MsgDeSoTxn {
+		txn := _generateTestTxn(t, rand, feeMin, feeMax, pk, priv, 100, 20)
+		txn.TxnFeeNanos = feeNanos
+		txn.TxnNonce.PartialID = partialID
+		if extraDataSize > 0 {
+			txn.ExtraData = map[string][]byte{"padding": RandomBytes(int32(extraDataSize))}
+		}
+		_signTxn(t, txn, priv)
+		return txn
+	}
+
+	// The parent is too big to fit in the block, so its high fee child must be left out too, while the other
+	// transaction still makes it in.
+	parentTxn := generateTxn(m0PubBytes, m0Priv, 5000, 5000, 2000)
+	childTxn := generateTxn(m0PubBytes, m0Priv, 100000, 5001, 0)
+	otherTxn := generateTxn(m1PubBytes, m1Priv, 1000, 7000, 0)
+	require.NoError(mempool.AddTransactionPackage([]*MsgDeSoTxn{parentTxn, childTxn}, time.Now()))
+	_wrappedPosMempoolAddTransaction(t, mempool, otherTxn)
+	require.Equal(*parentTxn.Hash(), *mempool.GetPackageParentHash(childTxn.Hash()))
+	require.Nil(mempool.GetPackageParentHash(otherTxn.Hash()))
+
+	pbp := NewPosBlockProducer(mempool, params, NewPublicKey(m1PubBytes), nil, time.Now().UnixNano())
+	txns, _, err := pbp.getBlockTransactions(NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 1000, 1000)
+	require.NoError(err)
+	require.Equal([]*MsgDeSoTxn{otherTxn}, txns)
+
+	// With room for the parent, the whole package is included ahead of the other transaction.
+	txns, _, err = pbp.getBlockTransactions(NewPublicKey(m1PubBytes), latestBlockView, 3, 0, 10000, 10000)
+	require.NoError(err)
+	require.Equal([]*MsgDeSoTxn{parentTxn, childTxn, otherTxn}, txns)
+}
+
 func TestGetBlockTransactions(t *testing.T) {
 	require := require.New(t)
 	seed := int64(381)
@@ -1728,7 +1728,6 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 	utxoOps := utxoViewAndUtxoOps.UtxoOps
 	block := utxoViewAndUtxoOps.Block
 	// Put the block in the db
-	// Note: we're skipping postgres.
 	blockNode.Status |= StatusBlockCommitted
 	err = bc.db.Update(func(txn *badger.Txn) error {
 		if bc.snapshot != nil {
@@ -1796,6 +1795,17 @@ func (bc *Blockchain) commitBlockPoS(blockHash *BlockHash, verifySignatures bool
 	if err != nil {
 		return errors.Wrapf(err, "commitBlockPoS: Problem putting block in db: ")
 	}
+	// If we're running with postgres, write the block, its transactions, and the resulting
+	// view to postgres only once badger has committed the block. Badger still gets the block
+	// node, utxo operations, and the PoS entries above, since those are always read from badger.
+	// The postgres write is a single transaction that moves the chain tip last, so if it fails
+	// postgres is left at the parent block and _initChain refuses to start until it is resynced.
+	if bc.postgres != nil {
+		if err = bc.postgres.CommitBlockAndFlushView(
+			blockNode, block, utxoView, uint64(blockNode.Height)); err != nil {
+			return errors.Wrapf(err, "commitBlockPoS: Problem writing committed block %v to postgres", blockHash)
+		}
+	}
 
 	if bc.snapshot != nil {
 		bc.snapshot.FinishProcessBlock(blockNode)
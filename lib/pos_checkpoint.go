@@ -0,0 +1,412 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/collections/bitset"
+	"github.com/deso-protocol/core/consensus"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// pos_checkpoint.go implements peer-to-peer checkpoint distribution. Rather than trusting the HTTP checkpoint syncing
+// providers, a syncing node can ask its peers for their committed tip:
+//
+//  1. The syncing node sends a MsgDeSoGetCheckpoint to each peer that advertises SFCheckpoints.
+//  2. The peer responds with a MsgDeSoCheckpoint holding the header of its committed tip, the header of the committed
+//     tip's child, and the validators' QC for the child.
+//  3. The syncing node verifies the QC against the validator set it knows, and uses the committed tip as its
+//     checkpoint block if it's higher than the current one.
+//
+// Under the Fast-HotStuff commit rule, a block is committed once its child, proposed in the very next view, is
+// certified by a QC. So the child's header and QC prove that the checkpoint block is committed. The QC's signers are
+// listed by voting public key rather than as a signers bitset, which indexes into the validator set of the child's
+// epoch. This lets a node whose validator set is a few epochs behind still verify the QC, as long as validators with
+// a super-majority of the stake it knows about signed it. A node that doesn't know any validator set, i.e. one that
+// hasn't synced past the PoS cutover, can't verify checkpoints from peers and has to rely on the HTTP providers.
+
+// ==================================================================
+// Get Checkpoint Message
+// ==================================================================
+
+type MsgDeSoGetCheckpoint struct {
+	MsgVersion MsgCheckpointVersion
+}
+
+func (msg *MsgDeSoGetCheckpoint) GetMsgType() MsgType {
+	return MsgTypeGetCheckpoint
+}
+
+func (msg *MsgDeSoGetCheckpoint) ToBytes(bool) ([]byte, error) {
+	if msg.MsgVersion != MsgCheckpointVersion0 {
+		return nil, fmt.Errorf("MsgDeSoGetCheckpoint.ToBytes: Invalid MsgVersion %d", msg.MsgVersion)
+	}
+	return []byte{msg.MsgVersion}, nil
+}
+
+func (msg *MsgDeSoGetCheckpoint) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	msgVersion, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetCheckpoint.FromBytes: Error decoding MsgVersion")
+	}
+	if msgVersion != MsgCheckpointVersion0 {
+		return fmt.Errorf("MsgDeSoGetCheckpoint.FromBytes: Invalid MsgVersion %d", msgVersion)
+	}
+	msg.MsgVersion = msgVersion
+	return nil
+}
+
+func (msg *MsgDeSoGetCheckpoint) String() string {
+	return fmt.Sprintf("{MsgVersion: %d}", msg.MsgVersion)
+}
+
+// ==================================================================
+// Checkpoint Message
+// ==================================================================
+
+type MsgDeSoCheckpoint struct {
+	MsgVersion MsgCheckpointVersion
+
+	// Header is the header of the committed block.
+	Header *MsgDeSoHeader
+
+	// ChildHeader is the header of the committed block's child, which was proposed in the view right after it.
+	ChildHeader *MsgDeSoHeader
+
+	// SignerPublicKeys are the voting public keys of the validators that voted for ChildHeader.
+	SignerPublicKeys []*bls.PublicKey
+
+	// AggregatedSignature is the signers' aggregated signature of the (ProposedInView, BlockHash) pair of
+	// ChildHeader.
+	AggregatedSignature *bls.Signature
+}
+
+func (msg *MsgDeSoCheckpoint) GetMsgType() MsgType {
+	return MsgTypeCheckpoint
+}
+
+func (msg *MsgDeSoCheckpoint) ToBytes(bool) ([]byte, error) {
+	if msg.MsgVersion != MsgCheckpointVersion0 {
+		return nil, fmt.Errorf("MsgDeSoCheckpoint.ToBytes: Invalid MsgVersion %d", msg.MsgVersion)
+	}
+	if msg.Header == nil || msg.ChildHeader == nil {
+		return nil, fmt.Errorf("MsgDeSoCheckpoint.ToBytes: Header and ChildHeader should not be nil")
+	}
+	if msg.AggregatedSignature == nil {
+		return nil, fmt.Errorf("MsgDeSoCheckpoint.ToBytes: AggregatedSignature should not be nil")
+	}
+
+	retBytes := []byte{}
+
+	// MsgVersion
+	retBytes = append(retBytes, msg.MsgVersion)
+
+	// Header
+	headerBytes, err := msg.Header.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCheckpoint.ToBytes: Problem encoding header")
+	}
+	retBytes = append(retBytes, EncodeByteArray(headerBytes)...)
+
+	// ChildHeader
+	childHeaderBytes, err := msg.ChildHeader.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCheckpoint.ToBytes: Problem encoding child header")
+	}
+	retBytes = append(retBytes, EncodeByteArray(childHeaderBytes)...)
+
+	// SignerPublicKeys
+	retBytes = append(retBytes, UintToBuf(uint64(len(msg.SignerPublicKeys)))...)
+	for _, signerPublicKey := range msg.SignerPublicKeys {
+		if signerPublicKey == nil {
+			return nil, fmt.Errorf("MsgDeSoCheckpoint.ToBytes: SignerPublicKeys should not contain nil keys")
+		}
+		retBytes = append(retBytes, EncodeBLSPublicKey(signerPublicKey)...)
+	}
+
+	// AggregatedSignature
+	retBytes = append(retBytes, EncodeBLSSignature(msg.AggregatedSignature)...)
+
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoCheckpoint) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// MsgVersion
+	msgVersion, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding MsgVersion")
+	}
+	if msgVersion != MsgCheckpointVersion0 {
+		return fmt.Errorf("MsgDeSoCheckpoint.FromBytes: Invalid MsgVersion %d", msgVersion)
+	}
+	retMsg := &MsgDeSoCheckpoint{MsgVersion: msgVersion}
+
+	// Header
+	headerBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding header")
+	}
+	retMsg.Header = NewMessage(MsgTypeHeader).(*MsgDeSoHeader)
+	if err = retMsg.Header.FromBytes(headerBytes); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding header")
+	}
+
+	// ChildHeader
+	childHeaderBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding child header")
+	}
+	retMsg.ChildHeader = NewMessage(MsgTypeHeader).(*MsgDeSoHeader)
+	if err = retMsg.ChildHeader.FromBytes(childHeaderBytes); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding child header")
+	}
+
+	// SignerPublicKeys
+	numSignerPublicKeys, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding number of signer public keys")
+	}
+	if numSignerPublicKeys > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoCheckpoint.FromBytes: Number of signer public keys %d exceeds remaining "+
+			"bytes %d", numSignerPublicKeys, rr.Len())
+	}
+	for ii := uint64(0); ii < numSignerPublicKeys; ii++ {
+		signerPublicKey, err := DecodeBLSPublicKey(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding signer public key")
+		}
+		retMsg.SignerPublicKeys = append(retMsg.SignerPublicKeys, signerPublicKey)
+	}
+
+	// AggregatedSignature
+	retMsg.AggregatedSignature, err = DecodeBLSSignature(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCheckpoint.FromBytes: Error decoding AggregatedSignature")
+	}
+
+	*msg = *retMsg
+	return nil
+}
+
+func (msg *MsgDeSoCheckpoint) String() string {
+	return fmt.Sprintf("{MsgVersion: %d, Header: %v, ChildHeader: %v, NumSigners: %d}",
+		msg.MsgVersion, msg.Header, msg.ChildHeader, len(msg.SignerPublicKeys))
+}
+
+// ==================================================================
+// Checkpoint Verification
+// ==================================================================
+
+// ToCheckpointBlockInfo verifies that the checkpoint's block is committed, using the QC for its child and the
+// validator set we know, and returns the checkpoint block info for it.
+func (msg *MsgDeSoCheckpoint) ToCheckpointBlockInfo(validatorSet []*ValidatorEntry) (*CheckpointBlockInfo, error) {
+	blockHash, childBlockHash, err := msg.validateHeaders()
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCheckpoint.ToCheckpointBlockInfo: ")
+	}
+
+	// Rebuild the QC for the child using the signers' indexes in our validator set.
+	validatorIndexes := make(map[bls.SerializedPublicKey]int, len(validatorSet))
+	for ii, validatorEntry := range validatorSet {
+		validatorIndexes[validatorEntry.VotingPublicKey.Serialize()] = ii
+	}
+	signersList := bitset.NewBitset()
+	for _, signerPublicKey := range msg.SignerPublicKeys {
+		validatorIndex, exists := validatorIndexes[signerPublicKey.Serialize()]
+		if !exists {
+			return nil, fmt.Errorf("MsgDeSoCheckpoint.ToCheckpointBlockInfo: Signer %v isn't in the known "+
+				"validator set", signerPublicKey.ToAbbreviatedString())
+		}
+		if signersList.Get(validatorIndex) {
+			return nil, fmt.Errorf("MsgDeSoCheckpoint.ToCheckpointBlockInfo: Duplicate signer %v",
+				signerPublicKey.ToAbbreviatedString())
+		}
+		signersList.Set(validatorIndex, true)
+	}
+	childQC := &QuorumCertificate{
+		BlockHash:      childBlockHash,
+		ProposedInView: msg.ChildHeader.ProposedInView,
+		ValidatorsVoteAggregatedSignature: &AggregatedBLSSignature{
+			SignersList: signersList,
+			Signature:   msg.AggregatedSignature,
+		},
+	}
+	if !consensus.IsValidSuperMajorityQuorumCertificate(childQC, toConsensusValidators(validatorSet)) {
+		return nil, fmt.Errorf("MsgDeSoCheckpoint.ToCheckpointBlockInfo: QC isn't signed by a super-majority " +
+			"of the known validator set")
+	}
+
+	return &CheckpointBlockInfo{
+		Height:     msg.Header.Height,
+		Hash:       blockHash,
+		HashHex:    blockHash.String(),
+		LatestView: msg.ChildHeader.ProposedInView,
+	}, nil
+}
+
+// validateHeaders checks that the checkpoint's headers are PoS headers, and that the child header extends the
+// checkpoint block in the very next view. It returns the hashes of the two headers.
+func (msg *MsgDeSoCheckpoint) validateHeaders() (_blockHash *BlockHash, _childBlockHash *BlockHash, _err error) {
+	if msg.Header == nil || msg.ChildHeader == nil || msg.AggregatedSignature == nil {
+		return nil, nil, fmt.Errorf("MsgDeSoCheckpoint.validateHeaders: Checkpoint is missing fields")
+	}
+	if msg.Header.Version < HeaderVersion2 || msg.ChildHeader.Version < HeaderVersion2 {
+		return nil, nil, fmt.Errorf("MsgDeSoCheckpoint.validateHeaders: Checkpoint headers must be PoS headers")
+	}
+	blockHash, err := msg.Header.Hash()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "MsgDeSoCheckpoint.validateHeaders: Problem hashing header")
+	}
+	childBlockHash, err := msg.ChildHeader.Hash()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "MsgDeSoCheckpoint.validateHeaders: Problem hashing child header")
+	}
+	if msg.ChildHeader.PrevBlockHash == nil || !msg.ChildHeader.PrevBlockHash.IsEqual(blockHash) ||
+		msg.ChildHeader.Height != msg.Header.Height+1 {
+		return nil, nil, fmt.Errorf("MsgDeSoCheckpoint.validateHeaders: Child header doesn't extend header")
+	}
+	if msg.ChildHeader.ProposedInView != msg.Header.ProposedInView+1 {
+		return nil, nil, fmt.Errorf("MsgDeSoCheckpoint.validateHeaders: Child header view %d doesn't follow "+
+			"header view %d", msg.ChildHeader.ProposedInView, msg.Header.ProposedInView)
+	}
+	return blockHash, childBlockHash, nil
+}
+
+// ==================================================================
+// Blockchain Checkpoints
+// ==================================================================
+
+// GetCommittedTipCheckpoint returns the checkpoint for our committed tip, which we send to peers that request it.
+// The checkpoint is cached until the committed tip changes.
+func (bc *Blockchain) GetCommittedTipCheckpoint() (*MsgDeSoCheckpoint, error) {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	committedTip, committedTipIndex := bc.GetCommittedTip()
+	if committedTip == nil {
+		return nil, fmt.Errorf("Blockchain.GetCommittedTipCheckpoint: No committed tip")
+	}
+
+	bc.committedTipCheckpointLock.Lock()
+	defer bc.committedTipCheckpointLock.Unlock()
+	if bc.committedTipCheckpoint != nil && bc.committedTipCheckpointHash.IsEqual(committedTip.Hash) {
+		return bc.committedTipCheckpoint, nil
+	}
+
+	// The committed tip's child must have been proposed in the very next view, and the child's QC is held by the
+	// block after it.
+	if committedTipIndex+2 >= len(bc.bestChain) {
+		return nil, fmt.Errorf("Blockchain.GetCommittedTipCheckpoint: Committed tip has no certified child")
+	}
+	childBlock := bc.bestChain[committedTipIndex+1]
+	grandchildBlock := bc.bestChain[committedTipIndex+2]
+	if committedTip.Header.Version < HeaderVersion2 || childBlock.Header.Version < HeaderVersion2 ||
+		childBlock.Header.ProposedInView != committedTip.Header.ProposedInView+1 {
+		return nil, fmt.Errorf("Blockchain.GetCommittedTipCheckpoint: Committed tip's child isn't a PoS block " +
+			"proposed in the next view")
+	}
+	childQC, ok := grandchildBlock.Header.GetQC().(*QuorumCertificate)
+	if !ok || childQC == nil || childQC.BlockHash == nil || !childQC.BlockHash.IsEqual(childBlock.Hash) ||
+		childQC.ValidatorsVoteAggregatedSignature == nil {
+		return nil, fmt.Errorf("Blockchain.GetCommittedTipCheckpoint: Committed tip's child has no QC")
+	}
+
+	// The child's QC was validated against the validator set after connecting the child, which may be in the epoch
+	// after the committed tip's.
+	validatorSet, err := bc.getSnapshotValidatorSetAfterBlockHeight(uint64(childBlock.Height))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Blockchain.GetCommittedTipCheckpoint: ")
+	}
+	signersList := childQC.ValidatorsVoteAggregatedSignature.SignersList
+	var signerPublicKeys []*bls.PublicKey
+	for ii, validatorEntry := range validatorSet {
+		if signersList.Get(ii) {
+			signerPublicKeys = append(signerPublicKeys, validatorEntry.VotingPublicKey)
+		}
+	}
+
+	bc.committedTipCheckpoint = &MsgDeSoCheckpoint{
+		MsgVersion:          MsgCheckpointVersion0,
+		Header:              committedTip.Header,
+		ChildHeader:         childBlock.Header,
+		SignerPublicKeys:    signerPublicKeys,
+		AggregatedSignature: childQC.ValidatorsVoteAggregatedSignature.Signature,
+	}
+	bc.committedTipCheckpointHash = committedTip.Hash
+	return bc.committedTipCheckpoint, nil
+}
+
+// getSnapshotValidatorSetAfterBlockHeight returns the validator set that results from connecting the block at the
+// height. The block must be in the epoch of the committed tip or the next one.
+func (bc *Blockchain) getSnapshotValidatorSetAfterBlockHeight(blockHeight uint64) ([]*ValidatorEntry, error) {
+	utxoView := bc.GetCommittedTipView()
+	currentEpochEntry, err := utxoView.GetCurrentEpochEntry()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getSnapshotValidatorSetAfterBlockHeight: Problem getting current epoch entry")
+	}
+	nextEpochEntry, err := utxoView.simulateNextEpochEntry(currentEpochEntry.EpochNumber, currentEpochEntry.FinalBlockHeight)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getSnapshotValidatorSetAfterBlockHeight: Problem getting next epoch entry")
+	}
+	epochEntry, err := getEpochEntryForBlockHeight(blockHeight+1, []*EpochEntry{currentEpochEntry, nextEpochEntry})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getSnapshotValidatorSetAfterBlockHeight: Block height %d is past the epoch "+
+			"after the committed tip's, which ends at block height %d", blockHeight, nextEpochEntry.FinalBlockHeight)
+	}
+	snapshotEpochNumber, err := utxoView.ComputeSnapshotEpochNumberForEpoch(epochEntry.EpochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getSnapshotValidatorSetAfterBlockHeight: Problem computing snapshot epoch number")
+	}
+	validatorSet, err := utxoView.GetAllSnapshotValidatorSetEntriesByStakeAtEpochNumber(snapshotEpochNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getSnapshotValidatorSetAfterBlockHeight: Problem getting validator set")
+	}
+	return validatorSet, nil
+}
+
+// ProcessCheckpoint verifies a checkpoint received from a peer against the validator set that voted on its child, and
+// makes it our checkpoint block if it's higher than the current one. It returns true if the checkpoint was used. We
+// only know the validator sets of the committed tip's epoch and the next one, so checkpoints from later epochs are
+// rejected rather than verified against a validator set that may no longer be active.
+func (bc *Blockchain) ProcessCheckpoint(msg *MsgDeSoCheckpoint) (_updated bool, _err error) {
+	if msg.Header == nil || msg.ChildHeader == nil {
+		return false, fmt.Errorf("Blockchain.ProcessCheckpoint: Header and ChildHeader should not be nil")
+	}
+	currentCheckpointBlockInfo := bc.GetCheckpointBlockInfo()
+	if currentCheckpointBlockInfo != nil && currentCheckpointBlockInfo.Hash != nil &&
+		msg.Header.Height <= currentCheckpointBlockInfo.Height {
+		return false, nil
+	}
+
+	validatorSet, err := bc.getSnapshotValidatorSetAfterBlockHeight(msg.ChildHeader.Height)
+	if err != nil {
+		return false, errors.Wrapf(err, "Blockchain.ProcessCheckpoint: ")
+	}
+	if len(validatorSet) == 0 {
+		return false, fmt.Errorf("Blockchain.ProcessCheckpoint: No known validator set to verify checkpoint with")
+	}
+	checkpointBlockInfo, err := msg.ToCheckpointBlockInfo(validatorSet)
+	if err != nil {
+		return false, errors.Wrapf(err, "Blockchain.ProcessCheckpoint: ")
+	}
+
+	bc.checkpointBlockInfoLock.Lock()
+	defer bc.checkpointBlockInfoLock.Unlock()
+	// Another checkpoint may have been set while we were verifying this one.
+	if bc.checkpointBlockInfo != nil && bc.checkpointBlockInfo.Hash != nil &&
+		checkpointBlockInfo.Height <= bc.checkpointBlockInfo.Height {
+		return false, nil
+	}
+	if bc.checkpointBlockInfo != nil && bc.checkpointBlockInfo.LatestView > checkpointBlockInfo.LatestView {
+		checkpointBlockInfo.LatestView = bc.checkpointBlockInfo.LatestView
+	}
+	glog.V(1).Infof("Blockchain.ProcessCheckpoint: Setting checkpoint block info to: %v", checkpointBlockInfo)
+	bc.checkpointBlockInfo = checkpointBlockInfo
+	return true, nil
+}
@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/deso-protocol/core/bls"
+	"github.com/deso-protocol/core/consensus"
+	"github.com/deso-protocol/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// _generateTestCheckpoint returns a checkpoint signed by the validators with the given private keys, along with the
+// validator set, in which every validator has the same stake.
+func _generateTestCheckpoint(t *testing.T, numValidators int, numSigners int) (
+	*MsgDeSoCheckpoint, []*ValidatorEntry, []*bls.PrivateKey) {
+	require := require.New(t)
+
+	var validatorSet []*ValidatorEntry
+	var privateKeys []*bls.PrivateKey
+	for ii := 0; ii < numValidators; ii++ {
+		privateKey, err := bls.NewPrivateKey()
+		require.NoError(err)
+		privateKeys = append(privateKeys, privateKey)
+		validatorSet = append(validatorSet, &ValidatorEntry{
+			ValidatorPKID:         &PKID{byte(ii)},
+			VotingPublicKey:       privateKey.PublicKey(),
+			TotalStakeAmountNanos: uint256.NewInt(100),
+		})
+	}
+
+	header := createTestBlockHeaderVersion2(t, false)
+	header.Height = 1000
+	header.ProposedInView = 2000
+	headerHash, err := header.Hash()
+	require.NoError(err)
+	childHeader := createTestBlockHeaderVersion2(t, false)
+	childHeader.PrevBlockHash = headerHash
+	childHeader.Height = 1001
+	childHeader.ProposedInView = 2001
+	childHeaderHash, err := childHeader.Hash()
+	require.NoError(err)
+
+	checkpoint := &MsgDeSoCheckpoint{
+		MsgVersion:  MsgCheckpointVersion0,
+		Header:      header,
+		ChildHeader: childHeader,
+	}
+	signaturePayload := consensus.GetVoteSignaturePayload(childHeader.ProposedInView, childHeaderHash)
+	var signatures []*bls.Signature
+	for _, privateKey := range privateKeys[:numSigners] {
+		signature, err := privateKey.Sign(signaturePayload[:])
+		require.NoError(err)
+		signatures = append(signatures, signature)
+		checkpoint.SignerPublicKeys = append(checkpoint.SignerPublicKeys, privateKey.PublicKey())
+	}
+	checkpoint.AggregatedSignature, err = bls.AggregateSignatures(signatures)
+	require.NoError(err)
+	return checkpoint, validatorSet, privateKeys
+}
+
+func TestCheckpointEncodeDecode(t *testing.T) {
+	require := require.New(t)
+	checkpoint, _, _ := _generateTestCheckpoint(t, 4, 3)
+
+	var buf bytes.Buffer
+	_, err := WriteMessage(&buf, checkpoint, NetworkType_TESTNET)
+	require.NoError(err)
+	decodedMsg, _, err := ReadMessage(&buf, NetworkType_TESTNET)
+	require.NoError(err)
+	decodedCheckpoint := decodedMsg.(*MsgDeSoCheckpoint)
+	require.True(checkpoint.AggregatedSignature.Eq(decodedCheckpoint.AggregatedSignature))
+	require.Len(decodedCheckpoint.SignerPublicKeys, 3)
+	for ii := range checkpoint.SignerPublicKeys {
+		require.True(checkpoint.SignerPublicKeys[ii].Eq(decodedCheckpoint.SignerPublicKeys[ii]))
+	}
+	headerHash, err := checkpoint.Header.Hash()
+	require.NoError(err)
+	decodedHeaderHash, err := decodedCheckpoint.Header.Hash()
+	require.NoError(err)
+	require.Equal(headerHash, decodedHeaderHash)
+	childHeaderHash, err := checkpoint.ChildHeader.Hash()
+	require.NoError(err)
+	decodedChildHeaderHash, err := decodedCheckpoint.ChildHeader.Hash()
+	require.NoError(err)
+	require.Equal(childHeaderHash, decodedChildHeaderHash)
+
+	getCheckpoint := &MsgDeSoGetCheckpoint{MsgVersion: MsgCheckpointVersion0}
+	getCheckpointBytes, err := getCheckpoint.ToBytes(false)
+	require.NoError(err)
+	decodedGetCheckpoint := &MsgDeSoGetCheckpoint{}
+	require.NoError(decodedGetCheckpoint.FromBytes(getCheckpointBytes))
+	require.Equal(getCheckpoint, decodedGetCheckpoint)
+	require.Error((&MsgDeSoGetCheckpoint{}).FromBytes([]byte{1}))
+}
+
+func TestCheckpointVerification(t *testing.T) {
+	require := require.New(t)
+	checkpoint, validatorSet, privateKeys := _generateTestCheckpoint(t, 4, 3)
+
+	// A checkpoint signed by a super-majority of the validator set is valid.
+	checkpointBlockInfo, err := checkpoint.ToCheckpointBlockInfo(validatorSet)
+	require.NoError(err)
+	headerHash, err := checkpoint.Header.Hash()
+	require.NoError(err)
+	require.Equal(uint64(1000), checkpointBlockInfo.Height)
+	require.Equal(headerHash, checkpointBlockInfo.Hash)
+	require.Equal(headerHash.String(), checkpointBlockInfo.HashHex)
+	require.Equal(uint64(2001), checkpointBlockInfo.LatestView)
+
+	// The signers are identified by public key, so the validator set's order doesn't matter, and validators that
+	// joined since don't prevent verification as long as the signers still hold a super-majority of the stake.
+	reorderedValidatorSet := []*ValidatorEntry{validatorSet[3], validatorSet[1], validatorSet[0], validatorSet[2]}
+	_, err = checkpoint.ToCheckpointBlockInfo(reorderedValidatorSet)
+	require.NoError(err)
+	newPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	extendedValidatorSet := append(validatorSet, &ValidatorEntry{
+		ValidatorPKID:         &PKID{0xff},
+		VotingPublicKey:       newPrivateKey.PublicKey(),
+		TotalStakeAmountNanos: uint256.NewInt(10),
+	})
+	_, err = checkpoint.ToCheckpointBlockInfo(extendedValidatorSet)
+	require.NoError(err)
+
+	// Signers that we don't know about, or that hold less than a super-majority of the stake, aren't enough.
+	_, err = checkpoint.ToCheckpointBlockInfo(validatorSet[1:])
+	require.Error(err)
+	extendedValidatorSet[4].TotalStakeAmountNanos = uint256.NewInt(200)
+	_, err = checkpoint.ToCheckpointBlockInfo(extendedValidatorSet)
+	require.Error(err)
+	minorityCheckpoint, minorityValidatorSet, _ := _generateTestCheckpoint(t, 3, 2)
+	_, err = minorityCheckpoint.ToCheckpointBlockInfo(minorityValidatorSet)
+	require.Error(err)
+
+	// Duplicate signers are rejected.
+	duplicateCheckpoint := *checkpoint
+	duplicateCheckpoint.SignerPublicKeys = append(checkpoint.SignerPublicKeys[:2:2], checkpoint.SignerPublicKeys[0])
+	_, err = duplicateCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.Error(err)
+
+	// The signature must match the signers.
+	badSignatureCheckpoint := *checkpoint
+	badSignatureCheckpoint.SignerPublicKeys = []*bls.PublicKey{
+		privateKeys[0].PublicKey(), privateKeys[1].PublicKey(), privateKeys[3].PublicKey(),
+	}
+	_, err = badSignatureCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.Error(err)
+
+	// The child must extend the checkpoint block in the very next view.
+	badChildCheckpoint, validatorSet, _ := _generateTestCheckpoint(t, 4, 4)
+	badChildCheckpoint.ChildHeader.ProposedInView++
+	_, err = badChildCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.Error(err)
+	badChildCheckpoint, validatorSet, _ = _generateTestCheckpoint(t, 4, 4)
+	badChildCheckpoint.ChildHeader.PrevBlockHash = &BlockHash{0x01}
+	_, err = badChildCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.Error(err)
+	badChildCheckpoint, validatorSet, _ = _generateTestCheckpoint(t, 4, 4)
+	badChildCheckpoint.Header.Version = HeaderVersion1
+	_, err = badChildCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.Error(err)
+}
+
+func TestBlockchainCheckpoints(t *testing.T) {
+	require := require.New(t)
+	testMeta := NewTestPoSBlockchainWithValidators(t)
+	chain := testMeta.chain
+
+	// Process three blocks in consecutive views, so that the first one is committed.
+	blockHeight := uint64(testMeta.savedHeight)
+	prevBlockHash := chain.BlockTip().Hash
+	var blockHashes []*BlockHash
+	for ii := uint64(0); ii < 3; ii++ {
+		var block *MsgDeSoBlock
+		block = _generateRealBlock(testMeta, blockHeight+ii, blockHeight+ii, int64(1000+ii), prevBlockHash, false)
+		success, _, _, err := chain.ProcessBlockPoS(block, blockHeight+ii, true)
+		require.NoError(err)
+		require.True(success)
+		prevBlockHash, err = block.Hash()
+		require.NoError(err)
+		blockHashes = append(blockHashes, prevBlockHash)
+	}
+	_verifyCommitRuleHelper(testMeta, []*BlockHash{blockHashes[0]}, blockHashes[1:], blockHashes[0])
+
+	// The checkpoint for the committed tip is proven by the QC for its child.
+	checkpoint, err := chain.GetCommittedTipCheckpoint()
+	require.NoError(err)
+	checkpointHash, err := checkpoint.Header.Hash()
+	require.NoError(err)
+	require.Equal(blockHashes[0], checkpointHash)
+	childHash, err := checkpoint.ChildHeader.Hash()
+	require.NoError(err)
+	require.Equal(blockHashes[1], childHash)
+	cachedCheckpoint, err := chain.GetCommittedTipCheckpoint()
+	require.NoError(err)
+	require.True(checkpoint == cachedCheckpoint)
+
+	// The checkpoint verifies against the validator set at the committed tip, and replaces lower checkpoints.
+	chain.checkpointBlockInfo = &CheckpointBlockInfo{Height: blockHeight - 1, Hash: &BlockHash{0x01}, LatestView: 1}
+	updated, err := chain.ProcessCheckpoint(checkpoint)
+	require.NoError(err)
+	require.True(updated)
+	checkpointBlockInfo := chain.GetCheckpointBlockInfo()
+	require.Equal(blockHeight, checkpointBlockInfo.Height)
+	require.Equal(blockHashes[0], checkpointBlockInfo.Hash)
+	require.Equal(blockHeight+1, checkpointBlockInfo.LatestView)
+
+	// Checkpoints that aren't higher than the current one are ignored.
+	updated, err = chain.ProcessCheckpoint(checkpoint)
+	require.NoError(err)
+	require.False(updated)
+
+	// Checkpoints that aren't signed by the validator set are rejected.
+	chain.checkpointBlockInfo = nil
+	badCheckpoint := *checkpoint
+	badCheckpoint.SignerPublicKeys = badCheckpoint.SignerPublicKeys[1:]
+	_, err = chain.ProcessCheckpoint(&badCheckpoint)
+	require.Error(err)
+	require.Nil(chain.GetCheckpointBlockInfo())
+
+	// Checkpoints past the epoch after the committed tip's are rejected, even if they're signed by the validator set
+	// we know, since that validator set may no longer be active by then.
+	farHeader := *checkpoint.Header
+	farHeader.Height += 100
+	farHeaderHash, err := farHeader.Hash()
+	require.NoError(err)
+	farChildHeader := *checkpoint.ChildHeader
+	farChildHeader.PrevBlockHash = farHeaderHash
+	farChildHeader.Height = farHeader.Height + 1
+	farChildHeaderHash, err := farChildHeader.Hash()
+	require.NoError(err)
+	farCheckpoint := &MsgDeSoCheckpoint{
+		MsgVersion:  MsgCheckpointVersion0,
+		Header:      &farHeader,
+		ChildHeader: &farChildHeader,
+	}
+	validatorSet, err := chain.GetCommittedTipView().GetAllSnapshotValidatorSetEntriesByStake()
+	require.NoError(err)
+	signaturePayload := consensus.GetVoteSignaturePayload(farChildHeader.ProposedInView, farChildHeaderHash)
+	var signatures []*bls.Signature
+	for _, validatorEntry := range validatorSet {
+		signature, err := testMeta.blsPubKeyToBLSKeyMap[validatorEntry.VotingPublicKey.ToString()].Sign(
+			signaturePayload[:])
+		require.NoError(err)
+		signatures = append(signatures, signature)
+		farCheckpoint.SignerPublicKeys = append(farCheckpoint.SignerPublicKeys, validatorEntry.VotingPublicKey)
+	}
+	farCheckpoint.AggregatedSignature, err = bls.AggregateSignatures(signatures)
+	require.NoError(err)
+	_, err = farCheckpoint.ToCheckpointBlockInfo(validatorSet)
+	require.NoError(err)
+	_, err = chain.ProcessCheckpoint(farCheckpoint)
+	require.Error(err)
+	require.Contains(err.Error(), "past the epoch after the committed tip's")
+	require.Nil(chain.GetCheckpointBlockInfo())
+}
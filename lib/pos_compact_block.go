@@ -0,0 +1,510 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pos_compact_block.go implements compact block relay for PoS blocks. Validators almost always already hold a
+// block's txns in their mempools by the time the block is proposed, so instead of relaying the full block, the
+// block proposer sends its header along with a short ID for each of its txns. The receiver looks up the txns in its
+// mempool by short ID, and requests any txns it doesn't have from the proposer:
+//
+//  1. The proposer sends a MsgDeSoCompactBlock to each validator that advertises SFCompactBlocks. Txns that the
+//     receiver can't possibly have, i.e. the block reward txn, are prefilled in the message.
+//  2. If the receiver is missing txns, it sends a MsgDeSoGetBlockTxns with the indexes of the missing txns.
+//  3. The proposer responds with a MsgDeSoBlockTxns holding the requested txns.
+//
+// Short txn IDs are the first CompactBlockShortTxnIdLen bytes of SHA256(blockHash || txnHash). Salting them with the
+// block hash means that a short ID collision between two txns doesn't carry over from one block to the next. If a
+// collision still results in the wrong txn being picked from the mempool, the reconstructed block won't match the
+// header's TransactionMerkleRoot, and we fall back to requesting the full block.
+
+const (
+	// CompactBlockShortTxnIdLen is the length in bytes of a short txn ID.
+	CompactBlockShortTxnIdLen = 8
+
+	// MaxPendingCompactBlocksPerPeer is the maximum number of compact blocks that can be waiting for missing
+	// txns from a single peer. Once it's reached, we request full blocks from the peer instead.
+	MaxPendingCompactBlocksPerPeer = 8
+
+	// CompactBlockTxnsTimeout is how long a compact block waits for the missing txns we requested from the peer.
+	// Once it elapses, we stop waiting and request the full block from the peer instead.
+	CompactBlockTxnsTimeout = 2 * time.Second
+)
+
+// CompactBlockShortTxnId is the short ID identifying a txn within a compact block.
+type CompactBlockShortTxnId [CompactBlockShortTxnIdLen]byte
+
+// ComputeCompactBlockShortTxnId computes the short ID of the txn within the block.
+func ComputeCompactBlockShortTxnId(blockHash *BlockHash, txnHash *BlockHash) CompactBlockShortTxnId {
+	hasher := sha256.New()
+	hasher.Write(blockHash[:])
+	hasher.Write(txnHash[:])
+
+	var shortTxnId CompactBlockShortTxnId
+	copy(shortTxnId[:], hasher.Sum(nil))
+	return shortTxnId
+}
+
+// ==================================================================
+// Proof of Stake Compact Block Message
+// ==================================================================
+
+// PrefilledTxn is a txn sent in full within a compact block, along with its index in the block.
+type PrefilledTxn struct {
+	Index uint64
+	Txn   *MsgDeSoTxn
+}
+
+type MsgDeSoCompactBlock struct {
+	MsgVersion MsgCompactBlockVersion
+
+	// The header of the block.
+	Header *MsgDeSoHeader
+
+	// The short IDs of the block's txns that aren't prefilled, in the order that they appear in the block.
+	ShortTxnIds []CompactBlockShortTxnId
+
+	// The txns sent in full, ordered by their index in the block. The block's txns are made up of the prefilled
+	// txns at their indexes, and the txns identified by the short IDs filling the remaining indexes in order.
+	PrefilledTxns []*PrefilledTxn
+}
+
+// NewMsgDeSoCompactBlock constructs the compact block for a PoS block. The block reward txn is prefilled, since it's
+// never in anyone's mempool.
+func NewMsgDeSoCompactBlock(block *MsgDeSoBlock) (*MsgDeSoCompactBlock, error) {
+	if block.Header == nil {
+		return nil, fmt.Errorf("NewMsgDeSoCompactBlock: Header should not be nil")
+	}
+	blockHash, err := block.Header.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewMsgDeSoCompactBlock: Problem hashing header")
+	}
+
+	compactBlock := &MsgDeSoCompactBlock{
+		MsgVersion: MsgCompactBlockVersion0,
+		Header:     block.Header,
+	}
+	for ii, txn := range block.Txns {
+		if txn.TxnMeta != nil && txn.TxnMeta.GetTxnType() == TxnTypeBlockReward {
+			compactBlock.PrefilledTxns = append(compactBlock.PrefilledTxns, &PrefilledTxn{
+				Index: uint64(ii),
+				Txn:   txn,
+			})
+			continue
+		}
+		txnHash := txn.Hash()
+		if txnHash == nil {
+			return nil, fmt.Errorf("NewMsgDeSoCompactBlock: Problem hashing txn at index %d", ii)
+		}
+		compactBlock.ShortTxnIds = append(compactBlock.ShortTxnIds, ComputeCompactBlockShortTxnId(blockHash, txnHash))
+	}
+	return compactBlock, nil
+}
+
+func (msg *MsgDeSoCompactBlock) GetMsgType() MsgType {
+	return MsgTypeCompactBlock
+}
+
+// GetNumTxns returns the number of txns in the block.
+func (msg *MsgDeSoCompactBlock) GetNumTxns() uint64 {
+	return uint64(len(msg.ShortTxnIds) + len(msg.PrefilledTxns))
+}
+
+func (msg *MsgDeSoCompactBlock) ToBytes(bool) ([]byte, error) {
+	if msg.MsgVersion != MsgCompactBlockVersion0 {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Invalid MsgVersion %d", msg.MsgVersion)
+	}
+	if msg.Header == nil {
+		return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Header should not be nil")
+	}
+
+	retBytes := []byte{}
+
+	// MsgVersion
+	retBytes = append(retBytes, msg.MsgVersion)
+
+	// Header
+	headerBytes, err := msg.Header.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding header")
+	}
+	retBytes = append(retBytes, EncodeByteArray(headerBytes)...)
+
+	// ShortTxnIds
+	retBytes = append(retBytes, UintToBuf(uint64(len(msg.ShortTxnIds)))...)
+	for _, shortTxnId := range msg.ShortTxnIds {
+		retBytes = append(retBytes, shortTxnId[:]...)
+	}
+
+	// PrefilledTxns
+	retBytes = append(retBytes, UintToBuf(uint64(len(msg.PrefilledTxns)))...)
+	for _, prefilledTxn := range msg.PrefilledTxns {
+		if prefilledTxn.Txn == nil {
+			return nil, fmt.Errorf("MsgDeSoCompactBlock.ToBytes: Prefilled txn at index %d is nil", prefilledTxn.Index)
+		}
+		txnBytes, err := prefilledTxn.Txn.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoCompactBlock.ToBytes: Problem encoding prefilled txn")
+		}
+		retBytes = append(retBytes, UintToBuf(prefilledTxn.Index)...)
+		retBytes = append(retBytes, EncodeByteArray(txnBytes)...)
+	}
+
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoCompactBlock) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	// MsgVersion
+	msgVersion, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding MsgVersion")
+	}
+	if msgVersion != MsgCompactBlockVersion0 {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Invalid MsgVersion %d", msgVersion)
+	}
+	retMsg := &MsgDeSoCompactBlock{MsgVersion: msgVersion}
+
+	// Header
+	headerBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding header")
+	}
+	retMsg.Header = NewMessage(MsgTypeHeader).(*MsgDeSoHeader)
+	if err = retMsg.Header.FromBytes(headerBytes); err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding header")
+	}
+
+	// ShortTxnIds
+	numShortTxnIds, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding number of short txn ids")
+	}
+	if numShortTxnIds > uint64(rr.Len())/CompactBlockShortTxnIdLen {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of short txn ids %d exceeds remaining bytes %d",
+			numShortTxnIds, rr.Len())
+	}
+	if numShortTxnIds > 0 {
+		retMsg.ShortTxnIds = make([]CompactBlockShortTxnId, numShortTxnIds)
+	}
+	for ii := range retMsg.ShortTxnIds {
+		if _, err = io.ReadFull(rr, retMsg.ShortTxnIds[ii][:]); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding short txn id")
+		}
+	}
+
+	// PrefilledTxns
+	numPrefilledTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding number of prefilled txns")
+	}
+	if numPrefilledTxns > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Number of prefilled txns %d exceeds remaining bytes %d",
+			numPrefilledTxns, rr.Len())
+	}
+	numTxns := numShortTxnIds + numPrefilledTxns
+	for ii := uint64(0); ii < numPrefilledTxns; ii++ {
+		index, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding prefilled txn index")
+		}
+		// The prefilled txns must be ordered by index, and fall within the block.
+		if index >= numTxns {
+			return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Prefilled txn index %d exceeds number of txns %d",
+				index, numTxns)
+		}
+		if len(retMsg.PrefilledTxns) > 0 && index <= retMsg.PrefilledTxns[len(retMsg.PrefilledTxns)-1].Index {
+			return fmt.Errorf("MsgDeSoCompactBlock.FromBytes: Prefilled txn index %d is out of order", index)
+		}
+		txnBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding prefilled txn")
+		}
+		txn := NewMessage(MsgTypeTxn).(*MsgDeSoTxn)
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoCompactBlock.FromBytes: Error decoding prefilled txn")
+		}
+		retMsg.PrefilledTxns = append(retMsg.PrefilledTxns, &PrefilledTxn{Index: index, Txn: txn})
+	}
+
+	*msg = *retMsg
+	return nil
+}
+
+func (msg *MsgDeSoCompactBlock) String() string {
+	return fmt.Sprintf("{MsgVersion: %d, Header: %v, NumShortTxnIds: %d, NumPrefilledTxns: %d}",
+		msg.MsgVersion, msg.Header, len(msg.ShortTxnIds), len(msg.PrefilledTxns))
+}
+
+// ==================================================================
+// Proof of Stake GetBlockTxns Message
+// ==================================================================
+
+type MsgDeSoGetBlockTxns struct {
+	MsgVersion MsgCompactBlockVersion
+
+	// The hash of the compact block that the txns are missing from.
+	BlockHash *BlockHash
+
+	// The indexes of the missing txns in the block, in increasing order.
+	TxnIndexes []uint64
+}
+
+func (msg *MsgDeSoGetBlockTxns) GetMsgType() MsgType {
+	return MsgTypeGetBlockTxns
+}
+
+func (msg *MsgDeSoGetBlockTxns) ToBytes(bool) ([]byte, error) {
+	if msg.MsgVersion != MsgCompactBlockVersion0 {
+		return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: Invalid MsgVersion %d", msg.MsgVersion)
+	}
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoGetBlockTxns.ToBytes: BlockHash should not be nil")
+	}
+
+	retBytes := []byte{}
+	retBytes = append(retBytes, msg.MsgVersion)
+	retBytes = append(retBytes, msg.BlockHash[:]...)
+	retBytes = append(retBytes, EncodeUint64Array(msg.TxnIndexes)...)
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoGetBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	msgVersion, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Error decoding MsgVersion")
+	}
+	if msgVersion != MsgCompactBlockVersion0 {
+		return fmt.Errorf("MsgDeSoGetBlockTxns.FromBytes: Invalid MsgVersion %d", msgVersion)
+	}
+	retMsg := &MsgDeSoGetBlockTxns{MsgVersion: msgVersion, BlockHash: &BlockHash{}}
+
+	if _, err = io.ReadFull(rr, retMsg.BlockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Error decoding BlockHash")
+	}
+	if retMsg.TxnIndexes, err = DecodeUint64Array(rr); err != nil {
+		return errors.Wrapf(err, "MsgDeSoGetBlockTxns.FromBytes: Error decoding TxnIndexes")
+	}
+
+	*msg = *retMsg
+	return nil
+}
+
+func (msg *MsgDeSoGetBlockTxns) String() string {
+	return fmt.Sprintf("{MsgVersion: %d, BlockHash: %v, NumTxnIndexes: %d}",
+		msg.MsgVersion, msg.BlockHash, len(msg.TxnIndexes))
+}
+
+// ==================================================================
+// Proof of Stake BlockTxns Message
+// ==================================================================
+
+type MsgDeSoBlockTxns struct {
+	MsgVersion MsgCompactBlockVersion
+
+	// The hash of the compact block that the txns were requested for.
+	BlockHash *BlockHash
+
+	// The requested txns, in the order of the requested indexes.
+	Txns []*MsgDeSoTxn
+}
+
+func (msg *MsgDeSoBlockTxns) GetMsgType() MsgType {
+	return MsgTypeBlockTxns
+}
+
+func (msg *MsgDeSoBlockTxns) ToBytes(bool) ([]byte, error) {
+	if msg.MsgVersion != MsgCompactBlockVersion0 {
+		return nil, fmt.Errorf("MsgDeSoBlockTxns.ToBytes: Invalid MsgVersion %d", msg.MsgVersion)
+	}
+	if msg.BlockHash == nil {
+		return nil, fmt.Errorf("MsgDeSoBlockTxns.ToBytes: BlockHash should not be nil")
+	}
+
+	retBytes := []byte{}
+	retBytes = append(retBytes, msg.MsgVersion)
+	retBytes = append(retBytes, msg.BlockHash[:]...)
+	retBytes = append(retBytes, UintToBuf(uint64(len(msg.Txns)))...)
+	for _, txn := range msg.Txns {
+		txnBytes, err := txn.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MsgDeSoBlockTxns.ToBytes: Problem encoding txn")
+		}
+		retBytes = append(retBytes, EncodeByteArray(txnBytes)...)
+	}
+	return retBytes, nil
+}
+
+func (msg *MsgDeSoBlockTxns) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+
+	msgVersion, err := rr.ReadByte()
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Error decoding MsgVersion")
+	}
+	if msgVersion != MsgCompactBlockVersion0 {
+		return fmt.Errorf("MsgDeSoBlockTxns.FromBytes: Invalid MsgVersion %d", msgVersion)
+	}
+	retMsg := &MsgDeSoBlockTxns{MsgVersion: msgVersion, BlockHash: &BlockHash{}}
+
+	if _, err = io.ReadFull(rr, retMsg.BlockHash[:]); err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Error decoding BlockHash")
+	}
+	numTxns, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Error decoding number of txns")
+	}
+	if numTxns > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoBlockTxns.FromBytes: Number of txns %d exceeds remaining bytes %d",
+			numTxns, rr.Len())
+	}
+	for ii := uint64(0); ii < numTxns; ii++ {
+		txnBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Error decoding txn")
+		}
+		txn := NewMessage(MsgTypeTxn).(*MsgDeSoTxn)
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return errors.Wrapf(err, "MsgDeSoBlockTxns.FromBytes: Error decoding txn")
+		}
+		retMsg.Txns = append(retMsg.Txns, txn)
+	}
+
+	*msg = *retMsg
+	return nil
+}
+
+func (msg *MsgDeSoBlockTxns) String() string {
+	return fmt.Sprintf("{MsgVersion: %d, BlockHash: %v, NumTxns: %d}", msg.MsgVersion, msg.BlockHash, len(msg.Txns))
+}
+
+// ==================================================================
+// Compact Block Reconstruction
+// ==================================================================
+
+// compactBlockReconstruction holds the state of a block being reconstructed from a compact block. It's only accessed
+// from the Server's message handling goroutine.
+type compactBlockReconstruction struct {
+	header    *MsgDeSoHeader
+	blockHash *BlockHash
+
+	// txns holds the block's txns. Missing txns are nil.
+	txns []*MsgDeSoTxn
+
+	// The indexes of the missing txns, and their short IDs.
+	missingTxnIndexes  []uint64
+	missingShortTxnIds []CompactBlockShortTxnId
+}
+
+// newCompactBlockReconstruction fills in the compact block's txns from its prefilled txns and the txns in the
+// mempool. Short IDs that match more than one mempool txn are treated as missing.
+func newCompactBlockReconstruction(
+	msg *MsgDeSoCompactBlock,
+	mempoolTxns []*MempoolTx,
+) (*compactBlockReconstruction, error) {
+	if msg.Header == nil {
+		return nil, fmt.Errorf("newCompactBlockReconstruction: Header should not be nil")
+	}
+	blockHash, err := msg.Header.Hash()
+	if err != nil {
+		return nil, errors.Wrapf(err, "newCompactBlockReconstruction: Problem hashing header")
+	}
+
+	txns := make([]*MsgDeSoTxn, msg.GetNumTxns())
+	for _, prefilledTxn := range msg.PrefilledTxns {
+		if prefilledTxn.Index >= uint64(len(txns)) || txns[prefilledTxn.Index] != nil || prefilledTxn.Txn == nil {
+			return nil, fmt.Errorf("newCompactBlockReconstruction: Invalid prefilled txn at index %d",
+				prefilledTxn.Index)
+		}
+		txns[prefilledTxn.Index] = prefilledTxn.Txn
+	}
+
+	mempoolTxnsByShortTxnId := make(map[CompactBlockShortTxnId]*MsgDeSoTxn, len(mempoolTxns))
+	for _, mempoolTxn := range mempoolTxns {
+		if mempoolTxn == nil || mempoolTxn.Tx == nil || mempoolTxn.Hash == nil {
+			continue
+		}
+		shortTxnId := ComputeCompactBlockShortTxnId(blockHash, mempoolTxn.Hash)
+		if _, exists := mempoolTxnsByShortTxnId[shortTxnId]; exists {
+			mempoolTxnsByShortTxnId[shortTxnId] = nil
+			continue
+		}
+		mempoolTxnsByShortTxnId[shortTxnId] = mempoolTxn.Tx
+	}
+
+	reconstruction := &compactBlockReconstruction{
+		header:    msg.Header,
+		blockHash: blockHash,
+		txns:      txns,
+	}
+	shortTxnIdIndex := 0
+	for ii := range txns {
+		if txns[ii] != nil {
+			continue
+		}
+		shortTxnId := msg.ShortTxnIds[shortTxnIdIndex]
+		shortTxnIdIndex++
+		if txn := mempoolTxnsByShortTxnId[shortTxnId]; txn != nil {
+			txns[ii] = txn
+			continue
+		}
+		reconstruction.missingTxnIndexes = append(reconstruction.missingTxnIndexes, uint64(ii))
+		reconstruction.missingShortTxnIds = append(reconstruction.missingShortTxnIds, shortTxnId)
+	}
+	return reconstruction, nil
+}
+
+// addMissingTxns fills in the missing txns, which must be in the order of their indexes.
+func (reconstruction *compactBlockReconstruction) addMissingTxns(txns []*MsgDeSoTxn) error {
+	if len(txns) != len(reconstruction.missingTxnIndexes) {
+		return fmt.Errorf("compactBlockReconstruction.addMissingTxns: Received %d txns, expected %d",
+			len(txns), len(reconstruction.missingTxnIndexes))
+	}
+	for ii, txn := range txns {
+		txnHash := txn.Hash()
+		if txnHash == nil {
+			return fmt.Errorf("compactBlockReconstruction.addMissingTxns: Problem hashing txn %d", ii)
+		}
+		if ComputeCompactBlockShortTxnId(reconstruction.blockHash, txnHash) != reconstruction.missingShortTxnIds[ii] {
+			return fmt.Errorf("compactBlockReconstruction.addMissingTxns: Txn %v doesn't match short txn id "+
+				"at index %d", txnHash, reconstruction.missingTxnIndexes[ii])
+		}
+	}
+	for ii, txn := range txns {
+		reconstruction.txns[reconstruction.missingTxnIndexes[ii]] = txn
+	}
+	reconstruction.missingTxnIndexes = nil
+	reconstruction.missingShortTxnIds = nil
+	return nil
+}
+
+// toBlock returns the reconstructed block. It errors if txns are still missing, or if the txns don't match the
+// header's TransactionMerkleRoot, which can happen if a short ID collision picked the wrong txn from the mempool.
+func (reconstruction *compactBlockReconstruction) toBlock() (*MsgDeSoBlock, error) {
+	if len(reconstruction.missingTxnIndexes) > 0 {
+		return nil, fmt.Errorf("compactBlockReconstruction.toBlock: Block is missing %d txns",
+			len(reconstruction.missingTxnIndexes))
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(reconstruction.txns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compactBlockReconstruction.toBlock: Problem computing merkle root")
+	}
+	if !merkleRoot.IsEqual(reconstruction.header.TransactionMerkleRoot) {
+		return nil, fmt.Errorf("compactBlockReconstruction.toBlock: Merkle root %v doesn't match header "+
+			"merkle root %v", merkleRoot, reconstruction.header.TransactionMerkleRoot)
+	}
+	return &MsgDeSoBlock{
+		Header: reconstruction.header,
+		Txns:   reconstruction.txns,
+	}, nil
+}
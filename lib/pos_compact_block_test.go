@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// _generateTestCompactBlock returns a PoS block with a block reward txn followed by numTxns basic transfers.
+func _generateTestCompactBlock(t *testing.T, numTxns int) *MsgDeSoBlock {
+	require := require.New(t)
+	rand := rand.New(rand.NewSource(1))
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+
+	block := createTestBlockVersion2(t, false)
+	block.Txns = []*MsgDeSoTxn{{
+		TxnMeta: &BlockRewardMetadataa{ExtraData: []byte{0x01, 0x02}},
+	}}
+	for ii := 0; ii < numTxns; ii++ {
+		block.Txns = append(block.Txns, _generateTestTxn(t, rand, 1000, 10000, m0PubBytes, m0Priv, 100, 0))
+	}
+	merkleRoot, _, err := ComputeMerkleRoot(block.Txns)
+	require.NoError(err)
+	block.Header.TransactionMerkleRoot = merkleRoot
+	return block
+}
+
+func _newTestMempoolTxns(txns []*MsgDeSoTxn) []*MempoolTx {
+	var mempoolTxns []*MempoolTx
+	for _, txn := range txns {
+		mempoolTxns = append(mempoolTxns, &MempoolTx{Tx: txn, Hash: txn.Hash()})
+	}
+	return mempoolTxns
+}
+
+func TestCompactBlockEncodeDecode(t *testing.T) {
+	require := require.New(t)
+	block := _generateTestCompactBlock(t, 3)
+
+	compactBlock, err := NewMsgDeSoCompactBlock(block)
+	require.NoError(err)
+	require.Equal(uint64(4), compactBlock.GetNumTxns())
+	require.Len(compactBlock.ShortTxnIds, 3)
+	require.Len(compactBlock.PrefilledTxns, 1)
+	require.Equal(uint64(0), compactBlock.PrefilledTxns[0].Index)
+
+	// The compact block round-trips through the wire format.
+	var buf bytes.Buffer
+	_, err = WriteMessage(&buf, compactBlock, NetworkType_TESTNET)
+	require.NoError(err)
+	decodedMsg, _, err := ReadMessage(&buf, NetworkType_TESTNET)
+	require.NoError(err)
+	decodedCompactBlock := decodedMsg.(*MsgDeSoCompactBlock)
+	require.Equal(compactBlock.ShortTxnIds, decodedCompactBlock.ShortTxnIds)
+	require.Len(decodedCompactBlock.PrefilledTxns, 1)
+	blockHash, err := block.Header.Hash()
+	require.NoError(err)
+	decodedBlockHash, err := decodedCompactBlock.Header.Hash()
+	require.NoError(err)
+	require.Equal(blockHash, decodedBlockHash)
+
+	// Prefilled txns must be ordered and fall within the block.
+	compactBlock.PrefilledTxns = []*PrefilledTxn{{Index: 4, Txn: block.Txns[0]}}
+	compactBlockBytes, err := compactBlock.ToBytes(false)
+	require.NoError(err)
+	require.Error((&MsgDeSoCompactBlock{}).FromBytes(compactBlockBytes))
+
+	// So do the GetBlockTxns and BlockTxns messages.
+	getBlockTxns := &MsgDeSoGetBlockTxns{
+		MsgVersion: MsgCompactBlockVersion0,
+		BlockHash:  blockHash,
+		TxnIndexes: []uint64{1, 3},
+	}
+	getBlockTxnsBytes, err := getBlockTxns.ToBytes(false)
+	require.NoError(err)
+	decodedGetBlockTxns := &MsgDeSoGetBlockTxns{}
+	require.NoError(decodedGetBlockTxns.FromBytes(getBlockTxnsBytes))
+	require.Equal(getBlockTxns, decodedGetBlockTxns)
+
+	blockTxns := &MsgDeSoBlockTxns{
+		MsgVersion: MsgCompactBlockVersion0,
+		BlockHash:  blockHash,
+		Txns:       []*MsgDeSoTxn{block.Txns[1], block.Txns[3]},
+	}
+	blockTxnsBytes, err := blockTxns.ToBytes(false)
+	require.NoError(err)
+	decodedBlockTxns := &MsgDeSoBlockTxns{}
+	require.NoError(decodedBlockTxns.FromBytes(blockTxnsBytes))
+	require.Len(decodedBlockTxns.Txns, 2)
+	require.Equal(block.Txns[1].Hash(), decodedBlockTxns.Txns[0].Hash())
+	require.Equal(block.Txns[3].Hash(), decodedBlockTxns.Txns[1].Hash())
+}
+
+func TestCompactBlockReconstruction(t *testing.T) {
+	require := require.New(t)
+	block := _generateTestCompactBlock(t, 4)
+	compactBlock, err := NewMsgDeSoCompactBlock(block)
+	require.NoError(err)
+
+	// If the mempool has every txn, the block is reconstructed right away.
+	reconstruction, err := newCompactBlockReconstruction(compactBlock, _newTestMempoolTxns(block.Txns[1:]))
+	require.NoError(err)
+	require.Empty(reconstruction.missingTxnIndexes)
+	reconstructedBlock, err := reconstruction.toBlock()
+	require.NoError(err)
+	require.Equal(block.Txns, reconstructedBlock.Txns)
+
+	// Otherwise, the missing txns are requested by index.
+	reconstruction, err = newCompactBlockReconstruction(
+		compactBlock, _newTestMempoolTxns([]*MsgDeSoTxn{block.Txns[1], block.Txns[3]}))
+	require.NoError(err)
+	require.Equal([]uint64{2, 4}, reconstruction.missingTxnIndexes)
+	_, err = reconstruction.toBlock()
+	require.Error(err)
+
+	// Txns that don't match the missing short ids are rejected.
+	require.Error(reconstruction.addMissingTxns([]*MsgDeSoTxn{block.Txns[2]}))
+	require.Error(reconstruction.addMissingTxns([]*MsgDeSoTxn{block.Txns[4], block.Txns[2]}))
+	require.NoError(reconstruction.addMissingTxns([]*MsgDeSoTxn{block.Txns[2], block.Txns[4]}))
+	reconstructedBlock, err = reconstruction.toBlock()
+	require.NoError(err)
+	require.Equal(block.Txns, reconstructedBlock.Txns)
+
+	// Short ids that match more than one mempool txn are treated as missing.
+	blockHash, err := block.Header.Hash()
+	require.NoError(err)
+	collidingTxnHash := &BlockHash{0x01}
+	mempoolTxns := append(_newTestMempoolTxns(block.Txns[1:]), &MempoolTx{Tx: block.Txns[0], Hash: collidingTxnHash})
+	compactBlock.ShortTxnIds[0] = ComputeCompactBlockShortTxnId(blockHash, collidingTxnHash)
+	reconstruction, err = newCompactBlockReconstruction(compactBlock, mempoolTxns)
+	require.NoError(err)
+	require.Empty(reconstruction.missingTxnIndexes)
+	mempoolTxns = append(mempoolTxns, &MempoolTx{Tx: block.Txns[1], Hash: collidingTxnHash})
+	reconstruction, err = newCompactBlockReconstruction(compactBlock, mempoolTxns)
+	require.NoError(err)
+	require.Equal([]uint64{1}, reconstruction.missingTxnIndexes)
+
+	// If a short id picks the wrong txn from the mempool, the block doesn't match the header's merkle root.
+	reconstruction, err = newCompactBlockReconstruction(compactBlock, mempoolTxns[:len(mempoolTxns)-1])
+	require.NoError(err)
+	_, err = reconstruction.toBlock()
+	require.Error(err)
+}
+
+func TestCompactBlockTimeout(t *testing.T) {
+	require := require.New(t)
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	srv := &Server{params: params, blockchain: chain}
+	pp := &Peer{
+		pendingCompactBlocks: make(map[BlockHash]*compactBlockReconstruction),
+		requestedBlocks:      make(map[BlockHash]bool),
+	}
+
+	compactBlock, err := NewMsgDeSoCompactBlock(_generateTestCompactBlock(t, 3))
+	require.NoError(err)
+	reconstruction, err := newCompactBlockReconstruction(compactBlock, nil)
+	require.NoError(err)
+	require.NotEmpty(reconstruction.missingTxnIndexes)
+	blockHash := *reconstruction.blockHash
+	pp.pendingCompactBlocks[blockHash] = reconstruction
+
+	// A timeout for an earlier compact block with the same hash is ignored.
+	srv._handleCompactBlockTimeout(pp, &MsgDeSoCompactBlockTimeout{
+		BlockHash:      reconstruction.blockHash,
+		reconstruction: &compactBlockReconstruction{},
+	})
+	require.Contains(pp.pendingCompactBlocks, blockHash)
+	require.Nil(pp.MaybeDequeueDeSoMessage())
+
+	// Once the pending compact block times out, it's evicted and the full block is requested instead.
+	srv._handleCompactBlockTimeout(pp, &MsgDeSoCompactBlockTimeout{
+		BlockHash:      reconstruction.blockHash,
+		reconstruction: reconstruction,
+	})
+	require.NotContains(pp.pendingCompactBlocks, blockHash)
+	messageMeta := pp.MaybeDequeueDeSoMessage()
+	require.NotNil(messageMeta)
+	require.Equal([]*BlockHash{reconstruction.blockHash}, messageMeta.DeSoMessage.(*MsgDeSoGetBlocks).HashList)
+
+	// A repeated timeout doesn't request the block again.
+	srv._handleCompactBlockTimeout(pp, &MsgDeSoCompactBlockTimeout{
+		BlockHash:      reconstruction.blockHash,
+		reconstruction: reconstruction,
+	})
+	require.Nil(pp.MaybeDequeueDeSoMessage())
+
+	// Txns that arrive after the timeout are ignored rather than treated as unrequested.
+	srv._handleBlockTxns(pp, &MsgDeSoBlockTxns{BlockHash: reconstruction.blockHash})
+	require.Equal(int32(0), pp.disconnected)
+}
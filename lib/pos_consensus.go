@@ -328,9 +328,19 @@ func (fc *FastHotStuffConsensus) handleBlockProposalEvent(
 		)
 	}
 
-	// Broadcast the block to the validator network
+	// Broadcast the block to the validator network. Validators that support compact blocks are sent one, and
+	// reconstruct the block from their mempools. If we fail to construct the compact block, we fall back to
+	// sending the full block to everyone.
+	compactBlockProposal, err := NewMsgDeSoCompactBlock(blockProposal)
+	if err != nil {
+		glog.Errorf("FastHotStuffConsensus.handleBlockProposalEvent: Error constructing compact block: %v", err)
+	}
 	validators := fc.networkManager.GetConnectedValidators()
 	for _, validator := range validators {
+		if compactBlockProposal != nil && validator.GetServiceFlag().HasService(SFCompactBlocks) {
+			sendMessageToRemoteNodeAsync(validator, compactBlockProposal)
+			continue
+		}
 		sendMessageToRemoteNodeAsync(validator, blockProposal)
 	}
 
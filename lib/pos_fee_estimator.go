@@ -3,9 +3,12 @@ package lib
 import (
 	"math"
 	"math/big"
+	"sort"
 	"sync"
 
 	"github.com/deso-protocol/core/collections"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -36,6 +39,9 @@ type PoSFeeEstimator struct {
 	// avoid having to recompute the fee buckets for all the past blocks every time we want to
 	// estimate a fee. We only keep the most recent numPastBlocks blocks in this cache.
 	cachedBlocks []*CachedBlock
+	// db is the database that cachedBlocks are persisted to, so that they survive restarts. It's nil until
+	// EnablePersistence is called, in which case cachedBlocks are only kept in memory.
+	db *badger.DB
 	// rwLock is a read-write lock that protects the PoSFeeEstimator from concurrent access.
 	rwLock *sync.RWMutex
 }
@@ -44,6 +50,10 @@ type CachedBlock struct {
 	Block *MsgDeSoBlock
 	Hash  BlockHash
 	Txns  []*MempoolTx
+	// InclusionLatencies maps the hashes of the block's transactions to the number of blocks they waited in the
+	// mempool before being included in this block. Only transactions that were in the mempool when the block was
+	// added to the fee estimator have an entry.
+	InclusionLatencies map[BlockHash]uint64
 }
 
 func NewPoSFeeEstimator() *PoSFeeEstimator {
@@ -125,6 +135,7 @@ func (posFeeEstimator *PoSFeeEstimator) AddBlock(block *MsgDeSoBlock) error {
 	if err != nil {
 		return errors.Wrap(err, "PoSFeeEstimator.AddBlock: error converting block to CachedBlock")
 	}
+	cachedBlock.InclusionLatencies = posFeeEstimator.computeInclusionLatencies(cachedBlock)
 
 	if err := posFeeEstimator.addBlockNoLock(cachedBlock); err != nil {
 		return errors.Wrap(err, "PoSFeeEstimator.AddBlock: error adding block to PoSFeeEstimator")
@@ -207,6 +218,14 @@ func (posFeeEstimator *PoSFeeEstimator) updatePastBlocksTransactionRegister(past
 		}
 	}
 
+	// Persist the changes to the cached blocks. This is a best effort operation. If it fails, the fee estimator
+	// keeps working from memory, and only loses the affected blocks after a restart.
+	if posFeeEstimator.db != nil {
+		if err := persistFeeEstimatorCachedBlocks(posFeeEstimator.db, posFeeEstimator.cachedBlocks, pastBlocks); err != nil {
+			glog.Errorf("PoSFeeEstimator.updatePastBlocksTransactionRegister: Problem persisting cached blocks: %v", err)
+		}
+	}
+
 	// Update the cached blocks and pastBlocksTransactionRegister.
 	posFeeEstimator.cachedBlocks = pastBlocks
 	posFeeEstimator.pastBlocksTransactionRegister = newTransactionRegister
@@ -740,10 +759,190 @@ func getPriorityFeeBucketFromTxns(
 	}
 
 	bucketMin, bucketMax := computeFeeTimeBucketRangeFromFeeNanosPerKB(
-		feeTimeOrderedTxns[percentilePosition].FeePerKB,
+		feeTimeOrderedTxns[percentilePosition].PackageFeePerKB(),
 		minimumNetworkFeeNanosPerKB,
 		feeBucketGrowthRateBasisPoints,
 	)
 
 	return bucketMin, bucketMax
 }
+
+// FeeEstimatorMinTargetSamples is the minimum number of past transactions at or above a fee rate that
+// EstimateFeeRateForTarget needs to see before it trusts the observed inclusion rate at that fee rate.
+const FeeEstimatorMinTargetSamples = 10
+
+// FeeRateInclusionStats summarizes how long the transactions in a single fee bucket of the cached past blocks
+// waited in the mempool before being included in a block.
+type FeeRateInclusionStats struct {
+	// MinFeeRateNanosPerKB and MaxFeeRateNanosPerKB are the inclusive fee rate range of the bucket.
+	MinFeeRateNanosPerKB uint64
+	MaxFeeRateNanosPerKB uint64
+	// InclusionLatencies are the number of blocks each transaction in the bucket waited, in ascending order.
+	InclusionLatencies []uint64
+}
+
+// NumIncludedWithin returns the number of transactions in the bucket that were included within numBlocks blocks.
+func (stats *FeeRateInclusionStats) NumIncludedWithin(numBlocks uint64) uint64 {
+	return uint64(sort.Search(len(stats.InclusionLatencies), func(ii int) bool {
+		return stats.InclusionLatencies[ii] > numBlocks
+	}))
+}
+
+// computeInclusionLatencies computes the number of blocks each of the block's transactions waited in the mempool
+// before being included. It must be called before the block's transactions are removed from the mempool.
+func (posFeeEstimator *PoSFeeEstimator) computeInclusionLatencies(cachedBlock *CachedBlock) map[BlockHash]uint64 {
+	inclusionLatencies := make(map[BlockHash]uint64)
+	if posFeeEstimator.mempoolTransactionRegister == nil {
+		return inclusionLatencies
+	}
+
+	blockHeight := cachedBlock.Block.Header.Height
+	for _, txn := range cachedBlock.Txns {
+		mempoolTxn := posFeeEstimator.mempoolTransactionRegister.GetTransaction(txn.Hash)
+		if mempoolTxn == nil {
+			continue
+		}
+		// The mempool records the tip height when a transaction is added, so a transaction included in the very
+		// next block has a latency of one.
+		latency := uint64(1)
+		if blockHeight > uint64(mempoolTxn.Height) {
+			latency = blockHeight - uint64(mempoolTxn.Height)
+		}
+		inclusionLatencies[*txn.Hash] = latency
+	}
+	return inclusionLatencies
+}
+
+// GetInclusionStats returns the inclusion latency stats of the cached past blocks for each fee bucket, ordered from
+// the highest fee rate range to the lowest. Only transactions that were seen in the mempool are counted.
+func (posFeeEstimator *PoSFeeEstimator) GetInclusionStats() []*FeeRateInclusionStats {
+	posFeeEstimator.rwLock.RLock()
+	defer posFeeEstimator.rwLock.RUnlock()
+
+	return posFeeEstimator.getInclusionStatsNoLock()
+}
+
+func (posFeeEstimator *PoSFeeEstimator) getInclusionStatsNoLock() []*FeeRateInclusionStats {
+	minimumNetworkFeeNanosPerKB := posFeeEstimator.pastBlocksTransactionRegister.minimumNetworkFeeNanosPerKB
+	feeBucketGrowthRateBasisPoints := posFeeEstimator.pastBlocksTransactionRegister.feeBucketGrowthRateBasisPoints
+
+	statsByBucketMin := make(map[uint64]*FeeRateInclusionStats)
+	for _, cachedBlock := range posFeeEstimator.cachedBlocks {
+		for _, txn := range cachedBlock.Txns {
+			latency, exists := cachedBlock.InclusionLatencies[*txn.Hash]
+			if !exists {
+				continue
+			}
+			bucketMin, bucketMax := computeFeeTimeBucketRangeFromFeeNanosPerKB(
+				txn.FeePerKB, minimumNetworkFeeNanosPerKB, feeBucketGrowthRateBasisPoints)
+			stats, exists := statsByBucketMin[bucketMin]
+			if !exists {
+				stats = &FeeRateInclusionStats{MinFeeRateNanosPerKB: bucketMin, MaxFeeRateNanosPerKB: bucketMax}
+				statsByBucketMin[bucketMin] = stats
+			}
+			stats.InclusionLatencies = append(stats.InclusionLatencies, latency)
+		}
+	}
+
+	inclusionStats := collections.MapValues(statsByBucketMin)
+	for _, stats := range inclusionStats {
+		sort.Slice(stats.InclusionLatencies, func(ii, jj int) bool {
+			return stats.InclusionLatencies[ii] < stats.InclusionLatencies[jj]
+		})
+	}
+	sort.Slice(inclusionStats, func(ii, jj int) bool {
+		return inclusionStats[ii].MinFeeRateNanosPerKB > inclusionStats[jj].MinFeeRateNanosPerKB
+	})
+	return inclusionStats
+}
+
+// GetFeeRateHistogram returns a histogram of the fee rates of the transactions currently in the mempool, ordered
+// from the highest fee rate range to the lowest.
+func (posFeeEstimator *PoSFeeEstimator) GetFeeRateHistogram() []*FeeRateHistogramBucket {
+	posFeeEstimator.rwLock.RLock()
+	defer posFeeEstimator.rwLock.RUnlock()
+
+	return posFeeEstimator.mempoolTransactionRegister.GetFeeRateHistogram()
+}
+
+// EstimateFeeRateForTarget estimates the fee rate in nanos per KB a transaction needs to pay to be included within
+// targetBlocks blocks with the given confidence, in basis points. It returns the highest of:
+//
+// 1. The lowest fee rate at which at least confidenceBasisPoints of the past blocks' transactions paying that fee
+// rate or more were included within targetBlocks blocks of entering the mempool.
+//
+// 2. The fee rate needed to get ahead of the mempool's backlog, i.e. to have less than targetBlocks blocks' worth
+// of transactions, scaled by the mempool congestion factor, ahead of the transaction.
+//
+// 3. The minimum network fee rate.
+func (posFeeEstimator *PoSFeeEstimator) EstimateFeeRateForTarget(targetBlocks uint64, confidenceBasisPoints uint64,
+) (uint64, error) {
+	if targetBlocks == 0 {
+		return 0, errors.New("PoSFeeEstimator.EstimateFeeRateForTarget: targetBlocks must be greater than zero")
+	}
+	if confidenceBasisPoints == 0 || confidenceBasisPoints > MaxBasisPoints {
+		return 0, errors.Errorf("PoSFeeEstimator.EstimateFeeRateForTarget: confidenceBasisPoints must be "+
+			"between 1 and %d, got %d", MaxBasisPoints, confidenceBasisPoints)
+	}
+
+	posFeeEstimator.rwLock.RLock()
+	defer posFeeEstimator.rwLock.RUnlock()
+
+	globalMinFeeRate, _ := posFeeEstimator.pastBlocksTransactionRegister.minimumNetworkFeeNanosPerKB.Uint64()
+	pastBlocksFeeRate := posFeeEstimator.pastBlocksFeeRateForTargetNoLock(targetBlocks, confidenceBasisPoints)
+	mempoolFeeRate := posFeeEstimator.mempoolFeeRateForTargetNoLock(targetBlocks)
+	return max(globalMinFeeRate, pastBlocksFeeRate, mempoolFeeRate), nil
+}
+
+// pastBlocksFeeRateForTargetNoLock walks the past blocks' fee buckets from the highest fee rate to the lowest, and
+// returns the lowest bucket's min fee rate for which the transactions in it and every higher bucket were included
+// within targetBlocks blocks at least confidenceBasisPoints of the time. It returns zero if there isn't enough data.
+func (posFeeEstimator *PoSFeeEstimator) pastBlocksFeeRateForTargetNoLock(targetBlocks uint64,
+	confidenceBasisPoints uint64) uint64 {
+
+	inclusionStats := posFeeEstimator.getInclusionStatsNoLock()
+	numTxns := uint64(0)
+	numIncluded := uint64(0)
+	feeRate := uint64(0)
+	for _, stats := range inclusionStats {
+		numTxns += uint64(len(stats.InclusionLatencies))
+		numIncluded += stats.NumIncludedWithin(targetBlocks)
+		if numTxns < FeeEstimatorMinTargetSamples {
+			continue
+		}
+		if numIncluded*MaxBasisPoints < confidenceBasisPoints*numTxns {
+			// If even the highest fee rates we've seen didn't meet the target, we suggest paying more than all of them.
+			if feeRate == 0 {
+				return inclusionStats[0].MaxFeeRateNanosPerKB + 1
+			}
+			break
+		}
+		feeRate = stats.MinFeeRateNanosPerKB
+	}
+	return feeRate
+}
+
+// mempoolFeeRateForTargetNoLock returns the fee rate needed to be included ahead of all but targetBlocks blocks'
+// worth of the mempool's transactions, scaled by the mempool congestion factor. It returns zero if the mempool
+// doesn't hold that many transactions.
+func (posFeeEstimator *PoSFeeEstimator) mempoolFeeRateForTargetNoLock(targetBlocks uint64) uint64 {
+	// If the target is so far out that the size of its blocks overflows, the mempool can't be that congested.
+	maxBlocksSize, err := SafeUint64().Mul(targetBlocks, posFeeEstimator.globalParams.SoftMaxBlockSizeBytesPoS)
+	if err != nil {
+		return 0
+	}
+	maxBytesAhead, err := SafeUint64().Mul(maxBlocksSize/MaxBasisPoints,
+		posFeeEstimator.globalParams.MempoolCongestionFactorBasisPoints)
+	if err != nil {
+		return 0
+	}
+
+	bytesAhead := uint64(0)
+	for _, bucket := range posFeeEstimator.mempoolTransactionRegister.GetFeeRateHistogram() {
+		bytesAhead += bucket.TotalTxnsSizeBytes
+		if bytesAhead > maxBytesAhead {
+			return bucket.MaxFeeRateNanosPerKB + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+)
+
+// feeEstimatorCachedBlockKeyPrefix prefixes the keys of the fee estimator's cached blocks in the mempool database.
+// The mempool's own records are keyed by the 32-byte transaction hash, so the longer fee estimator keys never
+// collide with them. A cached block is keyed by <prefix, height, block hash>, so that iterating over the prefix
+// returns the blocks in height order.
+var feeEstimatorCachedBlockKeyPrefix = []byte("FeeEstimatorCachedBlock")
+
+func feeEstimatorCachedBlockKey(cachedBlock *CachedBlock) []byte {
+	key := append([]byte{}, feeEstimatorCachedBlockKeyPrefix...)
+	key = append(key, EncodeUint64(cachedBlock.Block.Header.Height)...)
+	key = append(key, cachedBlock.Hash.ToBytes()...)
+	return key
+}
+
+// ToBytes encodes the cached block as the serialized block followed by the inclusion latencies of its transactions.
+// The block's MempoolTxs aren't encoded, since they're recomputed from the block when it's decoded.
+func (cachedBlock *CachedBlock) ToBytes() ([]byte, error) {
+	var data []byte
+
+	blockBytes, err := cachedBlock.Block.ToBytes(false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CachedBlock.ToBytes: Problem serializing block")
+	}
+	data = append(data, EncodeByteArray(blockBytes)...)
+
+	// Encode the latencies in the order of the block's transactions so that the encoding is deterministic.
+	var numLatencies uint64
+	var latencyBytes []byte
+	for _, txn := range cachedBlock.Txns {
+		latency, exists := cachedBlock.InclusionLatencies[*txn.Hash]
+		if !exists {
+			continue
+		}
+		numLatencies++
+		latencyBytes = append(latencyBytes, txn.Hash.ToBytes()...)
+		latencyBytes = append(latencyBytes, UintToBuf(latency)...)
+	}
+	data = append(data, UintToBuf(numLatencies)...)
+	data = append(data, latencyBytes...)
+	return data, nil
+}
+
+func (cachedBlock *CachedBlock) FromBytes(rr *bytes.Reader) error {
+	if cachedBlock == nil {
+		return errors.New("CachedBlock.FromBytes: cachedBlock is nil")
+	}
+
+	blockBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CachedBlock.FromBytes: Problem reading block bytes")
+	}
+	block := &MsgDeSoBlock{}
+	if err = block.FromBytes(blockBytes); err != nil {
+		return errors.Wrapf(err, "CachedBlock.FromBytes: Problem deserializing block")
+	}
+	newCachedBlock, err := blockToCachedBlock(block)
+	if err != nil {
+		return errors.Wrapf(err, "CachedBlock.FromBytes: Problem converting block to CachedBlock")
+	}
+
+	numLatencies, err := ReadUvarint(rr)
+	if err != nil {
+		return errors.Wrapf(err, "CachedBlock.FromBytes: Problem reading number of latencies")
+	}
+	if numLatencies > uint64(len(newCachedBlock.Txns)) {
+		return errors.Errorf("CachedBlock.FromBytes: Number of latencies %d exceeds number of txns %d",
+			numLatencies, len(newCachedBlock.Txns))
+	}
+	newCachedBlock.InclusionLatencies = make(map[BlockHash]uint64)
+	for ii := uint64(0); ii < numLatencies; ii++ {
+		txnHash := BlockHash{}
+		if _, err = rr.Read(txnHash[:]); err != nil {
+			return errors.Wrapf(err, "CachedBlock.FromBytes: Problem reading txn hash")
+		}
+		latency, err := ReadUvarint(rr)
+		if err != nil {
+			return errors.Wrapf(err, "CachedBlock.FromBytes: Problem reading latency")
+		}
+		newCachedBlock.InclusionLatencies[txnHash] = latency
+	}
+
+	*cachedBlock = *newCachedBlock
+	return nil
+}
+
+// EnablePersistence loads the cached blocks that a previous run of the fee estimator persisted to db, merges them
+// with the blocks the fee estimator was initialized with, and from then on keeps db in sync with the cached blocks.
+// The blocks passed to Init are taken to be on the current best chain: a persisted block at the same height as one
+// of them, or above all of them, was orphaned while the node was offline and is discarded.
+func (posFeeEstimator *PoSFeeEstimator) EnablePersistence(db *badger.DB) error {
+	posFeeEstimator.rwLock.Lock()
+	defer posFeeEstimator.rwLock.Unlock()
+
+	if db == nil {
+		return errors.New("PoSFeeEstimator.EnablePersistence: db cannot be nil")
+	}
+
+	persistedBlocks, err := getPersistedFeeEstimatorCachedBlocks(db)
+	if err != nil {
+		return errors.Wrap(err, "PoSFeeEstimator.EnablePersistence: Problem loading persisted blocks")
+	}
+
+	// Start from the blocks the fee estimator was initialized with, and add the persisted blocks below them.
+	mergedBlocks := append([]*CachedBlock{}, posFeeEstimator.cachedBlocks...)
+	blocksByHeight := make(map[uint64]*CachedBlock)
+	maxHeight := uint64(0)
+	for _, cachedBlock := range posFeeEstimator.cachedBlocks {
+		blocksByHeight[cachedBlock.Block.Header.Height] = cachedBlock
+		if cachedBlock.Block.Header.Height > maxHeight {
+			maxHeight = cachedBlock.Block.Header.Height
+		}
+	}
+	for _, persistedBlock := range persistedBlocks {
+		height := persistedBlock.Block.Header.Height
+		if existingBlock, exists := blocksByHeight[height]; exists {
+			// If it's the same block, keep the inclusion latencies we persisted for it.
+			if existingBlock.Hash.IsEqual(&persistedBlock.Hash) && len(existingBlock.InclusionLatencies) == 0 {
+				existingBlock.InclusionLatencies = persistedBlock.InclusionLatencies
+			}
+			continue
+		}
+		if len(posFeeEstimator.cachedBlocks) > 0 && height > maxHeight {
+			continue
+		}
+		mergedBlocks = append(mergedBlocks, persistedBlock)
+	}
+
+	if err = posFeeEstimator.updatePastBlocksTransactionRegister(posFeeEstimator.cleanUpPastBlocks(mergedBlocks)); err != nil {
+		return errors.Wrap(err, "PoSFeeEstimator.EnablePersistence: Problem updating pastBlocksTransactionRegister")
+	}
+
+	// Bring the database in sync with the merged blocks. From here on, updatePastBlocksTransactionRegister keeps it
+	// in sync as blocks are added and removed.
+	if err = persistFeeEstimatorCachedBlocks(db, persistedBlocks, posFeeEstimator.cachedBlocks); err != nil {
+		return errors.Wrap(err, "PoSFeeEstimator.EnablePersistence: Problem persisting cached blocks")
+	}
+	posFeeEstimator.db = db
+	return nil
+}
+
+// getPersistedFeeEstimatorCachedBlocks returns all the cached blocks persisted to db, ordered by height.
+func getPersistedFeeEstimatorCachedBlocks(db *badger.DB) ([]*CachedBlock, error) {
+	var cachedBlocks []*CachedBlock
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = feeEstimatorCachedBlockKeyPrefix
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+		for iter.Seek(feeEstimatorCachedBlockKeyPrefix); iter.ValidForPrefix(feeEstimatorCachedBlockKeyPrefix); iter.Next() {
+			cachedBlockBytes, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "Problem retrieving value")
+			}
+			cachedBlock := &CachedBlock{}
+			if err = cachedBlock.FromBytes(bytes.NewReader(cachedBlockBytes)); err != nil {
+				return errors.Wrapf(err, "Problem decoding cached block")
+			}
+			cachedBlocks = append(cachedBlocks, cachedBlock)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getPersistedFeeEstimatorCachedBlocks: Problem iterating over cached blocks")
+	}
+	return cachedBlocks, nil
+}
+
+// persistFeeEstimatorCachedBlocks updates db from oldBlocks to newBlocks, deleting the blocks that are no longer
+// cached and writing the blocks that are newly cached.
+func persistFeeEstimatorCachedBlocks(db *badger.DB, oldBlocks []*CachedBlock, newBlocks []*CachedBlock) error {
+	newBlockHashes := NewSet([]BlockHash{})
+	for _, cachedBlock := range newBlocks {
+		newBlockHashes.Add(cachedBlock.Hash)
+	}
+	oldBlockHashes := NewSet([]BlockHash{})
+	for _, cachedBlock := range oldBlocks {
+		oldBlockHashes.Add(cachedBlock.Hash)
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, cachedBlock := range oldBlocks {
+		if newBlockHashes.Includes(cachedBlock.Hash) {
+			continue
+		}
+		if err := wb.Delete(feeEstimatorCachedBlockKey(cachedBlock)); err != nil {
+			return errors.Wrapf(err, "persistFeeEstimatorCachedBlocks: Problem deleting cached block")
+		}
+	}
+	for _, cachedBlock := range newBlocks {
+		if oldBlockHashes.Includes(cachedBlock.Hash) {
+			continue
+		}
+		cachedBlockBytes, err := cachedBlock.ToBytes()
+		if err != nil {
+			return errors.Wrapf(err, "persistFeeEstimatorCachedBlocks: Problem encoding cached block")
+		}
+		if err = wb.Set(feeEstimatorCachedBlockKey(cachedBlock), cachedBlockBytes); err != nil {
+			return errors.Wrapf(err, "persistFeeEstimatorCachedBlocks: Problem setting cached block")
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return errors.Wrapf(err, "persistFeeEstimatorCachedBlocks: Problem flushing write batch")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"math"
 	"math/big"
 	"math/rand"
 	"testing"
@@ -395,6 +396,197 @@ func TestFeeEstimator(t *testing.T) {
 	}
 }
 
+func TestFeeEstimatorForTarget(t *testing.T) {
+	require := require.New(t)
+	randSource := rand.New(rand.NewSource(2381))
+	globalParams := _testGetDefaultGlobalParams()
+	globalParams.MempoolMaxSizeBytes = uint64(1e9)
+	globalParams.MempoolFeeEstimatorNumPastBlocks = 10
+	globalParams.SoftMaxBlockSizeBytesPoS = uint64(1e6)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+	defer mempool.Stop()
+
+	_, err := mempool.EstimateFeeRateForTarget(0, 9000)
+	require.Error(err)
+	_, err = mempool.EstimateFeeRateForTarget(1, 0)
+	require.Error(err)
+	_, err = mempool.EstimateFeeRateForTarget(1, MaxBasisPoints+1)
+	require.Error(err)
+	// Without any past blocks or mempool transactions, we return the global minimum fee rate.
+	feeRate, err := mempool.EstimateFeeRateForTarget(1, 9000)
+	require.NoError(err)
+	require.Equal(globalParams.MinimumNetworkFeeNanosPerKB, feeRate)
+
+	// Add high fee transactions from m0 and low fee transactions from m1 to the mempool at height 2.
+	var highFeeTxns, lowFeeTxns []*MsgDeSoTxn
+	for ii := 0; ii < 10; ii++ {
+		highFeeTxn := _generateTestTxnWithFeeRate(t, randSource, 5000, m0PubBytes, m0Priv, 100, 25)
+		_wrappedPosMempoolAddTransaction(t, mempool, highFeeTxn)
+		highFeeTxns = append(highFeeTxns, highFeeTxn)
+		lowFeeTxn := _generateTestTxnWithFeeRate(t, randSource, 1500, m1PubBytes, m1Priv, 100, 25)
+		_wrappedPosMempoolAddTransaction(t, mempool, lowFeeTxn)
+		lowFeeTxns = append(lowFeeTxns, lowFeeTxn)
+	}
+	lowestBucketMin := func(txns []*MsgDeSoTxn) uint64 {
+		bucketMin := uint64(math.MaxUint64)
+		for _, txn := range txns {
+			txnBucketMin, _ := computeFeeTimeBucketRangeFromFeeNanosPerKB(mempool.GetTransaction(txn.Hash()).FeePerKB,
+				mempool.txnRegister.minimumNetworkFeeNanosPerKB, mempool.txnRegister.feeBucketGrowthRateBasisPoints)
+			if txnBucketMin < bucketMin {
+				bucketMin = txnBucketMin
+			}
+		}
+		return bucketMin
+	}
+	highFeeBucketMin := lowestBucketMin(highFeeTxns)
+	lowFeeBucketMin := lowestBucketMin(lowFeeTxns)
+
+	// The histogram covers every transaction in the mempool, ordered from the highest fee rate to the lowest.
+	histogram := mempool.GetFeeRateHistogram()
+	numTxns := uint64(0)
+	for ii, bucket := range histogram {
+		numTxns += bucket.NumTxns
+		if ii > 0 {
+			require.Greater(histogram[ii-1].MinFeeRateNanosPerKB, bucket.MaxFeeRateNanosPerKB)
+		}
+	}
+	require.Equal(uint64(20), numTxns)
+
+	// The high fee transactions are included in the next block, and the low fee transactions four blocks later.
+	highFeeBlock := &MsgDeSoBlock{Header: &MsgDeSoHeader{Version: 1, Height: 3}, Txns: highFeeTxns}
+	mempool.OnBlockConnected(highFeeBlock)
+	lowFeeBlock := &MsgDeSoBlock{Header: &MsgDeSoHeader{Version: 1, Height: 6}, Txns: lowFeeTxns}
+	mempool.OnBlockConnected(lowFeeBlock)
+	require.Equal(0, len(mempool.GetTransactions()))
+	require.Equal(0, len(mempool.GetFeeRateHistogram()))
+
+	inclusionStats := mempool.feeEstimator.GetInclusionStats()
+	for _, stats := range inclusionStats {
+		if stats.MinFeeRateNanosPerKB >= highFeeBucketMin {
+			require.Equal(uint64(len(stats.InclusionLatencies)), stats.NumIncludedWithin(1))
+		} else {
+			require.Equal(uint64(0), stats.NumIncludedWithin(3))
+			require.Equal(uint64(len(stats.InclusionLatencies)), stats.NumIncludedWithin(4))
+		}
+	}
+
+	// To be included in the next block with 90% confidence, we need to pay as much as the high fee transactions.
+	feeRate, err = mempool.EstimateFeeRateForTarget(1, 9000)
+	require.NoError(err)
+	require.Equal(highFeeBucketMin, feeRate)
+	// Only half of all transactions were included in the next block, so 50% confidence accepts the low fee rate.
+	feeRate, err = mempool.EstimateFeeRateForTarget(1, 5000)
+	require.NoError(err)
+	require.Equal(lowFeeBucketMin, feeRate)
+	// Every transaction was included within four blocks.
+	feeRate, err = mempool.EstimateFeeRateForTarget(4, 10000)
+	require.NoError(err)
+	require.Equal(lowFeeBucketMin, feeRate)
+
+	// When the mempool holds more than the target's worth of transactions, we need to outbid them.
+	mempool.feeEstimator.globalParams.SoftMaxBlockSizeBytesPoS = 1000
+	backlogTxn := _generateTestTxnWithFeeRate(t, randSource, 20000, m0PubBytes, m0Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, backlogTxn)
+	_, backlogBucketMax := computeFeeTimeBucketRangeFromFeeNanosPerKB(mempool.GetTransaction(backlogTxn.Hash()).FeePerKB,
+		mempool.txnRegister.minimumNetworkFeeNanosPerKB, mempool.txnRegister.feeBucketGrowthRateBasisPoints)
+	feeRate, err = mempool.EstimateFeeRateForTarget(4, 10000)
+	require.NoError(err)
+	require.Equal(backlogBucketMax+1, feeRate)
+}
+
+func TestFeeEstimatorPersistence(t *testing.T) {
+	require := require.New(t)
+	randSource := rand.New(rand.NewSource(2393))
+	globalParams := _testGetDefaultGlobalParams()
+	globalParams.MempoolMaxSizeBytes = uint64(1e9)
+	globalParams.MempoolFeeEstimatorNumPastBlocks = 10
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+	startMempool := func(globalParams *GlobalParamsEntry, pastBlocks []*MsgDeSoBlock) *PosMempool {
+		mempool := NewPosMempool()
+		require.NoError(mempool.Init(
+			params, globalParams, latestBlockView, 2, dir, false, 30000, pastBlocks, 1000, 100,
+		))
+		require.NoError(mempool.Start())
+		require.True(mempool.IsRunning())
+		return mempool
+	}
+	cachedBlockHashes := func(mempool *PosMempool) []BlockHash {
+		var hashes []BlockHash
+		for _, cachedBlock := range mempool.feeEstimator.cachedBlocks {
+			hashes = append(hashes, cachedBlock.Hash)
+		}
+		return hashes
+	}
+
+	// Connect three blocks, each including one transaction from the mempool, then disconnect the last one.
+	mempool := startMempool(globalParams, nil)
+	var txns []*MsgDeSoTxn
+	var blocks []*MsgDeSoBlock
+	for ii := uint64(0); ii < 3; ii++ {
+		txn := _generateTestTxnWithFeeRate(t, randSource, 2000, m0PubBytes, m0Priv, 100, 25)
+		_wrappedPosMempoolAddTransaction(t, mempool, txn)
+		txns = append(txns, txn)
+	}
+	for ii := uint64(0); ii < 3; ii++ {
+		block := &MsgDeSoBlock{Header: &MsgDeSoHeader{Version: 1, Height: 3 + ii}, Txns: []*MsgDeSoTxn{txns[ii]}}
+		mempool.OnBlockConnected(block)
+		blocks = append(blocks, block)
+	}
+	mempool.OnBlockDisconnected(blocks[2])
+	block3Hash, err := blocks[0].Hash()
+	require.NoError(err)
+	block4Hash, err := blocks[1].Hash()
+	require.NoError(err)
+	require.Equal([]BlockHash{*block3Hash, *block4Hash}, cachedBlockHashes(mempool))
+	mempool.Stop()
+
+	// After a restart, the fee estimator reloads the remaining blocks along with the inclusion latencies of their
+	// transactions, and the mempool still reloads its own transactions.
+	mempool = startMempool(globalParams, nil)
+	require.Equal([]BlockHash{*block3Hash, *block4Hash}, cachedBlockHashes(mempool))
+	require.Equal(uint64(1), mempool.feeEstimator.cachedBlocks[0].InclusionLatencies[*txns[0].Hash()])
+	require.Equal(uint64(2), mempool.feeEstimator.cachedBlocks[1].InclusionLatencies[*txns[1].Hash()])
+	require.Equal(1, len(mempool.GetTransactions()))
+	require.NotNil(mempool.GetTransaction(txns[2].Hash()))
+
+	// Reducing the number of past blocks prunes the oldest block from the database too.
+	newGlobalParams := *globalParams
+	newGlobalParams.MempoolFeeEstimatorNumPastBlocks = 1
+	require.NoError(mempool.feeEstimator.UpdateGlobalParams(&newGlobalParams))
+	require.Equal([]BlockHash{*block4Hash}, cachedBlockHashes(mempool))
+	mempool.Stop()
+	mempool = startMempool(globalParams, nil)
+	require.Equal([]BlockHash{*block4Hash}, cachedBlockHashes(mempool))
+	mempool.Stop()
+
+	// If the chain reorged to a different block at the same height while the node was offline, the persisted block
+	// is discarded in favor of the block the fee estimator is initialized with.
+	reorgBlock := &MsgDeSoBlock{Header: &MsgDeSoHeader{Version: 1, Height: 4, TstampNanoSecs: 5 * 1e9}}
+	reorgBlockHash, err := reorgBlock.Hash()
+	require.NoError(err)
+	mempool = startMempool(globalParams, []*MsgDeSoBlock{reorgBlock})
+	require.Equal([]BlockHash{*reorgBlockHash}, cachedBlockHashes(mempool))
+	mempool.Stop()
+	mempool = startMempool(globalParams, nil)
+	require.Equal([]BlockHash{*reorgBlockHash}, cachedBlockHashes(mempool))
+	mempool.Stop()
+}
+
 func _generateTestTxnWithFeeRate(t *testing.T, rand *rand.Rand, feeRate uint64, pk []byte, priv string,
 	expirationHeight uint64, extraDataBytes int32) *MsgDeSoTxn {
 
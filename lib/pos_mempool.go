@@ -28,9 +28,13 @@ type Mempool interface {
 	Stop()
 	IsRunning() bool
 	AddTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) error
+	AddTransactionPackage(txns []*MsgDeSoTxn, txnTimestamp time.Time) error
 	RemoveTransaction(txnHash *BlockHash) error
 	GetTransaction(txnHash *BlockHash) *MempoolTx
 	GetTransactions() []*MempoolTx
+	// GetPackageParentHash returns the hash of the transaction's parent in its transaction package, or nil if the
+	// transaction isn't in the mempool or has no package parent.
+	GetPackageParentHash(txnHash *BlockHash) *BlockHash
 	UpdateLatestBlock(blockView *UtxoView, blockHeight uint64)
 	UpdateGlobalParams(globalParams *GlobalParamsEntry)
 
@@ -46,6 +50,15 @@ type Mempool interface {
 	GetMempoolSummaryStats() map[string]*SummaryStats
 	EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) (uint64, error)
 	EstimateFeeRate(minFeeRateNanosPerKB uint64) uint64
+	// EstimateFeeRateForTarget estimates the fee rate in nanos per KB needed for a transaction to be included within
+	// targetBlocks blocks with the given confidence, in basis points.
+	EstimateFeeRateForTarget(targetBlocks uint64, confidenceBasisPoints uint64) (uint64, error)
+	// GetFeeRateHistogram returns the number and size of the mempool's transactions in each fee bucket, ordered
+	// from the highest fee rate to the lowest.
+	GetFeeRateHistogram() []*FeeRateHistogramBucket
+	// Subscribe returns a subscription that streams MempoolTxnEvents as transactions are added to and removed from
+	// the mempool. A bufferSize <= 0 uses DefaultMempoolSubscriptionBufferSize.
+	Subscribe(bufferSize int) *MempoolSubscription
 }
 
 // GetAugmentedUniversalViewWithAdditionalTransactions is meant as a helper function
@@ -139,6 +152,10 @@ type PosMempool struct {
 	// facilitating a "replace by higher fee" feature. This feature gives users the ability to replace their existing
 	// mempool transaction with a new transaction having the same nonce but higher fee.
 	nonceTracker *NonceTracker
+	// publicKeyLimits caps how much of the mempool a single public key can use, and publicKeyUsage tracks how much
+	// each public key is currently using. The limits are disabled by default, and are set via SetPublicKeyLimits.
+	publicKeyLimits PosMempoolPublicKeyLimits
+	publicKeyUsage  *publicKeyUsageTracker
 
 	// readOnlyLatestBlockView is used to check if a transaction has a valid nonce before being added to the mempool.
 	// The readOnlyLatestBlockView should be updated whenever a new block is added to the blockchain via UpdateLatestBlock.
@@ -188,15 +205,21 @@ type PosMempool struct {
 	// recentRejectedTxnCache is a cache to store the txns that were recently rejected so that we can return better
 	// errors for them.
 	recentRejectedTxnCache lru.Map[BlockHash, error]
+
+	// subscriptions fans out MempoolTxnEvents to the subscribers registered through Subscribe. Events are published
+	// while the mempool lock is held, so subscribers observe them in the order they were applied.
+	subscriptions *mempoolSubscriptionManager
 }
 
 func NewPosMempool() *PosMempool {
 	return &PosMempool{
-		status:       PosMempoolStatusNotInitialized,
-		txnRegister:  NewTransactionRegister(),
-		feeEstimator: NewPoSFeeEstimator(),
-		nonceTracker: NewNonceTracker(),
-		quit:         make(chan interface{}),
+		status:         PosMempoolStatusNotInitialized,
+		txnRegister:    NewTransactionRegister(),
+		feeEstimator:   NewPoSFeeEstimator(),
+		nonceTracker:   NewNonceTracker(),
+		publicKeyUsage: newPublicKeyUsageTracker(),
+		quit:           make(chan interface{}),
+		subscriptions:  newMempoolSubscriptionManager(),
 	}
 }
 
@@ -241,6 +264,7 @@ func (mp *PosMempool) Init(
 	mp.txnRegister = NewTransactionRegister()
 	mp.txnRegister.Init(mp.globalParams)
 	mp.nonceTracker = NewNonceTracker()
+	mp.publicKeyUsage = newPublicKeyUsageTracker()
 
 	// Initialize the fee estimator
 	err = mp.feeEstimator.Init(mp.txnRegister, feeEstimatorPastBlocks, mp.globalParams)
@@ -276,6 +300,12 @@ func (mp *PosMempool) Start() error {
 		if err != nil {
 			return errors.Wrapf(err, "PosMempool.Start: Problem loading persisted transactions")
 		}
+
+		// Reload the fee estimator's past blocks from the previous run, so that its estimates don't have to warm up
+		// again, and persist its past blocks from now on.
+		if err = mp.feeEstimator.EnablePersistence(mp.db); err != nil {
+			return errors.Wrapf(err, "PosMempool.Start: Problem enabling fee estimator persistence")
+		}
 	}
 
 	mp.startGroup.Add(1)
@@ -329,8 +359,12 @@ func (mp *PosMempool) Stop() {
 	// Reset the transaction register, the ledger, and the nonce tracker.
 	mp.txnRegister.Reset()
 	mp.nonceTracker.Reset()
+	mp.publicKeyUsage = newPublicKeyUsageTracker()
 	mp.feeEstimator = NewPoSFeeEstimator()
 	mp.status = PosMempoolStatusNotInitialized
+
+	// Close all subscriptions so that subscribers know no further events will be delivered.
+	mp.subscriptions.closeAll()
 }
 
 func (mp *PosMempool) IsRunning() bool {
@@ -351,6 +385,19 @@ func (mp *PosMempool) OnBlockConnected(block *MsgDeSoBlock) {
 		return
 	}
 
+	// The block hash is only used to annotate the included-in-block events, so a hashing error isn't fatal.
+	blockHash, err := block.Hash()
+	if err != nil {
+		glog.Errorf("PosMempool.OnBlockConnected: Problem hashing block: %v", err)
+	}
+
+	// Add the block to the fee estimator. This is a best effort operation. If we fail to add the block
+	// to the fee estimator, we log an error and continue. This has to happen before the block's transactions
+	// are removed from the mempool so that the fee estimator can see how long they waited to be included.
+	if err := mp.feeEstimator.AddBlock(block); err != nil {
+		glog.Errorf("PosMempool.OnBlockConnected: Problem adding block to fee estimator: %v", err)
+	}
+
 	// Remove all transactions in the block from the mempool.
 	for _, txn := range block.Txns {
 		txnHash := txn.Hash()
@@ -373,13 +420,14 @@ func (mp *PosMempool) OnBlockConnected(block *MsgDeSoBlock) {
 		// Remove the transaction from the mempool.
 		if err := mp.removeTransactionNoLock(existingTxn, true); err != nil {
 			glog.Errorf("PosMempool.OnBlockConnected: Problem removing transaction from mempool: %v", err)
+			continue
 		}
-	}
-
-	// Add the block to the fee estimator. This is a best effort operation. If we fail to add the block
-	// to the fee estimator, we log an error and continue.
-	if err := mp.feeEstimator.AddBlock(block); err != nil {
-		glog.Errorf("PosMempool.OnBlockConnected: Problem adding block to fee estimator: %v", err)
+		mp.subscriptions.publish(&MempoolTxnEvent{
+			Type:      MempoolTxnEventIncludedInBlock,
+			Txn:       existingTxn,
+			Reason:    MempoolTxnEventReasonIncludedInBlock,
+			BlockHash: blockHash,
+		})
 	}
 }
 
@@ -418,7 +466,7 @@ func (mp *PosMempool) OnBlockDisconnected(block *MsgDeSoBlock) {
 		mp.deleteTxnHashFromRecentBlockCache(*txnHash)
 
 		// Add the transaction to the mempool and then prune if needed.
-		if err := mp.addTransactionNoLock(mempoolTx, true); err != nil {
+		if err := mp.addTransactionNoLock(mempoolTx, true, MempoolTxnEventReasonBlockDisconnected); err != nil {
 			glog.Errorf("PosMempool.AddTransaction: Problem adding transaction to mempool: %v", err)
 		}
 	}
@@ -474,7 +522,7 @@ func (mp *PosMempool) AddTransaction(txn *MsgDeSoTxn, txnTimestamp time.Time) er
 	}
 
 	// Add the transaction to the mempool and then prune if needed.
-	if err := mp.addTransactionNoLock(mempoolTx, true); err != nil {
+	if err := mp.addTransactionNoLock(mempoolTx, true, MempoolTxnEventReasonSubmitted); err != nil {
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem adding transaction to mempool")
 	}
 
@@ -544,6 +592,10 @@ func (mp *PosMempool) checkTransactionSanity(txn *MsgDeSoTxn, expectInnerAtomicT
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
 	}
 
+	if err := mp.checkMinInclusionBlockHeight(txn); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating min inclusion block height")
+	}
+
 	if err := ValidateDeSoTxnSanityBalanceModel(txn, mp.latestBlockHeight, mp.params, mp.globalParams); err != nil {
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem validating transaction sanity")
 	}
@@ -590,7 +642,9 @@ func (mp *PosMempool) persistMempoolAddEvent(txn *MempoolTx, persistToDb bool) {
 	}
 }
 
-func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) error {
+// addTransactionNoLock adds the transaction to the mempool, replacing any transaction with the same public key and
+// nonce, and publishes the corresponding events to subscribers. The addReason is attached to the added event.
+func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool, addReason string) error {
 	userPk := NewPublicKey(txn.Tx.PublicKey)
 
 	// Special handling for atomic txns. For atomic txns, the mempool will ignore the nonce for the wrapper txn
@@ -632,6 +686,17 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 			mp.nonceTracker.AddTxnByPublicKeyNonce(txn, *userPk, *txn.Tx.TxnNonce)
 			innerTxnsWithNoncesAdded = append(innerTxnsWithNoncesAdded, innerMempoolTx.Tx)
 		}
+		// Check that none of the inner txns' public keys would exceed their limits.
+		charges, err := getPublicKeyCharges(txn)
+		if err != nil {
+			mp.removeNonces(innerTxnsWithNoncesAdded)
+			return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem computing public key charges")
+		}
+		txnsToEvict, err := mp.checkPublicKeyLimitsNoLock(txn, charges, nil)
+		if err != nil {
+			mp.removeNonces(innerTxnsWithNoncesAdded)
+			return errors.Wrapf(err, "PosMempool.AddTransaction: Problem checking public key limits")
+		}
 		// Only add the wrapper transaction to the transaction register.
 		if err := mp.txnRegister.AddTransaction(txn); err != nil {
 			// If we failed to add the transaction to the txn register, we need to remove the inner txns'
@@ -639,8 +704,13 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 			mp.removeNonces(innerTxnsWithNoncesAdded)
 			return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem adding txn to register")
 		}
+		for _, evictedTxn := range txnsToEvict {
+			mp.evictTransactionNoLock(evictedTxn, MempoolTxnEventReasonPublicKeyLimit)
+		}
+		mp.publicKeyUsage.addTransaction(txn, charges)
 		// Emit a persist event only for the wrapper transaction.
 		mp.persistMempoolAddEvent(txn, persistToDb)
+		mp.subscriptions.publish(&MempoolTxnEvent{Type: MempoolTxnEventAdded, Txn: txn, Reason: addReason})
 		return nil
 	}
 
@@ -650,6 +720,16 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem checking nonce tracker")
 	}
 
+	// Check that the public key wouldn't exceed its limits, not counting the transaction being replaced.
+	charges, err := getPublicKeyCharges(txn)
+	if err != nil {
+		return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem computing public key charges")
+	}
+	txnsToEvict, err := mp.checkPublicKeyLimitsNoLock(txn, charges, existingTxn)
+	if err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransaction: Problem checking public key limits")
+	}
+
 	// We can now add the transaction to the mempool.
 	if err = mp.txnRegister.AddTransaction(txn); err != nil {
 		return errors.Wrapf(err, "PosMempool.addTransactionNoLock: Problem adding txn to register")
@@ -667,9 +747,27 @@ func (mp *PosMempool) addTransactionNoLock(txn *MempoolTx, persistToDb bool) err
 	// At this point the transaction is in the mempool. We can now update the nonce tracker.
 	mp.nonceTracker.AddTxnByPublicKeyNonce(txn, *userPk, *txn.Tx.TxnNonce)
 
+	// Evict the public key's lower priority transactions that the new transaction displaces, and charge the new
+	// transaction to the public key.
+	for _, evictedTxn := range txnsToEvict {
+		mp.evictTransactionNoLock(evictedTxn, MempoolTxnEventReasonPublicKeyLimit)
+	}
+	mp.publicKeyUsage.addTransaction(txn, charges)
+
 	// Emit an event for the newly added transaction.
 	mp.persistMempoolAddEvent(txn, persistToDb)
 
+	// Notify subscribers of the new transaction, followed by the transaction it replaced.
+	mp.subscriptions.publish(&MempoolTxnEvent{Type: MempoolTxnEventAdded, Txn: txn, Reason: addReason})
+	if existingTxn != nil {
+		mp.subscriptions.publish(&MempoolTxnEvent{
+			Type:              MempoolTxnEventReplaced,
+			Txn:               existingTxn,
+			Reason:            MempoolTxnEventReasonReplacedByHigherFee,
+			ReplacedByTxnHash: txn.Hash,
+		})
+	}
+
 	return nil
 }
 
@@ -686,7 +784,7 @@ func (mp *PosMempool) loadPersistedTransactions() error {
 	}
 	// We set the persistToDb flag to false so that persister doesn't try to save the transactions.
 	for _, txn := range txns {
-		if err := mp.addTransactionNoLock(txn, false); err != nil {
+		if err := mp.addTransactionNoLock(txn, false, MempoolTxnEventReasonLoadedFromDb); err != nil {
 			glog.Errorf("PosMempool.Start: Problem adding transaction with hash (%v) from persister: %v",
 				txn.Hash, err)
 		}
@@ -709,14 +807,38 @@ func (mp *PosMempool) RemoveTransaction(txnHash *BlockHash) error {
 		return nil
 	}
 
-	return mp.removeTransactionNoLock(txn, true)
+	if err := mp.removeTransactionNoLock(txn, true); err != nil {
+		return err
+	}
+	mp.subscriptions.publish(&MempoolTxnEvent{
+		Type:   MempoolTxnEventRemoved,
+		Txn:    txn,
+		Reason: MempoolTxnEventReasonRemoveRequested,
+	})
+	return nil
 }
 
-func (mp *PosMempool) removeTransaction(txn *MempoolTx, persistToDb bool) error {
+// removeInvalidatedTransaction removes a transaction that failed to connect during validateTransactions and
+// notifies subscribers with the connect error.
+func (mp *PosMempool) removeInvalidatedTransaction(txn *MempoolTx, connectErr error) error {
 	mp.Lock()
 	defer mp.Unlock()
 
-	return mp.removeTransactionNoLock(txn, persistToDb)
+	// The transaction may have been removed, e.g. by being included in a block, since validateTransactions released
+	// the lock. In that case, there's nothing to invalidate.
+	if mp.txnRegister.GetTransaction(txn.Hash) != txn {
+		return nil
+	}
+	if err := mp.removeTransactionNoLock(txn, true); err != nil {
+		return err
+	}
+	mp.subscriptions.publish(&MempoolTxnEvent{
+		Type:   MempoolTxnEventInvalidated,
+		Txn:    txn,
+		Reason: connectErr.Error(),
+		Err:    connectErr,
+	})
+	return nil
 }
 
 func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool) error {
@@ -727,6 +849,7 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 	if err := mp.txnRegister.RemoveTransaction(txn); err != nil {
 		return errors.Wrapf(err, "PosMempool.removeTransactionNoLock: Problem removing txn from register")
 	}
+	mp.publicKeyUsage.removeTransaction(txn)
 
 	if txn.Tx.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
 		// For atomic transactions, we remove the nonces of the inner txns, but not the wrapper txn.
@@ -743,6 +866,9 @@ func (mp *PosMempool) removeTransactionNoLock(txn *MempoolTx, persistToDb bool)
 		mp.nonceTracker.RemoveTxnByPublicKeyNonce(*userPk, *txn.Tx.TxnNonce)
 	}
 
+	// If the transaction was part of a package, the rest of the package no longer benefits from its fee.
+	mp.unlinkPackageNoLock(txn)
+
 	// Emit an event for the removed transaction.
 	if persistToDb && !mp.inMemoryOnly {
 		event := &MempoolEvent{
@@ -793,8 +919,28 @@ func (mp *PosMempool) GetTransactions() []*MempoolTx {
 	return mempoolTxns
 }
 
+// GetPackageParentHash returns the hash of the transaction's parent in its transaction package, or nil if the
+// transaction isn't in the mempool or has no package parent. This function is thread-safe.
+func (mp *PosMempool) GetPackageParentHash(txnHash *BlockHash) *BlockHash {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	txn := mp.txnRegister.GetTransaction(txnHash)
+	if txn == nil || txn.packageParent == nil {
+		return nil
+	}
+	return txn.packageParent.Hash
+}
+
+// getTransactionsNoLock returns the transactions that can be included in the next block in Fee-Time order, with
+// package ancestors ahead of their descendants. Scheduled transactions are left out until they're eligible.
 func (mp *PosMempool) getTransactionsNoLock() []*MempoolTx {
-	return mp.txnRegister.GetFeeTimeTransactions()
+	return mp.filterEligibleTransactionsNoLock(mp.getAllTransactionsNoLock())
+}
+
+// getAllTransactionsNoLock is the same as getTransactionsNoLock, except that it includes scheduled transactions.
+func (mp *PosMempool) getAllTransactionsNoLock() []*MempoolTx {
+	return orderTransactionsByPackage(mp.txnRegister.GetFeeTimeTransactions())
 }
 
 // validateTransactions updates the validated status of transactions in the mempool. The function connects the Fee-Time ordered
@@ -850,7 +996,9 @@ func (mp *PosMempool) validateTransactions() error {
 			mp.recentRejectedTxnCache.Put(*txn.Hash, err)
 
 			// Try to remove the transaction with a lock.
-			mp.removeTransaction(txn, true)
+			if err := mp.removeInvalidatedTransaction(txn, err); err != nil {
+				glog.Errorf("PosMempool.validateTransactions: Problem removing transaction from mempool: %v", err)
+			}
 
 			continue
 		}
@@ -882,6 +1030,9 @@ func (mp *PosMempool) pruneNoLock() error {
 		return nil
 	}
 
+	// If fair-share eviction is enabled, first evict transactions from public keys using more than their share.
+	mp.pruneFairShareNoLock()
+
 	prunedTxns, err := mp.txnRegister.PruneToSize(mp.globalParams.MempoolMaxSizeBytes)
 	if err != nil {
 		return errors.Wrapf(err, "PosMempool.pruneNoLock: Problem pruning mempool")
@@ -891,6 +1042,11 @@ func (mp *PosMempool) pruneNoLock() error {
 			// We should never get to here since the transaction was already pruned from the TransactionRegister.
 			glog.Errorf("PosMempool.pruneNoLock: Problem removing transaction from mempool: %v", err)
 		}
+		mp.subscriptions.publish(&MempoolTxnEvent{
+			Type:   MempoolTxnEventPruned,
+			Txn:    prunedTxn,
+			Reason: MempoolTxnEventReasonMempoolFull,
+		})
 	}
 	return nil
 }
@@ -912,6 +1068,11 @@ func (mp *PosMempool) rebucketTransactionRegisterNoLock() error {
 		txnInNewRegister := newTxnRegister.GetTransaction(txn.Hash)
 		if txnInNewRegister == nil {
 			mp.removeTransactionNoLock(txn, true)
+			mp.subscriptions.publish(&MempoolTxnEvent{
+				Type:   MempoolTxnEventRemoved,
+				Txn:    txn,
+				Reason: MempoolTxnEventReasonGlobalParamsChanged,
+			})
 		}
 	}
 
@@ -1087,8 +1248,17 @@ func (mp *PosMempool) GetMempoolTx(txHash *BlockHash) *MempoolTx {
 	return mp.txnRegister.txnMembership[*txHash]
 }
 
+// GetMempoolSummaryStats returns the number of transactions and bytes in the mempool for each txn type, along with
+// the per-public-key metrics keyed by the MempoolSummaryStatsPublicKey* constants.
 func (mp *PosMempool) GetMempoolSummaryStats() map[string]*SummaryStats {
-	return convertMempoolTxsToSummaryStats(mp.txnRegister.GetFeeTimeTransactions())
+	mp.RLock()
+	defer mp.RUnlock()
+
+	summaryStats := convertMempoolTxsToSummaryStats(mp.txnRegister.GetFeeTimeTransactions())
+	for key, stats := range mp.getPublicKeySummaryStatsNoLock() {
+		summaryStats[key] = stats
+	}
+	return summaryStats
 }
 
 func (mp *PosMempool) EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64) (uint64, error) {
@@ -1098,3 +1268,18 @@ func (mp *PosMempool) EstimateFee(txn *MsgDeSoTxn, minFeeRateNanosPerKB uint64)
 func (mp *PosMempool) EstimateFeeRate(minFeeRateNanosPerKB uint64) uint64 {
 	return mp.feeEstimator.EstimateFeeRateNanosPerKB(minFeeRateNanosPerKB)
 }
+
+func (mp *PosMempool) EstimateFeeRateForTarget(targetBlocks uint64, confidenceBasisPoints uint64) (uint64, error) {
+	return mp.feeEstimator.EstimateFeeRateForTarget(targetBlocks, confidenceBasisPoints)
+}
+
+func (mp *PosMempool) GetFeeRateHistogram() []*FeeRateHistogramBucket {
+	return mp.feeEstimator.GetFeeRateHistogram()
+}
+
+// Subscribe returns a subscription that streams MempoolTxnEvents for every transaction that is added to, replaced
+// in, or removed from the mempool from now on. Subscribers that want a consistent view should call Subscribe first,
+// then GetTransactions, and de-duplicate. The subscription is closed when the mempool stops.
+func (mp *PosMempool) Subscribe(bufferSize int) *MempoolSubscription {
+	return mp.subscriptions.subscribe(bufferSize)
+}
@@ -0,0 +1,305 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// MaxMempoolPackageSize is the maximum number of transactions in a transaction package, including any package members
+// that were already in the mempool.
+const MaxMempoolPackageSize = 25
+
+// A transaction package is a chain of transactions from a single public key whose nonces share the same
+// ExpirationBlockHeight and have consecutive PartialIDs. The transaction with the lowest PartialID is the root of the
+// package, and each following transaction is the child of the one before it.
+//
+// Packages allow a high fee child to pay for a low fee parent (child-pays-for-parent). Every transaction in a package
+// is ordered in the TransactionRegister by its package fee rate, which is the highest fee rate of any package prefix
+// that includes it. This makes package fee rates non-increasing from the root, so a parent is never ordered behind
+// its child because of its fee. Within a Fee-Time bucket, ancestors are moved ahead of their descendants when the
+// mempool returns its transactions.
+//
+// Packages only order transactions within this node's mempool. They are formed through AddTransactionPackage, which
+// is meant for in-process callers such as a node embedding this package: no peer message or API submits packages,
+// and transactions are relayed to peers individually. Transactions that happen to have consecutive nonces but are
+// added individually are not linked, and package links aren't persisted, so transactions reloaded from the database
+// are ordered by their own fee rates.
+
+// validateTransactionPackage checks that txns form a well-shaped package.
+func validateTransactionPackage(txns []*MsgDeSoTxn) error {
+	if len(txns) < 2 {
+		return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Package must contain at "+
+			"least two transactions, got %d", len(txns))
+	}
+	if len(txns) > MaxMempoolPackageSize {
+		return errors.Wrapf(MempoolErrorPackageTooLarge, "validateTransactionPackage: Package has %d transactions, "+
+			"the maximum is %d", len(txns), MaxMempoolPackageSize)
+	}
+	for ii, txn := range txns {
+		if txn == nil || txn.TxnNonce == nil || txn.TxnMeta == nil {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d is nil or "+
+				"has no nonce", ii)
+		}
+		if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper || txn.IsAtomicTxnsInnerTxn() {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d is an "+
+				"atomic transaction, which can't be part of a package", ii)
+		}
+		if _, exists := txn.ExtraData[MinInclusionBlockHeightKey]; exists {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d is a "+
+				"scheduled transaction, which can't be part of a package", ii)
+		}
+		if ii == 0 {
+			continue
+		}
+		prevTxn := txns[ii-1]
+		if !bytes.Equal(txn.PublicKey, prevTxn.PublicKey) {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d has a "+
+				"different public key than transaction %d", ii, ii-1)
+		}
+		if txn.TxnNonce.ExpirationBlockHeight != prevTxn.TxnNonce.ExpirationBlockHeight {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d has nonce "+
+				"expiration height %d but transaction %d has %d", ii, txn.TxnNonce.ExpirationBlockHeight, ii-1,
+				prevTxn.TxnNonce.ExpirationBlockHeight)
+		}
+		if prevTxn.TxnNonce.PartialID == math.MaxUint64 || txn.TxnNonce.PartialID != prevTxn.TxnNonce.PartialID+1 {
+			return errors.Wrapf(MempoolErrorInvalidPackage, "validateTransactionPackage: Transaction %d has nonce "+
+				"partial ID %d, which doesn't follow partial ID %d of transaction %d", ii, txn.TxnNonce.PartialID,
+				prevTxn.TxnNonce.PartialID, ii-1)
+		}
+	}
+	return nil
+}
+
+// getPackage returns the package that txn belongs to, ordered from the root to the last descendant.
+func getPackage(txn *MempoolTx) []*MempoolTx {
+	root := txn
+	for root.packageParent != nil {
+		root = root.packageParent
+	}
+	var packageTxns []*MempoolTx
+	for packageTxn := root; packageTxn != nil; packageTxn = packageTxn.packageChild {
+		packageTxns = append(packageTxns, packageTxn)
+	}
+	return packageTxns
+}
+
+// computePackageFeeRates returns the package fee rate of each transaction in packageTxns, which must be ordered from
+// the root. The package fee rate of a transaction is the highest fee rate of any prefix of the package that includes
+// the transaction.
+func computePackageFeeRates(packageTxns []*MempoolTx) []uint64 {
+	prefixFeeRates := make([]uint64, len(packageTxns))
+	totalFeeNanos := big.NewInt(0)
+	totalSizeBytes := big.NewInt(0)
+	for ii, txn := range packageTxns {
+		totalFeeNanos.Add(totalFeeNanos, new(big.Int).SetUint64(txn.Fee))
+		totalSizeBytes.Add(totalSizeBytes, new(big.Int).SetUint64(txn.TxSizeBytes))
+		prefixFeeRates[ii] = math.MaxUint64
+		if totalSizeBytes.Sign() > 0 {
+			feeRate := new(big.Int).Mul(totalFeeNanos, big.NewInt(1000))
+			feeRate.Quo(feeRate, totalSizeBytes)
+			if feeRate.IsUint64() {
+				prefixFeeRates[ii] = feeRate.Uint64()
+			}
+		}
+	}
+
+	packageFeeRates := make([]uint64, len(packageTxns))
+	maxFeeRate := uint64(0)
+	for ii := len(packageTxns) - 1; ii >= 0; ii-- {
+		if prefixFeeRates[ii] > maxFeeRate {
+			maxFeeRate = prefixFeeRates[ii]
+		}
+		packageFeeRates[ii] = maxFeeRate
+	}
+	return packageFeeRates
+}
+
+// refreshPackageFeeRatesNoLock recomputes the package fee rates of the package that txn belongs to, and re-buckets
+// any transactions whose package fee rate changed.
+func (mp *PosMempool) refreshPackageFeeRatesNoLock(txn *MempoolTx) {
+	packageTxns := getPackage(txn)
+	packageFeeRates := computePackageFeeRates(packageTxns)
+	for ii, packageTxn := range packageTxns {
+		newPackageFeePerKB := packageFeeRates[ii]
+		// A transaction that is no longer part of a package goes back to being ordered by its own fee rate.
+		if len(packageTxns) == 1 {
+			newPackageFeePerKB = 0
+		}
+		if packageTxn.packageFeePerKB == newPackageFeePerKB {
+			continue
+		}
+
+		// The TransactionRegister buckets transactions by their package fee rate, so we remove the transaction
+		// before updating it and add it back afterwards. Transactions that have already been pruned from the
+		// register are just updated.
+		inRegister := mp.txnRegister.GetTransaction(packageTxn.Hash) == packageTxn
+		if inRegister {
+			if err := mp.txnRegister.RemoveTransaction(packageTxn); err != nil {
+				glog.Errorf("PosMempool.refreshPackageFeeRatesNoLock: Problem removing txn from register: %v", err)
+				continue
+			}
+		}
+		packageTxn.packageFeePerKB = newPackageFeePerKB
+		if inRegister {
+			if err := mp.txnRegister.AddTransaction(packageTxn); err != nil {
+				glog.Errorf("PosMempool.refreshPackageFeeRatesNoLock: Problem adding txn to register: %v", err)
+			}
+		}
+	}
+}
+
+// unlinkPackageNoLock removes txn from its package, splitting the package in two if txn had both a parent and a
+// child. It must be called after txn has been removed from the TransactionRegister.
+func (mp *PosMempool) unlinkPackageNoLock(txn *MempoolTx) {
+	parent, child := txn.packageParent, txn.packageChild
+	txn.packageParent = nil
+	txn.packageChild = nil
+	txn.packageFeePerKB = 0
+
+	if parent != nil {
+		parent.packageChild = nil
+		mp.refreshPackageFeeRatesNoLock(parent)
+	}
+	if child != nil {
+		child.packageParent = nil
+		mp.refreshPackageFeeRatesNoLock(child)
+	}
+}
+
+// orderTransactionsByPackage moves package ancestors ahead of their descendants in the Fee-Time ordered txns, while
+// otherwise preserving the order. Package fee rates already guarantee that a parent is never in a lower Fee-Time
+// bucket than its child, but a parent can still be behind its child within a bucket if it was added later.
+func orderTransactionsByPackage(txns []*MempoolTx) []*MempoolTx {
+	hasPackages := false
+	for _, txn := range txns {
+		if txn.packageParent != nil {
+			hasPackages = true
+			break
+		}
+	}
+	if !hasPackages {
+		return txns
+	}
+
+	orderedTxns := make([]*MempoolTx, 0, len(txns))
+	orderedTxnHashes := NewSet([]BlockHash{})
+	for _, txn := range txns {
+		if orderedTxnHashes.Includes(*txn.Hash) {
+			continue
+		}
+		var ancestors []*MempoolTx
+		for parent := txn.packageParent; parent != nil && !orderedTxnHashes.Includes(*parent.Hash); parent = parent.packageParent {
+			ancestors = append(ancestors, parent)
+		}
+		for ii := len(ancestors) - 1; ii >= 0; ii-- {
+			orderedTxns = append(orderedTxns, ancestors[ii])
+			orderedTxnHashes.Add(*ancestors[ii].Hash)
+		}
+		orderedTxns = append(orderedTxns, txn)
+		orderedTxnHashes.Add(*txn.Hash)
+	}
+	return orderedTxns
+}
+
+// AddTransactionPackage validates a package of transactions and adds them to the mempool as a unit, so that the
+// package fee rate determines the Fee-Time priority of every transaction in it. The txns must be ordered from parent
+// to child. Transactions in the package that are already in the mempool are linked into the package rather than
+// re-added, which allows a stuck transaction to be bumped by submitting it together with a higher fee child.
+//
+// Either all the new transactions are added or none of them are. If the mempool overflows as a result of adding the
+// package, the mempool is pruned.
+func (mp *PosMempool) AddTransactionPackage(txns []*MsgDeSoTxn, txnTimestamp time.Time) error {
+	if err := validateTransactionPackage(txns); err != nil {
+		return errors.Wrapf(err, "PosMempool.AddTransactionPackage: Problem validating package")
+	}
+
+	mp.Lock()
+	defer mp.Unlock()
+
+	if !mp.IsRunning() {
+		return errors.Wrapf(MempoolErrorNotRunning, "PosMempool.AddTransactionPackage: ")
+	}
+
+	// Validate all the new transactions before adding any of them, so that we don't need to roll back in the
+	// common failure cases.
+	packageTxns := make([]*MempoolTx, len(txns))
+	isNewTxn := make([]bool, len(txns))
+	for ii, txn := range txns {
+		if existingTxn := mp.txnRegister.GetTransaction(txn.Hash()); existingTxn != nil {
+			packageTxns[ii] = existingTxn
+			continue
+		}
+		if err := mp.checkTransactionSanity(txn, false); err != nil {
+			return errors.Wrapf(err, "PosMempool.AddTransactionPackage: Problem verifying transaction %d", ii)
+		}
+		mempoolTx, err := NewMempoolTx(txn, txnTimestamp, mp.latestBlockHeight)
+		if err != nil {
+			return errors.Wrapf(err, "PosMempool.AddTransactionPackage: Problem constructing MempoolTx %d", ii)
+		}
+		if _, err = mp.checkNonceTracker(mempoolTx, NewPublicKey(txn.PublicKey)); err != nil {
+			return errors.Wrapf(err, "PosMempool.AddTransactionPackage: Problem checking nonce tracker for "+
+				"transaction %d", ii)
+		}
+		packageTxns[ii] = mempoolTx
+		isNewTxn[ii] = true
+	}
+
+	// The package may extend an existing package at either end. A new transaction at either end replaces the
+	// existing transaction with the same nonce, which detaches that transaction's relatives.
+	numPackageTxns := len(packageTxns)
+	if !isNewTxn[0] {
+		for parent := packageTxns[0].packageParent; parent != nil; parent = parent.packageParent {
+			numPackageTxns++
+		}
+	}
+	if !isNewTxn[len(packageTxns)-1] {
+		for child := packageTxns[len(packageTxns)-1].packageChild; child != nil; child = child.packageChild {
+			numPackageTxns++
+		}
+	}
+	if numPackageTxns > MaxMempoolPackageSize {
+		return errors.Wrapf(MempoolErrorPackageTooLarge, "PosMempool.AddTransactionPackage: Package would have "+
+			"%d transactions, the maximum is %d", numPackageTxns, MaxMempoolPackageSize)
+	}
+
+	// Add the new transactions to the mempool. If any of them fails, remove the ones we've already added.
+	for ii, mempoolTx := range packageTxns {
+		if !isNewTxn[ii] {
+			continue
+		}
+		if err := mp.addTransactionNoLock(mempoolTx, true, MempoolTxnEventReasonSubmitted); err != nil {
+			for jj := ii - 1; jj >= 0; jj-- {
+				if !isNewTxn[jj] {
+					continue
+				}
+				if removeErr := mp.removeTransactionNoLock(packageTxns[jj], true); removeErr != nil {
+					glog.Errorf("PosMempool.AddTransactionPackage: Problem rolling back transaction: %v", removeErr)
+					continue
+				}
+				mp.subscriptions.publish(&MempoolTxnEvent{
+					Type:   MempoolTxnEventRemoved,
+					Txn:    packageTxns[jj],
+					Reason: MempoolTxnEventReasonPackageRejected,
+				})
+			}
+			return errors.Wrapf(err, "PosMempool.AddTransactionPackage: Problem adding transaction %d", ii)
+		}
+	}
+
+	// Link the package together and re-bucket its transactions by their package fee rates.
+	for ii := 1; ii < len(packageTxns); ii++ {
+		packageTxns[ii-1].packageChild = packageTxns[ii]
+		packageTxns[ii].packageParent = packageTxns[ii-1]
+	}
+	mp.refreshPackageFeeRatesNoLock(packageTxns[0])
+
+	if err := mp.pruneNoLock(); err != nil {
+		glog.Errorf("PosMempool.AddTransactionPackage: Problem pruning mempool: %v", err)
+	}
+	return nil
+}
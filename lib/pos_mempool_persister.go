@@ -227,6 +227,11 @@ func (mp *MempoolPersister) GetPersistedTransactions() ([]*MempoolTx, error) {
 		defer iter.Close()
 		for iter.Seek([]byte{}); iter.Valid(); iter.Next() {
 			item := iter.Item()
+			// Transactions are keyed by their hash. Any other keys belong to the fee estimator, which shares the
+			// database.
+			if len(item.Key()) != HashSizeBytes {
+				continue
+			}
 			txnBytes, err := item.ValueCopy(nil)
 			if err != nil {
 				return errors.Wrapf(err, "MempoolPersister: Error retrieving value")
@@ -0,0 +1,320 @@
+package lib
+
+import (
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Keys of the per-public-key metrics that PosMempool.GetMempoolSummaryStats reports alongside the per-txn-type stats.
+const (
+	// MempoolSummaryStatsPublicKeyLimitRejections counts the transactions, and their bytes, that were rejected
+	// because their public key was at its limit.
+	MempoolSummaryStatsPublicKeyLimitRejections = "PUBLIC_KEY_LIMIT_REJECTIONS"
+	// MempoolSummaryStatsPublicKeyLimitEvictions counts the transactions, and their bytes, that were evicted to make
+	// room for a higher priority transaction from the same public key, or to enforce fair-share pruning.
+	MempoolSummaryStatsPublicKeyLimitEvictions = "PUBLIC_KEY_LIMIT_EVICTIONS"
+	// MempoolSummaryStatsLargestPublicKey reports the transactions and bytes of the public key using the most bytes.
+	MempoolSummaryStatsLargestPublicKey = "LARGEST_PUBLIC_KEY"
+	// MempoolSummaryStatsPublicKeys reports the number of distinct public keys with transactions in the mempool.
+	MempoolSummaryStatsPublicKeys = "PUBLIC_KEYS"
+)
+
+// PosMempoolPublicKeyLimits configures how much of the mempool a single public key can use. A zero limit means
+// there is no limit. Transactions in an atomic wrapper count towards the limits of their own public keys.
+type PosMempoolPublicKeyLimits struct {
+	// MaxTxnsPerPublicKey is the maximum number of transactions a public key can have in the mempool.
+	MaxTxnsPerPublicKey uint64
+	// MaxBytesPerPublicKey is the maximum number of transaction bytes a public key can have in the mempool.
+	MaxBytesPerPublicKey uint64
+	// FairShareEviction makes the mempool prune transactions from the public key using the most bytes, as long as
+	// it's using more than an equal share of the maximum mempool size, before falling back to Fee-Time pruning.
+	FairShareEviction bool
+}
+
+// publicKeyCharge is the amount of mempool usage a transaction is charged to a single public key.
+type publicKeyCharge struct {
+	publicKey PublicKey
+	numTxns   uint64
+	numBytes  uint64
+}
+
+// getPublicKeyCharges returns the public keys that a transaction is charged to. An atomic wrapper is charged to the
+// public keys of its inner transactions rather than its own.
+func getPublicKeyCharges(txn *MempoolTx) ([]publicKeyCharge, error) {
+	if txn.Tx.TxnMeta.GetTxnType() != TxnTypeAtomicTxnsWrapper {
+		return []publicKeyCharge{{publicKey: *NewPublicKey(txn.Tx.PublicKey), numTxns: 1, numBytes: txn.TxSizeBytes}}, nil
+	}
+	atomicTxnsWrapper, ok := txn.Tx.TxnMeta.(*AtomicTxnsWrapperMetadata)
+	if !ok {
+		return nil, errors.New("getPublicKeyCharges: Problem casting atomic txn wrapper metadata")
+	}
+	chargeIndexes := make(map[PublicKey]int)
+	var charges []publicKeyCharge
+	for _, innerTxn := range atomicTxnsWrapper.Txns {
+		innerTxnBytes, err := innerTxn.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getPublicKeyCharges: Problem serializing inner txn")
+		}
+		publicKey := *NewPublicKey(innerTxn.PublicKey)
+		chargeIndex, exists := chargeIndexes[publicKey]
+		if !exists {
+			chargeIndex = len(charges)
+			chargeIndexes[publicKey] = chargeIndex
+			charges = append(charges, publicKeyCharge{publicKey: publicKey})
+		}
+		charges[chargeIndex].numTxns++
+		charges[chargeIndex].numBytes += uint64(len(innerTxnBytes))
+	}
+	return charges, nil
+}
+
+// isLowerMempoolPriority returns true if txn a would be pruned before txn b, i.e. it has a lower fee rate, or the
+// same fee rate and a later timestamp.
+func isLowerMempoolPriority(a *MempoolTx, b *MempoolTx) bool {
+	if a.PackageFeePerKB() != b.PackageFeePerKB() {
+		return a.PackageFeePerKB() < b.PackageFeePerKB()
+	}
+	return a.Added.After(b.Added)
+}
+
+// publicKeyUsageTracker tracks the transactions and bytes each public key has in the mempool. It isn't thread safe,
+// and is protected by the PosMempool lock.
+type publicKeyUsageTracker struct {
+	txnsByPublicKey map[PublicKey]map[BlockHash]*MempoolTx
+	numTxns         map[PublicKey]uint64
+	numBytes        map[PublicKey]uint64
+	chargesByTxn    map[BlockHash][]publicKeyCharge
+
+	// Running totals of the transactions rejected and evicted because of the public key limits.
+	numRejectedTxns  uint64
+	numRejectedBytes uint64
+	numEvictedTxns   uint64
+	numEvictedBytes  uint64
+}
+
+func newPublicKeyUsageTracker() *publicKeyUsageTracker {
+	return &publicKeyUsageTracker{
+		txnsByPublicKey: make(map[PublicKey]map[BlockHash]*MempoolTx),
+		numTxns:         make(map[PublicKey]uint64),
+		numBytes:        make(map[PublicKey]uint64),
+		chargesByTxn:    make(map[BlockHash][]publicKeyCharge),
+	}
+}
+
+func (tracker *publicKeyUsageTracker) addTransaction(txn *MempoolTx, charges []publicKeyCharge) {
+	if _, exists := tracker.chargesByTxn[*txn.Hash]; exists {
+		return
+	}
+	tracker.chargesByTxn[*txn.Hash] = charges
+	for _, charge := range charges {
+		if tracker.txnsByPublicKey[charge.publicKey] == nil {
+			tracker.txnsByPublicKey[charge.publicKey] = make(map[BlockHash]*MempoolTx)
+		}
+		tracker.txnsByPublicKey[charge.publicKey][*txn.Hash] = txn
+		tracker.numTxns[charge.publicKey] += charge.numTxns
+		tracker.numBytes[charge.publicKey] += charge.numBytes
+	}
+}
+
+func (tracker *publicKeyUsageTracker) removeTransaction(txn *MempoolTx) {
+	charges, exists := tracker.chargesByTxn[*txn.Hash]
+	if !exists {
+		return
+	}
+	delete(tracker.chargesByTxn, *txn.Hash)
+	for _, charge := range charges {
+		delete(tracker.txnsByPublicKey[charge.publicKey], *txn.Hash)
+		tracker.numTxns[charge.publicKey] -= charge.numTxns
+		tracker.numBytes[charge.publicKey] -= charge.numBytes
+		if len(tracker.txnsByPublicKey[charge.publicKey]) == 0 {
+			delete(tracker.txnsByPublicKey, charge.publicKey)
+			delete(tracker.numTxns, charge.publicKey)
+			delete(tracker.numBytes, charge.publicKey)
+		}
+	}
+}
+
+// getCharge returns the charge of the given transaction to the given public key, or nil if the transaction isn't
+// tracked or isn't charged to the public key.
+func (tracker *publicKeyUsageTracker) getCharge(txnHash BlockHash, publicKey PublicKey) *publicKeyCharge {
+	for _, charge := range tracker.chargesByTxn[txnHash] {
+		if charge.publicKey == publicKey {
+			chargeCopy := charge
+			return &chargeCopy
+		}
+	}
+	return nil
+}
+
+// getLowestPriorityTransaction returns the transaction of the public key that would be pruned first, skipping the
+// transactions in excludedTxnHashes.
+func (tracker *publicKeyUsageTracker) getLowestPriorityTransaction(publicKey PublicKey,
+	excludedTxnHashes *Set[BlockHash]) *MempoolTx {
+
+	var lowestPriorityTxn *MempoolTx
+	for txnHash, txn := range tracker.txnsByPublicKey[publicKey] {
+		if excludedTxnHashes.Includes(txnHash) {
+			continue
+		}
+		if lowestPriorityTxn == nil || isLowerMempoolPriority(txn, lowestPriorityTxn) {
+			lowestPriorityTxn = txn
+		}
+	}
+	return lowestPriorityTxn
+}
+
+// getLargestPublicKey returns the public key using the most bytes, along with its usage.
+func (tracker *publicKeyUsageTracker) getLargestPublicKey() (_publicKey PublicKey, _numTxns uint64,
+	_numBytes uint64, _exists bool) {
+
+	var largestPublicKey PublicKey
+	exists := false
+	for publicKey, numBytes := range tracker.numBytes {
+		if !exists || numBytes > tracker.numBytes[largestPublicKey] {
+			largestPublicKey = publicKey
+			exists = true
+		}
+	}
+	if !exists {
+		return PublicKey{}, 0, 0, false
+	}
+	return largestPublicKey, tracker.numTxns[largestPublicKey], tracker.numBytes[largestPublicKey], true
+}
+
+// SetPublicKeyLimits sets the per-public-key limits of the mempool. The limits are enforced on transactions added
+// after the call. Transactions already in the mempool aren't evicted if they exceed new, lower limits.
+func (mp *PosMempool) SetPublicKeyLimits(limits PosMempoolPublicKeyLimits) {
+	mp.Lock()
+	defer mp.Unlock()
+
+	mp.publicKeyLimits = limits
+}
+
+// GetPublicKeyUsage returns the number of transactions and bytes the public key has in the mempool.
+func (mp *PosMempool) GetPublicKeyUsage(publicKey []byte) (_numTxns uint64, _numBytes uint64) {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	pk := *NewPublicKey(publicKey)
+	return mp.publicKeyUsage.numTxns[pk], mp.publicKeyUsage.numBytes[pk]
+}
+
+// checkPublicKeyLimitsNoLock checks whether txn can be added without any of its public keys exceeding their limits.
+// If a public key would exceed its limits, its lowest priority transactions are evicted to make room, but only if
+// they have a lower priority than txn. Otherwise, the txn is rejected with MempoolErrorPublicKeyLimitExceeded.
+// The replacedTxn, if not nil, is the transaction that txn replaces, and doesn't count towards the limits.
+func (mp *PosMempool) checkPublicKeyLimitsNoLock(txn *MempoolTx, charges []publicKeyCharge, replacedTxn *MempoolTx,
+) (_txnsToEvict []*MempoolTx, _err error) {
+
+	maxTxns := mp.publicKeyLimits.MaxTxnsPerPublicKey
+	maxBytes := mp.publicKeyLimits.MaxBytesPerPublicKey
+	if maxTxns == 0 && maxBytes == 0 {
+		return nil, nil
+	}
+
+	excludedTxnHashes := NewSet([]BlockHash{})
+	if replacedTxn != nil {
+		excludedTxnHashes.Add(*replacedTxn.Hash)
+	}
+	var txnsToEvict []*MempoolTx
+	for _, charge := range charges {
+		if (maxTxns != 0 && charge.numTxns > maxTxns) || (maxBytes != 0 && charge.numBytes > maxBytes) {
+			return nil, mp.rejectForPublicKeyLimitNoLock(txn, charge.publicKey)
+		}
+
+		// Compute the public key's usage once the replaced transaction and any transactions we've already decided
+		// to evict have been removed.
+		numTxns := mp.publicKeyUsage.numTxns[charge.publicKey]
+		numBytes := mp.publicKeyUsage.numBytes[charge.publicKey]
+		for _, txnHash := range excludedTxnHashes.ToSlice() {
+			if excludedCharge := mp.publicKeyUsage.getCharge(txnHash, charge.publicKey); excludedCharge != nil {
+				numTxns -= excludedCharge.numTxns
+				numBytes -= excludedCharge.numBytes
+			}
+		}
+
+		for (maxTxns != 0 && numTxns+charge.numTxns > maxTxns) || (maxBytes != 0 && numBytes+charge.numBytes > maxBytes) {
+			evictedTxn := mp.publicKeyUsage.getLowestPriorityTransaction(charge.publicKey, excludedTxnHashes)
+			// Atomic wrappers are never evicted here, since they also hold transactions from other public keys.
+			if evictedTxn == nil || !isLowerMempoolPriority(evictedTxn, txn) ||
+				evictedTxn.Tx.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+				return nil, mp.rejectForPublicKeyLimitNoLock(txn, charge.publicKey)
+			}
+			evictedCharge := mp.publicKeyUsage.getCharge(*evictedTxn.Hash, charge.publicKey)
+			numTxns -= evictedCharge.numTxns
+			numBytes -= evictedCharge.numBytes
+			excludedTxnHashes.Add(*evictedTxn.Hash)
+			txnsToEvict = append(txnsToEvict, evictedTxn)
+		}
+	}
+	return txnsToEvict, nil
+}
+
+func (mp *PosMempool) rejectForPublicKeyLimitNoLock(txn *MempoolTx, publicKey PublicKey) error {
+	mp.publicKeyUsage.numRejectedTxns++
+	mp.publicKeyUsage.numRejectedBytes += txn.TxSizeBytes
+	return errors.Wrapf(MempoolErrorPublicKeyLimitExceeded, "PosMempool.checkPublicKeyLimitsNoLock: Public key %v "+
+		"has %d transactions and %d bytes in the mempool, and the limits are %d transactions and %d bytes per "+
+		"public key. The transaction must pay a higher fee rate than the public key's lowest fee transaction to "+
+		"replace it", PkToString(publicKey[:], mp.params), mp.publicKeyUsage.numTxns[publicKey],
+		mp.publicKeyUsage.numBytes[publicKey], mp.publicKeyLimits.MaxTxnsPerPublicKey,
+		mp.publicKeyLimits.MaxBytesPerPublicKey)
+}
+
+// evictTransactionNoLock removes a transaction to enforce the per-public-key limits.
+func (mp *PosMempool) evictTransactionNoLock(txn *MempoolTx, reason string) {
+	if err := mp.removeTransactionNoLock(txn, true); err != nil {
+		glog.Errorf("PosMempool.evictTransactionNoLock: Problem removing transaction from mempool: %v", err)
+		return
+	}
+	mp.publicKeyUsage.numEvictedTxns++
+	mp.publicKeyUsage.numEvictedBytes += txn.TxSizeBytes
+	mp.subscriptions.publish(&MempoolTxnEvent{Type: MempoolTxnEventPruned, Txn: txn, Reason: reason})
+}
+
+// pruneFairShareNoLock evicts transactions from the public key using the most bytes, as long as the mempool is over
+// its maximum size and that public key is using more than an equal share of it.
+func (mp *PosMempool) pruneFairShareNoLock() {
+	if !mp.publicKeyLimits.FairShareEviction {
+		return
+	}
+	for mp.txnRegister.Size() > mp.globalParams.MempoolMaxSizeBytes {
+		largestPublicKey, _, numBytes, exists := mp.publicKeyUsage.getLargestPublicKey()
+		if !exists {
+			return
+		}
+		fairShareBytes := mp.globalParams.MempoolMaxSizeBytes / uint64(len(mp.publicKeyUsage.numBytes))
+		if numBytes <= fairShareBytes {
+			return
+		}
+		evictedTxn := mp.publicKeyUsage.getLowestPriorityTransaction(largestPublicKey, NewSet([]BlockHash{}))
+		if evictedTxn == nil {
+			return
+		}
+		mp.evictTransactionNoLock(evictedTxn, MempoolTxnEventReasonPublicKeyFairShare)
+	}
+}
+
+// getPublicKeySummaryStatsNoLock returns the per-public-key metrics reported by GetMempoolSummaryStats.
+func (mp *PosMempool) getPublicKeySummaryStatsNoLock() map[string]*SummaryStats {
+	summaryStats := map[string]*SummaryStats{
+		MempoolSummaryStatsPublicKeyLimitRejections: {
+			Count:      uint32(mp.publicKeyUsage.numRejectedTxns),
+			TotalBytes: mp.publicKeyUsage.numRejectedBytes,
+		},
+		MempoolSummaryStatsPublicKeyLimitEvictions: {
+			Count:      uint32(mp.publicKeyUsage.numEvictedTxns),
+			TotalBytes: mp.publicKeyUsage.numEvictedBytes,
+		},
+		MempoolSummaryStatsPublicKeys: {
+			Count: uint32(len(mp.publicKeyUsage.numBytes)),
+		},
+	}
+	if _, numTxns, numBytes, exists := mp.publicKeyUsage.getLargestPublicKey(); exists {
+		summaryStats[MempoolSummaryStatsLargestPublicKey] = &SummaryStats{
+			Count:      uint32(numTxns),
+			TotalBytes: numBytes,
+		}
+	}
+	return summaryStats
+}
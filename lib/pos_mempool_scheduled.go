@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"github.com/deso-protocol/core/collections"
+	"github.com/pkg/errors"
+)
+
+// Scheduled transactions declare a minimum inclusion block height through the MinInclusionBlockHeightKey in their
+// ExtraData, and can't be connected in a block below that height once the ScheduledTransactionsBlockHeight fork is
+// active. This allows a transaction to be signed ahead of time and submitted to the mempool, which holds it until it
+// becomes eligible for the next block.
+//
+// Scheduled transactions are kept in the TransactionRegister like any other transaction, so they're persisted,
+// tracked by the nonce tracker, charged to their public keys, and pruned by Fee-Time priority. However, they're left
+// out of GetTransactions and GetOrderedTransactions until they're eligible, so they're neither validated, relayed,
+// nor included in blocks before then. A scheduled transaction's nonce must not expire before its min inclusion block
+// height, which means that the furthest a transaction can be scheduled is bounded by the
+// MaxNonceExpirationBlockHeightOffset global param.
+
+// getMempoolTxnMinInclusionBlockHeight returns the minimum block height that the txn can be included in. For an
+// atomic txns wrapper, this is the highest min inclusion block height of its inner txns.
+func getMempoolTxnMinInclusionBlockHeight(txn *MsgDeSoTxn) (uint64, error) {
+	minInclusionBlockHeight, err := txn.GetMinInclusionBlockHeight()
+	if err != nil {
+		return 0, errors.Wrapf(err, "getMempoolTxnMinInclusionBlockHeight: ")
+	}
+	if txn.TxnMeta == nil || txn.TxnMeta.GetTxnType() != TxnTypeAtomicTxnsWrapper {
+		return minInclusionBlockHeight, nil
+	}
+	atomicTxnsWrapper, ok := txn.TxnMeta.(*AtomicTxnsWrapperMetadata)
+	if !ok {
+		return 0, errors.New("getMempoolTxnMinInclusionBlockHeight: Problem casting atomic txn wrapper metadata")
+	}
+	for _, innerTxn := range atomicTxnsWrapper.Txns {
+		innerMinInclusionBlockHeight, err := innerTxn.GetMinInclusionBlockHeight()
+		if err != nil {
+			return 0, errors.Wrapf(err, "getMempoolTxnMinInclusionBlockHeight: Problem with inner txn")
+		}
+		if innerMinInclusionBlockHeight > minInclusionBlockHeight {
+			minInclusionBlockHeight = innerMinInclusionBlockHeight
+		}
+	}
+	return minInclusionBlockHeight, nil
+}
+
+// checkMinInclusionBlockHeight validates the min inclusion block height of a txn submitted to the mempool. Txns can
+// only be scheduled once the ScheduledTransactionsBlockHeight fork is active for the next block, since before then
+// nothing stops a block producer from including them early. A scheduled txn's nonce must also not expire before the
+// txn becomes eligible, otherwise it could never be included.
+func (mp *PosMempool) checkMinInclusionBlockHeight(txn *MsgDeSoTxn) error {
+	if _, exists := txn.ExtraData[MinInclusionBlockHeightKey]; !exists {
+		return nil
+	}
+	if mp.latestBlockHeight+1 < uint64(mp.params.ForkHeights.ScheduledTransactionsBlockHeight) {
+		return errors.Wrapf(MempoolErrorScheduledTxnNotAllowed, "PosMempool.checkMinInclusionBlockHeight: "+
+			"Scheduled transactions aren't allowed before block height %d",
+			mp.params.ForkHeights.ScheduledTransactionsBlockHeight)
+	}
+	minInclusionBlockHeight, err := txn.GetMinInclusionBlockHeight()
+	if err != nil {
+		return errors.Wrapf(err, "PosMempool.checkMinInclusionBlockHeight: ")
+	}
+	if txn.TxnNonce != nil && txn.TxnNonce.ExpirationBlockHeight < minInclusionBlockHeight {
+		return errors.Wrapf(RuleErrorNonceExpiresBeforeMinInclusionHeight, "PosMempool.checkMinInclusionBlockHeight: "+
+			"Nonce expiration block height %d is below min inclusion block height %d",
+			txn.TxnNonce.ExpirationBlockHeight, minInclusionBlockHeight)
+	}
+	return nil
+}
+
+// IsEligibleForBlockHeight returns true if the txn can be included in a block at blockHeight.
+func (mempoolTx *MempoolTx) IsEligibleForBlockHeight(blockHeight uint64) bool {
+	return mempoolTx.MinInclusionBlockHeight <= blockHeight
+}
+
+// filterEligibleTransactionsNoLock returns the txns that can be included in the next block, preserving their order.
+func (mp *PosMempool) filterEligibleTransactionsNoLock(txns []*MempoolTx) []*MempoolTx {
+	nextBlockHeight := mp.latestBlockHeight + 1
+	eligibleTxns := make([]*MempoolTx, 0, len(txns))
+	for _, txn := range txns {
+		if !txn.IsEligibleForBlockHeight(nextBlockHeight) {
+			continue
+		}
+		eligibleTxns = append(eligibleTxns, txn)
+	}
+	return eligibleTxns
+}
+
+// GetScheduledTransactions returns the transactions in the mempool that can't be included in the next block yet
+// because of their min inclusion block height. The txns are ordered by min inclusion block height, and then by
+// Fee-Time. This function is thread-safe.
+func (mp *PosMempool) GetScheduledTransactions() []*MempoolTx {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	if !mp.IsRunning() {
+		return nil
+	}
+
+	nextBlockHeight := mp.latestBlockHeight + 1
+	var scheduledTxns []*MempoolTx
+	for _, txn := range mp.getAllTransactionsNoLock() {
+		if txn.IsEligibleForBlockHeight(nextBlockHeight) {
+			continue
+		}
+		scheduledTxns = append(scheduledTxns, txn)
+	}
+	return collections.SortStable(scheduledTxns, func(ii, jj *MempoolTx) bool {
+		return ii.MinInclusionBlockHeight < jj.MinInclusionBlockHeight
+	})
+}
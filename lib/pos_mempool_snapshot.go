@@ -0,0 +1,353 @@
+package lib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// MempoolSnapshotVersion is the version of the mempool snapshot file format written by WriteMempoolSnapshot.
+const MempoolSnapshotVersion = 1
+
+// DefaultMempoolSnapshotInjectBatchSize is the default number of transactions sent per MsgDeSoTransactionBundleV2
+// message when a snapshot is injected into a node over its protocol port.
+const DefaultMempoolSnapshotInjectBatchSize = 100
+
+// MempoolSnapshot is a portable copy of the transactions in a PosMempool. It is used to replay the mempool of one
+// node on another, e.g. to reproduce an incident or to seed a testnet. Snapshots are written as JSON so that they
+// can be inspected and edited by hand.
+type MempoolSnapshot struct {
+	Version uint64
+	// Network is the NetworkType of the node the snapshot was exported from, e.g. MAINNET or TESTNET.
+	Network string
+	// BlockHeight is the latest block height the source mempool had seen when the snapshot was exported.
+	BlockHeight uint64
+	// ExportedAtUnixMicro is the time at which the snapshot was exported.
+	ExportedAtUnixMicro int64
+
+	// Transactions are ordered by the time they were added to the source mempool.
+	Transactions []*MempoolSnapshotTxn
+}
+
+// MempoolSnapshotTxn is a single mempool transaction in a MempoolSnapshot.
+type MempoolSnapshotTxn struct {
+	TxnHashHex  string
+	TxnBytesHex string
+	// AddedUnixMicro is the time at which the transaction was added to the source mempool.
+	AddedUnixMicro uint64
+	// Height is the block height at which the transaction was added to the source mempool.
+	Height uint32
+	// Validated is whether the transaction connected on top of the source node's tip the last time the source
+	// mempool validated it. It's recorded for inspection only: a mempool that imports the snapshot validates the
+	// transaction against its own tip.
+	Validated bool
+}
+
+// NewMempoolSnapshot builds a snapshot of the given mempool transactions, ordered by the time they were added.
+func NewMempoolSnapshot(params *DeSoParams, blockHeight uint64, mempoolTxns []*MempoolTx) (*MempoolSnapshot, error) {
+	snapshot := &MempoolSnapshot{
+		Version:             MempoolSnapshotVersion,
+		Network:             params.NetworkType.String(),
+		BlockHeight:         blockHeight,
+		ExportedAtUnixMicro: time.Now().UnixMicro(),
+	}
+	for _, mempoolTx := range mempoolTxns {
+		if mempoolTx == nil || mempoolTx.Tx == nil {
+			continue
+		}
+		txnBytes, err := mempoolTx.Tx.ToBytes(false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewMempoolSnapshot: Problem serializing txn %v", mempoolTx.Hash)
+		}
+		snapshot.Transactions = append(snapshot.Transactions, &MempoolSnapshotTxn{
+			TxnHashHex:     hex.EncodeToString(mempoolTx.Hash[:]),
+			TxnBytesHex:    hex.EncodeToString(txnBytes),
+			AddedUnixMicro: mempoolTx.GetTimestamp(),
+			Height:         mempoolTx.Height,
+			Validated:      mempoolTx.IsValidated(),
+		})
+	}
+	sort.SliceStable(snapshot.Transactions, func(ii, jj int) bool {
+		return snapshot.Transactions[ii].AddedUnixMicro < snapshot.Transactions[jj].AddedUnixMicro
+	})
+	return snapshot, nil
+}
+
+// ToMempoolTxs decodes the snapshot's transactions, in the order they were added to the source mempool. It returns
+// an error if a transaction can't be decoded or doesn't match its hash.
+func (snapshot *MempoolSnapshot) ToMempoolTxs() ([]*MempoolTx, error) {
+	var mempoolTxns []*MempoolTx
+	for ii, snapshotTxn := range snapshot.Transactions {
+		txnBytes, err := hex.DecodeString(snapshotTxn.TxnBytesHex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MempoolSnapshot.ToMempoolTxs: Problem decoding hex for txn %d", ii)
+		}
+		txn := &MsgDeSoTxn{}
+		if err = txn.FromBytes(txnBytes); err != nil {
+			return nil, errors.Wrapf(err, "MempoolSnapshot.ToMempoolTxs: Problem deserializing txn %d", ii)
+		}
+		if snapshotTxn.AddedUnixMicro > math.MaxInt64 {
+			return nil, errors.Errorf("MempoolSnapshot.ToMempoolTxs: Invalid timestamp %d for txn %d",
+				snapshotTxn.AddedUnixMicro, ii)
+		}
+		mempoolTx, err := NewMempoolTx(txn, time.UnixMicro(int64(snapshotTxn.AddedUnixMicro)), uint64(snapshotTxn.Height))
+		if err != nil {
+			return nil, errors.Wrapf(err, "MempoolSnapshot.ToMempoolTxs: Problem constructing MempoolTx %d", ii)
+		}
+		if snapshotTxn.TxnHashHex != "" && snapshotTxn.TxnHashHex != hex.EncodeToString(mempoolTx.Hash[:]) {
+			return nil, errors.Errorf("MempoolSnapshot.ToMempoolTxs: Txn %d has hash %v but the snapshot "+
+				"records hash %v", ii, mempoolTx.Hash, snapshotTxn.TxnHashHex)
+		}
+		mempoolTx.SetValidated(snapshotTxn.Validated)
+		mempoolTxns = append(mempoolTxns, mempoolTx)
+	}
+	sort.SliceStable(mempoolTxns, func(ii, jj int) bool {
+		return mempoolTxns[ii].Added.Before(mempoolTxns[jj].Added)
+	})
+	return mempoolTxns, nil
+}
+
+// WriteMempoolSnapshot writes the snapshot to ww as indented JSON.
+func WriteMempoolSnapshot(ww io.Writer, snapshot *MempoolSnapshot) error {
+	encoder := json.NewEncoder(ww)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		return errors.Wrapf(err, "WriteMempoolSnapshot: Problem encoding snapshot")
+	}
+	return nil
+}
+
+// ReadMempoolSnapshot reads a snapshot written by WriteMempoolSnapshot and checks that it's for the given network.
+func ReadMempoolSnapshot(rr io.Reader, params *DeSoParams) (*MempoolSnapshot, error) {
+	snapshot := &MempoolSnapshot{}
+	if err := json.NewDecoder(rr).Decode(snapshot); err != nil {
+		return nil, errors.Wrapf(err, "ReadMempoolSnapshot: Problem decoding snapshot")
+	}
+	if snapshot.Version != MempoolSnapshotVersion {
+		return nil, fmt.Errorf("ReadMempoolSnapshot: Unsupported snapshot version %d, expected %d",
+			snapshot.Version, MempoolSnapshotVersion)
+	}
+	if snapshot.Network != params.NetworkType.String() {
+		return nil, fmt.Errorf("ReadMempoolSnapshot: Snapshot is for network %v, expected %v",
+			snapshot.Network, params.NetworkType.String())
+	}
+	return snapshot, nil
+}
+
+// ExportSnapshot returns a snapshot of the transactions currently in the mempool, including the time each was added
+// and whether it has been validated. Scheduled transactions are included even if they aren't eligible yet.
+func (mp *PosMempool) ExportSnapshot() (*MempoolSnapshot, error) {
+	mp.RLock()
+	defer mp.RUnlock()
+
+	if !mp.IsRunning() {
+		return nil, errors.Wrapf(MempoolErrorNotRunning, "PosMempool.ExportSnapshot: ")
+	}
+	return NewMempoolSnapshot(mp.params, mp.latestBlockHeight, mp.getAllTransactionsNoLock())
+}
+
+// ImportSnapshot adds the snapshot's transactions to the mempool in the order they were added to the source
+// mempool, keeping their original timestamps so that their Fee-Time ordering is reproduced. Transactions that the
+// mempool rejects, e.g. because they're already in it or no longer valid, are skipped. It returns the number of
+// transactions that were added.
+func (mp *PosMempool) ImportSnapshot(snapshot *MempoolSnapshot) (int, error) {
+	mempoolTxns, err := snapshot.ToMempoolTxs()
+	if err != nil {
+		return 0, errors.Wrapf(err, "PosMempool.ImportSnapshot: ")
+	}
+	numAdded := 0
+	for _, mempoolTx := range mempoolTxns {
+		if err = mp.AddTransaction(mempoolTx.Tx, mempoolTx.Added); err != nil {
+			glog.V(1).Infof("PosMempool.ImportSnapshot: Skipping txn %v: %v", mempoolTx.Hash, err)
+			continue
+		}
+		numAdded++
+	}
+	return numAdded, nil
+}
+
+// openPersistedMempool opens the database that a PosMempool with the given mempool dump dir persists its
+// transactions to, and starts a MempoolPersister on it. The node that owns the database must not be running.
+func openPersistedMempool(mempoolDumpDir string) (*badger.DB, *MempoolPersister, error) {
+	db, err := badger.Open(DefaultBadgerOptions(filepath.Join(mempoolDumpDir, "pos_mempool")))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Problem opening mempool database. Make sure the node is stopped")
+	}
+	// The backup interval doesn't matter here, since Stop flushes any outstanding events to the database.
+	persister := NewMempoolPersister(db, 30000)
+	persister.Start()
+	return db, persister, nil
+}
+
+// ReadPersistedMempoolSnapshot builds a snapshot from the transactions persisted in the mempool dump dir of a
+// stopped node. Validated flags aren't persisted, so every transaction in the snapshot is marked as not validated.
+func ReadPersistedMempoolSnapshot(params *DeSoParams, mempoolDumpDir string) (*MempoolSnapshot, error) {
+	db, persister, err := openPersistedMempool(mempoolDumpDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadPersistedMempoolSnapshot: ")
+	}
+	defer db.Close()
+
+	mempoolTxns, err := persister.GetPersistedTransactions()
+	if stopErr := persister.Stop(); stopErr != nil {
+		glog.Errorf("ReadPersistedMempoolSnapshot: Problem stopping persister: %v", stopErr)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadPersistedMempoolSnapshot: Problem reading persisted transactions")
+	}
+	blockHeight := uint64(0)
+	for _, mempoolTx := range mempoolTxns {
+		if uint64(mempoolTx.Height) > blockHeight {
+			blockHeight = uint64(mempoolTx.Height)
+		}
+	}
+	return NewMempoolSnapshot(params, blockHeight, mempoolTxns)
+}
+
+// WritePersistedMempoolSnapshot writes the snapshot's transactions, with their original timestamps, to the mempool
+// dump dir of a stopped node. The node loads and validates them the next time it starts.
+func WritePersistedMempoolSnapshot(mempoolDumpDir string, snapshot *MempoolSnapshot) (int, error) {
+	mempoolTxns, err := snapshot.ToMempoolTxs()
+	if err != nil {
+		return 0, errors.Wrapf(err, "WritePersistedMempoolSnapshot: ")
+	}
+	db, persister, err := openPersistedMempool(mempoolDumpDir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "WritePersistedMempoolSnapshot: ")
+	}
+	defer db.Close()
+
+	for _, mempoolTx := range mempoolTxns {
+		persister.EnqueueEvent(&MempoolEvent{Txn: mempoolTx, Type: MempoolEventAdd})
+	}
+	// Stop flushes all the enqueued events to the database.
+	if err = persister.Stop(); err != nil {
+		return 0, errors.Wrapf(err, "WritePersistedMempoolSnapshot: Problem persisting transactions")
+	}
+	return len(mempoolTxns), nil
+}
+
+// InjectMempoolSnapshot connects to the protocol port of the node at nodeAddress as a non-validator peer and relays
+// the snapshot's transactions to it in MsgDeSoTransactionBundleV2 messages of at most batchSize transactions, in the
+// order they were added to the source mempool. The node processes them like transactions relayed by any other peer,
+// so they're validated against its tip and stamped with the time they arrive. InjectMempoolSnapshot returns once
+// the node has received every bundle, which it confirms by answering a ping sent after the last one.
+func InjectMempoolSnapshot(params *DeSoParams, nodeAddress string, snapshot *MempoolSnapshot, batchSize int,
+	timeout time.Duration) error {
+
+	if batchSize <= 0 {
+		batchSize = DefaultMempoolSnapshotInjectBatchSize
+	}
+	mempoolTxns, err := snapshot.ToMempoolTxs()
+	if err != nil {
+		return errors.Wrapf(err, "InjectMempoolSnapshot: ")
+	}
+
+	conn, err := net.DialTimeout("tcp", nodeAddress, timeout)
+	if err != nil {
+		return errors.Wrapf(err, "InjectMempoolSnapshot: Problem connecting to %v", nodeAddress)
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.Wrapf(err, "InjectMempoolSnapshot: Problem setting deadline")
+	}
+
+	if err = mempoolSnapshotHandshake(params, conn); err != nil {
+		return errors.Wrapf(err, "InjectMempoolSnapshot: Problem performing handshake with %v", nodeAddress)
+	}
+
+	for ii := 0; ii < len(mempoolTxns); ii += batchSize {
+		bundle := &MsgDeSoTransactionBundleV2{}
+		for _, mempoolTx := range mempoolTxns[ii:min(ii+batchSize, len(mempoolTxns))] {
+			bundle.Transactions = append(bundle.Transactions, mempoolTx.Tx)
+		}
+		if _, err = WriteMessage(conn, bundle, params.NetworkType); err != nil {
+			return errors.Wrapf(err, "InjectMempoolSnapshot: Problem sending transaction bundle")
+		}
+		glog.V(1).Infof("InjectMempoolSnapshot: Sent %d of %d transactions to %v",
+			ii+len(bundle.Transactions), len(mempoolTxns), nodeAddress)
+	}
+
+	// The node reads messages from the connection in order, so a pong means it has received every bundle.
+	pingNonce := uint64(RandInt64(math.MaxInt64))
+	if _, err = WriteMessage(conn, &MsgDeSoPing{Nonce: pingNonce}, params.NetworkType); err != nil {
+		return errors.Wrapf(err, "InjectMempoolSnapshot: Problem sending ping")
+	}
+	for {
+		msg, _, err := ReadMessage(conn, params.NetworkType)
+		if err != nil {
+			return errors.Wrapf(err, "InjectMempoolSnapshot: Problem waiting for pong")
+		}
+		if pong, ok := msg.(*MsgDeSoPong); ok && pong.Nonce == pingNonce {
+			return nil
+		}
+	}
+}
+
+// mempoolSnapshotHandshake performs the version/verack handshake with a node as a non-validator peer.
+func mempoolSnapshotHandshake(params *DeSoParams, conn net.Conn) error {
+	nonceSent := uint64(RandInt64(math.MaxInt64))
+	versionMsg := NewMessage(MsgTypeVersion).(*MsgDeSoVersion)
+	versionMsg.Version = params.ProtocolVersion.ToUint64()
+	versionMsg.Services = SFFullNodeDeprecated
+	versionMsg.TstampSecs = time.Now().Unix()
+	versionMsg.Nonce = nonceSent
+	versionMsg.UserAgent = params.UserAgent
+	if _, err := WriteMessage(conn, versionMsg, params.NetworkType); err != nil {
+		return errors.Wrapf(err, "mempoolSnapshotHandshake: Problem sending version message")
+	}
+
+	// Wait for the node's version message, ignoring anything else it sends first.
+	var peerVersionMsg *MsgDeSoVersion
+	for peerVersionMsg == nil {
+		msg, _, err := ReadMessage(conn, params.NetworkType)
+		if err != nil {
+			return errors.Wrapf(err, "mempoolSnapshotHandshake: Problem reading version message")
+		}
+		peerVersionMsg, _ = msg.(*MsgDeSoVersion)
+	}
+
+	verackMsg := NewMessage(MsgTypeVerack).(*MsgDeSoVerack)
+	verackMsg.NonceReceived = peerVersionMsg.Nonce
+	negotiatedVersion := params.ProtocolVersion
+	if peerVersionMsg.Version < negotiatedVersion.ToUint64() {
+		negotiatedVersion = NewProtocolVersionType(peerVersionMsg.Version)
+	}
+	if negotiatedVersion.Before(ProtocolVersion2) {
+		verackMsg.Version = VerackVersion0
+	} else {
+		// Non-validators don't sign their verack.
+		verackMsg.Version = VerackVersion1
+		verackMsg.NonceSent = nonceSent
+		verackMsg.TstampMicro = uint64(time.Now().UnixMicro())
+	}
+	if _, err := WriteMessage(conn, verackMsg, params.NetworkType); err != nil {
+		return errors.Wrapf(err, "mempoolSnapshotHandshake: Problem sending verack message")
+	}
+
+	for {
+		msg, _, err := ReadMessage(conn, params.NetworkType)
+		if err != nil {
+			return errors.Wrapf(err, "mempoolSnapshotHandshake: Problem reading verack message")
+		}
+		peerVerackMsg, ok := msg.(*MsgDeSoVerack)
+		if !ok {
+			continue
+		}
+		if peerVerackMsg.NonceReceived != nonceSent {
+			return fmt.Errorf("mempoolSnapshotHandshake: Verack nonce %d doesn't match the nonce we sent %d",
+				peerVerackMsg.NonceReceived, nonceSent)
+		}
+		return nil
+	}
+}
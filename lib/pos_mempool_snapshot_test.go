@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPosMempoolSnapshot(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1077)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(10000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+
+	txn1 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0)
+	txn2 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 0)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	require.NoError(mempool.validateTransactions())
+
+	// The snapshot records the txns in the order they were added, along with their timestamps and validated flags.
+	snapshot, err := mempool.ExportSnapshot()
+	require.NoError(err)
+	require.Equal(params.NetworkType.String(), snapshot.Network)
+	require.Equal(uint64(2), snapshot.BlockHeight)
+	require.Equal(2, len(snapshot.Transactions))
+	require.LessOrEqual(snapshot.Transactions[0].AddedUnixMicro, snapshot.Transactions[1].AddedUnixMicro)
+	snapshotTxns := make(map[string]*MempoolSnapshotTxn)
+	for _, snapshotTxn := range snapshot.Transactions {
+		snapshotTxns[snapshotTxn.TxnHashHex] = snapshotTxn
+	}
+	for _, txn := range []*MsgDeSoTxn{txn1, txn2} {
+		mempoolTx := mempool.GetTransaction(txn.Hash())
+		snapshotTxn, exists := snapshotTxns[hex.EncodeToString(mempoolTx.Hash[:])]
+		require.True(exists)
+		require.Equal(mempoolTx.GetTimestamp(), snapshotTxn.AddedUnixMicro)
+		require.True(snapshotTxn.Validated)
+	}
+
+	// Round trip the snapshot through its file format.
+	buf := &bytes.Buffer{}
+	require.NoError(WriteMempoolSnapshot(buf, snapshot))
+	readSnapshot, err := ReadMempoolSnapshot(bytes.NewReader(buf.Bytes()), params)
+	require.NoError(err)
+	require.Equal(snapshot, readSnapshot)
+	_, err = ReadMempoolSnapshot(bytes.NewReader(buf.Bytes()), &DeSoMainnetParams)
+	require.Error(err)
+
+	// A snapshot whose txn doesn't match its recorded hash is rejected.
+	corruptSnapshot := *snapshot
+	corruptSnapshot.Transactions = []*MempoolSnapshotTxn{{
+		TxnHashHex:     snapshot.Transactions[1].TxnHashHex,
+		TxnBytesHex:    snapshot.Transactions[0].TxnBytesHex,
+		AddedUnixMicro: snapshot.Transactions[0].AddedUnixMicro,
+	}}
+	_, err = corruptSnapshot.ToMempoolTxs()
+	require.Error(err)
+
+	// Importing into another mempool preserves the original timestamps.
+	importedMempool := NewPosMempool()
+	require.NoError(importedMempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	require.NoError(importedMempool.Start())
+	numAdded, err := importedMempool.ImportSnapshot(readSnapshot)
+	require.NoError(err)
+	require.Equal(2, numAdded)
+	for _, txn := range []*MsgDeSoTxn{txn1, txn2} {
+		require.Equal(mempool.GetTransaction(txn.Hash()).GetTimestamp(),
+			importedMempool.GetTransaction(txn.Hash()).GetTimestamp())
+	}
+	// Importing the same snapshot again skips the txns that are already in the mempool.
+	numAdded, err = importedMempool.ImportSnapshot(readSnapshot)
+	require.NoError(err)
+	require.Equal(0, numAdded)
+	importedMempool.Stop()
+
+	// Write the snapshot to the mempool dump dir of a stopped node, and read it back.
+	dir := _dbDirSetup(t)
+	numWritten, err := WritePersistedMempoolSnapshot(dir, readSnapshot)
+	require.NoError(err)
+	require.Equal(2, numWritten)
+	persistedSnapshot, err := ReadPersistedMempoolSnapshot(params, dir)
+	require.NoError(err)
+	require.Equal(2, len(persistedSnapshot.Transactions))
+	for _, snapshotTxn := range persistedSnapshot.Transactions {
+		require.Contains(snapshotTxns, snapshotTxn.TxnHashHex)
+		require.Equal(snapshotTxns[snapshotTxn.TxnHashHex].AddedUnixMicro, snapshotTxn.AddedUnixMicro)
+		// Validated flags aren't persisted.
+		require.False(snapshotTxn.Validated)
+	}
+
+	// The node loads the written txns when it starts.
+	persistedMempool := NewPosMempool()
+	require.NoError(persistedMempool.Init(
+		params, globalParams, latestBlockView, 2, dir, false, 30000, nil, 1000, 100,
+	))
+	require.NoError(persistedMempool.Start())
+	require.Equal(2, len(persistedMempool.GetTransactions()))
+	for _, txn := range []*MsgDeSoTxn{txn1, txn2} {
+		require.Equal(mempool.GetTransaction(txn.Hash()).GetTimestamp(),
+			persistedMempool.GetTransaction(txn.Hash()).GetTimestamp())
+	}
+	persistedMempool.Stop()
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMempoolSubscriptionBufferSize is the number of events that can be buffered for a subscriber before the
+// subscriber is considered too slow and is dropped.
+const DefaultMempoolSubscriptionBufferSize = 10000
+
+type MempoolTxnEventType uint8
+
+const (
+	// MempoolTxnEventAdded is emitted when a transaction is admitted to the mempool.
+	MempoolTxnEventAdded MempoolTxnEventType = iota
+	// MempoolTxnEventReplaced is emitted when a transaction is replaced by a transaction from the same public key with
+	// the same nonce and a higher fee.
+	MempoolTxnEventReplaced
+	// MempoolTxnEventPruned is emitted when a transaction is evicted because the mempool exceeded its maximum size.
+	MempoolTxnEventPruned
+	// MempoolTxnEventInvalidated is emitted when a transaction is evicted because it no longer connects on top of the
+	// latest block and the transactions ahead of it in the mempool.
+	MempoolTxnEventInvalidated
+	// MempoolTxnEventIncludedInBlock is emitted when a transaction is removed from the mempool because it was included
+	// in a block that was connected to the tip of the chain.
+	MempoolTxnEventIncludedInBlock
+	// MempoolTxnEventRemoved is emitted when a transaction is removed for any other reason, e.g. an explicit call to
+	// RemoveTransaction.
+	MempoolTxnEventRemoved
+)
+
+func (eventType MempoolTxnEventType) String() string {
+	switch eventType {
+	case MempoolTxnEventAdded:
+		return "ADDED"
+	case MempoolTxnEventReplaced:
+		return "REPLACED"
+	case MempoolTxnEventPruned:
+		return "PRUNED"
+	case MempoolTxnEventInvalidated:
+		return "INVALIDATED"
+	case MempoolTxnEventIncludedInBlock:
+		return "INCLUDED_IN_BLOCK"
+	case MempoolTxnEventRemoved:
+		return "REMOVED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Reasons attached to mempool txn events that aren't derived from an error or a block.
+const (
+	MempoolTxnEventReasonSubmitted           = "submitted to mempool"
+	MempoolTxnEventReasonBlockDisconnected   = "returned to mempool after block was disconnected"
+	MempoolTxnEventReasonLoadedFromDb        = "loaded from persisted mempool"
+	MempoolTxnEventReasonReplacedByHigherFee = "replaced by transaction with the same nonce and a higher fee"
+	MempoolTxnEventReasonMempoolFull         = "mempool exceeded its maximum size"
+	MempoolTxnEventReasonRemoveRequested     = "removed by request"
+	MempoolTxnEventReasonGlobalParamsChanged = "fee is below the minimum after a global params update"
+	MempoolTxnEventReasonIncludedInBlock     = "included in block"
+	MempoolTxnEventReasonPackageRejected     = "another transaction in its package was rejected"
+	MempoolTxnEventReasonPublicKeyLimit      = "evicted for a higher fee transaction from the same public key"
+	MempoolTxnEventReasonPublicKeyFairShare  = "public key exceeded its fair share of the mempool"
+)
+
+// MempoolTxnEvent describes a single change to the set of transactions in the mempool.
+type MempoolTxnEvent struct {
+	Type MempoolTxnEventType
+	Txn  *MempoolTx
+	// Reason is a human-readable description of why the event happened. For MempoolTxnEventInvalidated it is the
+	// error returned when the transaction failed to connect.
+	Reason string
+	// Err is the connect error for MempoolTxnEventInvalidated events, and nil otherwise.
+	Err error
+	// ReplacedByTxnHash is the hash of the new transaction for MempoolTxnEventReplaced events.
+	ReplacedByTxnHash *BlockHash
+	// BlockHash is the hash of the block that included the transaction for MempoolTxnEventIncludedInBlock events.
+	BlockHash *BlockHash
+}
+
+// MempoolSubscription streams MempoolTxnEvents to a single subscriber. Events are delivered in the order in which
+// the mempool applied them. The mempool never blocks on a subscriber: if a subscriber's buffer fills up, it is
+// dropped and its Events channel is closed. A subscriber that is dropped should re-sync with GetTransactions
+// before subscribing again.
+type MempoolSubscription struct {
+	id      uint64
+	events  chan *MempoolTxnEvent
+	dropped int32
+	manager *mempoolSubscriptionManager
+}
+
+// Events returns the channel on which events are delivered. The channel is closed when the subscription is
+// unsubscribed, dropped, or the mempool is stopped.
+func (sub *MempoolSubscription) Events() <-chan *MempoolTxnEvent {
+	return sub.events
+}
+
+// Dropped returns true if the subscription was closed because the subscriber fell too far behind.
+func (sub *MempoolSubscription) Dropped() bool {
+	return atomic.LoadInt32(&sub.dropped) == 1
+}
+
+// Unsubscribe stops delivery of events and closes the Events channel. It is safe to call more than once.
+func (sub *MempoolSubscription) Unsubscribe() {
+	sub.manager.remove(sub.id)
+}
+
+// mempoolSubscriptionManager fans out MempoolTxnEvents to all subscribers.
+type mempoolSubscriptionManager struct {
+	sync.Mutex
+	nextId        uint64
+	subscriptions map[uint64]*MempoolSubscription
+}
+
+func newMempoolSubscriptionManager() *mempoolSubscriptionManager {
+	return &mempoolSubscriptionManager{
+		subscriptions: make(map[uint64]*MempoolSubscription),
+	}
+}
+
+func (manager *mempoolSubscriptionManager) subscribe(bufferSize int) *MempoolSubscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultMempoolSubscriptionBufferSize
+	}
+	manager.Lock()
+	defer manager.Unlock()
+
+	sub := &MempoolSubscription{
+		id:      manager.nextId,
+		events:  make(chan *MempoolTxnEvent, bufferSize),
+		manager: manager,
+	}
+	manager.nextId++
+	manager.subscriptions[sub.id] = sub
+	return sub
+}
+
+func (manager *mempoolSubscriptionManager) remove(id uint64) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	if sub, exists := manager.subscriptions[id]; exists {
+		delete(manager.subscriptions, id)
+		close(sub.events)
+	}
+}
+
+// publish delivers the event to every subscriber without blocking. Subscribers whose buffers are full are dropped.
+func (manager *mempoolSubscriptionManager) publish(event *MempoolTxnEvent) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	for id, sub := range manager.subscriptions {
+		select {
+		case sub.events <- event:
+		default:
+			atomic.StoreInt32(&sub.dropped, 1)
+			delete(manager.subscriptions, id)
+			close(sub.events)
+		}
+	}
+}
+
+// closeAll closes every subscription. It is called when the mempool stops.
+func (manager *mempoolSubscriptionManager) closeAll() {
+	manager.Lock()
+	defer manager.Unlock()
+
+	for id, sub := range manager.subscriptions {
+		delete(manager.subscriptions, id)
+		close(sub.events)
+	}
+}
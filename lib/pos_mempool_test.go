@@ -405,6 +405,298 @@ func TestPosMempoolTransactionValidation(t *testing.T) {
 	mempool.Stop()
 }
 
+func TestPosMempoolSubscription(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1081)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+
+	sub := mempool.Subscribe(0)
+	// A subscriber with a buffer of one is dropped as soon as it falls behind.
+	slowSub := mempool.Subscribe(1)
+	nextEvent := func() *MempoolTxnEvent {
+		select {
+		case event := <-sub.Events():
+			return event
+		default:
+			require.FailNow("expected a mempool event")
+			return nil
+		}
+	}
+
+	// Add a transaction, then replace it with a higher fee transaction with the same nonce.
+	txn1 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	txn1New := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	txn1New.TxnFeeNanos = txn1.TxnFeeNanos + 1000
+	*txn1New.TxnNonce = *txn1.TxnNonce
+	_signTxn(t, txn1New, m0Priv)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1New)
+
+	event := nextEvent()
+	require.Equal(MempoolTxnEventAdded, event.Type)
+	require.Equal(*txn1.Hash(), *event.Txn.Hash)
+	require.Equal(MempoolTxnEventReasonSubmitted, event.Reason)
+	event = nextEvent()
+	require.Equal(MempoolTxnEventAdded, event.Type)
+	require.Equal(*txn1New.Hash(), *event.Txn.Hash)
+	event = nextEvent()
+	require.Equal(MempoolTxnEventReplaced, event.Type)
+	require.Equal(*txn1.Hash(), *event.Txn.Hash)
+	require.Equal(*txn1New.Hash(), *event.ReplacedByTxnHash)
+	require.True(slowSub.Dropped())
+	// The dropped subscriber still receives the event it buffered, after which its channel is closed.
+	event, ok := <-slowSub.Events()
+	require.True(ok)
+	require.Equal(*txn1.Hash(), *event.Txn.Hash)
+	_, ok = <-slowSub.Events()
+	require.False(ok)
+
+	// Explicitly remove a transaction.
+	txn2 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	_wrappedPosMempoolRemoveTransaction(t, mempool, txn2.Hash())
+	require.Equal(MempoolTxnEventAdded, nextEvent().Type)
+	event = nextEvent()
+	require.Equal(MempoolTxnEventRemoved, event.Type)
+	require.Equal(*txn2.Hash(), *event.Txn.Hash)
+
+	// Connecting a block that includes the remaining transaction removes it from the mempool.
+	block := &MsgDeSoBlock{Header: &MsgDeSoHeader{Version: 1}, Txns: []*MsgDeSoTxn{txn1New}}
+	blockHash, err := block.Hash()
+	require.NoError(err)
+	mempool.OnBlockConnected(block)
+	require.Equal(0, len(mempool.GetTransactions()))
+	event = nextEvent()
+	require.Equal(MempoolTxnEventIncludedInBlock, event.Type)
+	require.Equal(*txn1New.Hash(), *event.Txn.Hash)
+	require.Equal(*blockHash, *event.BlockHash)
+
+	// Stopping the mempool closes the subscription.
+	mempool.Stop()
+	_, ok = <-sub.Events()
+	require.False(ok)
+	require.False(sub.Dropped())
+	sub.Unsubscribe()
+}
+
+func TestPosMempoolTransactionPackage(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1083)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+	require.True(mempool.IsRunning())
+
+	generateTxn := func(pk []byte, priv string, feeNanos uint64, partialID uint64) *MsgDeSoTxn {
+		txn := _generateTestTxn(t, rand, feeMin, feeMax, pk, priv, 100, 25)
+		txn.TxnFeeNanos = feeNanos
+		txn.TxnNonce.PartialID = partialID
+		_signTxn(t, txn, priv)
+		return txn
+	}
+	getTxnHashes := func() []BlockHash {
+		var txnHashes []BlockHash
+		for _, txn := range mempool.GetTransactions() {
+			txnHashes = append(txnHashes, *txn.Hash)
+		}
+		return txnHashes
+	}
+
+	// A low fee parent from m0 is ordered behind a higher fee transaction from m1.
+	parentTxn := generateTxn(m0PubBytes, m0Priv, 1000, 5000)
+	otherTxn := generateTxn(m1PubBytes, m1Priv, 5000, 7000)
+	_wrappedPosMempoolAddTransaction(t, mempool, parentTxn)
+	_wrappedPosMempoolAddTransaction(t, mempool, otherTxn)
+	require.Equal([]BlockHash{*otherTxn.Hash(), *parentTxn.Hash()}, getTxnHashes())
+
+	// Packages must be chains of consecutive nonces from the same public key.
+	childTxn := generateTxn(m0PubBytes, m0Priv, 100000, 5001)
+	err := mempool.AddTransactionPackage([]*MsgDeSoTxn{parentTxn, generateTxn(m0PubBytes, m0Priv, 100000, 5002)}, time.Now())
+	require.Contains(err.Error(), MempoolErrorInvalidPackage)
+	err = mempool.AddTransactionPackage([]*MsgDeSoTxn{parentTxn, generateTxn(m1PubBytes, m1Priv, 100000, 5001)}, time.Now())
+	require.Contains(err.Error(), MempoolErrorInvalidPackage)
+	require.Equal(2, len(mempool.GetTransactions()))
+
+	// Submitting the parent together with a high fee child bumps the parent ahead of the other transaction.
+	require.NoError(mempool.AddTransactionPackage([]*MsgDeSoTxn{parentTxn, childTxn}, time.Now()))
+	require.True(_checkPosMempoolIntegrity(t, mempool))
+	require.Equal([]BlockHash{*parentTxn.Hash(), *childTxn.Hash(), *otherTxn.Hash()}, getTxnHashes())
+	parentMempoolTx := mempool.GetTransaction(parentTxn.Hash())
+	childMempoolTx := mempool.GetTransaction(childTxn.Hash())
+	require.Greater(parentMempoolTx.PackageFeePerKB(), parentMempoolTx.FeePerKB)
+	require.Equal(parentMempoolTx.PackageFeePerKB(), childMempoolTx.PackageFeePerKB())
+	require.Less(childMempoolTx.PackageFeePerKB(), childMempoolTx.FeePerKB)
+
+	// Removing the child drops the parent back to its own fee rate.
+	_wrappedPosMempoolRemoveTransaction(t, mempool, childTxn.Hash())
+	require.Equal([]BlockHash{*otherTxn.Hash(), *parentTxn.Hash()}, getTxnHashes())
+	require.Equal(parentMempoolTx.FeePerKB, parentMempoolTx.PackageFeePerKB())
+}
+
+func TestOrderTransactionsByPackage(t *testing.T) {
+	require := require.New(t)
+
+	newMempoolTx := func(hashByte byte) *MempoolTx {
+		return &MempoolTx{Hash: &BlockHash{hashByte}}
+	}
+	parent, child, grandchild, other := newMempoolTx(1), newMempoolTx(2), newMempoolTx(3), newMempoolTx(4)
+	parent.packageChild = child
+	child.packageParent = parent
+	child.packageChild = grandchild
+	grandchild.packageParent = child
+
+	orderedTxns := orderTransactionsByPackage([]*MempoolTx{grandchild, other, parent, child})
+	require.Equal([]*MempoolTx{parent, child, grandchild, other}, orderedTxns)
+	orderedTxns = orderTransactionsByPackage([]*MempoolTx{other, parent, child})
+	require.Equal([]*MempoolTx{other, parent, child}, orderedTxns)
+}
+
+func TestPosMempoolScheduledTransactions(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1103)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetup(t)
+	params.ForkHeights.ScheduledTransactionsBlockHeight = 0
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	scheduleTxn := func(txn *MsgDeSoTxn, priv string, minInclusionBlockHeight uint64) {
+		txn.ExtraData[MinInclusionBlockHeightKey] = UintToBuf(minInclusionBlockHeight)
+		_signTxn(t, txn, priv)
+	}
+	txnHashes := func(txns []*MempoolTx) []BlockHash {
+		var hashes []BlockHash
+		for _, txn := range txns {
+			hashes = append(hashes, *txn.Hash)
+		}
+		return hashes
+	}
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	dir := _dbDirSetup(t)
+	startMempool := func(transactionValidationRefreshIntervalMillis uint64) *PosMempool {
+		mempool := NewPosMempool()
+		require.NoError(mempool.Init(
+			params, globalParams, latestBlockView, 2, dir, false, 30000, nil, 1000,
+			transactionValidationRefreshIntervalMillis,
+		))
+		require.NoError(mempool.Start())
+		require.True(mempool.IsRunning())
+		return mempool
+	}
+	mempool := startMempool(100)
+
+	// txn1 can be included in the next block, while txn2 is scheduled for block 4.
+	txn1 := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	txn2 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	scheduleTxn(txn2, m1Priv, 4)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	require.Equal(uint64(4), mempool.GetTransaction(txn2.Hash()).MinInclusionBlockHeight)
+
+	// Only txn1 is returned for block production, and only txn1 gets validated, but txn2 stays in the mempool.
+	require.Equal([]BlockHash{*txn1.Hash()}, txnHashes(mempool.GetTransactions()))
+	require.Equal([]BlockHash{*txn1.Hash()}, txnHashes(mempool.GetOrderedTransactions()))
+	require.Equal([]BlockHash{*txn2.Hash()}, txnHashes(mempool.GetScheduledTransactions()))
+	mempool.BlockUntilReadOnlyViewRegenerated()
+	require.True(mempool.GetTransaction(txn1.Hash()).IsValidated())
+	require.False(mempool.GetTransaction(txn2.Hash()).IsValidated())
+	require.True(mempool.IsTransactionInPool(txn2.Hash()))
+
+	// Scheduled txns must have a well-formed min inclusion block height and a nonce that doesn't expire before it.
+	malformedTxn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	malformedTxn.ExtraData[MinInclusionBlockHeightKey] = []byte{0xff}
+	_signTxn(t, malformedTxn, m1Priv)
+	require.Contains(mempool.AddTransaction(malformedTxn, time.Now()).Error(),
+		RuleErrorInvalidMinInclusionBlockHeight.Error())
+	expiringTxn := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 10, 25)
+	scheduleTxn(expiringTxn, m1Priv, 11)
+	require.Contains(mempool.AddTransaction(expiringTxn, time.Now()).Error(),
+		RuleErrorNonceExpiresBeforeMinInclusionHeight.Error())
+
+	// Scheduled txns can't be packaged.
+	packageTxns := []*MsgDeSoTxn{
+		_generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25),
+		_generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25),
+	}
+	packageTxns[1].TxnNonce.PartialID = packageTxns[0].TxnNonce.PartialID + 1
+	scheduleTxn(packageTxns[1], m0Priv, 4)
+	require.Contains(mempool.AddTransactionPackage(packageTxns, time.Now()).Error(),
+		MempoolErrorInvalidPackage.Error())
+
+	// txn2 is persisted and reloaded as a scheduled txn after a restart. The restarted mempool doesn't validate
+	// its txns, since the test chain doesn't have the blocks needed to connect them past the next block.
+	mempool.Stop()
+	mempool = startMempool(3600000)
+	require.Equal([]BlockHash{*txn1.Hash()}, txnHashes(mempool.GetTransactions()))
+	require.Equal([]BlockHash{*txn2.Hash()}, txnHashes(mempool.GetScheduledTransactions()))
+
+	// Once the next block is block 4, txn2 is eligible.
+	mempool.UpdateLatestBlock(latestBlockView, 3)
+	require.Equal(2, len(mempool.GetTransactions()))
+	require.Empty(mempool.GetScheduledTransactions())
+	mempool.Stop()
+
+	// Blocks can't include scheduled txns before their min inclusion block height.
+	blockTxn := _generateTestTxn(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 25)
+	scheduleTxn(blockTxn, m0Priv, 3)
+	_, _, _, _, err := latestBlockView.CopyUtxoView().ConnectTransaction(
+		blockTxn, blockTxn.Hash(), 2, 0, true, false)
+	require.Error(err)
+	require.Contains(err.Error(), RuleErrorTxnBeforeMinInclusionBlockHeight.Error())
+	_, _, _, _, err = latestBlockView.CopyUtxoView().ConnectTransaction(
+		blockTxn, blockTxn.Hash(), 3, 0, true, false)
+	require.NoError(err)
+
+	// Before the fork, the mempool doesn't accept scheduled txns, and blocks ignore the min inclusion block height.
+	params.ForkHeights.ScheduledTransactionsBlockHeight = 10
+	mempool = startMempool(100)
+	defer mempool.Stop()
+	txn3 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 25)
+	scheduleTxn(txn3, m1Priv, 4)
+	require.Contains(mempool.AddTransaction(txn3, time.Now()).Error(), MempoolErrorScheduledTxnNotAllowed.Error())
+	_, _, _, _, err = latestBlockView.CopyUtxoView().ConnectTransaction(
+		txn3, txn3.Hash(), 3, 0, true, false)
+	require.NoError(err)
+}
+
 func _posTestBlockchainSetup(t *testing.T) (_params *DeSoParams, _db *badger.DB) {
 	return _posTestBlockchainSetupWithBalances(t, 200000, 200000)
 }
@@ -448,6 +740,127 @@ func _dbDirSetup(t *testing.T) (_dir string) {
 	return dir
 }
 
+func TestPosMempoolPublicKeyLimits(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1091)
+	rand := rand.New(rand.NewSource(seed))
+
+	globalParams := _testGetDefaultGlobalParams()
+	feeMin := globalParams.MinimumNetworkFeeNanosPerKB
+	feeMax := uint64(2000)
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+
+	params, db := _posTestBlockchainSetup(t)
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	generateTxnWithFee := func(pk []byte, priv string, fee uint64) *MsgDeSoTxn {
+		txn := _generateTestTxn(t, rand, feeMin, feeMax, pk, priv, 100, 25)
+		txn.TxnFeeNanos = fee
+		_signTxn(t, txn, priv)
+		return txn
+	}
+
+	latestBlockView := NewUtxoView(db, params, nil, nil, nil)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	mempool.SetPublicKeyLimits(PosMempoolPublicKeyLimits{MaxTxnsPerPublicKey: 2})
+	require.NoError(mempool.Start())
+	require.True(mempool.IsRunning())
+	sub := mempool.Subscribe(0)
+
+	// Fill up m0's budget.
+	txn1 := generateTxnWithFee(m0PubBytes, m0Priv, 1200)
+	txn2 := generateTxnWithFee(m0PubBytes, m0Priv, 1100)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn2)
+	numTxns, numBytes := mempool.GetPublicKeyUsage(m0PubBytes)
+	require.Equal(uint64(2), numTxns)
+	require.Equal(mempool.GetTransaction(txn1.Hash()).TxSizeBytes+mempool.GetTransaction(txn2.Hash()).TxSizeBytes,
+		numBytes)
+
+	// A transaction with a lower fee than all of m0's transactions is rejected.
+	txn3 := generateTxnWithFee(m0PubBytes, m0Priv, 1000)
+	err := mempool.AddTransaction(txn3, time.Now())
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorPublicKeyLimitExceeded)
+	require.Nil(mempool.GetTransaction(txn3.Hash()))
+
+	// A transaction with a higher fee evicts m0's lowest fee transaction.
+	txn4 := generateTxnWithFee(m0PubBytes, m0Priv, 1500)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn4)
+	require.Nil(mempool.GetTransaction(txn2.Hash()))
+	require.NotNil(mempool.GetTransaction(txn1.Hash()))
+	require.NotNil(mempool.GetTransaction(txn4.Hash()))
+	numTxns, _ = mempool.GetPublicKeyUsage(m0PubBytes)
+	require.Equal(uint64(2), numTxns)
+	require.Equal(MempoolTxnEventAdded, (<-sub.Events()).Type)
+	require.Equal(MempoolTxnEventAdded, (<-sub.Events()).Type)
+	event := <-sub.Events()
+	require.Equal(MempoolTxnEventPruned, event.Type)
+	require.Equal(*txn2.Hash(), *event.Txn.Hash)
+	require.Equal(MempoolTxnEventReasonPublicKeyLimit, event.Reason)
+	require.Equal(MempoolTxnEventAdded, (<-sub.Events()).Type)
+
+	// Replacing a transaction by nonce doesn't count towards the limit.
+	txn1New := generateTxnWithFee(m0PubBytes, m0Priv, 2000)
+	*txn1New.TxnNonce = *txn1.TxnNonce
+	_signTxn(t, txn1New, m0Priv)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1New)
+	require.NotNil(mempool.GetTransaction(txn4.Hash()))
+	require.Equal(2, len(mempool.GetTransactions()))
+
+	// Other public keys aren't affected by m0's limit.
+	txn5 := generateTxnWithFee(m1PubBytes, m1Priv, 1000)
+	_wrappedPosMempoolAddTransaction(t, mempool, txn5)
+	require.Equal(3, len(mempool.GetTransactions()))
+
+	summaryStats := mempool.GetMempoolSummaryStats()
+	require.Equal(uint32(1), summaryStats[MempoolSummaryStatsPublicKeyLimitRejections].Count)
+	require.Equal(uint32(1), summaryStats[MempoolSummaryStatsPublicKeyLimitEvictions].Count)
+	require.Equal(uint32(2), summaryStats[MempoolSummaryStatsPublicKeys].Count)
+	require.Equal(uint32(2), summaryStats[MempoolSummaryStatsLargestPublicKey].Count)
+	require.Equal(uint32(3), summaryStats[TxnTypeBasicTransfer.String()].Count)
+
+	// A transaction that's larger than the byte limit on its own is always rejected.
+	mempool.SetPublicKeyLimits(PosMempoolPublicKeyLimits{MaxBytesPerPublicKey: 10})
+	txn6 := generateTxnWithFee(m1PubBytes, m1Priv, 2000)
+	err = mempool.AddTransaction(txn6, time.Now())
+	require.Error(err)
+	require.Contains(err.Error(), MempoolErrorPublicKeyLimitExceeded)
+	mempool.Stop()
+
+	// With fair-share eviction, a full mempool evicts from the public key using more than its share of the
+	// mempool, even though the other public key's transaction has a lower fee.
+	m1Txn := generateTxnWithFee(m1PubBytes, m1Priv, 1000)
+	var m0Txns []*MsgDeSoTxn
+	for ii := uint64(0); ii < 4; ii++ {
+		m0Txns = append(m0Txns, generateTxnWithFee(m0PubBytes, m0Priv, 1500+100*ii))
+	}
+	m0TxnBytes, err := m0Txns[0].ToBytes(false)
+	require.NoError(err)
+	globalParams.MempoolMaxSizeBytes = 3*uint64(len(m0TxnBytes)) + 10
+
+	mempool = NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, latestBlockView, 2, "", true, 30000, nil, 1000, 100,
+	))
+	mempool.SetPublicKeyLimits(PosMempoolPublicKeyLimits{FairShareEviction: true})
+	require.NoError(mempool.Start())
+	_wrappedPosMempoolAddTransaction(t, mempool, m1Txn)
+	for _, txn := range m0Txns {
+		_wrappedPosMempoolAddTransaction(t, mempool, txn)
+	}
+	require.NotNil(mempool.GetTransaction(m1Txn.Hash()))
+	require.Nil(mempool.GetTransaction(m0Txns[0].Hash()))
+	require.Nil(mempool.GetTransaction(m0Txns[1].Hash()))
+	require.NotNil(mempool.GetTransaction(m0Txns[2].Hash()))
+	require.NotNil(mempool.GetTransaction(m0Txns[3].Hash()))
+	require.Equal(uint32(2), mempool.GetMempoolSummaryStats()[MempoolSummaryStatsPublicKeyLimitEvictions].Count)
+	mempool.Stop()
+}
+
 func _generateTestTxn(t *testing.T, rand *rand.Rand, feeMin uint64, feeMax uint64, pk []byte, priv string, expirationHeight uint64,
 	extraDataBytes int32) *MsgDeSoTxn {
 
@@ -493,13 +906,13 @@ func _checkPosMempoolIntegrity(t *testing.T, mp *PosMempool) bool {
 		return true
 	}
 
-	if len(mp.GetTransactions()) != len(mp.nonceTracker.nonceMap) {
+	if len(mp.txnRegister.GetFeeTimeTransactions()) != len(mp.nonceTracker.nonceMap) {
 		t.Errorf("PosMempool transactions and nonceTracker are out of sync")
 		return false
 	}
 
 	balances := make(map[PublicKey]uint64)
-	txns := mp.GetTransactions()
+	txns := mp.txnRegister.GetFeeTimeTransactions()
 	for _, txn := range txns {
 		if txn.Tx.TxnNonce == nil {
 			t.Errorf("PosMempool transaction has nil nonce")
@@ -39,8 +39,20 @@ type MempoolTx struct {
 	// The fee rate of the transaction in nanos per KB.
 	FeePerKB uint64
 
+	// MinInclusionBlockHeight is the minimum block height that the transaction can be included in, as declared by
+	// the MinInclusionBlockHeightKey in its ExtraData. It is zero for transactions that aren't scheduled.
+	MinInclusionBlockHeight uint64
+
 	// index is used by the heap logic to allow for modification in-place.
 	index int
+
+	// packageParent and packageChild link the transaction to its neighbors in a transaction package, as submitted
+	// through PosMempool.AddTransactionPackage. They are nil for transactions that aren't part of a package.
+	packageParent *MempoolTx
+	packageChild  *MempoolTx
+	// packageFeePerKB is the fee rate used to order the transaction in the TransactionRegister. It is zero for
+	// transactions that have never been part of a package, in which case FeePerKB is used.
+	packageFeePerKB uint64
 }
 
 func NewMempoolTx(txn *MsgDeSoTxn, addedUnixMicro time.Time, blockHeight uint64) (*MempoolTx, error) {
@@ -58,6 +70,10 @@ func NewMempoolTx(txn *MsgDeSoTxn, addedUnixMicro time.Time, blockHeight uint64)
 	if err != nil {
 		return nil, errors.Wrapf(err, "PosMempool.GetMempoolTx: Problem computing fee per KB")
 	}
+	minInclusionBlockHeight, err := getMempoolTxnMinInclusionBlockHeight(txn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PosMempool.GetMempoolTx: Problem getting min inclusion block height")
+	}
 
 	return &MempoolTx{
 		Tx:          txn,
@@ -67,6 +83,8 @@ func NewMempoolTx(txn *MsgDeSoTxn, addedUnixMicro time.Time, blockHeight uint64)
 		Height:      uint32(blockHeight),
 		Fee:         txn.TxnFeeNanos,
 		FeePerKB:    feePerKb,
+
+		MinInclusionBlockHeight: minInclusionBlockHeight,
 	}, nil
 }
 
@@ -129,6 +147,16 @@ func (mempoolTx *MempoolTx) FromBytes(rr *bytes.Reader) error {
 	return nil
 }
 
+// PackageFeePerKB returns the fee rate that determines the transaction's Fee-Time priority. For a transaction in a
+// package this is the highest fee rate of any package prefix that includes the transaction, so that a high fee
+// child raises the priority of its ancestors. For any other transaction it is the transaction's own FeePerKB.
+func (mempoolTx *MempoolTx) PackageFeePerKB() uint64 {
+	if mempoolTx.packageFeePerKB == 0 {
+		return mempoolTx.FeePerKB
+	}
+	return mempoolTx.packageFeePerKB
+}
+
 func (mempoolTx *MempoolTx) SetValidated(validated bool) {
 	mempoolTx.validated = validated
 }
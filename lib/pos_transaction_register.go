@@ -145,8 +145,8 @@ func (tr *TransactionRegister) addTransactionNoLock(txn *MempoolTx) error {
 			"total size %v", txn.TxSizeBytes, tr.totalTxnsSizeBytes)
 	}
 
-	// Determine the min fee of the bucket based on the transaction's fee rate.
-	bucketMinFeeNanosPerKb, bucketMaxFeeNanosPerKB := computeFeeTimeBucketRangeFromFeeNanosPerKB(txn.FeePerKB,
+	// Determine the min fee of the bucket based on the transaction's package fee rate.
+	bucketMinFeeNanosPerKb, bucketMaxFeeNanosPerKB := computeFeeTimeBucketRangeFromFeeNanosPerKB(txn.PackageFeePerKB(),
 		tr.minimumNetworkFeeNanosPerKB, tr.feeBucketGrowthRateBasisPoints)
 	// Lookup the bucket in the map.
 	bucket, bucketExists := tr.feeTimeBucketsByMinFeeMap[bucketMinFeeNanosPerKb]
@@ -196,8 +196,8 @@ func (tr *TransactionRegister) removeTransactionNoLock(txn *MempoolTx) error {
 			"exceeds total mempool size %v", txn.Hash.String(), txn.TxSizeBytes, tr.totalTxnsSizeBytes)
 	}
 
-	// Determine the min fee of the bucket based on the transaction's fee rate.
-	bucketMinFeeNanosPerKb, _ := computeFeeTimeBucketRangeFromFeeNanosPerKB(txn.FeePerKB,
+	// Determine the min fee of the bucket based on the transaction's package fee rate.
+	bucketMinFeeNanosPerKb, _ := computeFeeTimeBucketRangeFromFeeNanosPerKB(txn.PackageFeePerKB(),
 		tr.minimumNetworkFeeNanosPerKB, tr.feeBucketGrowthRateBasisPoints)
 	// Remove the transaction from the bucket.
 	if bucket, exists := tr.feeTimeBucketsByMinFeeMap[bucketMinFeeNanosPerKb]; exists {
@@ -308,6 +308,41 @@ func (tr *TransactionRegister) GetFeeTimeTransactions() []*MempoolTx {
 	return txns
 }
 
+// FeeRateHistogramBucket summarizes the transactions in a single FeeTimeBucket of a TransactionRegister.
+type FeeRateHistogramBucket struct {
+	// MinFeeRateNanosPerKB and MaxFeeRateNanosPerKB are the inclusive fee rate range of the FeeTimeBucket.
+	MinFeeRateNanosPerKB uint64
+	MaxFeeRateNanosPerKB uint64
+	// NumTxns is the number of transactions in the FeeTimeBucket.
+	NumTxns uint64
+	// TotalTxnsSizeBytes is the total size of the transactions in the FeeTimeBucket.
+	TotalTxnsSizeBytes uint64
+}
+
+// GetFeeRateHistogram returns a FeeRateHistogramBucket for each non-empty FeeTimeBucket in the register. The buckets
+// are ordered from the highest fee rate range to the lowest, i.e. in the order in which their transactions would be
+// included in blocks.
+func (tr *TransactionRegister) GetFeeRateHistogram() []*FeeRateHistogramBucket {
+	tr.RLock()
+	defer tr.RUnlock()
+
+	histogram := []*FeeRateHistogramBucket{}
+	it := tr.feeTimeBucketSet.Iterator()
+	for it.Next() {
+		feeTimeBucket, ok := it.Value().(*FeeTimeBucket)
+		if !ok || feeTimeBucket.Empty() {
+			continue
+		}
+		histogram = append(histogram, &FeeRateHistogramBucket{
+			MinFeeRateNanosPerKB: feeTimeBucket.minFeeNanosPerKB,
+			MaxFeeRateNanosPerKB: feeTimeBucket.maxFeeNanosPerKB,
+			NumTxns:              uint64(feeTimeBucket.txnsSet.Size()),
+			TotalTxnsSizeBytes:   feeTimeBucket.Size(),
+		})
+	}
+	return histogram
+}
+
 // GetTransaction returns the transaction with the given hash if it exists in the register, or nil otherwise.
 func (tr *TransactionRegister) GetTransaction(hash *BlockHash) *MempoolTx {
 	if hash == nil {
@@ -500,7 +535,7 @@ func NewFeeTimeBucket(minFeeNanosPerKB uint64, maxFeeNanosPerKB uint64) *FeeTime
 }
 
 // mempoolTxTimeOrderComparator is a comparator function for MempoolTx transactions stored inside a FeeTimeBucket. The comparator
-// orders the transactions by smallest timestamp. In case of a tie, transactions are ordered by greatest fee rate. Finally,
+// orders the transactions by smallest timestamp. In case of a tie, transactions are ordered by greatest package fee rate. Finally,
 // in case of another tie, transactions are ordered by their hash.
 func mempoolTxTimeOrderComparator(a, b interface{}) int {
 	aVal, aOk := a.(*MempoolTx)
@@ -514,9 +549,9 @@ func mempoolTxTimeOrderComparator(a, b interface{}) int {
 		return 1
 	} else if aVal.Added.UnixMicro() < bVal.Added.UnixMicro() {
 		return -1
-	} else if aVal.FeePerKB < bVal.FeePerKB {
+	} else if aVal.PackageFeePerKB() < bVal.PackageFeePerKB() {
 		return 1
-	} else if aVal.FeePerKB > bVal.FeePerKB {
+	} else if aVal.PackageFeePerKB() > bVal.PackageFeePerKB() {
 		return -1
 	}
 	// If the timestamps and fee rates are the same, we order by the transaction hash.
@@ -542,9 +577,9 @@ func (tb *FeeTimeBucket) AddTransaction(txn *MempoolTx) error {
 			txn.TxSizeBytes, tb.totalTxnsSizeBytes)
 	}
 
-	if tb.minFeeNanosPerKB > txn.FeePerKB || tb.maxFeeNanosPerKB < txn.FeePerKB {
+	if tb.minFeeNanosPerKB > txn.PackageFeePerKB() || tb.maxFeeNanosPerKB < txn.PackageFeePerKB() {
 		return fmt.Errorf("FeeTimeBucket.AddTransaction: Transaction fee %d outside of bucket range [%d, %d]",
-			txn.FeePerKB, tb.minFeeNanosPerKB, tb.maxFeeNanosPerKB)
+			txn.PackageFeePerKB(), tb.minFeeNanosPerKB, tb.maxFeeNanosPerKB)
 	}
 
 	tb.txnsSet.Add(txn)
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/collections"
 	"net/url"
 	"regexp"
@@ -16,6 +17,7 @@ import (
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 )
 
 type Postgres struct {
@@ -135,36 +137,44 @@ type PGTransaction struct {
 	TxnNoncePartialId             uint64
 
 	// Relationships
-	Outputs                       []*PGTransactionOutput           `pg:"rel:has-many,join_fk:output_hash"`
-	MetadataBlockReward           *PGMetadataBlockReward           `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataBitcoinExchange       *PGMetadataBitcoinExchange       `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataPrivateMessage        *PGMetadataPrivateMessage        `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataSubmitPost            *PGMetadataSubmitPost            `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataUpdateExchangeRate    *PGMetadataUpdateExchangeRate    `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataUpdateProfile         *PGMetadataUpdateProfile         `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataFollow                *PGMetadataFollow                `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataLike                  *PGMetadataLike                  `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataCreatorCoin           *PGMetadataCreatorCoin           `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataCreatorCoinTransfer   *PGMetadataCreatorCoinTransfer   `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataSwapIdentity          *PGMetadataSwapIdentity          `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataCreateNFT             *PGMetadataCreateNFT             `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataUpdateNFT             *PGMetadataUpdateNFT             `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataAcceptNFTBid          *PGMetadataAcceptNFTBid          `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataNFTBid                *PGMetadataNFTBid                `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataNFTTransfer           *PGMetadataNFTTransfer           `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataAcceptNFTTransfer     *PGMetadataAcceptNFTTransfer     `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataBurnNFT               *PGMetadataBurnNFT               `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDerivedKey            *PGMetadataDerivedKey            `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDAOCoin               *PGMetadataDAOCoin               `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDAOCoinTransfer       *PGMetadataDAOCoinTransfer       `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDAOCoinLimitOrder     *PGMetadataDAOCoinLimitOrder     `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataCreateUserAssociation *PGMetadataCreateUserAssociation `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDeleteUserAssociation *PGMetadataDeleteUserAssociation `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataCreatePostAssociation *PGMetadataCreatePostAssociation `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataDeletePostAssociation *PGMetadataDeletePostAssociation `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataAccessGroup           *PGMetadataAccessGroup           `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataAccessGroupMembers    *PGMetadataAccessGroupMembers    `pg:"rel:belongs-to,join_fk:transaction_hash"`
-	MetadataNewMessage            *PGMetadataNewMessage            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	Outputs                        []*PGTransactionOutput            `pg:"rel:has-many,join_fk:output_hash"`
+	MetadataBlockReward            *PGMetadataBlockReward            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataBitcoinExchange        *PGMetadataBitcoinExchange        `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataPrivateMessage         *PGMetadataPrivateMessage         `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataSubmitPost             *PGMetadataSubmitPost             `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUpdateExchangeRate     *PGMetadataUpdateExchangeRate     `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUpdateProfile          *PGMetadataUpdateProfile          `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataFollow                 *PGMetadataFollow                 `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataLike                   *PGMetadataLike                   `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCreatorCoin            *PGMetadataCreatorCoin            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCreatorCoinTransfer    *PGMetadataCreatorCoinTransfer    `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataSwapIdentity           *PGMetadataSwapIdentity           `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCreateNFT              *PGMetadataCreateNFT              `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUpdateNFT              *PGMetadataUpdateNFT              `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataAcceptNFTBid           *PGMetadataAcceptNFTBid           `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataNFTBid                 *PGMetadataNFTBid                 `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataNFTTransfer            *PGMetadataNFTTransfer            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataAcceptNFTTransfer      *PGMetadataAcceptNFTTransfer      `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataBurnNFT                *PGMetadataBurnNFT                `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDerivedKey             *PGMetadataDerivedKey             `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDAOCoin                *PGMetadataDAOCoin                `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDAOCoinTransfer        *PGMetadataDAOCoinTransfer        `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDAOCoinLimitOrder      *PGMetadataDAOCoinLimitOrder      `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCreateUserAssociation  *PGMetadataCreateUserAssociation  `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDeleteUserAssociation  *PGMetadataDeleteUserAssociation  `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCreatePostAssociation  *PGMetadataCreatePostAssociation  `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataDeletePostAssociation  *PGMetadataDeletePostAssociation  `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataAccessGroup            *PGMetadataAccessGroup            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataAccessGroupMembers     *PGMetadataAccessGroupMembers     `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataNewMessage             *PGMetadataNewMessage             `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataRegisterAsValidator    *PGMetadataRegisterAsValidator    `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataStake                  *PGMetadataStake                  `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUnstake                *PGMetadataUnstake                `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUnlockStake            *PGMetadataUnlockStake            `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCoinLockup             *PGMetadataCoinLockup             `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataUpdateCoinLockupParams *PGMetadataUpdateCoinLockupParams `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCoinLockupTransfer     *PGMetadataCoinLockupTransfer     `pg:"rel:belongs-to,join_fk:transaction_hash"`
+	MetadataCoinUnlock             *PGMetadataCoinUnlock             `pg:"rel:belongs-to,join_fk:transaction_hash"`
 }
 
 // PGTransactionOutput represents DeSoOutput, DeSoInput, and UtxoEntry
@@ -530,14 +540,15 @@ type PGProfile struct {
 	// FIXME: Postgres will break when values exceed uint64
 	// We don't use Postgres right now so going to plow ahead and set this as-is
 	// to fix compile errors. CoinsInCirculationNanos will never exceed uint64
-	CoinsInCirculationNanos          uint64
-	CoinWatermarkNanos               uint64
-	MintingDisabled                  bool
-	DAOCoinNumberOfHolders           uint64                    `pg:"dao_coin_number_of_holders"`
-	DAOCoinCoinsInCirculationNanos   string                    `pg:"dao_coin_coins_in_circulation_nanos"`
-	DAOCoinMintingDisabled           bool                      `pg:"dao_coin_minting_disabled"`
-	DAOCoinTransferRestrictionStatus TransferRestrictionStatus `pg:"dao_coin_transfer_restriction_status"`
-	ExtraData                        map[string][]byte
+	CoinsInCirculationNanos                uint64
+	CoinWatermarkNanos                     uint64
+	MintingDisabled                        bool
+	DAOCoinNumberOfHolders                 uint64                    `pg:"dao_coin_number_of_holders"`
+	DAOCoinCoinsInCirculationNanos         string                    `pg:"dao_coin_coins_in_circulation_nanos"`
+	DAOCoinMintingDisabled                 bool                      `pg:"dao_coin_minting_disabled"`
+	DAOCoinTransferRestrictionStatus       TransferRestrictionStatus `pg:"dao_coin_transfer_restriction_status"`
+	DAOCoinLockupTransferRestrictionStatus TransferRestrictionStatus `pg:"dao_coin_lockup_transfer_restriction_status"`
+	ExtraData                              map[string][]byte
 }
 
 func (profile *PGProfile) Empty() bool {
@@ -1385,6 +1396,20 @@ func (postgres *Postgres) DeleteTransactionsForBlock(block *MsgDeSoBlock, blockN
 	})
 }
 
+// _flattenAtomicTxnsForPostgres returns the transactions with the inner transactions of each atomic transaction
+// wrapper inserted right after the wrapper. Wrappers don't have any outputs or metadata of their own, so their inner
+// transactions are stored as if they had been included in the block directly.
+func _flattenAtomicTxnsForPostgres(desoTxns []*MsgDeSoTxn) []*MsgDeSoTxn {
+	var flattenedTxns []*MsgDeSoTxn
+	for _, txn := range desoTxns {
+		flattenedTxns = append(flattenedTxns, txn)
+		if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+			flattenedTxns = append(flattenedTxns, txn.TxnMeta.(*AtomicTxnsWrapperMetadata).Txns...)
+		}
+	}
+	return flattenedTxns
+}
+
 // InsertTransactionsTx inserts all the transactions from a block in a bulk query
 func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn, blockNode *BlockNode, delete bool) error {
 	var transactions []*PGTransaction
@@ -1422,11 +1447,19 @@ func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn
 	var metadataAccessGroup []*PGMetadataAccessGroup
 	var metadataAccessGroupMembers []*PGMetadataAccessGroupMembers
 	var metadataNewMessage []*PGMetadataNewMessage
+	var metadataRegisterAsValidator []*PGMetadataRegisterAsValidator
+	var metadataStake []*PGMetadataStake
+	var metadataUnstake []*PGMetadataUnstake
+	var metadataUnlockStake []*PGMetadataUnlockStake
+	var metadataCoinLockup []*PGMetadataCoinLockup
+	var metadataUpdateCoinLockupParams []*PGMetadataUpdateCoinLockupParams
+	var metadataCoinLockupTransfer []*PGMetadataCoinLockupTransfer
+	var metadataCoinUnlock []*PGMetadataCoinUnlock
 
 	blockHash := blockNode.Hash
 
 	// Iterate over all the transactions and build the arrays of data to insert
-	for _, txn := range desoTxns {
+	for _, txn := range _flattenAtomicTxnsForPostgres(desoTxns) {
 		txnHash := txn.Hash()
 		transaction := &PGTransaction{
 			Hash:        txnHash,
@@ -1850,6 +1883,88 @@ func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn
 				NewMessageType:                     uint8(txMeta.NewMessageType),
 				NewMessageOperation:                uint8(txMeta.NewMessageOperation),
 			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeRegisterAsValidator {
+			txMeta := txn.TxnMeta.(*RegisterAsValidatorMetadata)
+
+			metadataRegisterAsValidator = append(metadataRegisterAsValidator, &PGMetadataRegisterAsValidator{
+				TransactionHash:                     txnHash,
+				Domains:                             _domainsToPGDomains(txMeta.Domains),
+				DisableDelegatedStake:               txMeta.DisableDelegatedStake,
+				DelegatedStakeCommissionBasisPoints: txMeta.DelegatedStakeCommissionBasisPoints,
+				VotingPublicKey:                     _blsPublicKeyToPGBytes(txMeta.VotingPublicKey),
+				VotingAuthorization:                 txMeta.VotingAuthorization.ToBytes(),
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeUnregisterAsValidator {
+			// No extra metadata needed
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeStake {
+			txMeta := txn.TxnMeta.(*StakeMetadata)
+
+			metadataStake = append(metadataStake, &PGMetadataStake{
+				TransactionHash:    txnHash,
+				ValidatorPublicKey: txMeta.ValidatorPublicKey,
+				RewardMethod:       uint8(txMeta.RewardMethod),
+				StakeAmountNanos:   Uint256ToLeftPaddedHex(txMeta.StakeAmountNanos),
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeUnstake {
+			txMeta := txn.TxnMeta.(*UnstakeMetadata)
+
+			metadataUnstake = append(metadataUnstake, &PGMetadataUnstake{
+				TransactionHash:    txnHash,
+				ValidatorPublicKey: txMeta.ValidatorPublicKey,
+				UnstakeAmountNanos: Uint256ToLeftPaddedHex(txMeta.UnstakeAmountNanos),
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeUnlockStake {
+			txMeta := txn.TxnMeta.(*UnlockStakeMetadata)
+
+			metadataUnlockStake = append(metadataUnlockStake, &PGMetadataUnlockStake{
+				TransactionHash:    txnHash,
+				ValidatorPublicKey: txMeta.ValidatorPublicKey,
+				StartEpochNumber:   txMeta.StartEpochNumber,
+				EndEpochNumber:     txMeta.EndEpochNumber,
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeUnjailValidator {
+			// No extra metadata needed
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeCoinLockup {
+			txMeta := txn.TxnMeta.(*CoinLockupMetadata)
+
+			metadataCoinLockup = append(metadataCoinLockup, &PGMetadataCoinLockup{
+				TransactionHash:             txnHash,
+				ProfilePublicKey:            txMeta.ProfilePublicKey,
+				RecipientPublicKey:          txMeta.RecipientPublicKey,
+				UnlockTimestampNanoSecs:     txMeta.UnlockTimestampNanoSecs,
+				VestingEndTimestampNanoSecs: txMeta.VestingEndTimestampNanoSecs,
+				LockupAmountBaseUnits:       Uint256ToLeftPaddedHex(txMeta.LockupAmountBaseUnits),
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeUpdateCoinLockupParams {
+			txMeta := txn.TxnMeta.(*UpdateCoinLockupParamsMetadata)
+
+			metadataUpdateCoinLockupParams = append(metadataUpdateCoinLockupParams, &PGMetadataUpdateCoinLockupParams{
+				TransactionHash:                 txnHash,
+				LockupYieldDurationNanoSecs:     txMeta.LockupYieldDurationNanoSecs,
+				LockupYieldAPYBasisPoints:       txMeta.LockupYieldAPYBasisPoints,
+				RemoveYieldCurvePoint:           txMeta.RemoveYieldCurvePoint,
+				NewLockupTransferRestrictions:   txMeta.NewLockupTransferRestrictions,
+				LockupTransferRestrictionStatus: txMeta.LockupTransferRestrictionStatus,
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeCoinLockupTransfer {
+			txMeta := txn.TxnMeta.(*CoinLockupTransferMetadata)
+
+			metadataCoinLockupTransfer = append(metadataCoinLockupTransfer, &PGMetadataCoinLockupTransfer{
+				TransactionHash:                txnHash,
+				RecipientPublicKey:             txMeta.RecipientPublicKey,
+				ProfilePublicKey:               txMeta.ProfilePublicKey,
+				UnlockTimestampNanoSecs:        txMeta.UnlockTimestampNanoSecs,
+				LockedCoinsToTransferBaseUnits: Uint256ToLeftPaddedHex(txMeta.LockedCoinsToTransferBaseUnits),
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeCoinUnlock {
+			txMeta := txn.TxnMeta.(*CoinUnlockMetadata)
+
+			metadataCoinUnlock = append(metadataCoinUnlock, &PGMetadataCoinUnlock{
+				TransactionHash:  txnHash,
+				ProfilePublicKey: txMeta.ProfilePublicKey,
+			})
+		} else if txn.TxnMeta.GetTxnType() == TxnTypeAtomicTxnsWrapper {
+			// No extra metadata needed. The inner transactions are inserted separately.
 		} else {
 			return fmt.Errorf("InsertTransactionTx: Unimplemented txn type %v", txn.TxnMeta.GetTxnType().String())
 		}
@@ -2219,27 +2334,147 @@ func (postgres *Postgres) InsertTransactionsTx(tx *pg.Tx, desoTxns []*MsgDeSoTxn
 		}
 	}
 
+	if len(metadataRegisterAsValidator) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataRegisterAsValidator).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataRegisterAsValidator).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataStake) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataStake).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataStake).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataUnstake) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataUnstake).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataUnstake).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataUnlockStake) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataUnlockStake).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataUnlockStake).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataCoinLockup) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataCoinLockup).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataCoinLockup).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataUpdateCoinLockupParams) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataUpdateCoinLockupParams).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataUpdateCoinLockupParams).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataCoinLockupTransfer) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataCoinLockupTransfer).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataCoinLockupTransfer).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(metadataCoinUnlock) > 0 {
+		if !delete {
+			if _, err := tx.Model(&metadataCoinUnlock).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataCoinUnlock).Returning("NULL").Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
 	if len(metadataCreateUserAssociations) > 0 {
-		if _, err := tx.Model(&metadataCreateUserAssociations).Returning("NULL").Insert(); err != nil {
-			return err
+		if !delete {
+			if _, err := tx.Model(&metadataCreateUserAssociations).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataCreateUserAssociations).Returning("NULL").Delete(); err != nil {
+				return err
+			}
 		}
 	}
 
 	if len(metadataDeleteUserAssociations) > 0 {
-		if _, err := tx.Model(&metadataDeleteUserAssociations).Returning("NULL").Insert(); err != nil {
-			return err
+		if !delete {
+			if _, err := tx.Model(&metadataDeleteUserAssociations).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataDeleteUserAssociations).Returning("NULL").Delete(); err != nil {
+				return err
+			}
 		}
 	}
 
 	if len(metadataCreatePostAssociations) > 0 {
-		if _, err := tx.Model(&metadataCreatePostAssociations).Returning("NULL").Insert(); err != nil {
-			return err
+		if !delete {
+			if _, err := tx.Model(&metadataCreatePostAssociations).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataCreatePostAssociations).Returning("NULL").Delete(); err != nil {
+				return err
+			}
 		}
 	}
 
 	if len(metadataDeletePostAssociations) > 0 {
-		if _, err := tx.Model(&metadataDeletePostAssociations).Returning("NULL").Insert(); err != nil {
-			return err
+		if !delete {
+			if _, err := tx.Model(&metadataDeletePostAssociations).Returning("NULL").Insert(); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Model(&metadataDeletePostAssociations).Returning("NULL").Delete(); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -2285,69 +2520,461 @@ func (postgres *Postgres) GetTransactionByHash(txnHash *BlockHash) *PGTransactio
 
 func (postgres *Postgres) FlushView(view *UtxoView, blockHeight uint64) error {
 	return postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
-		if err := postgres.flushUtxos(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushProfiles(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushPosts(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushLikes(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushFollows(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushDiamonds(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushMessages(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushCreatorCoinBalances(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushDAOCoinBalances(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushBalances(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushForbiddenKeys(tx, view); err != nil {
-			return err
-		}
-		if err := postgres.flushNFTs(tx, view); err != nil {
+		return postgres.flushViewTx(tx, view, blockHeight)
+	})
+}
+
+// CommitBlockAndFlushView writes a committed block, its transactions, and the view that results from
+// connecting it in a single transaction. The main chain tip is moved last, so Postgres either fully
+// reflects the block or is left at its parent. Every write is an upsert, so it is safe to repeat.
+func (postgres *Postgres) CommitBlockAndFlushView(
+	blockNode *BlockNode, desoBlock *MsgDeSoBlock, view *UtxoView, blockHeight uint64) error {
+	return postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
+		if err := postgres.UpsertBlockTx(tx, blockNode); err != nil {
 			return err
 		}
-		if err := postgres.flushNFTBids(tx, view); err != nil {
+		if err := postgres.InsertTransactionsTx(tx, desoBlock.Txns, blockNode, false); err != nil {
 			return err
 		}
-		if err := postgres.flushDerivedKeys(tx, view, blockHeight); err != nil {
+		if err := postgres.flushViewTx(tx, view, blockHeight); err != nil {
 			return err
 		}
-		if err := postgres.flushAccessGroupEntries(tx, view); err != nil {
-			return err
+		return postgres.UpsertChainTx(tx, MAIN_CHAIN, blockNode.Hash)
+	})
+}
+
+func (postgres *Postgres) flushViewTx(tx *pg.Tx, view *UtxoView, blockHeight uint64) error {
+	if err := postgres.flushUtxos(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushProfiles(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushPosts(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushLikes(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushFollows(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushDiamonds(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushMessages(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushCreatorCoinBalances(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushDAOCoinBalances(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushBalances(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushForbiddenKeys(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushNFTs(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushNFTBids(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushDerivedKeys(tx, view, blockHeight); err != nil {
+		return err
+	}
+	if err := postgres.flushAccessGroupEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushAccessGroupMemberEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushNewMessageEntries(tx, view); err != nil {
+		return err
+	}
+	// Temporarily write limit orders to badger
+	//if err := postgres.flushDAOCoinLimitOrders(tx, view); err != nil {
+	//	return err
+	//}
+	if err := postgres.flushUserAssociations(tx, view, blockHeight); err != nil {
+		return err
+	}
+	if err := postgres.flushPostAssociations(tx, view, blockHeight); err != nil {
+		return err
+	}
+	if err := postgres.flushValidatorEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushSnapshotValidatorSet(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushStakeEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushLockedStakeEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushCurrentEpochEntry(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushLockedBalanceEntries(tx, view); err != nil {
+		return err
+	}
+	if err := postgres.flushLockupYieldCurvePoints(tx, view); err != nil {
+		return err
+	}
+	return nil
+}
+
+//
+// Hypersync
+//
+
+// DeleteAllStateRecords truncates every table that LoadSnapshotChunk writes to. It's the Postgres
+// counterpart of DBDeleteAllStateRecords, and is called whenever hypersync starts over so that a new
+// snapshot isn't loaded on top of the state left behind by an earlier attempt.
+func (postgres *Postgres) DeleteAllStateRecords() error {
+	stateModels := []interface{}{
+		(*PGTransactionOutput)(nil),
+		(*PGProfile)(nil),
+		(*PGPost)(nil),
+		(*PGLike)(nil),
+		(*PGFollow)(nil),
+		(*PGDiamond)(nil),
+		(*PGMessage)(nil),
+		(*PGCreatorCoinBalance)(nil),
+		(*PGDAOCoinBalance)(nil),
+		(*PGBalance)(nil),
+		(*PGForbiddenKey)(nil),
+		(*PGNFT)(nil),
+		(*PGNFTBid)(nil),
+		(*PGDerivedKey)(nil),
+		(*PGAccessGroupEntry)(nil),
+		(*PGAccessGroupMemberEntry)(nil),
+		(*PGAccessGroupMemberEnumerationEntry)(nil),
+		(*PGNewMessageDmEntry)(nil),
+		(*PGNewMessageDmThreadEntry)(nil),
+		(*PGNewMessageGroupChatEntry)(nil),
+		(*PGNewMessageGroupChatThreadEntry)(nil),
+		(*PGUserAssociation)(nil),
+		(*PGPostAssociation)(nil),
+		(*PGValidatorEntry)(nil),
+		(*PGSnapshotValidatorEntry)(nil),
+		(*PGStakeEntry)(nil),
+		(*PGLockedStakeEntry)(nil),
+		(*PGEpochEntry)(nil),
+		(*PGLockedBalanceEntry)(nil),
+		(*PGLockupYieldCurvePoint)(nil),
+	}
+	return postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
+		for _, stateModel := range stateModels {
+			if _, err := tx.Model(stateModel).Exec("TRUNCATE ?TableName"); err != nil {
+				return errors.Wrapf(err, "DeleteAllStateRecords: Problem truncating %T", stateModel)
+			}
 		}
-		if err := postgres.flushAccessGroupMemberEntries(tx, view); err != nil {
+		return nil
+	})
+}
+
+// LoadSnapshotChunk decodes a chunk of state records received from a peer during hypersync
+// and upserts them into the corresponding Postgres tables. Records are set on a bare view so
+// the conversions in FlushView can be reused. Only the primary record of each entry is loaded;
+// badger indexes that duplicate it, as well as prefixes Postgres doesn't store, are skipped.
+//
+// Loading a chunk is idempotent, so a chunk that failed to load can safely be retried. The view reads the
+// global state it needs to initialize, such as the global params, from the badger handle.
+func (postgres *Postgres) LoadSnapshotChunk(handle *badger.DB, chunk []*DBEntry, blockHeight uint64) error {
+	view, profiles, pkidProfiles, err := _decodeSnapshotChunkForPostgres(handle, chunk)
+	if err != nil {
+		return errors.Wrapf(err, "LoadSnapshotChunk: ")
+	}
+
+	if len(profiles) > 0 || len(pkidProfiles) > 0 {
+		err := postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
+			if len(profiles) > 0 {
+				_, err := tx.Model(&profiles).WherePK().OnConflict("(pkid) DO UPDATE").Returning("NULL").Insert()
+				if err != nil {
+					return fmt.Errorf("LoadSnapshotChunk: insert profiles: %v", err)
+				}
+			}
+			// A PKID entry only carries the public key, so it must not overwrite a profile
+			// that was loaded from an earlier chunk.
+			if len(pkidProfiles) > 0 {
+				_, err := tx.Model(&pkidProfiles).WherePK().OnConflict("(pkid) DO NOTHING").Returning("NULL").Insert()
+				if err != nil {
+					return fmt.Errorf("LoadSnapshotChunk: insert pkids: %v", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
-		if err := postgres.flushNewMessageEntries(tx, view); err != nil {
-			return err
+	}
+
+	return postgres.FlushView(view, blockHeight)
+}
+
+// _decodeSnapshotChunkForPostgres decodes a chunk of state records into a bare view. Profiles and PKIDs are stored
+// under separate prefixes and therefore arrive in different chunks. flushProfiles expects both to be present in the
+// view, so they're returned separately instead.
+func _decodeSnapshotChunkForPostgres(handle *badger.DB, chunk []*DBEntry) (
+	_view *UtxoView, _profiles []*PGProfile, _pkidProfiles []*PGProfile, _err error) {
+	view := &UtxoView{Handle: handle}
+	view._ResetViewMappingsAfterFlush()
+
+	var profiles []*PGProfile
+	var pkidProfiles []*PGProfile
+
+	for _, dbEntry := range chunk {
+		// Snapshot chunks may be terminated by an empty entry.
+		if dbEntry.IsEmpty() {
+			continue
 		}
-		// Temporarily write limit orders to badger
-		//if err := postgres.flushDAOCoinLimitOrders(tx, view); err != nil {
-		//	return err
-		//}
-		if err := postgres.flushUserAssociations(tx, view, blockHeight); err != nil {
-			return err
+
+		prefix := dbEntry.Key[:1]
+		keyBytes := dbEntry.Key[1:]
+
+		var encoder DeSoEncoder
+		if isEncoder, stateEncoder := StatePrefixToDeSoEncoder(prefix); isEncoder && stateEncoder != nil {
+			if exist, err := DecodeFromBytes(stateEncoder, bytes.NewReader(dbEntry.Value)); err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: Problem decoding entry "+
+					"with prefix %v", prefix)
+			} else if !exist {
+				continue
+			}
+			encoder = stateEncoder
 		}
-		if err := postgres.flushPostAssociations(tx, view, blockHeight); err != nil {
-			return err
+
+		switch {
+		case bytes.Equal(prefix, Prefixes.PrefixUtxoKeyToUtxoEntry):
+			utxoKey := _UtxoKeyFromDbKey(keyBytes)
+			view.UtxoKeyToUtxoEntry[*utxoKey] = encoder.(*UtxoEntry)
+
+		case bytes.Equal(prefix, Prefixes.PrefixPublicKeyToDeSoBalanceNanos):
+			balanceEntry, err := _decodeDbKeyForPublicKeyToDeSoBalanceNanosMapping(dbEntry.Key, dbEntry.Value)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			view.PublicKeyToDeSoBalanceNanos[*NewPublicKey(balanceEntry.PublicKey)] = balanceEntry.BalanceNanos
+
+		case bytes.Equal(prefix, Prefixes.PrefixPKIDToProfileEntry):
+			profileEntry := encoder.(*ProfileEntry)
+			pkid := &PKID{}
+			copy(pkid[:], keyBytes)
+			profiles = append(profiles, &PGProfile{
+				PKID:                                   pkid,
+				PublicKey:                              NewPublicKey(profileEntry.PublicKey),
+				Username:                               string(profileEntry.Username),
+				Description:                            string(profileEntry.Description),
+				ProfilePic:                             profileEntry.ProfilePic,
+				CreatorBasisPoints:                     profileEntry.CreatorCoinEntry.CreatorBasisPoints,
+				DeSoLockedNanos:                        profileEntry.CreatorCoinEntry.DeSoLockedNanos,
+				NumberOfHolders:                        profileEntry.CreatorCoinEntry.NumberOfHolders,
+				CoinsInCirculationNanos:                profileEntry.CreatorCoinEntry.CoinsInCirculationNanos.Uint64(),
+				CoinWatermarkNanos:                     profileEntry.CreatorCoinEntry.CoinWatermarkNanos,
+				DAOCoinCoinsInCirculationNanos:         profileEntry.DAOCoinEntry.CoinsInCirculationNanos.Hex(),
+				DAOCoinMintingDisabled:                 profileEntry.DAOCoinEntry.MintingDisabled,
+				DAOCoinNumberOfHolders:                 profileEntry.DAOCoinEntry.NumberOfHolders,
+				DAOCoinTransferRestrictionStatus:       profileEntry.DAOCoinEntry.TransferRestrictionStatus,
+				DAOCoinLockupTransferRestrictionStatus: profileEntry.DAOCoinEntry.LockupTransferRestrictionStatus,
+				ExtraData:                              profileEntry.ExtraData,
+			})
+
+		case bytes.Equal(prefix, Prefixes.PrefixPublicKeyToPKID):
+			pkidEntry := encoder.(*PKIDEntry)
+			pkidProfiles = append(pkidProfiles, &PGProfile{
+				PKID:      pkidEntry.PKID,
+				PublicKey: NewPublicKey(keyBytes),
+			})
+
+		case bytes.Equal(prefix, Prefixes.PrefixPostHashToPostEntry):
+			postEntry := encoder.(*PostEntry)
+			view.PostHashToPostEntry[*postEntry.PostHash] = postEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixLikerPubKeyToLikedPostHash):
+			likeEntry, err := _decodeDbKeyForLikerPubKeyToLikedPostHashMapping(dbEntry.Key)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			view.LikeKeyToLikeEntry[MakeLikeKey(likeEntry.LikerPubKey, *likeEntry.LikedPostHash)] = likeEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixFollowerPKIDToFollowedPKID):
+			followEntry, err := _decodeDbKeyForFollowerToFollowedMapping(dbEntry.Key)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			view.FollowKeyToFollowEntry[MakeFollowKey(followEntry.FollowerPKID, followEntry.FollowedPKID)] = followEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixDiamondReceiverPKIDDiamondSenderPKIDPostHash):
+			diamondEntry := encoder.(*DiamondEntry)
+			diamondKey := MakeDiamondKey(diamondEntry.SenderPKID, diamondEntry.ReceiverPKID, diamondEntry.DiamondPostHash)
+			view.DiamondKeyToDiamondEntry[diamondKey] = diamondEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry):
+			balanceEntry := encoder.(*BalanceEntry)
+			balanceKey := MakeBalanceEntryKey(balanceEntry.HODLerPKID, balanceEntry.CreatorPKID)
+			view.HODLerPKIDCreatorPKIDToBalanceEntry[balanceKey] = balanceEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry):
+			balanceEntry := encoder.(*BalanceEntry)
+			balanceKey := MakeBalanceEntryKey(balanceEntry.HODLerPKID, balanceEntry.CreatorPKID)
+			view.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry[balanceKey] = balanceEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixForbiddenBlockSignaturePubKeys):
+			view.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(keyBytes)] = &ForbiddenPubKeyEntry{
+				PubKey: keyBytes,
+			}
+
+		case bytes.Equal(prefix, Prefixes.PrefixPostHashSerialNumberToNFTEntry):
+			nftEntry := encoder.(*NFTEntry)
+			view.NFTKeyToNFTEntry[MakeNFTKey(nftEntry.NFTPostHash, nftEntry.SerialNumber)] = nftEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixPostHashSerialNumberBidNanosBidderPKID):
+			bidEntry, err := _decodeDbKeyForPostHashSerialNumberBidNanosBidderPKIDMapping(dbEntry.Key)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			bidKey := MakeNFTBidKey(bidEntry.BidderPKID, bidEntry.NFTPostHash, bidEntry.SerialNumber)
+			view.NFTBidKeyToNFTBidEntry[bidKey] = bidEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixAuthorizeDerivedKey):
+			derivedKeyEntry := encoder.(*DerivedKeyEntry)
+			derivedKeyMapKey := MakeDerivedKeyMapKey(derivedKeyEntry.OwnerPublicKey, derivedKeyEntry.DerivedPublicKey)
+			view.DerivedKeyToDerivedEntry[derivedKeyMapKey] = derivedKeyEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixAccessGroupEntriesByAccessGroupId):
+			accessGroupEntry := encoder.(*AccessGroupEntry)
+			accessGroupId := NewAccessGroupId(accessGroupEntry.AccessGroupOwnerPublicKey, accessGroupEntry.AccessGroupKeyName.ToBytes())
+			view.AccessGroupIdToAccessGroupEntry[*accessGroupId] = accessGroupEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixAccessGroupMembershipIndex):
+			memberPublicKey, ownerPublicKey, groupKeyName, err := _dbDecodeKeyForAccessGroupMemberEntry(dbEntry.Key)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			membershipKey := AccessGroupMembershipKey{
+				AccessGroupMemberPublicKey: memberPublicKey,
+				AccessGroupOwnerPublicKey:  ownerPublicKey,
+				AccessGroupKeyName:         groupKeyName,
+			}
+			view.AccessGroupMembershipKeyToAccessGroupMember[membershipKey] = encoder.(*AccessGroupMemberEntry)
+
+		case bytes.Equal(prefix, Prefixes.PrefixDmMessagesIndex):
+			messageEntry := encoder.(*NewMessageEntry)
+			dmMessageKey := MakeDmMessageKeyForSenderRecipient(
+				*messageEntry.SenderAccessGroupOwnerPublicKey, *messageEntry.SenderAccessGroupKeyName,
+				*messageEntry.RecipientAccessGroupOwnerPublicKey, *messageEntry.RecipientAccessGroupKeyName,
+				messageEntry.TimestampNanos)
+			view.DmMessagesIndex[dmMessageKey] = messageEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixDmThreadIndex):
+			userPublicKey, userKeyName, partyPublicKey, partyKeyName, err := _dbDecodeKeyForPrefixDmThreadIndex(dbEntry.Key)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "_decodeSnapshotChunkForPostgres: ")
+			}
+			dmThreadKey := MakeDmThreadKey(userPublicKey, userKeyName, partyPublicKey, partyKeyName)
+			view.DmThreadIndex[dmThreadKey] = encoder.(*DmThreadEntry)
+
+		case bytes.Equal(prefix, Prefixes.PrefixGroupChatMessagesIndex):
+			messageEntry := encoder.(*NewMessageEntry)
+			groupChatMessageKey := MakeGroupChatMessageKey(*messageEntry.RecipientAccessGroupOwnerPublicKey,
+				*messageEntry.RecipientAccessGroupKeyName, messageEntry.TimestampNanos)
+			view.GroupChatMessagesIndex[groupChatMessageKey] = messageEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixUserAssociationByID):
+			associationEntry := encoder.(*UserAssociationEntry)
+			view.AssociationMapKeyToUserAssociationEntry[associationEntry.ToMapKey()] = associationEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixPostAssociationByID):
+			associationEntry := encoder.(*PostAssociationEntry)
+			view.AssociationMapKeyToPostAssociationEntry[associationEntry.ToMapKey()] = associationEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixValidatorByPKID):
+			validatorEntry := encoder.(*ValidatorEntry)
+			view.ValidatorPKIDToValidatorEntry[*validatorEntry.ValidatorPKID] = validatorEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixSnapshotValidatorSetByPKID):
+			validatorEntry := encoder.(*ValidatorEntry)
+			mapKey := SnapshotValidatorSetMapKey{
+				SnapshotAtEpochNumber: DecodeUint64(keyBytes[:8]),
+				ValidatorPKID:         *validatorEntry.ValidatorPKID,
+			}
+			view.SnapshotValidatorSet[mapKey] = validatorEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixStakeByValidatorAndStaker):
+			stakeEntry := encoder.(*StakeEntry)
+			view.StakeMapKeyToStakeEntry[stakeEntry.ToMapKey()] = stakeEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixLockedStakeByValidatorAndStakerAndLockedAt):
+			lockedStakeEntry := encoder.(*LockedStakeEntry)
+			view.LockedStakeMapKeyToLockedStakeEntry[lockedStakeEntry.ToMapKey()] = lockedStakeEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixCurrentEpoch):
+			view.CurrentEpochEntry = encoder.(*EpochEntry)
+
+		case bytes.Equal(prefix, Prefixes.PrefixLockedBalanceEntry):
+			lockedBalanceEntry := encoder.(*LockedBalanceEntry)
+			view.LockedBalanceEntryKeyToLockedBalanceEntry[lockedBalanceEntry.ToMapKey()] = lockedBalanceEntry
+
+		case bytes.Equal(prefix, Prefixes.PrefixLockupYieldCurvePointByProfilePKIDAndDurationNanoSecs):
+			yieldCurvePoint := encoder.(*LockupYieldCurvePoint)
+			profilePKID := *yieldCurvePoint.ProfilePKID
+			if _, exists := view.PKIDToLockupYieldCurvePointKeyToLockupYieldCurvePoints[profilePKID]; !exists {
+				view.PKIDToLockupYieldCurvePointKeyToLockupYieldCurvePoints[profilePKID] =
+					make(map[LockupYieldCurvePointKey]*LockupYieldCurvePoint)
+			}
+			view.PKIDToLockupYieldCurvePointKeyToLockupYieldCurvePoints[profilePKID][yieldCurvePoint.ToMapKey()] = yieldCurvePoint
+
+		case bytes.Equal(prefix, Prefixes.PrefixPublicKeyTimestampToPrivateMessage):
+			// Messages are stored under both the sender's and the recipient's public key, but both
+			// copies map to the same PGMessage since it's keyed by sender, recipient and timestamp.
+			pgMessage := _snapshotMessageEntryToPGMessage(encoder.(*MessageEntry))
+			view.MessageMap[*pgMessage.MessageHash] = pgMessage
 		}
+	}
 
-		return nil
+	return view, profiles, pkidProfiles, nil
+}
+
+// _pgMessageHash returns the key of a legacy private message in Postgres. Badger guarantees that
+// <sender, timestamp> and <recipient, timestamp> are unique, so a hash of the sender, recipient and
+// timestamp identifies a message and, unlike the transaction hash, can be computed both when
+// connecting a PrivateMessage transaction and when loading a MessageEntry from a snapshot.
+func _pgMessageHash(senderPublicKey []byte, recipientPublicKey []byte, timestampNanos uint64) *BlockHash {
+	var messageHashBytes []byte
+	messageHashBytes = append(messageHashBytes, senderPublicKey...)
+	messageHashBytes = append(messageHashBytes, recipientPublicKey...)
+	messageHashBytes = append(messageHashBytes, EncodeUint64(timestampNanos)...)
+	return Sha256DoubleHash(messageHashBytes)
+}
+
+// _snapshotMessageEntryToPGMessage converts a legacy private message loaded from a snapshot to a PGMessage.
+func _snapshotMessageEntryToPGMessage(messageEntry *MessageEntry) *PGMessage {
+	return &PGMessage{
+		MessageHash: _pgMessageHash(messageEntry.SenderPublicKey.ToBytes(),
+			messageEntry.RecipientPublicKey.ToBytes(), messageEntry.TstampNanos),
+		SenderPublicKey:    messageEntry.SenderPublicKey.ToBytes(),
+		RecipientPublicKey: messageEntry.RecipientPublicKey.ToBytes(),
+		EncryptedText:      messageEntry.EncryptedText,
+		TimestampNanos:     messageEntry.TstampNanos,
+		ExtraData:          messageEntry.ExtraData,
+	}
+}
+
+// UpsertHypersyncBlockNodes stores the block nodes of the chain that was synced from a snapshot and
+// moves the main chain tip to the snapshot block, so that the node continues block-by-block from there.
+func (postgres *Postgres) UpsertHypersyncBlockNodes(blockNodes []*BlockNode, tipHash *BlockHash) error {
+	return postgres.db.RunInTransaction(postgres.db.Context(), func(tx *pg.Tx) error {
+		for _, blockNode := range blockNodes {
+			if err := postgres.UpsertBlockTx(tx, blockNode); err != nil {
+				return errors.Wrapf(err, "UpsertHypersyncBlockNodes: Problem upserting block %v", blockNode.Hash)
+			}
+		}
+		return postgres.UpsertChainTx(tx, MAIN_CHAIN, tipHash)
 	})
 }
 
@@ -2403,6 +3030,7 @@ func (postgres *Postgres) flushProfiles(tx *pg.Tx, view *UtxoView) error {
 			profile.DAOCoinMintingDisabled = profileEntry.DAOCoinEntry.MintingDisabled
 			profile.DAOCoinNumberOfHolders = profileEntry.DAOCoinEntry.NumberOfHolders
 			profile.DAOCoinTransferRestrictionStatus = profileEntry.DAOCoinEntry.TransferRestrictionStatus
+			profile.DAOCoinLockupTransferRestrictionStatus = profileEntry.DAOCoinEntry.LockupTransferRestrictionStatus
 			profile.ExtraData = profileEntry.ExtraData
 		}
 
@@ -4377,6 +5005,21 @@ func (postgres *Postgres) GetUserAssociationIdsByAttributes(
 	return NewSet(associationIds), nil, nil
 }
 
+func (postgres *Postgres) CountUserAssociationsByAttributes(
+	associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (uint64, error) {
+	// Construct SQL query.
+	sqlQuery := postgres.db.Model(&[]PGUserAssociation{})
+	_constructFilterUserAssociationsByAttributesQuery(sqlQuery, associationQuery, utxoViewAssociationIds)
+
+	// Execute SQL query. Counting in the db avoids pulling every matching ID into memory.
+	count, err := sqlQuery.Count()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(count), nil
+}
+
 func _constructFilterUserAssociationsByAttributesQuery(
 	sqlQuery *pg.Query, associationQuery *UserAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
 ) {
@@ -4396,12 +5039,12 @@ func _constructFilterUserAssociationsByAttributesQuery(
 	if len(associationQuery.AssociationType) > 0 {
 		sqlQuery.Where("LOWER(association_type) = ?", string(bytes.ToLower(associationQuery.AssociationType)))
 	} else if len(associationQuery.AssociationTypePrefix) > 0 {
-		sqlQuery.Where("LOWER(association_type) LIKE ?", string(bytes.ToLower(associationQuery.AssociationTypePrefix))+"%")
+		sqlQuery.Where("LOWER(association_type) LIKE ?", _pgLikePrefixPattern(bytes.ToLower(associationQuery.AssociationTypePrefix)))
 	}
 	if len(associationQuery.AssociationValue) > 0 {
 		sqlQuery.Where("association_value = ?", string(associationQuery.AssociationValue))
 	} else if len(associationQuery.AssociationValuePrefix) > 0 {
-		sqlQuery.Where("association_value LIKE ?", string(associationQuery.AssociationValuePrefix)+"%")
+		sqlQuery.Where("association_value LIKE ?", _pgLikePrefixPattern(associationQuery.AssociationValuePrefix))
 	}
 	if associationQuery.Limit > 0 {
 		if associationQuery.LastSeenAssociationID != nil {
@@ -4470,6 +5113,21 @@ func (postgres *Postgres) GetPostAssociationIdsByAttributes(
 	return NewSet(associationIds), nil, nil
 }
 
+func (postgres *Postgres) CountPostAssociationsByAttributes(
+	associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
+) (uint64, error) {
+	// Construct SQL query.
+	sqlQuery := postgres.db.Model(&[]PGPostAssociation{})
+	_constructFilterPostAssociationsByAttributesQuery(sqlQuery, associationQuery, utxoViewAssociationIds)
+
+	// Execute SQL query. Counting in the db avoids pulling every matching ID into memory.
+	count, err := sqlQuery.Count()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(count), nil
+}
+
 func _constructFilterPostAssociationsByAttributesQuery(
 	sqlQuery *pg.Query, associationQuery *PostAssociationQuery, utxoViewAssociationIds *Set[BlockHash],
 ) {
@@ -4489,12 +5147,12 @@ func _constructFilterPostAssociationsByAttributesQuery(
 	if len(associationQuery.AssociationType) > 0 {
 		sqlQuery.Where("LOWER(association_type) = ?", string(bytes.ToLower(associationQuery.AssociationType)))
 	} else if len(associationQuery.AssociationTypePrefix) > 0 {
-		sqlQuery.Where("LOWER(association_type) LIKE ?", string(bytes.ToLower(associationQuery.AssociationTypePrefix))+"%")
+		sqlQuery.Where("LOWER(association_type) LIKE ?", _pgLikePrefixPattern(bytes.ToLower(associationQuery.AssociationTypePrefix)))
 	}
 	if len(associationQuery.AssociationValue) > 0 {
 		sqlQuery.Where("association_value = ?", string(associationQuery.AssociationValue))
 	} else if len(associationQuery.AssociationValuePrefix) > 0 {
-		sqlQuery.Where("association_value LIKE ?", string(associationQuery.AssociationValuePrefix)+"%")
+		sqlQuery.Where("association_value LIKE ?", _pgLikePrefixPattern(associationQuery.AssociationValuePrefix))
 	}
 	if associationQuery.Limit > 0 {
 		if associationQuery.LastSeenAssociationID != nil {
@@ -4519,6 +5177,14 @@ func _constructFilterPostAssociationsByAttributesQuery(
 	}
 }
 
+// _pgLikePrefixPattern returns a LIKE pattern matching every string that starts with prefix. LIKE
+// wildcards in the prefix are escaped so that e.g. a "_" only matches a literal underscore, the
+// same as the byte-prefix seek we do in badger.
+func _pgLikePrefixPattern(prefix []byte) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return escaper.Replace(string(prefix)) + "%"
+}
+
 func (postgres *Postgres) flushUserAssociations(tx *pg.Tx, view *UtxoView, blockHeight uint64) error {
 	var insertAssociations []*PGUserAssociation
 	var deleteAssociations []*PGUserAssociation
@@ -4580,3 +5246,619 @@ func (postgres *Postgres) flushPostAssociations(tx *pg.Tx, view *UtxoView, block
 	}
 	return nil
 }
+
+//
+// Proof of Stake
+//
+
+// PGMetadataRegisterAsValidator represents RegisterAsValidatorMetadata
+type PGMetadataRegisterAsValidator struct {
+	tableName struct{} `pg:"pg_metadata_register_as_validators"`
+
+	TransactionHash                     *BlockHash `pg:",pk,type:bytea"`
+	Domains                             []string   `pg:",array"`
+	DisableDelegatedStake               bool       `pg:",use_zero"`
+	DelegatedStakeCommissionBasisPoints uint64     `pg:",use_zero"`
+	VotingPublicKey                     []byte     `pg:",type:bytea"`
+	VotingAuthorization                 []byte     `pg:",type:bytea"`
+}
+
+// PGMetadataStake represents StakeMetadata
+type PGMetadataStake struct {
+	tableName struct{} `pg:"pg_metadata_stakes"`
+
+	TransactionHash    *BlockHash `pg:",pk,type:bytea"`
+	ValidatorPublicKey *PublicKey `pg:",type:bytea"`
+	RewardMethod       uint8      `pg:",use_zero"`
+	StakeAmountNanos   string     `pg:",use_zero"`
+}
+
+// PGMetadataUnstake represents UnstakeMetadata
+type PGMetadataUnstake struct {
+	tableName struct{} `pg:"pg_metadata_unstakes"`
+
+	TransactionHash    *BlockHash `pg:",pk,type:bytea"`
+	ValidatorPublicKey *PublicKey `pg:",type:bytea"`
+	UnstakeAmountNanos string     `pg:",use_zero"`
+}
+
+// PGMetadataUnlockStake represents UnlockStakeMetadata
+type PGMetadataUnlockStake struct {
+	tableName struct{} `pg:"pg_metadata_unlock_stakes"`
+
+	TransactionHash    *BlockHash `pg:",pk,type:bytea"`
+	ValidatorPublicKey *PublicKey `pg:",type:bytea"`
+	StartEpochNumber   uint64     `pg:",use_zero"`
+	EndEpochNumber     uint64     `pg:",use_zero"`
+}
+
+// PGValidatorEntry represents ValidatorEntry. The PoS tables mirror the badger state so that it can be queried from
+// postgres; the node itself always reads PoS entries from badger.
+type PGValidatorEntry struct {
+	tableName struct{} `pg:"pg_validators"`
+
+	ValidatorPKID                       *PKID    `pg:",pk,type:bytea"`
+	Domains                             []string `pg:",array"`
+	DisableDelegatedStake               bool     `pg:",use_zero"`
+	DelegatedStakeCommissionBasisPoints uint64   `pg:",use_zero"`
+	VotingPublicKey                     []byte   `pg:",type:bytea"`
+	VotingAuthorization                 []byte   `pg:",type:bytea"`
+	// TotalStakeAmountNanos is stored as a left-padded hex string so that
+	// validators can be sorted by stake in SQL.
+	TotalStakeAmountNanos   string `pg:",use_zero"`
+	LastActiveAtEpochNumber uint64 `pg:",use_zero"`
+	JailedAtEpochNumber     uint64 `pg:",use_zero"`
+	// Status is derived from JailedAtEpochNumber. We store it so that it can be
+	// used as a filter in queries.
+	Status    uint8 `pg:",use_zero"`
+	ExtraData map[string][]byte
+}
+
+// PGSnapshotValidatorEntry represents a ValidatorEntry in the SnapshotValidatorSet
+type PGSnapshotValidatorEntry struct {
+	tableName struct{} `pg:"pg_snapshot_validators"`
+
+	SnapshotAtEpochNumber               uint64   `pg:",pk,use_zero"`
+	ValidatorPKID                       *PKID    `pg:",pk,type:bytea"`
+	Domains                             []string `pg:",array"`
+	DisableDelegatedStake               bool     `pg:",use_zero"`
+	DelegatedStakeCommissionBasisPoints uint64   `pg:",use_zero"`
+	VotingPublicKey                     []byte   `pg:",type:bytea"`
+	VotingAuthorization                 []byte   `pg:",type:bytea"`
+	TotalStakeAmountNanos               string   `pg:",use_zero"`
+	LastActiveAtEpochNumber             uint64   `pg:",use_zero"`
+	JailedAtEpochNumber                 uint64   `pg:",use_zero"`
+	Status                              uint8    `pg:",use_zero"`
+	ExtraData                           map[string][]byte
+}
+
+// PGStakeEntry represents StakeEntry
+type PGStakeEntry struct {
+	tableName struct{} `pg:"pg_stakes"`
+
+	ValidatorPKID    *PKID  `pg:",pk,type:bytea"`
+	StakerPKID       *PKID  `pg:",pk,type:bytea"`
+	RewardMethod     uint8  `pg:",use_zero"`
+	StakeAmountNanos string `pg:",use_zero"`
+	ExtraData        map[string][]byte
+}
+
+// PGLockedStakeEntry represents LockedStakeEntry
+type PGLockedStakeEntry struct {
+	tableName struct{} `pg:"pg_locked_stakes"`
+
+	ValidatorPKID       *PKID  `pg:",pk,type:bytea"`
+	StakerPKID          *PKID  `pg:",pk,type:bytea"`
+	LockedAtEpochNumber uint64 `pg:",pk,use_zero"`
+	LockedAmountNanos   string `pg:",use_zero"`
+	ExtraData           map[string][]byte
+}
+
+// PGEpochEntry represents EpochEntry. Badger only stores the current epoch, but we
+// keep every epoch in Postgres so that the history can be queried.
+type PGEpochEntry struct {
+	tableName struct{} `pg:"pg_epochs"`
+
+	EpochNumber                     uint64 `pg:",pk,use_zero"`
+	InitialBlockHeight              uint64 `pg:",use_zero"`
+	InitialView                     uint64 `pg:",use_zero"`
+	FinalBlockHeight                uint64 `pg:",use_zero"`
+	InitialLeaderIndexOffset        uint64 `pg:",use_zero"`
+	CreatedAtBlockTimestampNanoSecs int64  `pg:",use_zero"`
+}
+
+func _blsPublicKeyToPGBytes(publicKey *bls.PublicKey) []byte {
+	if publicKey == nil {
+		return nil
+	}
+	return publicKey.ToBytes()
+}
+
+func _pgBytesToBLSPublicKey(publicKeyBytes []byte) *bls.PublicKey {
+	if len(publicKeyBytes) == 0 {
+		return nil
+	}
+	publicKey, _ := (&bls.PublicKey{}).FromBytes(publicKeyBytes)
+	return publicKey
+}
+
+func _pgBytesToBLSSignature(signatureBytes []byte) *bls.Signature {
+	if len(signatureBytes) == 0 {
+		return nil
+	}
+	signature, _ := (&bls.Signature{}).FromBytes(signatureBytes)
+	return signature
+}
+
+func _domainsToPGDomains(domains [][]byte) []string {
+	var pgDomains []string
+	for _, domain := range domains {
+		pgDomains = append(pgDomains, string(domain))
+	}
+	return pgDomains
+}
+
+func _pgDomainsToDomains(pgDomains []string) [][]byte {
+	var domains [][]byte
+	for _, domain := range pgDomains {
+		domains = append(domains, []byte(domain))
+	}
+	return domains
+}
+
+func (validator *PGValidatorEntry) FromValidatorEntry(validatorEntry *ValidatorEntry) *PGValidatorEntry {
+	validator.ValidatorPKID = validatorEntry.ValidatorPKID.NewPKID()
+	validator.Domains = _domainsToPGDomains(validatorEntry.Domains)
+	validator.DisableDelegatedStake = validatorEntry.DisableDelegatedStake
+	validator.DelegatedStakeCommissionBasisPoints = validatorEntry.DelegatedStakeCommissionBasisPoints
+	validator.VotingPublicKey = _blsPublicKeyToPGBytes(validatorEntry.VotingPublicKey)
+	validator.VotingAuthorization = validatorEntry.VotingAuthorization.ToBytes()
+	validator.TotalStakeAmountNanos = Uint256ToLeftPaddedHex(validatorEntry.TotalStakeAmountNanos)
+	validator.LastActiveAtEpochNumber = validatorEntry.LastActiveAtEpochNumber
+	validator.JailedAtEpochNumber = validatorEntry.JailedAtEpochNumber
+	validator.Status = uint8(validatorEntry.Status())
+	validator.ExtraData = validatorEntry.ExtraData
+	return validator
+}
+
+func (validator *PGValidatorEntry) ToValidatorEntry() *ValidatorEntry {
+	return &ValidatorEntry{
+		ValidatorPKID:                       validator.ValidatorPKID,
+		Domains:                             _pgDomainsToDomains(validator.Domains),
+		DisableDelegatedStake:               validator.DisableDelegatedStake,
+		DelegatedStakeCommissionBasisPoints: validator.DelegatedStakeCommissionBasisPoints,
+		VotingPublicKey:                     _pgBytesToBLSPublicKey(validator.VotingPublicKey),
+		VotingAuthorization:                 _pgBytesToBLSSignature(validator.VotingAuthorization),
+		TotalStakeAmountNanos:               LeftPaddedHexToUint256(validator.TotalStakeAmountNanos),
+		LastActiveAtEpochNumber:             validator.LastActiveAtEpochNumber,
+		JailedAtEpochNumber:                 validator.JailedAtEpochNumber,
+		ExtraData:                           validator.ExtraData,
+	}
+}
+
+func (validator *PGSnapshotValidatorEntry) FromValidatorEntry(
+	validatorEntry *ValidatorEntry, snapshotAtEpochNumber uint64,
+) *PGSnapshotValidatorEntry {
+	validator.SnapshotAtEpochNumber = snapshotAtEpochNumber
+	validator.ValidatorPKID = validatorEntry.ValidatorPKID.NewPKID()
+	validator.Domains = _domainsToPGDomains(validatorEntry.Domains)
+	validator.DisableDelegatedStake = validatorEntry.DisableDelegatedStake
+	validator.DelegatedStakeCommissionBasisPoints = validatorEntry.DelegatedStakeCommissionBasisPoints
+	validator.VotingPublicKey = _blsPublicKeyToPGBytes(validatorEntry.VotingPublicKey)
+	validator.VotingAuthorization = validatorEntry.VotingAuthorization.ToBytes()
+	validator.TotalStakeAmountNanos = Uint256ToLeftPaddedHex(validatorEntry.TotalStakeAmountNanos)
+	validator.LastActiveAtEpochNumber = validatorEntry.LastActiveAtEpochNumber
+	validator.JailedAtEpochNumber = validatorEntry.JailedAtEpochNumber
+	validator.Status = uint8(validatorEntry.Status())
+	validator.ExtraData = validatorEntry.ExtraData
+	return validator
+}
+
+func (validator *PGSnapshotValidatorEntry) ToValidatorEntry() *ValidatorEntry {
+	return &ValidatorEntry{
+		ValidatorPKID:                       validator.ValidatorPKID,
+		Domains:                             _pgDomainsToDomains(validator.Domains),
+		DisableDelegatedStake:               validator.DisableDelegatedStake,
+		DelegatedStakeCommissionBasisPoints: validator.DelegatedStakeCommissionBasisPoints,
+		VotingPublicKey:                     _pgBytesToBLSPublicKey(validator.VotingPublicKey),
+		VotingAuthorization:                 _pgBytesToBLSSignature(validator.VotingAuthorization),
+		TotalStakeAmountNanos:               LeftPaddedHexToUint256(validator.TotalStakeAmountNanos),
+		LastActiveAtEpochNumber:             validator.LastActiveAtEpochNumber,
+		JailedAtEpochNumber:                 validator.JailedAtEpochNumber,
+		ExtraData:                           validator.ExtraData,
+	}
+}
+
+func (stake *PGStakeEntry) FromStakeEntry(stakeEntry *StakeEntry) *PGStakeEntry {
+	stake.ValidatorPKID = stakeEntry.ValidatorPKID.NewPKID()
+	stake.StakerPKID = stakeEntry.StakerPKID.NewPKID()
+	stake.RewardMethod = stakeEntry.RewardMethod
+	stake.StakeAmountNanos = Uint256ToLeftPaddedHex(stakeEntry.StakeAmountNanos)
+	stake.ExtraData = stakeEntry.ExtraData
+	return stake
+}
+
+func (stake *PGStakeEntry) ToStakeEntry() *StakeEntry {
+	return &StakeEntry{
+		ValidatorPKID:    stake.ValidatorPKID,
+		StakerPKID:       stake.StakerPKID,
+		RewardMethod:     stake.RewardMethod,
+		StakeAmountNanos: LeftPaddedHexToUint256(stake.StakeAmountNanos),
+		ExtraData:        stake.ExtraData,
+	}
+}
+
+func (lockedStake *PGLockedStakeEntry) FromLockedStakeEntry(lockedStakeEntry *LockedStakeEntry) *PGLockedStakeEntry {
+	lockedStake.ValidatorPKID = lockedStakeEntry.ValidatorPKID.NewPKID()
+	lockedStake.StakerPKID = lockedStakeEntry.StakerPKID.NewPKID()
+	lockedStake.LockedAtEpochNumber = lockedStakeEntry.LockedAtEpochNumber
+	lockedStake.LockedAmountNanos = Uint256ToLeftPaddedHex(lockedStakeEntry.LockedAmountNanos)
+	lockedStake.ExtraData = lockedStakeEntry.ExtraData
+	return lockedStake
+}
+
+func (lockedStake *PGLockedStakeEntry) ToLockedStakeEntry() *LockedStakeEntry {
+	return &LockedStakeEntry{
+		ValidatorPKID:       lockedStake.ValidatorPKID,
+		StakerPKID:          lockedStake.StakerPKID,
+		LockedAtEpochNumber: lockedStake.LockedAtEpochNumber,
+		LockedAmountNanos:   LeftPaddedHexToUint256(lockedStake.LockedAmountNanos),
+		ExtraData:           lockedStake.ExtraData,
+	}
+}
+
+func (epoch *PGEpochEntry) FromEpochEntry(epochEntry *EpochEntry) *PGEpochEntry {
+	epoch.EpochNumber = epochEntry.EpochNumber
+	epoch.InitialBlockHeight = epochEntry.InitialBlockHeight
+	epoch.InitialView = epochEntry.InitialView
+	epoch.FinalBlockHeight = epochEntry.FinalBlockHeight
+	epoch.InitialLeaderIndexOffset = epochEntry.InitialLeaderIndexOffset
+	epoch.CreatedAtBlockTimestampNanoSecs = epochEntry.CreatedAtBlockTimestampNanoSecs
+	return epoch
+}
+
+func (epoch *PGEpochEntry) ToEpochEntry() *EpochEntry {
+	return &EpochEntry{
+		EpochNumber:                     epoch.EpochNumber,
+		InitialBlockHeight:              epoch.InitialBlockHeight,
+		InitialView:                     epoch.InitialView,
+		FinalBlockHeight:                epoch.FinalBlockHeight,
+		InitialLeaderIndexOffset:        epoch.InitialLeaderIndexOffset,
+		CreatedAtBlockTimestampNanoSecs: epoch.CreatedAtBlockTimestampNanoSecs,
+	}
+}
+
+func (postgres *Postgres) flushValidatorEntries(tx *pg.Tx, view *UtxoView) error {
+	var insertValidators []*PGValidatorEntry
+	var deleteValidators []*PGValidatorEntry
+
+	for _, validatorEntry := range view.ValidatorPKIDToValidatorEntry {
+		if validatorEntry == nil {
+			continue
+		}
+
+		pgValidator := (&PGValidatorEntry{}).FromValidatorEntry(validatorEntry)
+		if validatorEntry.isDeleted {
+			deleteValidators = append(deleteValidators, pgValidator)
+		} else {
+			insertValidators = append(insertValidators, pgValidator)
+		}
+	}
+
+	if len(insertValidators) > 0 {
+		_, err := tx.Model(&insertValidators).WherePK().OnConflict("(validator_pkid) DO UPDATE").Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushValidatorEntries: insert: %v", err)
+		}
+	}
+
+	if len(deleteValidators) > 0 {
+		_, err := tx.Model(&deleteValidators).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushValidatorEntries: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushSnapshotValidatorSet(tx *pg.Tx, view *UtxoView) error {
+	var insertValidators []*PGSnapshotValidatorEntry
+	var deleteValidators []*PGSnapshotValidatorEntry
+
+	for mapKey, validatorEntry := range view.SnapshotValidatorSet {
+		if validatorEntry == nil {
+			continue
+		}
+
+		pgValidator := (&PGSnapshotValidatorEntry{}).FromValidatorEntry(validatorEntry, mapKey.SnapshotAtEpochNumber)
+		if validatorEntry.isDeleted {
+			deleteValidators = append(deleteValidators, pgValidator)
+		} else {
+			insertValidators = append(insertValidators, pgValidator)
+		}
+	}
+
+	if len(insertValidators) > 0 {
+		_, err := tx.Model(&insertValidators).WherePK().
+			OnConflict("(snapshot_at_epoch_number, validator_pkid) DO UPDATE").Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushSnapshotValidatorSet: insert: %v", err)
+		}
+	}
+
+	if len(deleteValidators) > 0 {
+		_, err := tx.Model(&deleteValidators).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushSnapshotValidatorSet: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushStakeEntries(tx *pg.Tx, view *UtxoView) error {
+	var insertStakes []*PGStakeEntry
+	var deleteStakes []*PGStakeEntry
+
+	for _, stakeEntry := range view.StakeMapKeyToStakeEntry {
+		if stakeEntry == nil {
+			continue
+		}
+
+		pgStake := (&PGStakeEntry{}).FromStakeEntry(stakeEntry)
+		if stakeEntry.isDeleted {
+			deleteStakes = append(deleteStakes, pgStake)
+		} else {
+			insertStakes = append(insertStakes, pgStake)
+		}
+	}
+
+	if len(insertStakes) > 0 {
+		_, err := tx.Model(&insertStakes).WherePK().OnConflict("(validator_pkid, staker_pkid) DO UPDATE").Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushStakeEntries: insert: %v", err)
+		}
+	}
+
+	if len(deleteStakes) > 0 {
+		_, err := tx.Model(&deleteStakes).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushStakeEntries: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushLockedStakeEntries(tx *pg.Tx, view *UtxoView) error {
+	var insertLockedStakes []*PGLockedStakeEntry
+	var deleteLockedStakes []*PGLockedStakeEntry
+
+	for _, lockedStakeEntry := range view.LockedStakeMapKeyToLockedStakeEntry {
+		if lockedStakeEntry == nil {
+			continue
+		}
+
+		pgLockedStake := (&PGLockedStakeEntry{}).FromLockedStakeEntry(lockedStakeEntry)
+		if lockedStakeEntry.isDeleted {
+			deleteLockedStakes = append(deleteLockedStakes, pgLockedStake)
+		} else {
+			insertLockedStakes = append(insertLockedStakes, pgLockedStake)
+		}
+	}
+
+	if len(insertLockedStakes) > 0 {
+		_, err := tx.Model(&insertLockedStakes).WherePK().
+			OnConflict("(validator_pkid, staker_pkid, locked_at_epoch_number) DO UPDATE").Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushLockedStakeEntries: insert: %v", err)
+		}
+	}
+
+	if len(deleteLockedStakes) > 0 {
+		_, err := tx.Model(&deleteLockedStakes).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushLockedStakeEntries: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushCurrentEpochEntry(tx *pg.Tx, view *UtxoView) error {
+	// The CurrentEpochEntry is nil if the view never touched it, in which case
+	// there is nothing to write.
+	if view.CurrentEpochEntry == nil {
+		return nil
+	}
+
+	pgEpoch := (&PGEpochEntry{}).FromEpochEntry(view.CurrentEpochEntry)
+	_, err := tx.Model(pgEpoch).WherePK().OnConflict("(epoch_number) DO UPDATE").Returning("NULL").Insert()
+	if err != nil {
+		return fmt.Errorf("flushCurrentEpochEntry: insert: %v", err)
+	}
+
+	return nil
+}
+
+//
+// Lockups
+//
+
+// PGMetadataCoinLockup represents CoinLockupMetadata
+type PGMetadataCoinLockup struct {
+	tableName struct{} `pg:"pg_metadata_coin_lockups"`
+
+	TransactionHash             *BlockHash `pg:",pk,type:bytea"`
+	ProfilePublicKey            *PublicKey `pg:",type:bytea"`
+	RecipientPublicKey          *PublicKey `pg:",type:bytea"`
+	UnlockTimestampNanoSecs     int64      `pg:",use_zero"`
+	VestingEndTimestampNanoSecs int64      `pg:",use_zero"`
+	LockupAmountBaseUnits       string     `pg:",use_zero"`
+}
+
+// PGMetadataUpdateCoinLockupParams represents UpdateCoinLockupParamsMetadata
+type PGMetadataUpdateCoinLockupParams struct {
+	tableName struct{} `pg:"pg_metadata_update_coin_lockup_params"`
+
+	TransactionHash                 *BlockHash                `pg:",pk,type:bytea"`
+	LockupYieldDurationNanoSecs     int64                     `pg:",use_zero"`
+	LockupYieldAPYBasisPoints       uint64                    `pg:"lockup_yield_apy_basis_points,use_zero"`
+	RemoveYieldCurvePoint           bool                      `pg:",use_zero"`
+	NewLockupTransferRestrictions   bool                      `pg:",use_zero"`
+	LockupTransferRestrictionStatus TransferRestrictionStatus `pg:",use_zero"`
+}
+
+// PGMetadataCoinLockupTransfer represents CoinLockupTransferMetadata
+type PGMetadataCoinLockupTransfer struct {
+	tableName struct{} `pg:"pg_metadata_coin_lockup_transfers"`
+
+	TransactionHash                *BlockHash `pg:",pk,type:bytea"`
+	RecipientPublicKey             *PublicKey `pg:",type:bytea"`
+	ProfilePublicKey               *PublicKey `pg:",type:bytea"`
+	UnlockTimestampNanoSecs        int64      `pg:",use_zero"`
+	LockedCoinsToTransferBaseUnits string     `pg:",use_zero"`
+}
+
+// PGMetadataCoinUnlock represents CoinUnlockMetadata
+type PGMetadataCoinUnlock struct {
+	tableName struct{} `pg:"pg_metadata_coin_unlocks"`
+
+	TransactionHash  *BlockHash `pg:",pk,type:bytea"`
+	ProfilePublicKey *PublicKey `pg:",type:bytea"`
+}
+
+// PGLockedBalanceEntry represents LockedBalanceEntry
+type PGLockedBalanceEntry struct {
+	tableName struct{} `pg:"pg_locked_balance_entries"`
+
+	HolderPKID                  *PKID `pg:",pk,type:bytea"`
+	ProfilePKID                 *PKID `pg:",pk,type:bytea"`
+	UnlockTimestampNanoSecs     int64 `pg:",pk,use_zero"`
+	VestingEndTimestampNanoSecs int64 `pg:",pk,use_zero"`
+	// BalanceBaseUnits is stored as a left-padded hex string so that balances
+	// can be sorted in SQL.
+	BalanceBaseUnits string `pg:",use_zero"`
+}
+
+// PGLockupYieldCurvePoint represents LockupYieldCurvePoint
+type PGLockupYieldCurvePoint struct {
+	tableName struct{} `pg:"pg_lockup_yield_curve_points"`
+
+	ProfilePKID               *PKID  `pg:",pk,type:bytea"`
+	LockupDurationNanoSecs    int64  `pg:",pk,use_zero"`
+	LockupYieldAPYBasisPoints uint64 `pg:"lockup_yield_apy_basis_points,use_zero"`
+}
+
+func (lockedBalance *PGLockedBalanceEntry) FromLockedBalanceEntry(
+	lockedBalanceEntry *LockedBalanceEntry,
+) *PGLockedBalanceEntry {
+	lockedBalance.HolderPKID = lockedBalanceEntry.HODLerPKID.NewPKID()
+	lockedBalance.ProfilePKID = lockedBalanceEntry.ProfilePKID.NewPKID()
+	lockedBalance.UnlockTimestampNanoSecs = lockedBalanceEntry.UnlockTimestampNanoSecs
+	lockedBalance.VestingEndTimestampNanoSecs = lockedBalanceEntry.VestingEndTimestampNanoSecs
+	lockedBalance.BalanceBaseUnits = Uint256ToLeftPaddedHex(&lockedBalanceEntry.BalanceBaseUnits)
+	return lockedBalance
+}
+
+func (lockedBalance *PGLockedBalanceEntry) ToLockedBalanceEntry() *LockedBalanceEntry {
+	return &LockedBalanceEntry{
+		HODLerPKID:                  lockedBalance.HolderPKID,
+		ProfilePKID:                 lockedBalance.ProfilePKID,
+		UnlockTimestampNanoSecs:     lockedBalance.UnlockTimestampNanoSecs,
+		VestingEndTimestampNanoSecs: lockedBalance.VestingEndTimestampNanoSecs,
+		BalanceBaseUnits:            *LeftPaddedHexToUint256(lockedBalance.BalanceBaseUnits),
+	}
+}
+
+func (yieldCurvePoint *PGLockupYieldCurvePoint) FromLockupYieldCurvePoint(
+	lockupYieldCurvePoint *LockupYieldCurvePoint,
+) *PGLockupYieldCurvePoint {
+	yieldCurvePoint.ProfilePKID = lockupYieldCurvePoint.ProfilePKID.NewPKID()
+	yieldCurvePoint.LockupDurationNanoSecs = lockupYieldCurvePoint.LockupDurationNanoSecs
+	yieldCurvePoint.LockupYieldAPYBasisPoints = lockupYieldCurvePoint.LockupYieldAPYBasisPoints
+	return yieldCurvePoint
+}
+
+func (yieldCurvePoint *PGLockupYieldCurvePoint) ToLockupYieldCurvePoint() *LockupYieldCurvePoint {
+	return &LockupYieldCurvePoint{
+		ProfilePKID:               yieldCurvePoint.ProfilePKID,
+		LockupDurationNanoSecs:    yieldCurvePoint.LockupDurationNanoSecs,
+		LockupYieldAPYBasisPoints: yieldCurvePoint.LockupYieldAPYBasisPoints,
+	}
+}
+
+func (postgres *Postgres) flushLockedBalanceEntries(tx *pg.Tx, view *UtxoView) error {
+	var insertLockedBalances []*PGLockedBalanceEntry
+	var deleteLockedBalances []*PGLockedBalanceEntry
+
+	for _, lockedBalanceEntry := range view.LockedBalanceEntryKeyToLockedBalanceEntry {
+		if lockedBalanceEntry == nil {
+			continue
+		}
+
+		pgLockedBalance := (&PGLockedBalanceEntry{}).FromLockedBalanceEntry(lockedBalanceEntry)
+		// Zero balance entries are never stored in badger, so we treat them as deleted here as well.
+		if lockedBalanceEntry.isDeleted || lockedBalanceEntry.BalanceBaseUnits.IsZero() {
+			deleteLockedBalances = append(deleteLockedBalances, pgLockedBalance)
+		} else {
+			insertLockedBalances = append(insertLockedBalances, pgLockedBalance)
+		}
+	}
+
+	if len(insertLockedBalances) > 0 {
+		_, err := tx.Model(&insertLockedBalances).WherePK().OnConflict(
+			"(holder_pkid, profile_pkid, unlock_timestamp_nano_secs, vesting_end_timestamp_nano_secs) DO UPDATE",
+		).Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushLockedBalanceEntries: insert: %v", err)
+		}
+	}
+
+	if len(deleteLockedBalances) > 0 {
+		_, err := tx.Model(&deleteLockedBalances).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushLockedBalanceEntries: delete: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (postgres *Postgres) flushLockupYieldCurvePoints(tx *pg.Tx, view *UtxoView) error {
+	var insertYieldCurvePoints []*PGLockupYieldCurvePoint
+	var deleteYieldCurvePoints []*PGLockupYieldCurvePoint
+
+	for _, lockupYieldCurvePoints := range view.PKIDToLockupYieldCurvePointKeyToLockupYieldCurvePoints {
+		for _, lockupYieldCurvePoint := range lockupYieldCurvePoints {
+			if lockupYieldCurvePoint == nil {
+				continue
+			}
+
+			pgYieldCurvePoint := (&PGLockupYieldCurvePoint{}).FromLockupYieldCurvePoint(lockupYieldCurvePoint)
+			if lockupYieldCurvePoint.isDeleted {
+				deleteYieldCurvePoints = append(deleteYieldCurvePoints, pgYieldCurvePoint)
+			} else {
+				insertYieldCurvePoints = append(insertYieldCurvePoints, pgYieldCurvePoint)
+			}
+		}
+	}
+
+	if len(insertYieldCurvePoints) > 0 {
+		_, err := tx.Model(&insertYieldCurvePoints).WherePK().
+			OnConflict("(profile_pkid, lockup_duration_nano_secs) DO UPDATE").Returning("NULL").Insert()
+		if err != nil {
+			return fmt.Errorf("flushLockupYieldCurvePoints: insert: %v", err)
+		}
+	}
+
+	if len(deleteYieldCurvePoints) > 0 {
+		_, err := tx.Model(&deleteYieldCurvePoints).Returning("NULL").Delete()
+		if err != nil {
+			return fmt.Errorf("flushLockupYieldCurvePoints: delete: %v", err)
+		}
+	}
+
+	return nil
+}
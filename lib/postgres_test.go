@@ -1,8 +1,11 @@
 package lib
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/deso-protocol/core/bls"
 	"github.com/deso-protocol/core/migrate"
+	"github.com/deso-protocol/uint256"
 	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
 	"github.com/go-pg/pg/v10"
 	"github.com/golang/glog"
@@ -10,6 +13,8 @@ import (
 	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	"math"
+	"os"
 	"testing"
 )
 
@@ -33,6 +38,140 @@ func TestParsePostgresURI(t *testing.T) {
 	require.Equal(pgOptions.Password, "testPassword")
 }
 
+func TestPGValidatorAndStakeEntryConversion(t *testing.T) {
+	require := require.New(t)
+
+	validatorPKID := NewPKID([]byte{1, 2, 3})
+	stakerPKID := NewPKID([]byte{4, 5, 6})
+	votingPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	votingAuthorization, err := votingPrivateKey.Sign([]byte("authorization"))
+	require.NoError(err)
+
+	validatorEntry := &ValidatorEntry{
+		ValidatorPKID:                       validatorPKID,
+		Domains:                             [][]byte{[]byte("example.com:18000")},
+		DisableDelegatedStake:               true,
+		DelegatedStakeCommissionBasisPoints: 100,
+		VotingPublicKey:                     votingPrivateKey.PublicKey(),
+		VotingAuthorization:                 votingAuthorization,
+		TotalStakeAmountNanos:               uint256.NewInt(12345),
+		LastActiveAtEpochNumber:             7,
+		JailedAtEpochNumber:                 3,
+		ExtraData:                           map[string][]byte{"key": []byte("value")},
+	}
+	pgValidator := (&PGValidatorEntry{}).FromValidatorEntry(validatorEntry)
+	require.Equal(pgValidator.Status, uint8(ValidatorStatusJailed))
+	validatorEntryFromPG := pgValidator.ToValidatorEntry()
+	require.True(validatorEntryFromPG.ValidatorPKID.Eq(validatorPKID))
+	require.Equal(validatorEntryFromPG.Domains, validatorEntry.Domains)
+	require.True(validatorEntryFromPG.DisableDelegatedStake)
+	require.Equal(validatorEntryFromPG.DelegatedStakeCommissionBasisPoints, uint64(100))
+	require.True(validatorEntryFromPG.VotingPublicKey.Eq(validatorEntry.VotingPublicKey))
+	require.True(validatorEntryFromPG.VotingAuthorization.Eq(validatorEntry.VotingAuthorization))
+	require.Equal(validatorEntryFromPG.TotalStakeAmountNanos, uint256.NewInt(12345))
+	require.Equal(validatorEntryFromPG.LastActiveAtEpochNumber, uint64(7))
+	require.Equal(validatorEntryFromPG.JailedAtEpochNumber, uint64(3))
+	require.Equal(validatorEntryFromPG.ExtraData, validatorEntry.ExtraData)
+
+	stakeEntry := &StakeEntry{
+		StakerPKID:       stakerPKID,
+		ValidatorPKID:    validatorPKID,
+		RewardMethod:     StakingRewardMethodRestake,
+		StakeAmountNanos: uint256.NewInt(500),
+	}
+	stakeEntryFromPG := (&PGStakeEntry{}).FromStakeEntry(stakeEntry).ToStakeEntry()
+	require.True(stakeEntryFromPG.StakerPKID.Eq(stakerPKID))
+	require.True(stakeEntryFromPG.ValidatorPKID.Eq(validatorPKID))
+	require.Equal(stakeEntryFromPG.RewardMethod, StakingRewardMethodRestake)
+	require.Equal(stakeEntryFromPG.StakeAmountNanos, uint256.NewInt(500))
+
+	lockedStakeEntry := &LockedStakeEntry{
+		StakerPKID:          stakerPKID,
+		ValidatorPKID:       validatorPKID,
+		LockedAmountNanos:   uint256.NewInt(250),
+		LockedAtEpochNumber: 5,
+	}
+	lockedStakeEntryFromPG := (&PGLockedStakeEntry{}).FromLockedStakeEntry(lockedStakeEntry).ToLockedStakeEntry()
+	require.True(lockedStakeEntryFromPG.StakerPKID.Eq(stakerPKID))
+	require.True(lockedStakeEntryFromPG.ValidatorPKID.Eq(validatorPKID))
+	require.Equal(lockedStakeEntryFromPG.LockedAmountNanos, uint256.NewInt(250))
+	require.Equal(lockedStakeEntryFromPG.LockedAtEpochNumber, uint64(5))
+
+	epochEntry := &EpochEntry{
+		EpochNumber:                     2,
+		InitialBlockHeight:              100,
+		InitialView:                     101,
+		FinalBlockHeight:                199,
+		InitialLeaderIndexOffset:        4,
+		CreatedAtBlockTimestampNanoSecs: 1700000000000000000,
+	}
+	require.Equal((&PGEpochEntry{}).FromEpochEntry(epochEntry).ToEpochEntry(), epochEntry)
+}
+
+func TestPGLockupEntryConversion(t *testing.T) {
+	require := require.New(t)
+
+	hodlerPKID := NewPKID([]byte{1, 2, 3})
+	profilePKID := NewPKID([]byte{4, 5, 6})
+
+	lockedBalanceEntry := &LockedBalanceEntry{
+		HODLerPKID:                  hodlerPKID,
+		ProfilePKID:                 profilePKID,
+		UnlockTimestampNanoSecs:     1000,
+		VestingEndTimestampNanoSecs: 2000,
+		BalanceBaseUnits:            *uint256.NewInt(1e18),
+	}
+	lockedBalanceEntryFromPG := (&PGLockedBalanceEntry{}).FromLockedBalanceEntry(lockedBalanceEntry).
+		ToLockedBalanceEntry()
+	require.True(lockedBalanceEntryFromPG.HODLerPKID.Eq(hodlerPKID))
+	require.True(lockedBalanceEntryFromPG.ProfilePKID.Eq(profilePKID))
+	require.Equal(lockedBalanceEntryFromPG.UnlockTimestampNanoSecs, int64(1000))
+	require.Equal(lockedBalanceEntryFromPG.VestingEndTimestampNanoSecs, int64(2000))
+	require.Equal(lockedBalanceEntryFromPG.BalanceBaseUnits, *uint256.NewInt(1e18))
+	require.Equal(lockedBalanceEntryFromPG.ToMapKey(), lockedBalanceEntry.ToMapKey())
+
+	lockupYieldCurvePoint := &LockupYieldCurvePoint{
+		ProfilePKID:               profilePKID,
+		LockupDurationNanoSecs:    365 * 24 * 60 * 60 * 1e9,
+		LockupYieldAPYBasisPoints: 500,
+	}
+	lockupYieldCurvePointFromPG := (&PGLockupYieldCurvePoint{}).FromLockupYieldCurvePoint(lockupYieldCurvePoint).
+		ToLockupYieldCurvePoint()
+	require.True(lockupYieldCurvePointFromPG.Eq(lockupYieldCurvePoint))
+	require.Equal(lockupYieldCurvePointFromPG.LockupYieldAPYBasisPoints, uint64(500))
+}
+
+func TestPGLikePrefixPattern(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(_pgLikePrefixPattern([]byte("endorsement")), "endorsement%")
+	require.Equal(_pgLikePrefixPattern([]byte("")), "%")
+	// LIKE wildcards and the escape character are matched literally.
+	require.Equal(_pgLikePrefixPattern([]byte("100%_")), `100\%\_%`)
+	require.Equal(_pgLikePrefixPattern([]byte(`a\b`)), `a\\b%`)
+}
+
+func TestFlattenAtomicTxnsForPostgres(t *testing.T) {
+	require := require.New(t)
+
+	newBasicTransfer := func(feeNanos uint64) *MsgDeSoTxn {
+		return &MsgDeSoTxn{TxnMeta: &BasicTransferMetadata{}, TxnFeeNanos: feeNanos}
+	}
+	innerTxn0 := newBasicTransfer(1)
+	innerTxn1 := newBasicTransfer(2)
+	wrapperTxn := &MsgDeSoTxn{TxnMeta: &AtomicTxnsWrapperMetadata{Txns: []*MsgDeSoTxn{innerTxn0, innerTxn1}}}
+	blockRewardTxn := &MsgDeSoTxn{TxnMeta: &BlockRewardMetadataa{}}
+	lastTxn := newBasicTransfer(3)
+
+	// The inner transactions of atomic wrappers are inserted right after their wrapper, in order.
+	require.Equal(
+		[]*MsgDeSoTxn{blockRewardTxn, wrapperTxn, innerTxn0, innerTxn1, lastTxn},
+		_flattenAtomicTxnsForPostgres([]*MsgDeSoTxn{blockRewardTxn, wrapperTxn, lastTxn}),
+	)
+	require.Empty(_flattenAtomicTxnsForPostgres(nil))
+}
+
 func TestEmbedPg(t *testing.T) {
 	require := require.New(t)
 	return
@@ -114,3 +253,314 @@ func ResetPostgres(postgres *Postgres) error {
 	}
 	return nil
 }
+
+// TestDecodeSnapshotChunkForPostgres flushes one entry of each state prefix that Postgres stores to badger, reads the
+// prefixes back the way hypersync does, and checks that decoding the chunk yields the same entries.
+func TestDecodeSnapshotChunkForPostgres(t *testing.T) {
+	require := require.New(t)
+	db, dir := GetTestBadgerDb()
+	defer os.RemoveAll(dir)
+	defer db.Close()
+	blockHeight := uint64(math.MaxUint32)
+
+	m0PKID := NewPKID(m0PkBytes)
+	m1PKID := NewPKID(m1PkBytes)
+	m0PublicKey := NewPublicKey(m0PkBytes)
+	m1PublicKey := NewPublicKey(m1PkBytes)
+	m2PublicKey := NewPublicKey(m2PkBytes)
+	postHash := NewBlockHash(bytes.Repeat([]byte{0x01}, HashSizeBytes))
+	groupKeyName := NewGroupKeyName([]byte("group"))
+	extraData := map[string][]byte{"key": []byte("value")}
+
+	view := NewUtxoView(db, &DeSoTestnetParams, nil, nil, nil)
+
+	utxoEntry := &UtxoEntry{
+		AmountNanos: 100,
+		PublicKey:   m0PkBytes,
+		BlockHeight: 10,
+		UtxoType:    UtxoTypeOutput,
+		UtxoKey:     &UtxoKey{TxID: *postHash, Index: 1},
+	}
+	require.NoError(view._setUtxoMappings(utxoEntry))
+	view.PublicKeyToDeSoBalanceNanos[*m0PublicKey] = 200
+	profileEntry := &ProfileEntry{
+		PublicKey:   m0PkBytes,
+		Username:    []byte("m0"),
+		Description: []byte("description"),
+		ExtraData:   extraData,
+	}
+	profileEntry.CreatorCoinEntry.CoinsInCirculationNanos = *uint256.NewInt(300)
+	profileEntry.DAOCoinEntry.CoinsInCirculationNanos = *uint256.NewInt(400)
+	view._setProfileEntryMappings(profileEntry)
+	// PKIDs that match their public key aren't stored, so we use one that was swapped.
+	swappedPKID := NewPKID(m3PkBytes)
+	view._setPKIDMappings(&PKIDEntry{PKID: swappedPKID, PublicKey: m1PkBytes})
+	postEntry := &PostEntry{PostHash: postHash, PosterPublicKey: m0PkBytes, Body: []byte("body")}
+	view._setPostEntryMappings(postEntry)
+	likeEntry := &LikeEntry{LikerPubKey: m1PkBytes, LikedPostHash: postHash}
+	view._setLikeEntryMappings(likeEntry)
+	followEntry := &FollowEntry{FollowerPKID: m1PKID, FollowedPKID: m0PKID}
+	view._setFollowEntryMappings(followEntry)
+	diamondEntry := &DiamondEntry{SenderPKID: m1PKID, ReceiverPKID: m0PKID, DiamondPostHash: postHash, DiamondLevel: 2}
+	view._setDiamondEntryMappings(diamondEntry)
+	creatorCoinBalanceEntry := &BalanceEntry{
+		HODLerPKID: m1PKID, CreatorPKID: m0PKID, BalanceNanos: *uint256.NewInt(500), HasPurchased: true}
+	view._setBalanceEntryMappings(creatorCoinBalanceEntry, false)
+	daoCoinBalanceEntry := &BalanceEntry{HODLerPKID: m0PKID, CreatorPKID: m1PKID, BalanceNanos: *uint256.NewInt(600)}
+	view._setBalanceEntryMappings(daoCoinBalanceEntry, true)
+	view.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(m2PkBytes)] = &ForbiddenPubKeyEntry{PubKey: m2PkBytes}
+	nftEntry := &NFTEntry{
+		OwnerPKID: m0PKID, NFTPostHash: postHash, SerialNumber: 1, IsForSale: true, MinBidAmountNanos: 10,
+		ExtraData: extraData}
+	view._setNFTEntryMappings(nftEntry)
+	nftBidEntry := &NFTBidEntry{BidderPKID: m1PKID, NFTPostHash: postHash, SerialNumber: 1, BidAmountNanos: 20}
+	view._setNFTBidEntryMappings(nftBidEntry)
+	derivedKeyEntry := &DerivedKeyEntry{
+		OwnerPublicKey:   *m0PublicKey,
+		DerivedPublicKey: *m1PublicKey,
+		ExpirationBlock:  1000,
+		OperationType:    AuthorizeDerivedKeyOperationValid,
+		ExtraData:        extraData,
+		TransactionSpendingLimitTracker: &TransactionSpendingLimit{
+			GlobalDESOLimit:          10,
+			TransactionCountLimitMap: map[TxnType]uint64{TxnTypeSubmitPost: 5},
+		},
+		Memo: []byte("memo"),
+	}
+	view._setDerivedKeyMapping(derivedKeyEntry)
+	accessGroupEntry := &AccessGroupEntry{
+		AccessGroupOwnerPublicKey: m0PublicKey,
+		AccessGroupKeyName:        groupKeyName,
+		AccessGroupPublicKey:      m2PublicKey,
+		ExtraData:                 extraData,
+	}
+	require.NoError(view._setAccessGroupIdToAccessGroupEntryMapping(accessGroupEntry))
+	accessGroupMemberEntry := &AccessGroupMemberEntry{
+		AccessGroupMemberPublicKey: m1PublicKey,
+		AccessGroupMemberKeyName:   BaseGroupKeyName(),
+		EncryptedKey:               []byte{0x02},
+	}
+	require.NoError(view._setAccessGroupMembershipKeyToAccessGroupMemberMapping(
+		accessGroupMemberEntry, m0PublicKey, groupKeyName))
+	dmMessageEntry := &NewMessageEntry{
+		SenderAccessGroupOwnerPublicKey:    m0PublicKey,
+		SenderAccessGroupKeyName:           BaseGroupKeyName(),
+		SenderAccessGroupPublicKey:         m0PublicKey,
+		RecipientAccessGroupOwnerPublicKey: m1PublicKey,
+		RecipientAccessGroupKeyName:        BaseGroupKeyName(),
+		RecipientAccessGroupPublicKey:      m1PublicKey,
+		EncryptedText:                      []byte("dm"),
+		TimestampNanos:                     1,
+		ExtraData:                          extraData,
+	}
+	dmMessageKey := MakeDmMessageKeyForSenderRecipient(*m0PublicKey, *BaseGroupKeyName(), *m1PublicKey,
+		*BaseGroupKeyName(), dmMessageEntry.TimestampNanos)
+	view.DmMessagesIndex[dmMessageKey] = dmMessageEntry
+	dmThreadKey := MakeDmThreadKey(*m0PublicKey, *BaseGroupKeyName(), *m1PublicKey, *BaseGroupKeyName())
+	dmThreadEntry := MakeDmThreadEntry()
+	view.DmThreadIndex[dmThreadKey] = &dmThreadEntry
+	groupChatMessageEntry := &NewMessageEntry{
+		SenderAccessGroupOwnerPublicKey:    m1PublicKey,
+		SenderAccessGroupKeyName:           BaseGroupKeyName(),
+		SenderAccessGroupPublicKey:         m1PublicKey,
+		RecipientAccessGroupOwnerPublicKey: m0PublicKey,
+		RecipientAccessGroupKeyName:        groupKeyName,
+		RecipientAccessGroupPublicKey:      m2PublicKey,
+		EncryptedText:                      []byte("group chat"),
+		TimestampNanos:                     2,
+	}
+	groupChatMessageKey := MakeGroupChatMessageKey(*m0PublicKey, *groupKeyName, groupChatMessageEntry.TimestampNanos)
+	view.GroupChatMessagesIndex[groupChatMessageKey] = groupChatMessageEntry
+	userAssociationEntry := &UserAssociationEntry{
+		AssociationID:    NewBlockHash(bytes.Repeat([]byte{0x02}, HashSizeBytes)),
+		TransactorPKID:   m0PKID,
+		TargetUserPKID:   m1PKID,
+		AppPKID:          m1PKID,
+		AssociationType:  []byte("endorsement"),
+		AssociationValue: []byte("golang"),
+		ExtraData:        extraData,
+		BlockHeight:      10,
+	}
+	view._setUserAssociationEntryMappings(userAssociationEntry)
+	postAssociationEntry := &PostAssociationEntry{
+		AssociationID:    NewBlockHash(bytes.Repeat([]byte{0x03}, HashSizeBytes)),
+		TransactorPKID:   m1PKID,
+		PostHash:         postHash,
+		AppPKID:          m0PKID,
+		AssociationType:  []byte("reaction"),
+		AssociationValue: []byte("heart"),
+		BlockHeight:      11,
+	}
+	view._setPostAssociationEntryMappings(postAssociationEntry)
+	votingPrivateKey, err := bls.NewPrivateKey()
+	require.NoError(err)
+	votingAuthorization, err := votingPrivateKey.Sign([]byte("authorization"))
+	require.NoError(err)
+	validatorEntry := &ValidatorEntry{
+		ValidatorPKID:           m0PKID,
+		Domains:                 [][]byte{[]byte("example.com:18000")},
+		VotingPublicKey:         votingPrivateKey.PublicKey(),
+		VotingAuthorization:     votingAuthorization,
+		TotalStakeAmountNanos:   uint256.NewInt(700),
+		LastActiveAtEpochNumber: 3,
+		ExtraData:               extraData,
+	}
+	view._setValidatorEntryMappings(validatorEntry)
+	view._setSnapshotValidatorSetEntry(validatorEntry, 2)
+	stakeEntry := &StakeEntry{
+		StakerPKID:       m1PKID,
+		ValidatorPKID:    m0PKID,
+		RewardMethod:     StakingRewardMethodRestake,
+		StakeAmountNanos: uint256.NewInt(800),
+		ExtraData:        extraData,
+	}
+	view._setStakeEntryMappings(stakeEntry)
+	lockedStakeEntry := &LockedStakeEntry{
+		StakerPKID:          m1PKID,
+		ValidatorPKID:       m0PKID,
+		LockedAmountNanos:   uint256.NewInt(900),
+		LockedAtEpochNumber: 2,
+		ExtraData:           extraData,
+	}
+	view._setLockedStakeEntryMappings(lockedStakeEntry)
+	epochEntry := &EpochEntry{
+		EpochNumber:                     3,
+		InitialBlockHeight:              100,
+		InitialView:                     101,
+		FinalBlockHeight:                199,
+		InitialLeaderIndexOffset:        1,
+		CreatedAtBlockTimestampNanoSecs: 1000,
+	}
+	view._setCurrentEpochEntry(epochEntry)
+	lockedBalanceEntry := &LockedBalanceEntry{
+		HODLerPKID:                  m1PKID,
+		ProfilePKID:                 m0PKID,
+		UnlockTimestampNanoSecs:     1000,
+		VestingEndTimestampNanoSecs: 2000,
+		BalanceBaseUnits:            *uint256.NewInt(1000),
+	}
+	view._setLockedBalanceEntry(lockedBalanceEntry)
+	yieldCurvePoint := &LockupYieldCurvePoint{
+		ProfilePKID:               m0PKID,
+		LockupDurationNanoSecs:    365 * 24 * 60 * 60 * 1e9,
+		LockupYieldAPYBasisPoints: 500,
+	}
+	view._setLockupYieldCurvePoint(yieldCurvePoint)
+	messageEntry := &MessageEntry{
+		SenderPublicKey:                m0PublicKey,
+		RecipientPublicKey:             m1PublicKey,
+		EncryptedText:                  []byte("legacy message"),
+		TstampNanos:                    3,
+		Version:                        MessagesVersion3,
+		SenderMessagingPublicKey:       m0PublicKey,
+		SenderMessagingGroupKeyName:    BaseGroupKeyName(),
+		RecipientMessagingPublicKey:    m1PublicKey,
+		RecipientMessagingGroupKeyName: BaseGroupKeyName(),
+		ExtraData:                      extraData,
+	}
+	view._setMessageEntryMappings(messageEntry)
+
+	require.NoError(view.FlushToDb(blockHeight))
+
+	// Read every state prefix the way a peer serves it during hypersync.
+	var chunk []*DBEntry
+	for _, prefix := range StatePrefixes.StatePrefixesList {
+		dbEntries, _, err := DBIteratePrefixKeys(db, prefix, prefix, math.MaxUint32)
+		require.NoError(err)
+		chunk = append(chunk, dbEntries...)
+	}
+	decodedView, profiles, pkidProfiles, err := _decodeSnapshotChunkForPostgres(db, chunk)
+	require.NoError(err)
+
+	// PrefixUtxoKeyToUtxoEntry and PrefixPublicKeyToDeSoBalanceNanos
+	decodedUtxoEntry := decodedView.UtxoKeyToUtxoEntry[*utxoEntry.UtxoKey]
+	require.NotNil(decodedUtxoEntry)
+	require.Equal(utxoEntry.AmountNanos, decodedUtxoEntry.AmountNanos)
+	require.Equal(utxoEntry.PublicKey, decodedUtxoEntry.PublicKey)
+	require.Equal(utxoEntry.BlockHeight, decodedUtxoEntry.BlockHeight)
+	require.Equal(utxoEntry.UtxoType, decodedUtxoEntry.UtxoType)
+	require.Equal(uint64(200), decodedView.PublicKeyToDeSoBalanceNanos[*m0PublicKey])
+
+	// PrefixPKIDToProfileEntry and PrefixPublicKeyToPKID
+	require.Len(profiles, 1)
+	require.Equal(m0PKID, profiles[0].PKID)
+	require.Equal(m0PublicKey, profiles[0].PublicKey)
+	require.Equal("m0", profiles[0].Username)
+	require.Equal("description", profiles[0].Description)
+	require.Equal(uint64(300), profiles[0].CoinsInCirculationNanos)
+	require.Equal(profileEntry.DAOCoinEntry.CoinsInCirculationNanos.Hex(), profiles[0].DAOCoinCoinsInCirculationNanos)
+	require.Equal(extraData, profiles[0].ExtraData)
+	require.Len(pkidProfiles, 1)
+	require.Equal(swappedPKID, pkidProfiles[0].PKID)
+	require.Equal(m1PublicKey, pkidProfiles[0].PublicKey)
+
+	// The remaining prefixes are decoded into the view.
+	require.Equal(postEntry.Body, decodedView.PostHashToPostEntry[*postHash].Body)
+	require.Equal(postEntry.PosterPublicKey, decodedView.PostHashToPostEntry[*postHash].PosterPublicKey)
+	require.Equal(likeEntry, decodedView.LikeKeyToLikeEntry[MakeLikeKey(m1PkBytes, *postHash)])
+	require.Equal(followEntry, decodedView.FollowKeyToFollowEntry[MakeFollowKey(m1PKID, m0PKID)])
+	require.Equal(diamondEntry, decodedView.DiamondKeyToDiamondEntry[MakeDiamondKey(m1PKID, m0PKID, postHash)])
+	require.Equal(creatorCoinBalanceEntry,
+		decodedView.HODLerPKIDCreatorPKIDToBalanceEntry[MakeBalanceEntryKey(m1PKID, m0PKID)])
+	require.Equal(daoCoinBalanceEntry,
+		decodedView.HODLerPKIDCreatorPKIDToDAOCoinBalanceEntry[MakeBalanceEntryKey(m0PKID, m1PKID)])
+	require.Equal(&ForbiddenPubKeyEntry{PubKey: m2PkBytes},
+		decodedView.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(m2PkBytes)])
+	require.Equal(nftEntry, decodedView.NFTKeyToNFTEntry[MakeNFTKey(postHash, 1)])
+	require.Equal(nftBidEntry, decodedView.NFTBidKeyToNFTBidEntry[MakeNFTBidKey(m1PKID, postHash, 1)])
+	decodedDerivedKeyEntry := decodedView.DerivedKeyToDerivedEntry[MakeDerivedKeyMapKey(*m0PublicKey, *m1PublicKey)]
+	require.NotNil(decodedDerivedKeyEntry)
+	require.Equal(derivedKeyEntry.ExpirationBlock, decodedDerivedKeyEntry.ExpirationBlock)
+	require.Equal(derivedKeyEntry.OperationType, decodedDerivedKeyEntry.OperationType)
+	require.Equal(derivedKeyEntry.ExtraData, decodedDerivedKeyEntry.ExtraData)
+	require.Equal(derivedKeyEntry.Memo, decodedDerivedKeyEntry.Memo)
+	require.Equal(derivedKeyEntry.TransactionSpendingLimitTracker.GlobalDESOLimit,
+		decodedDerivedKeyEntry.TransactionSpendingLimitTracker.GlobalDESOLimit)
+	require.Equal(derivedKeyEntry.TransactionSpendingLimitTracker.TransactionCountLimitMap,
+		decodedDerivedKeyEntry.TransactionSpendingLimitTracker.TransactionCountLimitMap)
+	require.Equal(accessGroupEntry,
+		decodedView.AccessGroupIdToAccessGroupEntry[*NewAccessGroupId(m0PublicKey, groupKeyName.ToBytes())])
+	require.Equal(accessGroupMemberEntry, decodedView.AccessGroupMembershipKeyToAccessGroupMember[AccessGroupMembershipKey{
+		AccessGroupMemberPublicKey: *m1PublicKey,
+		AccessGroupOwnerPublicKey:  *m0PublicKey,
+		AccessGroupKeyName:         *groupKeyName,
+	}])
+	require.Equal(dmMessageEntry, decodedView.DmMessagesIndex[dmMessageKey])
+	require.Equal(&dmThreadEntry, decodedView.DmThreadIndex[dmThreadKey])
+	require.Equal(groupChatMessageEntry, decodedView.GroupChatMessagesIndex[groupChatMessageKey])
+	require.Equal(userAssociationEntry,
+		decodedView.AssociationMapKeyToUserAssociationEntry[userAssociationEntry.ToMapKey()])
+	require.Equal(postAssociationEntry,
+		decodedView.AssociationMapKeyToPostAssociationEntry[postAssociationEntry.ToMapKey()])
+	for _, decodedValidatorEntry := range []*ValidatorEntry{
+		decodedView.ValidatorPKIDToValidatorEntry[*m0PKID],
+		decodedView.SnapshotValidatorSet[SnapshotValidatorSetMapKey{SnapshotAtEpochNumber: 2, ValidatorPKID: *m0PKID}],
+	} {
+		require.NotNil(decodedValidatorEntry)
+		require.Equal(validatorEntry.Domains, decodedValidatorEntry.Domains)
+		require.True(validatorEntry.VotingPublicKey.Eq(decodedValidatorEntry.VotingPublicKey))
+		require.True(validatorEntry.VotingAuthorization.Eq(decodedValidatorEntry.VotingAuthorization))
+		require.Equal(validatorEntry.TotalStakeAmountNanos, decodedValidatorEntry.TotalStakeAmountNanos)
+		require.Equal(validatorEntry.LastActiveAtEpochNumber, decodedValidatorEntry.LastActiveAtEpochNumber)
+		require.Equal(validatorEntry.ExtraData, decodedValidatorEntry.ExtraData)
+	}
+	require.Equal(stakeEntry, decodedView.StakeMapKeyToStakeEntry[stakeEntry.ToMapKey()])
+	require.Equal(lockedStakeEntry, decodedView.LockedStakeMapKeyToLockedStakeEntry[lockedStakeEntry.ToMapKey()])
+	require.Equal(epochEntry, decodedView.CurrentEpochEntry)
+	require.Equal(lockedBalanceEntry,
+		decodedView.LockedBalanceEntryKeyToLockedBalanceEntry[lockedBalanceEntry.ToMapKey()])
+	require.Equal(yieldCurvePoint,
+		decodedView.PKIDToLockupYieldCurvePointKeyToLockupYieldCurvePoints[*m0PKID][yieldCurvePoint.ToMapKey()])
+
+	// PrefixPublicKeyTimestampToPrivateMessage: the message is stored under both the sender's and the recipient's key,
+	// and both copies are loaded as a single message.
+	require.Len(decodedView.MessageMap, 1)
+	for _, pgMessage := range decodedView.MessageMap {
+		require.Equal(_snapshotMessageEntryToPGMessage(messageEntry), pgMessage)
+		// The key matches the one _connectPrivateMessage computes from the transaction.
+		require.Equal(_pgMessageHash(m0PkBytes, m1PkBytes, messageEntry.TstampNanos), pgMessage.MessageHash)
+		require.Equal(m0PkBytes, pgMessage.SenderPublicKey)
+		require.Equal(m1PkBytes, pgMessage.RecipientPublicKey)
+		require.Equal([]byte("legacy message"), pgMessage.EncryptedText)
+	}
+}
@@ -109,6 +109,9 @@ type RemoteNode struct {
 	latestBlockHeight uint64
 	// nodeServices is a bitfield that indicates the services supported by our node.
 	nodeServices ServiceFlag
+	// requireEncryptedValidatorTransport is true if our node, as a validator, refuses to complete the handshake with
+	// another validator unless the encrypted transport was negotiated.
+	requireEncryptedValidatorTransport bool
 
 	// handshakeMetadata is used to store the information received from the peer during the handshake.
 	handshakeMetadata *HandshakeMetadata
@@ -131,6 +134,12 @@ type HandshakeMetadata struct {
 	versionNonceSent uint64
 	// versionNonceReceived is the nonce received in the Version message from the peer.
 	versionNonceReceived uint64
+	// servicesSent is the bitfield of services we advertised in our Version message.
+	servicesSent ServiceFlag
+	// transportPublicKeySent is the ephemeral transport public key we sent in our Version message, if any.
+	transportPublicKeySent []byte
+	// transportPublicKeyReceived is the ephemeral transport public key the peer sent in its Version message, if any.
+	transportPublicKeyReceived []byte
 	// userAgent is a meta level label that can be used to analyze the network.
 	userAgent string
 	// serviceFlag is a bitfield that indicates the services supported by the peer.
@@ -168,6 +177,7 @@ func NewRemoteNode(
 	minTxFeeRateNanosPerKB uint64,
 	latestBlockHeight uint64,
 	nodeServices ServiceFlag,
+	requireEncryptedValidatorTransport bool,
 ) *RemoteNode {
 	return &RemoteNode{
 		id:                     id,
@@ -183,6 +193,8 @@ func NewRemoteNode(
 		minTxFeeRateNanosPerKB: minTxFeeRateNanosPerKB,
 		latestBlockHeight:      latestBlockHeight,
 		nodeServices:           nodeServices,
+
+		requireEncryptedValidatorTransport: requireEncryptedValidatorTransport,
 	}
 }
 
@@ -351,7 +363,8 @@ func (rn *RemoteNode) AttachInboundConnection(conn net.Conn, na *wire.NetAddress
 	}
 
 	id := rn.GetId().ToUint64()
-	rn.peer = rn.cmgr.ConnectPeer(id, conn, na, false, false)
+	rn.peer = rn.cmgr.ConnectPeer(id, conn, na, false, false, rn.nodeServices.HasService(SFEncryptedTransport),
+		rn.nodeServices.HasService(SFMessageCompression))
 	versionTimeExpected := time.Now().Add(rn.params.VersionNegotiationTimeout)
 	rn.versionTimeExpected = &versionTimeExpected
 	rn.setStatusConnected()
@@ -378,7 +391,8 @@ func (rn *RemoteNode) AttachOutboundConnection(conn net.Conn, na *wire.NetAddres
 	}
 
 	id := rn.GetId().ToUint64()
-	rn.peer = rn.cmgr.ConnectPeer(id, conn, na, true, rn.isPersistent)
+	rn.peer = rn.cmgr.ConnectPeer(id, conn, na, true, rn.isPersistent,
+		rn.nodeServices.HasService(SFEncryptedTransport), rn.nodeServices.HasService(SFMessageCompression))
 	versionTimeExpected := time.Now().Add(rn.params.VersionNegotiationTimeout)
 	rn.versionTimeExpected = &versionTimeExpected
 	rn.setStatusConnected()
@@ -453,6 +467,9 @@ func (rn *RemoteNode) sendVersionMessage(nonce uint64) error {
 	// detect self connections and so we can validate that the peer actually
 	// controls the IP she's supposedly communicating to us from.
 	rn.handshakeMetadata.versionNonceSent = nonce
+	// Record the services and transport key we advertise, which our verack signature covers if we're a validator.
+	rn.handshakeMetadata.servicesSent = verMsg.Services
+	rn.handshakeMetadata.transportPublicKeySent = verMsg.TransportPublicKey
 
 	if err := rn.sendMessage(verMsg); err != nil {
 		return fmt.Errorf("sendVersionMessage: Problem sending version message to peer (id= %d): %v", rn.id, err)
@@ -483,6 +500,17 @@ func (rn *RemoteNode) newVersionMessage(nonce uint64) *MsgDeSoVersion {
 	// Set the minimum fee rate the peer will accept.
 	ver.MinFeeRateNanosPerKB = rn.minTxFeeRateNanosPerKB
 
+	// Attach our ephemeral transport key if we support the encrypted transport. If the peer's transport couldn't
+	// be enabled, we stop advertising the encrypted transport so that the connection falls back to plaintext.
+	if ver.Services.HasService(SFEncryptedTransport) {
+		if rn.peer != nil {
+			ver.TransportPublicKey = rn.peer.GetTransportPublicKey()
+		}
+		if len(ver.TransportPublicKey) == 0 {
+			ver.Services &^= SFEncryptedTransport
+		}
+	}
+
 	return ver
 }
 
@@ -567,8 +595,23 @@ func (rn *RemoteNode) HandleVersionMessage(verMsg *MsgDeSoVersion, responseNonce
 			"RemoteNode has SFValidator service flag, but doesn't have ProtocolVersion2 or later", rn.id)
 	}
 
+	// If the RemoteNode advertises the encrypted transport, then it must send a valid ephemeral transport key.
+	if verMsg.Services.HasService(SFEncryptedTransport) && len(verMsg.TransportPublicKey) != PeerTransportPublicKeyLen {
+		return fmt.Errorf("RemoteNode.HandleVersionMessage: Requesting disconnect for id: (%v). "+
+			"RemoteNode has SFEncryptedTransport service flag, but sent invalid transport public key of length %d",
+			rn.id, len(verMsg.TransportPublicKey))
+	}
+
+	// Start compressing large messages if both nodes support compression. Compressed messages are only sent to
+	// nodes on ProtocolVersion2 or later.
+	if rn.peer != nil && rn.nodeServices.HasService(SFMessageCompression) &&
+		verMsg.Services.HasService(SFMessageCompression) && !negotiatedVersion.Before(ProtocolVersion2) {
+		rn.peer.StartCompressingMessages()
+	}
+
 	// Save the received version nonce so we can include it in our verack message.
 	vMeta.versionNonceReceived = verMsg.Nonce
+	vMeta.transportPublicKeyReceived = verMsg.TransportPublicKey
 
 	// Set the peer info-related fields.
 	vMeta.userAgent = verMsg.UserAgent
@@ -636,7 +679,16 @@ func (rn *RemoteNode) newVerackMessage() (*MsgDeSoVerack, error) {
 			break
 		}
 		verack.PublicKey = rn.keystore.GetSigner().GetPublicKey()
-		verack.Signature, err = rn.keystore.GetSigner().SignPoSValidatorHandshake(verack.NonceSent, verack.NonceReceived, tstampMicro)
+		// If both nodes support the encrypted transport, we also sign the handshake binding, which covers the services
+		// and transport keys in the version messages and proves that the transport's session keys, if any, belong to
+		// our validator. Otherwise, we sign the legacy handshake payload that nodes without the transport verify.
+		if rn.isHandshakeBindingSigned() {
+			verack.Signature, err = rn.keystore.GetSigner().SignPoSValidatorTransport(verack.NonceSent,
+				verack.NonceReceived, tstampMicro, rn.getHandshakeBinding(true))
+		} else {
+			verack.Signature, err = rn.keystore.GetSigner().SignPoSValidatorHandshake(verack.NonceSent,
+				verack.NonceReceived, tstampMicro)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("RemoteNode.newVerackMessage: Problem signing verack message: %v", err)
 		}
@@ -737,9 +789,24 @@ func (rn *RemoteNode) validateVerackPoS(vrkMsg *MsgDeSoVerack) error {
 			"verack public key or signature is nil", rn.id)
 	}
 
-	// Verify the verack message's signature.
-	ok, err := BLSVerifyPoSValidatorHandshake(vrkMsg.NonceSent, vrkMsg.NonceReceived, vrkMsg.TstampMicro,
-		vrkMsg.Signature, vrkMsg.PublicKey)
+	// If we're a validator that requires the encrypted transport with other validators, make sure it was negotiated.
+	if rn.requireEncryptedValidatorTransport && rn.nodeServices.HasService(SFPosValidator) && !rn.IsEncryptedTransport() {
+		return fmt.Errorf("RemoteNode.validateVerackPoS: Requesting disconnect for id: (%v) "+
+			"encrypted transport is required between validators but wasn't negotiated", rn.id)
+	}
+
+	// Verify the verack message's signature. If both nodes support the encrypted transport, the signature must also
+	// cover the handshake binding, so that any tampering with the services or transport keys in the version messages
+	// is detected.
+	var ok bool
+	var err error
+	if rn.isHandshakeBindingSigned() {
+		ok, err = BLSVerifyPoSValidatorTransport(vrkMsg.NonceSent, vrkMsg.NonceReceived, vrkMsg.TstampMicro,
+			rn.getHandshakeBinding(false), vrkMsg.Signature, vrkMsg.PublicKey)
+	} else {
+		ok, err = BLSVerifyPoSValidatorHandshake(vrkMsg.NonceSent, vrkMsg.NonceReceived, vrkMsg.TstampMicro,
+			vrkMsg.Signature, vrkMsg.PublicKey)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "RemoteNode.validateVerackPoS: Requesting disconnect for id: (%v) "+
 			"verack signature verification failed with error", rn.id)
@@ -760,6 +827,56 @@ func (rn *RemoteNode) validateVerackPoS(vrkMsg *MsgDeSoVerack) error {
 	return nil
 }
 
+// isHandshakeBindingSigned returns true if both version messages advertise SFEncryptedTransport, in which case the
+// validator verack signs the handshake binding. Nodes that predate the encrypted transport never advertise it, so they
+// keep exchanging the legacy handshake signature. A man in the middle can strip SFEncryptedTransport from both version
+// messages to fall back to it, which is what requireEncryptedValidatorTransport guards against. Stripping it from only
+// one of them leaves the two nodes signing and verifying different payloads, so the handshake fails.
+func (rn *RemoteNode) isHandshakeBindingSigned() bool {
+	vMeta := rn.handshakeMetadata
+	return vMeta.servicesSent.HasService(SFEncryptedTransport) && vMeta.serviceFlag.HasService(SFEncryptedTransport)
+}
+
+// getHandshakeBinding returns the part of the handshake that a validator's verack signature covers on top of the
+// nonces and timestamp: the services and transport keys that the signer sent and received in the version messages,
+// followed by the session binding of the encrypted transport, if one was negotiated. The version messages aren't
+// signed, so this prevents a man in the middle from swapping the transport keys in them, or from tampering with the
+// services they advertise. isSigner is true when building the binding for our own verack, and false
+// when verifying the peer's verack, in which case what we sent is what the signer received and vice versa.
+func (rn *RemoteNode) getHandshakeBinding(isSigner bool) []byte {
+	vMeta := rn.handshakeMetadata
+	servicesSent, transportPublicKeySent := vMeta.servicesSent, vMeta.transportPublicKeySent
+	servicesReceived, transportPublicKeyReceived := vMeta.serviceFlag, vMeta.transportPublicKeyReceived
+	if !isSigner {
+		servicesSent, servicesReceived = servicesReceived, servicesSent
+		transportPublicKeySent, transportPublicKeyReceived = transportPublicKeyReceived, transportPublicKeySent
+	}
+	sessionBinding, _ := rn.getTransportSessionBinding()
+
+	var handshakeBinding []byte
+	handshakeBinding = append(handshakeBinding, UintToBuf(uint64(servicesSent))...)
+	handshakeBinding = append(handshakeBinding, EncodeByteArray(transportPublicKeySent)...)
+	handshakeBinding = append(handshakeBinding, UintToBuf(uint64(servicesReceived))...)
+	handshakeBinding = append(handshakeBinding, EncodeByteArray(transportPublicKeyReceived)...)
+	handshakeBinding = append(handshakeBinding, EncodeByteArray(sessionBinding)...)
+	return handshakeBinding
+}
+
+// getTransportSessionBinding returns the session binding of the encrypted transport, and whether the encrypted
+// transport was negotiated with the peer.
+func (rn *RemoteNode) getTransportSessionBinding() ([]byte, bool) {
+	if rn.peer == nil {
+		return nil, false
+	}
+	return rn.peer.GetTransportSessionBinding()
+}
+
+// IsEncryptedTransport returns true if the encrypted transport was negotiated with the peer.
+func (rn *RemoteNode) IsEncryptedTransport() bool {
+	_, ok := rn.getTransportSessionBinding()
+	return ok
+}
+
 func (rn *RemoteNode) _logVersionSuccess() {
 	inboundStr := "INBOUND"
 	if rn.IsOutbound() {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/deso-protocol/go-deadlock"
 	"net"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
@@ -272,6 +273,11 @@ func (srv *Server) GetMempool() Mempool {
 	return srv.mempool
 }
 
+// GetPosMempool returns the PoS mempool, which runs alongside the legacy mempool even before the PoS cutover.
+func (srv *Server) GetPosMempool() *PosMempool {
+	return srv.posMempool
+}
+
 // TODO: The hallmark of a messy non-law-of-demeter-following interface...
 func (srv *Server) GetBlockProducer() *DeSoBlockProducer {
 	return srv.blockProducer
@@ -431,8 +437,16 @@ func NewServer(
 	_mempoolBackupIntervalMillis uint64,
 	_mempoolMaxValidationViewConnects uint64,
 	_transactionValidationRefreshIntervalMillis uint64,
+	_mempoolPublicKeyLimits PosMempoolPublicKeyLimits,
 	_stateSyncerMempoolTxnSyncLimit uint64,
+	_stateChangeSocketPath string,
+	_stateChangeSQLitePath string,
 	_checkpointSyncingProviders []string,
+	_encryptedTransport bool,
+	_requireEncryptedValidatorTransport bool,
+	_peerBanThreshold uint64,
+	_peerBanDurationSeconds uint64,
+	_messageCompression bool,
 ) (
 	_srv *Server,
 	_err error,
@@ -443,9 +457,27 @@ func NewServer(
 	// Only initialize state change syncer if the directories are defined.
 	var stateChangeSyncer *StateChangeSyncer
 	if _stateChangeDir != "" {
+		// Set up any sinks that state changes should be written to in addition to the state change files.
+		var stateChangeSinks []StateChangeSink
+		if _stateChangeSocketPath != "" {
+			socketSink, err := NewStateChangeSocketSink(_stateChangeSocketPath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "NewServer: Problem creating state change socket sink"), false
+			}
+			stateChangeSinks = append(stateChangeSinks, socketSink)
+		}
+		if _stateChangeSQLitePath != "" {
+			sqliteSink, err := NewStateChangeSQLiteSink(_stateChangeSQLitePath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "NewServer: Problem creating state change SQLite sink"), false
+			}
+			stateChangeSinks = append(stateChangeSinks, sqliteSink)
+		}
+
 		// Create the state change syncer to handle syncing state changes to disk, and assign some of its methods
 		// to the event manager.
-		stateChangeSyncer = NewStateChangeSyncer(_stateChangeDir, _syncType, _stateSyncerMempoolTxnSyncLimit)
+		stateChangeSyncer = NewStateChangeSyncer(
+			_stateChangeDir, _syncType, _stateSyncerMempoolTxnSyncLimit, stateChangeSinks...)
 		eventManager.OnStateSyncerOperation(stateChangeSyncer._handleStateSyncerOperation)
 		eventManager.OnStateSyncerFlushed(stateChangeSyncer._handleStateSyncerFlush)
 	}
@@ -467,6 +499,7 @@ func NewServer(
 			_disableEncoderMigrations,
 			_hypersyncMaxQueueSize,
 			eventManager,
+			postgres,
 		)
 		if err != nil {
 			panic(err)
@@ -562,9 +595,31 @@ func NewServer(
 	if _blsKeystore != nil {
 		nodeServices |= SFPosValidator
 	}
+	// Requiring the encrypted transport between validators implies supporting it.
+	if _encryptedTransport || _requireEncryptedValidatorTransport {
+		nodeServices |= SFEncryptedTransport
+	}
+	// Every node can reconstruct compact blocks, but only validators are sent them.
+	nodeServices |= SFCompactBlocks
+	// Every node serves checkpoints for its committed tip, once it has a PoS committed tip.
+	nodeServices |= SFCheckpoints
+	if _messageCompression {
+		nodeServices |= SFMessageCompression
+	}
+	// The ban list is persisted to the data directory, if there is one, so that bans survive restarts.
+	peerBanListPath := ""
+	if _dataDir != "" {
+		peerBanListPath = filepath.Join(_dataDir, PeerBanListFileName)
+	}
+	peerBanManager, err := NewPeerBanManager(
+		_peerBanThreshold, time.Duration(_peerBanDurationSeconds)*time.Second, peerBanListPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewServer: Problem initializing peer ban manager"), false
+	}
 	srv.networkManager = NewNetworkManager(_params, srv, _chain, _cmgr, _blsKeystore, _desoAddrMgr,
 		_connectIps, _targetOutboundPeers, _maxInboundPeers, _limitOneInboundConnectionPerIP,
-		_peerConnectionRefreshIntervalMillis, _minFeeRateNanosPerKB, nodeServices)
+		_peerConnectionRefreshIntervalMillis, _minFeeRateNanosPerKB, nodeServices, _requireEncryptedValidatorTransport,
+		peerBanManager)
 
 	if srv.stateChangeSyncer != nil {
 		srv.stateChangeSyncer.BlockHeight = uint64(_chain.headerTip().Height)
@@ -604,6 +659,7 @@ func NewServer(
 	if err != nil {
 		return nil, errors.Wrapf(err, "NewServer: Problem initializing PoS mempool"), true
 	}
+	_posMempool.SetPublicKeyLimits(_mempoolPublicKeyLimits)
 
 	// Useful for debugging. Every second, it outputs the contents of the mempool
 	// and the contents of the addrmanager.
@@ -1123,7 +1179,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 				"found between the received header height %v does not match the checkpoint block info %v",
 				pp, srv.blockchain.chainState(), headerReceived.Height,
 				srv.blockchain.GetCheckpointBlockInfo().String())
-			pp.Disconnect("Header height mismatch with checkpoint block info")
+			pp.Misbehaving(PeerMisbehaviorInvalidHeader, "Header height mismatch with checkpoint block info")
 			return
 		}
 
@@ -1148,7 +1204,11 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 				"because error occurred processing header: %v, isOrphan: %v",
 				pp, srv.blockchain.chainState(), err, isOrphan)
 
-			pp.Disconnect("Error processing header")
+			misbehavior := PeerMisbehaviorInvalidHeader
+			if err == nil {
+				misbehavior = PeerMisbehaviorUnconnectedHeaders
+			}
+			pp.Misbehaving(misbehavior, "Error processing header")
 			return
 		}
 	}
@@ -1218,6 +1278,18 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 					glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: problem while deleting state "+
 						"records, error: %v", err)))
 				}
+				// Postgres nodes load the snapshot into Postgres as well, so we clear the state left there by
+				// an earlier hypersync attempt along with the badger records.
+				if srv.blockchain.postgres != nil {
+					if err := srv.blockchain.postgres.DeleteAllStateRecords(); err != nil {
+						glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleHeaderBundle: problem while deleting "+
+							"postgres state records, restarting the node, error: %v", err)))
+						if srv.nodeMessageChannel != nil {
+							srv.nodeMessageChannel <- NodeErase
+						}
+						return
+					}
+				}
 				if shouldErase {
 					if srv.nodeMessageChannel != nil {
 						srv.nodeMessageChannel <- NodeErase
@@ -1358,7 +1430,7 @@ func (srv *Server) _handleHeaderBundle(pp *Peer, msg *MsgDeSoHeaderBundle) {
 			"she indicated that she has more headers but the last hash %v in "+
 			"the header bundle does not correspond to a block in our index.",
 			pp, lastHash)
-		pp.Disconnect("Last hash in header bundle not in our index")
+		pp.Misbehaving(PeerMisbehaviorUnconnectedHeaders, "Last hash in header bundle not in our index")
 		return
 	}
 	pp.AddDeSoMessage(&MsgDeSoGetHeaders{
@@ -1436,7 +1508,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// We should disconnect the peer because he is misbehaving or doesn't have the snapshot.
 		glog.Errorf("srv._handleSnapshot: Received a snapshot messages with empty snapshot chunk "+
 			"disconnecting misbehaving peer (%v)", pp)
-		pp.Disconnect("handleSnapshot: Empty snapshot chunk received from peer")
+		pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Empty snapshot chunk received from peer")
 		return
 	}
 
@@ -1483,7 +1555,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			"hyper sync height (%v) and hash (%v)",
 			msg.SnapshotMetadata.SnapshotBlockHeight, msg.SnapshotMetadata.CurrentEpochBlockHash,
 			srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight, srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochBlockHash)
-		pp.Disconnect("handleSnapshot: Snapshot metadata does not match expected snapshot metadata")
+		pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Snapshot metadata does not match expected snapshot metadata")
 		return
 	}
 
@@ -1500,7 +1572,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// We should disconnect the peer because he is misbehaving
 		glog.Errorf("srv._handleSnapshot: Problem finding appropriate sync prefix progress "+
 			"disconnecting misbehaving peer (%v)", pp)
-		pp.Disconnect("handleSnapshot: Problem finding appropriate sync prefix progress")
+		pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Problem finding appropriate sync prefix progress")
 		return
 	}
 
@@ -1515,7 +1587,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 		// We should disconnect the peer because he is misbehaving
 		glog.Errorf("srv._handleSnapshot: HyperSyncProgress epoch checksum bytes does not match that received from peer, "+
 			"disconnecting misbehaving peer (%v)", pp)
-		pp.Disconnect("handleSnapshot: Snapshot checksum bytes do not match expected checksum bytes")
+		pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Snapshot checksum bytes do not match expected checksum bytes")
 		return
 	}
 
@@ -1538,7 +1610,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			glog.Errorf("srv._handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-			pp.Disconnect("handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix")
+			pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Snapshot chunk DBEntry key has mismatched prefix")
 			return
 		}
 		dbChunk = append(dbChunk, msg.SnapshotChunk[0])
@@ -1550,7 +1622,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 			glog.Errorf("srv._handleSnapshot: Received a snapshot chunk that's not in-line with the sync progress "+
 				"disconnecting misbehaving peer (%v)", pp)
 			srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-			pp.Disconnect("handleSnapshot: Snapshot chunk not in-line with sync progress")
+			pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: Snapshot chunk not in-line with sync progress")
 			return
 		}
 	}
@@ -1567,7 +1639,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 				glog.Errorf("srv._handleSnapshot: DBEntry key has mismatched prefix "+
 					"disconnecting misbehaving peer (%v)", pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-				pp.Disconnect("handleSnapshot: DBEntry key has mismatched prefix")
+				pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: DBEntry key has mismatched prefix")
 				return
 			}
 			// Make sure that the dbChunk is sorted increasingly.
@@ -1577,7 +1649,7 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 					"value (%v) and second entry with index (%v) and value (%v) disconnecting misbehaving peer (%v)",
 					ii-1, dbChunk[ii-1].Key, ii, dbChunk[ii].Key, pp)
 				srv.HyperSyncProgress.SnapshotMetadata.CurrentEpochChecksumBytes = prevChecksumBytes
-				pp.Disconnect("handleSnapshot: dbChunk entries are not sorted")
+				pp.Misbehaving(PeerMisbehaviorInvalidSnapshotChunk, "handleSnapshot: dbChunk entries are not sorted")
 				return
 			}
 		}
@@ -1639,6 +1711,17 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	// Wait for the snapshot thread to process all operations and print the checksum.
 	srv.snapshot.WaitForAllOperationsToFinish()
 
+	// If a snapshot chunk couldn't be set even after retrying, the state is incomplete, so we erase it
+	// and hypersync again from the beginning.
+	if err := srv.snapshot.SnapshotChunkError(); err != nil {
+		glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleSnapshot: Failed to set a snapshot chunk, "+
+			"restarting hypersync, error: (%v)", err)))
+		if srv.nodeMessageChannel != nil {
+			srv.nodeMessageChannel <- NodeErase
+		}
+		return
+	}
+
 	// If we get to this point it means we synced all db prefixes, therefore finishing hyper sync.
 	// Do some logging.
 	srv.timer.End("HyperSync")
@@ -1694,6 +1777,43 @@ func (srv *Server) _handleSnapshot(pp *Peer, msg *MsgDeSoSnapshotData) {
 	//
 	// We split the db update into batches of 10,000 block nodes to avoid a single transaction
 	// being too large and possibly causing an error in badger.
+	// Postgres nodes read the block index and chain tip from Postgres, so we store the snapshot
+	// block nodes there as well. We do this before taking the chain lock so that retrying a slow
+	// or failing Postgres write doesn't stall the rest of the node. The stored copies carry the
+	// statuses that are set on the block nodes below.
+	if srv.blockchain.postgres != nil {
+		snapshotBlockHeight := srv.HyperSyncProgress.SnapshotMetadata.SnapshotBlockHeight
+		srv.blockchain.ChainLock.RLock()
+		snapshotBlockNodes := make([]*BlockNode, 0, snapshotBlockHeight)
+		for _, blockNode := range srv.blockchain.bestHeaderChain[1 : snapshotBlockHeight+1] {
+			blockNodeCopy := *blockNode
+			blockNodeCopy.Status |= StatusBlockProcessed | StatusBlockValidated | StatusBlockCommitted
+			snapshotBlockNodes = append(snapshotBlockNodes, &blockNodeCopy)
+		}
+		srv.blockchain.ChainLock.RUnlock()
+
+		for ii := 0; ii < MetadataRetryCount; ii++ {
+			err = srv.blockchain.postgres.UpsertHypersyncBlockNodes(
+				snapshotBlockNodes, msg.SnapshotMetadata.CurrentEpochBlockHash)
+			if err != nil {
+				glog.Errorf("Server._handleSnapshot: Problem updating snapshot block nodes in postgres, error: (%v)", err)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+			break
+		}
+		// Without the block index, the node can't continue syncing from the snapshot, so we erase the state and
+		// hypersync again from the beginning.
+		if err != nil {
+			glog.Errorf(CLog(Red, fmt.Sprintf("Server._handleSnapshot: Failed to store the snapshot block nodes "+
+				"in postgres, restarting hypersync, error: (%v)", err)))
+			if srv.nodeMessageChannel != nil {
+				srv.nodeMessageChannel <- NodeErase
+			}
+			return
+		}
+	}
+
 	glog.V(0).Infof("Server._handleSnapshot: Updating snapshot block nodes in the database")
 	var blockNodeBatch []*BlockNode
 	// acquire the chain lock while we update the best chain and best chain map.
@@ -1870,6 +1990,10 @@ func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 	// Request a mempool sync if we're ready
 	srv._tryRequestMempoolFromPeer(pp)
 
+	// Request the peer's checkpoint if we're syncing. This is sent before any GetHeaders message so that the
+	// checkpoint arrives before the headers.
+	srv._tryRequestCheckpointFromPeer(pp)
+
 	// Start syncing by choosing the best candidate.
 	if isSyncCandidate && srv.SyncPeer == nil {
 		srv._startSync()
@@ -1880,6 +2004,61 @@ func (srv *Server) HandleAcceptedPeer(rn *RemoteNode) {
 	}
 }
 
+// _tryRequestCheckpointFromPeer asks the peer for the checkpoint for its committed tip, if we're syncing and the
+// peer serves checkpoints.
+func (srv *Server) _tryRequestCheckpointFromPeer(pp *Peer) {
+	if !srv.blockchain.isSyncing() || pp.checkpointRequestInFlight {
+		return
+	}
+	pp.PeerInfoMtx.Lock()
+	servesCheckpoints := pp.serviceFlags.HasService(SFCheckpoints) &&
+		pp.NegotiatedProtocolVersion >= ProtocolVersion2
+	pp.PeerInfoMtx.Unlock()
+	if !servesCheckpoints {
+		return
+	}
+	pp.checkpointRequestInFlight = true
+	pp.AddDeSoMessage(&MsgDeSoGetCheckpoint{MsgVersion: MsgCheckpointVersion0}, false)
+}
+
+// _handleGetCheckpoint responds to a peer's request for the checkpoint for our committed tip. If we don't have a
+// PoS committed tip yet, we don't respond.
+func (srv *Server) _handleGetCheckpoint(pp *Peer, msg *MsgDeSoGetCheckpoint) {
+	checkpoint, err := srv.blockchain.GetCommittedTipCheckpoint()
+	if err != nil {
+		glog.V(1).Infof("Server._handleGetCheckpoint: Not sending checkpoint to peer %v: %v", pp, err)
+		return
+	}
+	pp.AddDeSoMessage(checkpoint, false)
+}
+
+// _handleCheckpoint processes the checkpoint a peer sent us in response to our GetCheckpoint message. A checkpoint
+// that we can't verify isn't necessarily malicious, as the peer's validator set may have drifted too far from ours,
+// so the peer is only penalized for unrequested checkpoints and checkpoints whose headers don't line up.
+func (srv *Server) _handleCheckpoint(pp *Peer, msg *MsgDeSoCheckpoint) {
+	if !pp.checkpointRequestInFlight {
+		glog.Errorf("Server._handleCheckpoint: Received unrequested checkpoint from peer %v", pp)
+		pp.Misbehaving(PeerMisbehaviorInvalidCheckpoint, "Received unrequested checkpoint")
+		return
+	}
+	pp.checkpointRequestInFlight = false
+
+	if _, _, err := msg.validateHeaders(); err != nil {
+		glog.Errorf("Server._handleCheckpoint: Received invalid checkpoint from peer %v: %v", pp, err)
+		pp.Misbehaving(PeerMisbehaviorInvalidCheckpoint, "Received invalid checkpoint")
+		return
+	}
+	updated, err := srv.blockchain.ProcessCheckpoint(msg)
+	if err != nil {
+		glog.Warningf("Server._handleCheckpoint: Problem processing checkpoint from peer %v: %v", pp, err)
+		return
+	}
+	if updated {
+		glog.V(1).Infof("Server._handleCheckpoint: Using checkpoint %v from peer %v",
+			srv.blockchain.GetCheckpointBlockInfo(), pp)
+	}
+}
+
 func (srv *Server) maybeRequestAddresses(remoteNode *RemoteNode) {
 	if remoteNode == nil {
 		return
@@ -2238,17 +2417,18 @@ func (srv *Server) _handleBlockAccepted(event *BlockEvent) {
 	}
 }
 
-func (srv *Server) _logAndDisconnectPeer(pp *Peer, blockMsg *MsgDeSoBlock, suffix string) {
+func (srv *Server) _logAndDisconnectPeer(pp *Peer, blockMsg *MsgDeSoBlock, misbehavior PeerMisbehavior, suffix string) {
 	// Disconnect the Peer. Generally-speaking, disconnecting from the peer will cause its
 	// requested blocks and txns to be removed from the global maps and cause it to be
 	// replaced by another peer. Furthermore,
 	// if we're in the process of syncing our node, the startSync process will also
 	// be restarted as a resul. If we're not syncing our peer and have instead reached
 	// the steady-state, then the next interesting inv message should cause us to
-	// fetch headers, blocks, etc. So we'll be back.
+	// fetch headers, blocks, etc. So we'll be back. The misbehavior is also added to
+	// the peer's ban score.
 	glog.Errorf("Server._handleBlock: Encountered an error processing "+
 		"block %v. Disconnecting from peer %v: %s", blockMsg, pp, suffix)
-	pp.Disconnect("Problem processing block")
+	pp.Misbehaving(misbehavior, "Problem processing block")
 }
 
 // This function handles a single block that we receive from our peer. Originally, we would receive blocks
@@ -2265,7 +2445,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	blockHeader := blk.Header
 	if blockHeader == nil {
 		// Should never happen but check it nevertheless.
-		srv._logAndDisconnectPeer(pp, blk, "Header was nil")
+		srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorInvalidBlock, "Header was nil")
 		return
 	}
 
@@ -2281,7 +2461,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	// disconnect from the peer. The block is obviously bad.
 	blockHash, err := blk.Header.Hash()
 	if err != nil {
-		srv._logAndDisconnectPeer(pp, blk, "Problem computing block hash")
+		srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorInvalidBlock, "Problem computing block hash")
 		return
 	}
 
@@ -2289,7 +2469,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	// we see such a block, then we log an error and disconnect from the peer.
 	_, isRequestedBlock := pp.requestedBlocks[*blockHash]
 	if srv.fastHotStuffConsensus == nil && !isRequestedBlock {
-		srv._logAndDisconnectPeer(pp, blk, "Getting a block that we haven't requested before")
+		srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorUnrequestedBlock, "Getting a block that we haven't requested before")
 		return
 	}
 
@@ -2306,7 +2486,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			_, entryExists := srv.mempool.readOnlyUtxoView.ForbiddenPubKeyToForbiddenPubKeyEntry[MakePkMapKey(
 				blk.BlockProducerInfo.PublicKey)]
 			if entryExists {
-				srv._logAndDisconnectPeer(pp, blk, "Got forbidden block signature public key.")
+				srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorInvalidBlock, "Got forbidden block signature public key.")
 				return
 			}
 		}
@@ -2321,7 +2501,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			"found between the received header height %v does not match the checkpoint block info %v",
 			pp, srv.blockchain.chainState(), blk.Header.Height,
 			srv.blockchain.GetCheckpointBlockInfo().Hash.String())
-		pp.Disconnect("Mismatch between received header height and checkpoint block info")
+		pp.Misbehaving(PeerMisbehaviorInvalidBlock, "Mismatch between received header height and checkpoint block info")
 		return
 	}
 
@@ -2371,7 +2551,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			// If the block fails the spam prevention check, then it must be signed by the
 			// bad block proposer signature or it has a bad QC. In either case, we should
 			// disconnect the peer.
-			srv._logAndDisconnectPeer(pp, blk, errors.Wrapf(err, "Error while processing block at height %v: ", blk.Header.Height).Error())
+			srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorInvalidBlock, errors.Wrapf(err, "Error while processing block at height %v: ", blk.Header.Height).Error())
 			return
 		} else {
 			// For any other error, we log the error and continue.
@@ -2414,7 +2594,7 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 			srv.RequestBlocksByHash(pp, blockHashesToRequest)
 		} else {
 			// If we don't have any blocks to request, then we disconnect from the peer.
-			srv._logAndDisconnectPeer(pp, blk, "Received orphan block")
+			srv._logAndDisconnectPeer(pp, blk, PeerMisbehaviorUnrequestedBlock, "Received orphan block")
 		}
 
 		return
@@ -2492,12 +2672,163 @@ func (srv *Server) _handleBlock(pp *Peer, blk *MsgDeSoBlock, isLastBlock bool) {
 	srv.tryTransitionToFastHotStuffConsensus()
 }
 
+// _handleCompactBlock reconstructs a PoS block from a compact block using the txns in our mempool. If any txns are
+// missing, we request them from the peer and finish processing the block once they arrive in _handleBlockTxns.
+func (srv *Server) _handleCompactBlock(pp *Peer, msg *MsgDeSoCompactBlock) {
+	// Compact blocks are only relayed between PoS validators, so we should not expect to see one unless we're
+	// running the FastHotStuffConsensus.
+	if srv.fastHotStuffConsensus == nil {
+		glog.Errorf("Server._handleCompactBlock: Received compact block %v from peer %v that we can't process "+
+			"without the FastHotStuffConsensus. Disconnecting peer.", msg, pp)
+		pp.Misbehaving(PeerMisbehaviorUnrequestedBlock, "Received unexpected compact block")
+		return
+	}
+
+	reconstruction, err := newCompactBlockReconstruction(msg, srv.GetMempool().GetTransactions())
+	if err != nil {
+		glog.Errorf("Server._handleCompactBlock: Problem reconstructing compact block %v from peer %v: %v",
+			msg, pp, err)
+		pp.Misbehaving(PeerMisbehaviorInvalidBlock, "Invalid compact block")
+		return
+	}
+
+	// If we already have every txn, then we can process the block right away.
+	if len(reconstruction.missingTxnIndexes) == 0 {
+		srv._processCompactBlockReconstruction(pp, reconstruction)
+		return
+	}
+
+	// Ignore duplicate compact blocks that we're already fetching txns for.
+	if _, exists := pp.pendingCompactBlocks[*reconstruction.blockHash]; exists {
+		return
+	}
+
+	// If the peer already has too many compact blocks waiting on txns, then we fall back to requesting the
+	// full block.
+	if len(pp.pendingCompactBlocks) >= MaxPendingCompactBlocksPerPeer {
+		glog.V(1).Infof("Server._handleCompactBlock: Too many pending compact blocks for peer %v. Requesting "+
+			"full block %v instead.", pp, reconstruction.blockHash)
+		srv.RequestBlocksByHash(pp, []*BlockHash{reconstruction.blockHash})
+		return
+	}
+
+	glog.V(1).Infof("Server._handleCompactBlock: Requesting %d of %d txns for compact block %v from peer %v",
+		len(reconstruction.missingTxnIndexes), msg.GetNumTxns(), reconstruction.blockHash, pp)
+	pp.pendingCompactBlocks[*reconstruction.blockHash] = reconstruction
+	pp.AddDeSoMessage(&MsgDeSoGetBlockTxns{
+		MsgVersion: MsgCompactBlockVersion0,
+		BlockHash:  reconstruction.blockHash,
+		TxnIndexes: reconstruction.missingTxnIndexes,
+	}, false)
+
+	// If the peer never sends the txns, the timeout is handled on the server's message loop, which is the only
+	// place the pending compact blocks are accessed. The send doesn't block, so that the timer's goroutine doesn't
+	// get stuck once the server stops or while the message loop is backed up. Dropping the timeout then is safe: the
+	// compact block may already be gone, and otherwise it stays pending, which MaxPendingCompactBlocksPerPeer bounds,
+	// until the peer sends the txns or disconnects.
+	time.AfterFunc(CompactBlockTxnsTimeout, func() {
+		select {
+		case srv.incomingMessages <- &ServerMessage{
+			Peer: pp,
+			Msg: &MsgDeSoCompactBlockTimeout{
+				BlockHash:      reconstruction.blockHash,
+				reconstruction: reconstruction,
+			},
+		}:
+		default:
+			glog.V(1).Infof("Server._handleCompactBlock: Dropping timeout for compact block %v from peer %v, "+
+				"since the message queue is full", reconstruction.blockHash, pp)
+		}
+	})
+}
+
+// _handleCompactBlockTimeout evicts a compact block that's still waiting for the missing txns we requested from the
+// peer, and requests the full block from the peer instead.
+func (srv *Server) _handleCompactBlockTimeout(pp *Peer, msg *MsgDeSoCompactBlockTimeout) {
+	if pp == nil {
+		return
+	}
+	// The txns may have arrived in the meantime, in which case there's nothing to do.
+	if reconstruction, exists := pp.pendingCompactBlocks[*msg.BlockHash]; !exists || reconstruction != msg.reconstruction {
+		return
+	}
+	delete(pp.pendingCompactBlocks, *msg.BlockHash)
+
+	glog.V(1).Infof("Server._handleCompactBlockTimeout: Timed out waiting for txns for compact block %v from "+
+		"peer %v. Requesting full block instead.", msg.BlockHash, pp)
+	srv.RequestBlocksByHash(pp, []*BlockHash{msg.BlockHash})
+}
+
+// _handleBlockTxns finishes reconstructing a compact block with the missing txns we requested from the peer.
+func (srv *Server) _handleBlockTxns(pp *Peer, msg *MsgDeSoBlockTxns) {
+	reconstruction, exists := pp.pendingCompactBlocks[*msg.BlockHash]
+	// If the compact block timed out and we've requested the full block instead, then the txns just arrived late.
+	if !exists && pp.requestedBlocks[*msg.BlockHash] {
+		glog.V(1).Infof("Server._handleBlockTxns: Ignoring late txns for block %v from peer %v", msg.BlockHash, pp)
+		return
+	}
+	if !exists {
+		glog.Errorf("Server._handleBlockTxns: Received txns for block %v that we haven't requested from peer %v",
+			msg.BlockHash, pp)
+		pp.Misbehaving(PeerMisbehaviorUnrequestedBlock, "Received block txns that we haven't requested")
+		return
+	}
+	delete(pp.pendingCompactBlocks, *msg.BlockHash)
+
+	if err := reconstruction.addMissingTxns(msg.Txns); err != nil {
+		glog.Errorf("Server._handleBlockTxns: Problem adding txns for compact block %v from peer %v: %v",
+			msg.BlockHash, pp, err)
+		pp.Misbehaving(PeerMisbehaviorInvalidBlock, "Invalid block txns")
+		return
+	}
+	srv._processCompactBlockReconstruction(pp, reconstruction)
+}
+
+// _processCompactBlockReconstruction processes a fully reconstructed compact block as if we had received the full
+// block. If the reconstructed txns don't match the header, which can happen if a short txn ID collision picked the
+// wrong txn from our mempool, then we request the full block from the peer instead.
+func (srv *Server) _processCompactBlockReconstruction(pp *Peer, reconstruction *compactBlockReconstruction) {
+	blk, err := reconstruction.toBlock()
+	if err != nil {
+		glog.Warningf("Server._processCompactBlockReconstruction: Problem reconstructing compact block %v from "+
+			"peer %v. Requesting full block instead: %v", reconstruction.blockHash, pp, err)
+		srv.RequestBlocksByHash(pp, []*BlockHash{reconstruction.blockHash})
+		return
+	}
+	srv._handleBlock(pp, blk, true)
+}
+
+// _handleGetBlockTxns responds to a peer's request for the txns it's missing from a compact block we sent it.
+func (srv *Server) _handleGetBlockTxns(pp *Peer, msg *MsgDeSoGetBlockTxns) {
+	blk := srv.blockchain.GetBlock(msg.BlockHash)
+	if blk == nil {
+		glog.Warningf("Server._handleGetBlockTxns: Block %v requested by peer %v not found", msg.BlockHash, pp)
+		return
+	}
+
+	txns := make([]*MsgDeSoTxn, 0, len(msg.TxnIndexes))
+	for _, txnIndex := range msg.TxnIndexes {
+		if txnIndex >= uint64(len(blk.Txns)) {
+			glog.Errorf("Server._handleGetBlockTxns: Peer %v requested txn index %d from block %v with %d txns",
+				pp, txnIndex, msg.BlockHash, len(blk.Txns))
+			pp.Misbehaving(PeerMisbehaviorInvalidBlockRequest, "Requested block txn index out of range")
+			return
+		}
+		txns = append(txns, blk.Txns[txnIndex])
+	}
+	pp.AddDeSoMessage(&MsgDeSoBlockTxns{
+		MsgVersion: MsgCompactBlockVersion0,
+		BlockHash:  msg.BlockHash,
+		Txns:       txns,
+	}, false)
+}
+
 func (srv *Server) _handleBlockBundle(pp *Peer, bundle *MsgDeSoBlockBundle) {
 	if len(bundle.Blocks) == 0 {
 		glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Received EMPTY block bundle "+
 			"at header height ( %v ) from Peer %v. Disconnecting peer since this should never happen.",
 			srv.blockchain.headerTip().Height, pp)))
-		pp.Disconnect("Received empty block bundle.")
+		pp.Misbehaving(PeerMisbehaviorUnrequestedBlock, "Received empty block bundle.")
 		return
 	}
 	glog.Infof(CLog(Cyan, fmt.Sprintf("Server._handleBlockBundle: Received blocks ( %v->%v / %v ) from Peer %v. "+
@@ -2656,7 +2987,7 @@ func (srv *Server) _processTransactions(pp *Peer, transactions []*MsgDeSoTxn) []
 				glog.Errorf(fmt.Sprintf("Server._handleTransactionBundle: Disconnecting "+
 					"Peer %v for sending us a transaction %v with fee below the minimum fee %d",
 					pp, txn, srv.mempool.minFeeRateNanosPerKB))
-				pp.Disconnect("Transaction fee below minimum fee")
+				pp.Misbehaving(PeerMisbehaviorLowFeeTransaction, "Transaction fee below minimum fee")
 			}
 
 			// Don't do anything else if we got an error.
@@ -2839,13 +3170,15 @@ func (srv *Server) _handleGetAddrMessage(pp *Peer, desoMsg DeSoMessage) {
 }
 
 func (srv *Server) _handleControlMessages(serverMessage *ServerMessage) (_shouldQuit bool) {
-	switch serverMessage.Msg.(type) {
+	switch msg := serverMessage.Msg.(type) {
 	// Control messages used internally to signal to the server.
 	case *MsgDeSoDisconnectedPeer:
 		srv._handleDisconnectedPeerMessage(serverMessage.Peer)
 		srv.networkManager._handleDisconnectedPeerMessage(serverMessage.Peer, serverMessage.Msg)
 	case *MsgDeSoNewConnection:
 		srv.networkManager._handleNewConnectionMessage(serverMessage.Peer, serverMessage.Msg)
+	case *MsgDeSoCompactBlockTimeout:
+		srv._handleCompactBlockTimeout(serverMessage.Peer, msg)
 	case *MsgDeSoQuit:
 		return true
 	}
@@ -2872,6 +3205,16 @@ func (srv *Server) _handlePeerMessages(serverMessage *ServerMessage) {
 	case *MsgDeSoBlock:
 		// isLastBlock is always true when we get a legacy single-block message.
 		srv._handleBlock(serverMessage.Peer, msg, true)
+	case *MsgDeSoCompactBlock:
+		srv._handleCompactBlock(serverMessage.Peer, msg)
+	case *MsgDeSoGetBlockTxns:
+		srv._handleGetBlockTxns(serverMessage.Peer, msg)
+	case *MsgDeSoBlockTxns:
+		srv._handleBlockTxns(serverMessage.Peer, msg)
+	case *MsgDeSoGetCheckpoint:
+		srv._handleGetCheckpoint(serverMessage.Peer, msg)
+	case *MsgDeSoCheckpoint:
+		srv._handleCheckpoint(serverMessage.Peer, msg)
 	case *MsgDeSoGetSnapshot:
 		srv._handleGetSnapshot(serverMessage.Peer, msg)
 	case *MsgDeSoSnapshotData:
@@ -3295,6 +3638,12 @@ func (srv *Server) Stop() {
 	// Wait for the server to fully shut down.
 	// TODO: shouldn't we wait for all modules to shutdown?
 	srv.waitGroup.Wait()
+
+	// Close the state change sinks now that nothing else should be flushing state changes.
+	if srv.stateChangeSyncer != nil {
+		srv.stateChangeSyncer.Close()
+		glog.Infof(CLog(Yellow, "Server.Stop: Closed StateChangeSyncer"))
+	}
 	glog.Info("Server.Stop: Successfully shut down Server")
 }
 
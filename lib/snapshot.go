@@ -66,6 +66,9 @@ const (
 	// Default value for limiting the number of items stored in the OperationChannel. Because the snapshot chunks are
 	// 100MB each, this limits the number of operations stored at one time to 2GB
 	HypersyncDefaultMaxQueueSize = 20
+	// Number of times setting a snapshot chunk is attempted before hypersync is failed. Chunks usually
+	// fail for transient reasons, but a chunk that can never be set would otherwise be requeued forever.
+	SnapshotChunkMaxRetries = 10
 	// Default value for snapshot epoch period for PoS
 	DefaultSnapshotEpochPeriodPoS = 600000
 )
@@ -354,9 +357,18 @@ type Snapshot struct {
 	mainDb *badger.DB
 	params *DeSoParams
 
+	// postgres is set when the node runs on Postgres. Snapshot chunks received during hypersync
+	// are then also loaded into Postgres, so that the node can continue syncing block-by-block.
+	postgres *Postgres
+
 	isTxIndex       bool
 	disableChecksum bool
 
+	// snapshotChunkErr is set once a snapshot chunk has failed SnapshotChunkMaxRetries times,
+	// after which hypersync can't complete and has to start over.
+	snapshotChunkErr     error
+	snapshotChunkErrLock sync.RWMutex
+
 	// ExitChannel is used to stop the snapshot when shutting down the node.
 	ExitChannel chan bool
 	// updateWaitGroup is used to wait for snapshot loop to finish.
@@ -378,6 +390,7 @@ func NewSnapshot(
 	disableMigrations bool,
 	hypersyncMaxQueueSize uint32,
 	eventManager *EventManager,
+	postgres *Postgres,
 ) (
 	_snap *Snapshot,
 	_err error,
@@ -503,6 +516,7 @@ func NewSnapshot(
 		timer:                        timer,
 		ExitChannel:                  make(chan bool),
 		eventManager:                 eventManager,
+		postgres:                     postgres,
 	}
 	// Now we will set the handler for finishing all operations in the operation channel.
 	snap.OperationChannel.SetFinishAllOperationsHandler(snap.PersistChecksumAndMigration)
@@ -535,8 +549,8 @@ func (snap *Snapshot) Run() {
 		case SnapshotOperationProcessChunk:
 			glog.V(1).Infof("Snapshot.Run: Number of operations in the operation channel (%v)",
 				snap.OperationChannel.GetStatus())
-			if err := snap.SetSnapshotChunk(operation.mainDb, operation.mainDbMutex, operation.snapshotChunk,
-				operation.blockHeight); err != nil {
+			if err := snap.setSnapshotChunk(operation.mainDb, operation.mainDbMutex, operation.snapshotChunk,
+				operation.blockHeight, operation.snapshotChunkAttempts); err != nil {
 				glog.Errorf("Snapshot.Run: Problem adding snapshot chunk to the db")
 			}
 
@@ -657,6 +671,39 @@ func (snap *Snapshot) ProcessSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadl
 	})
 }
 
+// retrySnapshotChunk requeues a snapshot chunk that failed to be set. Once the chunk has failed
+// SnapshotChunkMaxRetries times it is dropped and the error is recorded, so that hypersync fails.
+func (snap *Snapshot) retrySnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex,
+	snapshotChunk []*DBEntry, blockHeight uint64, attempts int, err error) {
+	if attempts >= SnapshotChunkMaxRetries {
+		glog.Errorf(CLog(Red, fmt.Sprintf("Snapshot.retrySnapshotChunk: Giving up on snapshot chunk after (%v) "+
+			"attempts, error: (%v)", attempts, err)))
+		snap.snapshotChunkErrLock.Lock()
+		defer snap.snapshotChunkErrLock.Unlock()
+		if snap.snapshotChunkErr == nil {
+			snap.snapshotChunkErr = errors.Wrapf(err, "Snapshot: Failed to set snapshot chunk after %v attempts",
+				attempts)
+		}
+		return
+	}
+	snap.OperationChannel.EnqueueOperation(&SnapshotOperation{
+		operationType:         SnapshotOperationProcessChunk,
+		mainDb:                mainDb,
+		mainDbMutex:           mainDbMutex,
+		snapshotChunk:         snapshotChunk,
+		blockHeight:           blockHeight,
+		snapshotChunkAttempts: attempts,
+	})
+}
+
+// SnapshotChunkError returns the error of a snapshot chunk that couldn't be set after
+// SnapshotChunkMaxRetries attempts, or nil if every chunk so far has been set.
+func (snap *Snapshot) SnapshotChunkError() error {
+	snap.snapshotChunkErrLock.RLock()
+	defer snap.snapshotChunkErrLock.RUnlock()
+	return snap.snapshotChunkErr
+}
+
 func (snap *Snapshot) AddChecksumBytes(key []byte, value []byte) {
 	snap.OperationChannel.EnqueueOperation(&SnapshotOperation{
 		operationType: SnapshotOperationChecksumAdd,
@@ -1205,6 +1252,13 @@ func (snap *Snapshot) GetSnapshotChunk(prefix []byte, startKey []byte) (
 // SetSnapshotChunk is called to put the snapshot chunk that we've got from a peer in the database.
 func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex,
 	chunk []*DBEntry, blockHeight uint64) error {
+	return snap.setSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight, 0)
+}
+
+// setSnapshotChunk sets the snapshot chunk, where previousAttempts is the number of times setting
+// this chunk has already failed.
+func (snap *Snapshot) setSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.RWMutex,
+	chunk []*DBEntry, blockHeight uint64, previousAttempts int) error {
 
 	var err error
 	var syncGroup sync.WaitGroup
@@ -1217,7 +1271,7 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 		initialChecksumBytes, err = snap.Checksum.ToBytes()
 		if err != nil {
 			glog.Errorf("Snapshot.SetSnapshotChunk: Problem retrieving checksum bytes, error: (%v)", err)
-			snap.ProcessSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight)
+			snap.retrySnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight, previousAttempts+1, err)
 			return err
 		}
 	}
@@ -1291,6 +1345,14 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 	syncGroup.Wait()
 	//mainDbMutex.Unlock()
 
+	// Postgres nodes also load the chunk into the relational tables. This happens after the badger
+	// write so that a failure here is retried together with the rest of the chunk.
+	if err == nil && snap.postgres != nil {
+		snap.timer.Start("SetSnapshotChunk.Postgres")
+		err = snap.postgres.LoadSnapshotChunk(mainDb, chunk, blockHeight)
+		snap.timer.End("SetSnapshotChunk.Postgres")
+	}
+
 	// If there's a problem setting the snapshot checksum, we'll reschedule this snapshot chunk set.
 	if err != nil {
 		if snap.eventManager != nil {
@@ -1304,12 +1366,12 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 		if !snap.disableChecksum {
 			// We reset the snapshot checksum so its initial value, so we won't overlap with processing the next snapshot chunk.
 			// If we've errored during a writeBatch set we'll redo this chunk in next SetSnapshotChunk so we're fine with overlaps.
-			if err = snap.Checksum.FromBytes(initialChecksumBytes); err != nil {
+			if resetErr := snap.Checksum.FromBytes(initialChecksumBytes); resetErr != nil {
 				panic(fmt.Errorf("Snapshot.SetSnapshotChunk: Problem resetting checksum. This should never happen, "+
-					"error: (%v)", err))
+					"error: (%v)", resetErr))
 			}
 		}
-		snap.ProcessSnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight)
+		snap.retrySnapshotChunk(mainDb, mainDbMutex, chunk, blockHeight, previousAttempts+1, err)
 		return err
 	}
 
@@ -1328,6 +1390,7 @@ func (snap *Snapshot) SetSnapshotChunk(mainDb *badger.DB, mainDbMutex *deadlock.
 	snap.timer.Print("SetSnapshotChunk.Total")
 	snap.timer.Print("SetSnapshotChunk.Set")
 	snap.timer.Print("SetSnapshotChunk.Checksum")
+	snap.timer.Print("SetSnapshotChunk.Postgres")
 	return nil
 }
 
@@ -1897,6 +1960,8 @@ type SnapshotOperation struct {
 	snapshotChunk []*DBEntry
 	// snapshot epoch block height.
 	blockHeight uint64
+	// snapshotChunkAttempts is the number of times setting this snapshot chunk has already failed.
+	snapshotChunkAttempts int
 
 	/* SnapshotOperationChecksumAdd, SnapshotOperationChecksumRemove */
 	// checksumKey, checksumValue are the bytes we want to add to the state checksum, e.g. when we flush to the db.
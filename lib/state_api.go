@@ -0,0 +1,809 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deso-protocol/uint256"
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// StateAPIServer serves a read-only HTTP/JSON API over the committed state of a running node.
+// Every request is answered from a UtxoView built at the committed tip while the chain lock is
+// held, so all data in a response is consistent with the BlockHeight and BlockHashHex it reports.
+// Responses are encoded and written after the lock is released.
+//
+// List endpoints are paginated with the Offset and Limit query parameters. To page through a
+// list without mixing results from different blocks, pass the BlockHeight of the first page on
+// subsequent requests; the server responds with 409 Conflict if the committed tip has moved.
+//
+// If a PosMempool is set with SetPosMempool, the server also exports snapshots of the mempool. These
+// are served without the chain lock.
+type StateAPIServer struct {
+	blockchain    *Blockchain
+	params        *DeSoParams
+	listenAddress string
+	posMempool    *PosMempool
+
+	httpServer *http.Server
+}
+
+const (
+	StateAPIDefaultPageLimit = 100
+	StateAPIMaxPageLimit     = 1000
+	// StateAPIMaxOffset bounds how far into a list a request can page. List handlers scan every entry
+	// before the offset while holding the chain lock, so an unbounded offset would let one request
+	// stall block processing.
+	StateAPIMaxOffset = 10000
+
+	// stateAPIShutdownTimeout is how long Stop waits for in-flight requests to finish.
+	stateAPIShutdownTimeout = 5 * time.Second
+)
+
+// StateAPIResponse wraps every successful response. NextOffset is set on list endpoints when
+// there are more results past the returned page.
+type StateAPIResponse struct {
+	BlockHeight  uint64
+	BlockHashHex string
+	NextOffset   *uint64 `json:",omitempty"`
+	Data         interface{}
+}
+
+type StateAPIErrorResponse struct {
+	Error string
+}
+
+// stateAPIError carries the HTTP status code that should be returned for an error.
+type stateAPIError struct {
+	statusCode int
+	err        error
+}
+
+func (apiErr *stateAPIError) Error() string {
+	return apiErr.err.Error()
+}
+
+func newStateAPIError(statusCode int, format string, args ...interface{}) *stateAPIError {
+	return &stateAPIError{statusCode: statusCode, err: fmt.Errorf(format, args...)}
+}
+
+// stateAPIRequest is passed to every handler. The view is built at the committed tip and
+// must not be modified.
+type stateAPIRequest struct {
+	view    *UtxoView
+	request *http.Request
+	offset  uint64
+	limit   uint64
+
+	// nextOffset is set by list handlers through paginateStateAPIResults.
+	nextOffset *uint64
+}
+
+type stateAPIHandler func(req *stateAPIRequest) (interface{}, error)
+
+func NewStateAPIServer(blockchain *Blockchain, params *DeSoParams, listenAddress string) *StateAPIServer {
+	return &StateAPIServer{
+		blockchain:    blockchain,
+		params:        params,
+		listenAddress: listenAddress,
+	}
+}
+
+// SetPosMempool enables the mempool snapshot endpoint. It must be called before Start.
+func (api *StateAPIServer) SetPosMempool(posMempool *PosMempool) {
+	api.posMempool = posMempool
+}
+
+// Start binds the listen address and serves requests in the background.
+func (api *StateAPIServer) Start() error {
+	listener, err := net.Listen("tcp", api.listenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "StateAPIServer.Start: Problem listening on %v", api.listenAddress)
+	}
+	api.httpServer = &http.Server{Handler: api.Router()}
+
+	go func() {
+		glog.Infof("StateAPIServer.Start: Serving read-only state API on %v", listener.Addr())
+		if err := api.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("StateAPIServer.Start: Problem serving state API: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (api *StateAPIServer) Stop() {
+	if api.httpServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateAPIShutdownTimeout)
+	defer cancel()
+	if err := api.httpServer.Shutdown(ctx); err != nil {
+		glog.Errorf("StateAPIServer.Stop: Problem shutting down state API: %v", err)
+	}
+	api.httpServer = nil
+}
+
+// Router returns the handler for all state API routes.
+func (api *StateAPIServer) Router() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v0/tip", api.wrap(api.getTip))
+	mux.HandleFunc("GET /api/v0/balance/{publicKey}", api.wrap(api.getBalance))
+	mux.HandleFunc("GET /api/v0/coin-balance/{holderPublicKey}/{creatorPublicKey}", api.wrap(api.getCoinBalance))
+	mux.HandleFunc("GET /api/v0/profile/{publicKey}", api.wrap(api.getProfile))
+	mux.HandleFunc("GET /api/v0/post/{postHashHex}", api.wrap(api.getPost))
+	mux.HandleFunc("GET /api/v0/posts/{publicKey}", api.wrap(api.getPostsForPublicKey))
+	mux.HandleFunc("GET /api/v0/nfts/{postHashHex}", api.wrap(api.getNFTsForPostHash))
+	mux.HandleFunc("GET /api/v0/dao-coin-orders/{buyingPublicKey}/{sellingPublicKey}", api.wrap(api.getDAOCoinOrders))
+	mux.HandleFunc("GET /api/v0/validator/{publicKey}", api.wrap(api.getValidator))
+	mux.HandleFunc("GET /api/v0/validators", api.wrap(api.getTopValidators))
+	mux.HandleFunc("GET /api/v0/stakes/{validatorPublicKey}", api.wrap(api.getStakesForValidator))
+	mux.HandleFunc("GET /api/v0/locked-balances/{publicKey}", api.wrap(api.getLockedBalances))
+	mux.HandleFunc("GET /api/v0/mempool/snapshot", api.serveMempoolSnapshot)
+	return mux
+}
+
+// wrap runs the handler while holding the chain lock, and encodes and writes its result once the lock is released.
+// Holding the read lock while we build the view and run the handler guarantees that no block is committed while
+// we're reading, and releasing it before encoding guarantees that a large response or a slow client can't stall
+// block processing.
+func (api *StateAPIServer) wrap(handler stateAPIHandler) http.HandlerFunc {
+	return func(ww http.ResponseWriter, rr *http.Request) {
+		var statusCode int
+		var responseBytes []byte
+		if response, err := api.buildResponse(rr, handler); err != nil {
+			statusCode, responseBytes = encodeStateAPIError(err)
+		} else {
+			statusCode, responseBytes = encodeStateAPIResponse(http.StatusOK, response)
+		}
+		writeStateAPIResponseBytes(ww, statusCode, responseBytes)
+	}
+}
+
+// buildResponse runs the handler against a view at the committed tip while holding the chain lock. Handlers copy
+// everything they return into response structs, so the response doesn't reference state that changes once the
+// lock is released.
+func (api *StateAPIServer) buildResponse(rr *http.Request, handler stateAPIHandler) (*StateAPIResponse, error) {
+	offset, limit, err := parseStateAPIPagination(rr)
+	if err != nil {
+		return nil, err
+	}
+
+	api.blockchain.ChainLock.RLock()
+	defer api.blockchain.ChainLock.RUnlock()
+
+	committedTip, _ := api.blockchain.GetCommittedTip()
+	if committedTip == nil {
+		return nil, newStateAPIError(http.StatusServiceUnavailable, "No committed tip found")
+	}
+	if blockHeightStr := rr.URL.Query().Get("BlockHeight"); blockHeightStr != "" {
+		blockHeight, err := strconv.ParseUint(blockHeightStr, 10, 64)
+		if err != nil {
+			return nil, newStateAPIError(http.StatusBadRequest, "Invalid BlockHeight: %v", err)
+		}
+		if blockHeight != committedTip.Header.Height {
+			return nil, newStateAPIError(http.StatusConflict,
+				"Requested BlockHeight %d but the committed tip is at %d", blockHeight, committedTip.Header.Height)
+		}
+	}
+
+	req := &stateAPIRequest{
+		view:    api.blockchain.GetCommittedTipView(),
+		request: rr,
+		offset:  offset,
+		limit:   limit,
+	}
+	data, err := handler(req)
+	if err != nil {
+		return nil, err
+	}
+	return &StateAPIResponse{
+		BlockHeight:  committedTip.Header.Height,
+		BlockHashHex: hex.EncodeToString(committedTip.Hash[:]),
+		NextOffset:   req.nextOffset,
+		Data:         data,
+	}, nil
+}
+
+func parseStateAPIPagination(rr *http.Request) (_offset uint64, _limit uint64, _err error) {
+	offset := uint64(0)
+	limit := uint64(StateAPIDefaultPageLimit)
+	var err error
+	if offsetStr := rr.URL.Query().Get("Offset"); offsetStr != "" {
+		if offset, err = strconv.ParseUint(offsetStr, 10, 64); err != nil {
+			return 0, 0, newStateAPIError(http.StatusBadRequest, "Invalid Offset: %v", err)
+		}
+	}
+	if limitStr := rr.URL.Query().Get("Limit"); limitStr != "" {
+		if limit, err = strconv.ParseUint(limitStr, 10, 64); err != nil {
+			return 0, 0, newStateAPIError(http.StatusBadRequest, "Invalid Limit: %v", err)
+		}
+	}
+	if offset > StateAPIMaxOffset {
+		return 0, 0, newStateAPIError(http.StatusBadRequest, "Offset must be at most %d", StateAPIMaxOffset)
+	}
+	if limit == 0 || limit > StateAPIMaxPageLimit {
+		return 0, 0, newStateAPIError(http.StatusBadRequest, "Limit must be between 1 and %d", StateAPIMaxPageLimit)
+	}
+	return offset, limit, nil
+}
+
+// paginateStateAPIResults returns the page of items selected by the request's offset and limit, and
+// sets the request's nextOffset if there are more items. Items must already be in a deterministic order.
+func paginateStateAPIResults[T any](req *stateAPIRequest, items []T) []T {
+	if req.offset >= uint64(len(items)) {
+		return []T{}
+	}
+	end := req.offset + req.limit
+	if end < uint64(len(items)) {
+		req.nextOffset = &end
+	} else {
+		end = uint64(len(items))
+	}
+	return items[req.offset:end]
+}
+
+func encodeStateAPIResponse(statusCode int, response interface{}) (_statusCode int, _responseBytes []byte) {
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		glog.Errorf("encodeStateAPIResponse: Problem encoding response: %v", err)
+		return encodeStateAPIError(newStateAPIError(http.StatusInternalServerError, "Problem encoding response"))
+	}
+	return statusCode, responseBytes
+}
+
+func encodeStateAPIError(err error) (_statusCode int, _responseBytes []byte) {
+	statusCode := http.StatusInternalServerError
+	var apiErr *stateAPIError
+	if errors.As(err, &apiErr) {
+		statusCode = apiErr.statusCode
+	}
+	// The error response only holds a string, so encoding it can't fail.
+	responseBytes, _ := json.Marshal(&StateAPIErrorResponse{Error: err.Error()})
+	return statusCode, responseBytes
+}
+
+func writeStateAPIResponseBytes(ww http.ResponseWriter, statusCode int, responseBytes []byte) {
+	ww.Header().Set("Content-Type", "application/json")
+	ww.WriteHeader(statusCode)
+	if _, err := ww.Write(append(responseBytes, '\n')); err != nil {
+		glog.V(1).Infof("writeStateAPIResponseBytes: Problem writing response: %v", err)
+	}
+}
+
+//
+// Request parsing helpers
+//
+
+func (req *stateAPIRequest) publicKeyParam(name string) ([]byte, error) {
+	publicKeyBytes, _, err := Base58CheckDecode(req.request.PathValue(name))
+	if err != nil || len(publicKeyBytes) != PublicKeyLenCompressed {
+		return nil, newStateAPIError(http.StatusBadRequest, "Invalid public key for %v: %v", name, req.request.PathValue(name))
+	}
+	return publicKeyBytes, nil
+}
+
+func (req *stateAPIRequest) pkidParam(name string) (*PKID, error) {
+	publicKeyBytes, err := req.publicKeyParam(name)
+	if err != nil {
+		return nil, err
+	}
+	pkidEntry := req.view.GetPKIDForPublicKey(publicKeyBytes)
+	if pkidEntry == nil || pkidEntry.isDeleted {
+		return nil, newStateAPIError(http.StatusNotFound, "No PKID found for %v", req.request.PathValue(name))
+	}
+	return pkidEntry.PKID, nil
+}
+
+func (req *stateAPIRequest) blockHashParam(name string) (*BlockHash, error) {
+	hashBytes, err := hex.DecodeString(req.request.PathValue(name))
+	if err != nil || len(hashBytes) != HashSizeBytes {
+		return nil, newStateAPIError(http.StatusBadRequest, "Invalid hash for %v: %v", name, req.request.PathValue(name))
+	}
+	return NewBlockHash(hashBytes), nil
+}
+
+func (req *stateAPIRequest) pkidToPublicKeyBase58Check(pkid *PKID, params *DeSoParams) string {
+	if pkid == nil {
+		return ""
+	}
+	return PkToString(req.view.GetPublicKeyForPKID(pkid), params)
+}
+
+func uint256ToDecimalString(value *uint256.Int) string {
+	if value == nil {
+		return "0"
+	}
+	return value.Dec()
+}
+
+func blockHashToHexOrEmpty(blockHash *BlockHash) string {
+	if blockHash == nil {
+		return ""
+	}
+	return hex.EncodeToString(blockHash[:])
+}
+
+func extraDataToStrings(extraData map[string][]byte) map[string]string {
+	if len(extraData) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(extraData))
+	for key, value := range extraData {
+		result[key] = string(value)
+	}
+	return result
+}
+
+//
+// Handlers
+//
+
+type StateAPITipResponse struct {
+	CommittedTipHeight   uint64
+	CommittedTipHashHex  string
+	CurrentEpochNumber   uint64
+	UncommittedTipHeight uint64
+}
+
+func (api *StateAPIServer) getTip(req *stateAPIRequest) (interface{}, error) {
+	committedTip, _ := api.blockchain.GetCommittedTip()
+	response := &StateAPITipResponse{
+		CommittedTipHeight:   committedTip.Header.Height,
+		CommittedTipHashHex:  hex.EncodeToString(committedTip.Hash[:]),
+		UncommittedTipHeight: api.blockchain.BlockTip().Header.Height,
+	}
+	// The epoch entry only exists after the PoS cutover.
+	if epochNumber, err := req.view.GetCurrentEpochNumber(); err == nil {
+		response.CurrentEpochNumber = epochNumber
+	}
+	return response, nil
+}
+
+type StateAPIBalanceResponse struct {
+	PublicKeyBase58Check string
+	BalanceNanos         uint64
+}
+
+func (api *StateAPIServer) getBalance(req *stateAPIRequest) (interface{}, error) {
+	publicKeyBytes, err := req.publicKeyParam("publicKey")
+	if err != nil {
+		return nil, err
+	}
+	balanceNanos, err := req.view.GetDeSoBalanceNanosForPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getBalance: ")
+	}
+	return &StateAPIBalanceResponse{
+		PublicKeyBase58Check: PkToString(publicKeyBytes, api.params),
+		BalanceNanos:         balanceNanos,
+	}, nil
+}
+
+type StateAPICoinBalanceResponse struct {
+	HODLerPublicKeyBase58Check  string
+	CreatorPublicKeyBase58Check string
+	IsDAOCoin                   bool
+	BalanceNanos                string
+	HasPurchased                bool
+}
+
+// getCoinBalance returns a creator coin balance, or a DAO coin balance if IsDAOCoin=true is passed.
+func (api *StateAPIServer) getCoinBalance(req *stateAPIRequest) (interface{}, error) {
+	holderPublicKey, err := req.publicKeyParam("holderPublicKey")
+	if err != nil {
+		return nil, err
+	}
+	creatorPublicKey, err := req.publicKeyParam("creatorPublicKey")
+	if err != nil {
+		return nil, err
+	}
+	isDAOCoin := strings.EqualFold(req.request.URL.Query().Get("IsDAOCoin"), "true")
+
+	response := &StateAPICoinBalanceResponse{
+		HODLerPublicKeyBase58Check:  PkToString(holderPublicKey, api.params),
+		CreatorPublicKeyBase58Check: PkToString(creatorPublicKey, api.params),
+		IsDAOCoin:                   isDAOCoin,
+		BalanceNanos:                "0",
+	}
+	balanceEntry, _, _ := req.view.GetBalanceEntryForHODLerPubKeyAndCreatorPubKey(
+		holderPublicKey, creatorPublicKey, isDAOCoin)
+	if balanceEntry != nil && !balanceEntry.isDeleted {
+		response.BalanceNanos = uint256ToDecimalString(&balanceEntry.BalanceNanos)
+		response.HasPurchased = balanceEntry.HasPurchased
+	}
+	return response, nil
+}
+
+type StateAPIProfileResponse struct {
+	PublicKeyBase58Check       string
+	Username                   string
+	Description                string
+	IsHidden                   bool
+	CreatorBasisPoints         uint64
+	DeSoLockedNanos            uint64
+	NumberOfHolders            uint64
+	CoinsInCirculationNanos    string
+	DAOCoinsInCirculationNanos string
+	DAOCoinNumberOfHolders     uint64
+	DAOCoinMintingDisabled     bool
+	DAOCoinTransferRestriction string
+	ExtraData                  map[string]string `json:",omitempty"`
+}
+
+func (api *StateAPIServer) getProfile(req *stateAPIRequest) (interface{}, error) {
+	publicKeyBytes, err := req.publicKeyParam("publicKey")
+	if err != nil {
+		return nil, err
+	}
+	profileEntry := req.view.GetProfileEntryForPublicKey(publicKeyBytes)
+	if profileEntry == nil || profileEntry.isDeleted {
+		return nil, newStateAPIError(http.StatusNotFound, "No profile found for %v", PkToString(publicKeyBytes, api.params))
+	}
+	return &StateAPIProfileResponse{
+		PublicKeyBase58Check:       PkToString(profileEntry.PublicKey, api.params),
+		Username:                   string(profileEntry.Username),
+		Description:                string(profileEntry.Description),
+		IsHidden:                   profileEntry.IsHidden,
+		CreatorBasisPoints:         profileEntry.CreatorCoinEntry.CreatorBasisPoints,
+		DeSoLockedNanos:            profileEntry.CreatorCoinEntry.DeSoLockedNanos,
+		NumberOfHolders:            profileEntry.CreatorCoinEntry.NumberOfHolders,
+		CoinsInCirculationNanos:    uint256ToDecimalString(&profileEntry.CreatorCoinEntry.CoinsInCirculationNanos),
+		DAOCoinsInCirculationNanos: uint256ToDecimalString(&profileEntry.DAOCoinEntry.CoinsInCirculationNanos),
+		DAOCoinNumberOfHolders:     profileEntry.DAOCoinEntry.NumberOfHolders,
+		DAOCoinMintingDisabled:     profileEntry.DAOCoinEntry.MintingDisabled,
+		DAOCoinTransferRestriction: profileEntry.DAOCoinEntry.TransferRestrictionStatus.String(),
+		ExtraData:                  extraDataToStrings(profileEntry.ExtraData),
+	}, nil
+}
+
+type StateAPIPostResponse struct {
+	PostHashHex                string
+	PosterPublicKeyBase58Check string
+	ParentPostHashHex          string `json:",omitempty"`
+	RepostedPostHashHex        string `json:",omitempty"`
+	IsQuotedRepost             bool
+	Body                       string
+	TimestampNanos             uint64
+	IsHidden                   bool
+	LikeCount                  uint64
+	RepostCount                uint64
+	QuoteRepostCount           uint64
+	DiamondCount               uint64
+	CommentCount               uint64
+	IsPinned                   bool
+	IsNFT                      bool
+	NumNFTCopies               uint64
+	ExtraData                  map[string]string `json:",omitempty"`
+}
+
+func (api *StateAPIServer) postEntryToResponse(postEntry *PostEntry) *StateAPIPostResponse {
+	response := &StateAPIPostResponse{
+		PostHashHex:                blockHashToHexOrEmpty(postEntry.PostHash),
+		PosterPublicKeyBase58Check: PkToString(postEntry.PosterPublicKey, api.params),
+		RepostedPostHashHex:        blockHashToHexOrEmpty(postEntry.RepostedPostHash),
+		IsQuotedRepost:             postEntry.IsQuotedRepost,
+		Body:                       string(postEntry.Body),
+		TimestampNanos:             postEntry.TimestampNanos,
+		IsHidden:                   postEntry.IsHidden,
+		LikeCount:                  postEntry.LikeCount,
+		RepostCount:                postEntry.RepostCount,
+		QuoteRepostCount:           postEntry.QuoteRepostCount,
+		DiamondCount:               postEntry.DiamondCount,
+		CommentCount:               postEntry.CommentCount,
+		IsPinned:                   postEntry.IsPinned,
+		IsNFT:                      postEntry.IsNFT,
+		NumNFTCopies:               postEntry.NumNFTCopies,
+		ExtraData:                  extraDataToStrings(postEntry.PostExtraData),
+	}
+	if len(postEntry.ParentStakeID) == HashSizeBytes {
+		response.ParentPostHashHex = hex.EncodeToString(postEntry.ParentStakeID)
+	}
+	return response
+}
+
+func (api *StateAPIServer) getPost(req *stateAPIRequest) (interface{}, error) {
+	postHash, err := req.blockHashParam("postHashHex")
+	if err != nil {
+		return nil, err
+	}
+	postEntry := req.view.GetPostEntryForPostHash(postHash)
+	if postEntry == nil || postEntry.isDeleted {
+		return nil, newStateAPIError(http.StatusNotFound, "No post found for %v", postHash)
+	}
+	return api.postEntryToResponse(postEntry), nil
+}
+
+// getPostsForPublicKey returns a user's posts, newest first.
+func (api *StateAPIServer) getPostsForPublicKey(req *stateAPIRequest) (interface{}, error) {
+	publicKeyBytes, err := req.publicKeyParam("publicKey")
+	if err != nil {
+		return nil, err
+	}
+	// Fetch enough posts to cover the requested page plus one so we know whether there's a next page.
+	postEntries, err := req.view.GetPostsPaginatedForPublicKeyOrderedByTimestamp(
+		publicKeyBytes, nil, req.offset+req.limit+1, false, false, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getPostsForPublicKey: ")
+	}
+	var responses []*StateAPIPostResponse
+	for _, postEntry := range paginateStateAPIResults(req, postEntries) {
+		responses = append(responses, api.postEntryToResponse(postEntry))
+	}
+	return responses, nil
+}
+
+type StateAPINFTResponse struct {
+	PostHashHex               string
+	SerialNumber              uint64
+	OwnerPublicKeyBase58Check string
+	IsForSale                 bool
+	MinBidAmountNanos         uint64
+	IsBuyNow                  bool
+	BuyNowPriceNanos          uint64
+	IsPending                 bool
+}
+
+func (api *StateAPIServer) getNFTsForPostHash(req *stateAPIRequest) (interface{}, error) {
+	postHash, err := req.blockHashParam("postHashHex")
+	if err != nil {
+		return nil, err
+	}
+	nftEntries := req.view.GetNFTEntriesForPostHash(postHash)
+	sort.Slice(nftEntries, func(ii, jj int) bool {
+		return nftEntries[ii].SerialNumber < nftEntries[jj].SerialNumber
+	})
+	var responses []*StateAPINFTResponse
+	for _, nftEntry := range paginateStateAPIResults(req, nftEntries) {
+		responses = append(responses, &StateAPINFTResponse{
+			PostHashHex:               blockHashToHexOrEmpty(nftEntry.NFTPostHash),
+			SerialNumber:              nftEntry.SerialNumber,
+			OwnerPublicKeyBase58Check: req.pkidToPublicKeyBase58Check(nftEntry.OwnerPKID, api.params),
+			IsForSale:                 nftEntry.IsForSale,
+			MinBidAmountNanos:         nftEntry.MinBidAmountNanos,
+			IsBuyNow:                  nftEntry.IsBuyNow,
+			BuyNowPriceNanos:          nftEntry.BuyNowPriceNanos,
+			IsPending:                 nftEntry.IsPending,
+		})
+	}
+	return responses, nil
+}
+
+type StateAPIDAOCoinOrderResponse struct {
+	OrderIDHex                                string
+	TransactorPublicKeyBase58Check            string
+	BuyingDAOCoinCreatorPublicKeyBase58Check  string
+	SellingDAOCoinCreatorPublicKeyBase58Check string
+	ScaledExchangeRateCoinsToSellPerCoinToBuy string
+	QuantityToFillInBaseUnits                 string
+	OperationType                             string
+	FillType                                  uint8
+	BlockHeight                               uint32
+}
+
+// daoCoinPKIDParam resolves a DAO coin creator in the orderbook endpoints. "DESO" refers to DESO,
+// which is represented by the ZeroPKID in the orderbook.
+func (req *stateAPIRequest) daoCoinPKIDParam(name string) (*PKID, error) {
+	if strings.EqualFold(req.request.PathValue(name), "DESO") {
+		return &ZeroPKID, nil
+	}
+	return req.pkidParam(name)
+}
+
+func (api *StateAPIServer) daoCoinPKIDToString(req *stateAPIRequest, pkid *PKID) string {
+	if pkid == nil || pkid.IsZeroPKID() {
+		return "DESO"
+	}
+	return req.pkidToPublicKeyBase58Check(pkid, api.params)
+}
+
+// getDAOCoinOrders returns the open orders for a DAO coin pair, sorted by order ID.
+func (api *StateAPIServer) getDAOCoinOrders(req *stateAPIRequest) (interface{}, error) {
+	buyingPKID, err := req.daoCoinPKIDParam("buyingPublicKey")
+	if err != nil {
+		return nil, err
+	}
+	sellingPKID, err := req.daoCoinPKIDParam("sellingPublicKey")
+	if err != nil {
+		return nil, err
+	}
+	orderEntries, err := req.view.GetAllDAOCoinLimitOrdersForThisDAOCoinPair(buyingPKID, sellingPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getDAOCoinOrders: ")
+	}
+	sort.Slice(orderEntries, func(ii, jj int) bool {
+		return bytes.Compare(orderEntries[ii].OrderID[:], orderEntries[jj].OrderID[:]) < 0
+	})
+	var responses []*StateAPIDAOCoinOrderResponse
+	for _, orderEntry := range paginateStateAPIResults(req, orderEntries) {
+		responses = append(responses, &StateAPIDAOCoinOrderResponse{
+			OrderIDHex:                                blockHashToHexOrEmpty(orderEntry.OrderID),
+			TransactorPublicKeyBase58Check:            req.pkidToPublicKeyBase58Check(orderEntry.TransactorPKID, api.params),
+			BuyingDAOCoinCreatorPublicKeyBase58Check:  api.daoCoinPKIDToString(req, orderEntry.BuyingDAOCoinCreatorPKID),
+			SellingDAOCoinCreatorPublicKeyBase58Check: api.daoCoinPKIDToString(req, orderEntry.SellingDAOCoinCreatorPKID),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: uint256ToDecimalString(orderEntry.ScaledExchangeRateCoinsToSellPerCoinToBuy),
+			QuantityToFillInBaseUnits:                 uint256ToDecimalString(orderEntry.QuantityToFillInBaseUnits),
+			OperationType:                             orderEntry.OperationType.String(),
+			FillType:                                  uint8(orderEntry.FillType),
+			BlockHeight:                               orderEntry.BlockHeight,
+		})
+	}
+	return responses, nil
+}
+
+type StateAPIValidatorResponse struct {
+	ValidatorPublicKeyBase58Check       string
+	Domains                             []string
+	DisableDelegatedStake               bool
+	DelegatedStakeCommissionBasisPoints uint64
+	VotingPublicKey                     string
+	TotalStakeAmountNanos               string
+	LastActiveAtEpochNumber             uint64
+	JailedAtEpochNumber                 uint64
+	Status                              string
+}
+
+func (api *StateAPIServer) validatorEntryToResponse(req *stateAPIRequest, validatorEntry *ValidatorEntry) *StateAPIValidatorResponse {
+	response := &StateAPIValidatorResponse{
+		ValidatorPublicKeyBase58Check:       req.pkidToPublicKeyBase58Check(validatorEntry.ValidatorPKID, api.params),
+		DisableDelegatedStake:               validatorEntry.DisableDelegatedStake,
+		DelegatedStakeCommissionBasisPoints: validatorEntry.DelegatedStakeCommissionBasisPoints,
+		TotalStakeAmountNanos:               uint256ToDecimalString(validatorEntry.TotalStakeAmountNanos),
+		LastActiveAtEpochNumber:             validatorEntry.LastActiveAtEpochNumber,
+		JailedAtEpochNumber:                 validatorEntry.JailedAtEpochNumber,
+		Status:                              validatorEntry.Status().ToString(),
+	}
+	for _, domain := range validatorEntry.Domains {
+		response.Domains = append(response.Domains, string(domain))
+	}
+	if validatorEntry.VotingPublicKey != nil {
+		response.VotingPublicKey = validatorEntry.VotingPublicKey.ToString()
+	}
+	return response
+}
+
+func (api *StateAPIServer) getValidator(req *stateAPIRequest) (interface{}, error) {
+	publicKeyBytes, err := req.publicKeyParam("publicKey")
+	if err != nil {
+		return nil, err
+	}
+	validatorEntry, err := req.view.GetValidatorByPublicKey(NewPublicKey(publicKeyBytes))
+	if err != nil {
+		return nil, newStateAPIError(http.StatusNotFound, "No validator found for %v: %v",
+			PkToString(publicKeyBytes, api.params), err)
+	}
+	if validatorEntry == nil {
+		return nil, newStateAPIError(http.StatusNotFound, "No validator found for %v", PkToString(publicKeyBytes, api.params))
+	}
+	return api.validatorEntryToResponse(req, validatorEntry), nil
+}
+
+// getTopValidators returns the active validators ordered by total stake, descending.
+func (api *StateAPIServer) getTopValidators(req *stateAPIRequest) (interface{}, error) {
+	validatorEntries, err := req.view.GetTopActiveValidatorsByStakeAmount(req.offset + req.limit + 1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getTopValidators: ")
+	}
+	var responses []*StateAPIValidatorResponse
+	for _, validatorEntry := range paginateStateAPIResults(req, validatorEntries) {
+		responses = append(responses, api.validatorEntryToResponse(req, validatorEntry))
+	}
+	return responses, nil
+}
+
+type StateAPIStakeResponse struct {
+	StakerPublicKeyBase58Check    string
+	ValidatorPublicKeyBase58Check string
+	RewardMethod                  string
+	StakeAmountNanos              string
+}
+
+// getStakesForValidator returns the stakes assigned to a validator, ordered by stake amount, descending.
+func (api *StateAPIServer) getStakesForValidator(req *stateAPIRequest) (interface{}, error) {
+	validatorPKID, err := req.pkidParam("validatorPublicKey")
+	if err != nil {
+		return nil, err
+	}
+	stakeEntries, err := req.view.GetStakeEntriesForValidatorPKID(validatorPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getStakesForValidator: ")
+	}
+	sort.Slice(stakeEntries, func(ii, jj int) bool {
+		if cmp := stakeEntries[ii].StakeAmountNanos.Cmp(stakeEntries[jj].StakeAmountNanos); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(stakeEntries[ii].StakerPKID.ToBytes(), stakeEntries[jj].StakerPKID.ToBytes()) < 0
+	})
+	var responses []*StateAPIStakeResponse
+	for _, stakeEntry := range paginateStateAPIResults(req, stakeEntries) {
+		rewardMethod := "PayToBalance"
+		if stakeEntry.RewardMethod == StakingRewardMethodRestake {
+			rewardMethod = "Restake"
+		}
+		responses = append(responses, &StateAPIStakeResponse{
+			StakerPublicKeyBase58Check:    req.pkidToPublicKeyBase58Check(stakeEntry.StakerPKID, api.params),
+			ValidatorPublicKeyBase58Check: req.pkidToPublicKeyBase58Check(stakeEntry.ValidatorPKID, api.params),
+			RewardMethod:                  rewardMethod,
+			StakeAmountNanos:              uint256ToDecimalString(stakeEntry.StakeAmountNanos),
+		})
+	}
+	return responses, nil
+}
+
+type StateAPILockedBalanceResponse struct {
+	HODLerPublicKeyBase58Check  string
+	ProfilePublicKeyBase58Check string
+	UnlockTimestampNanoSecs     int64
+	VestingEndTimestampNanoSecs int64
+	BalanceBaseUnits            string
+}
+
+// getLockedBalances returns a user's locked balance entries, ordered by unlock timestamp.
+func (api *StateAPIServer) getLockedBalances(req *stateAPIRequest) (interface{}, error) {
+	hodlerPKID, err := req.pkidParam("publicKey")
+	if err != nil {
+		return nil, err
+	}
+	lockedBalanceEntries, err := req.view.GetAllLockedBalanceEntriesForHodlerPKID(hodlerPKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getLockedBalances: ")
+	}
+	sort.Slice(lockedBalanceEntries, func(ii, jj int) bool {
+		left, right := lockedBalanceEntries[ii], lockedBalanceEntries[jj]
+		if left.UnlockTimestampNanoSecs != right.UnlockTimestampNanoSecs {
+			return left.UnlockTimestampNanoSecs < right.UnlockTimestampNanoSecs
+		}
+		if left.VestingEndTimestampNanoSecs != right.VestingEndTimestampNanoSecs {
+			return left.VestingEndTimestampNanoSecs < right.VestingEndTimestampNanoSecs
+		}
+		return bytes.Compare(left.ProfilePKID.ToBytes(), right.ProfilePKID.ToBytes()) < 0
+	})
+	var responses []*StateAPILockedBalanceResponse
+	for _, lockedBalanceEntry := range paginateStateAPIResults(req, lockedBalanceEntries) {
+		responses = append(responses, &StateAPILockedBalanceResponse{
+			HODLerPublicKeyBase58Check:  req.pkidToPublicKeyBase58Check(lockedBalanceEntry.HODLerPKID, api.params),
+			ProfilePublicKeyBase58Check: req.pkidToPublicKeyBase58Check(lockedBalanceEntry.ProfilePKID, api.params),
+			UnlockTimestampNanoSecs:     lockedBalanceEntry.UnlockTimestampNanoSecs,
+			VestingEndTimestampNanoSecs: lockedBalanceEntry.VestingEndTimestampNanoSecs,
+			BalanceBaseUnits:            uint256ToDecimalString(&lockedBalanceEntry.BalanceBaseUnits),
+		})
+	}
+	return responses, nil
+}
+
+// serveMempoolSnapshot returns a MempoolSnapshot of the PoS mempool. Unlike the other endpoints, the snapshot
+// reflects the mempool rather than the committed state, so it's served without the chain lock and isn't paginated.
+// The response's BlockHeight is the latest block height the mempool had seen, and its BlockHashHex is empty.
+func (api *StateAPIServer) serveMempoolSnapshot(ww http.ResponseWriter, rr *http.Request) {
+	var statusCode int
+	var responseBytes []byte
+	if snapshot, err := api.getMempoolSnapshot(); err != nil {
+		statusCode, responseBytes = encodeStateAPIError(err)
+	} else {
+		statusCode, responseBytes = encodeStateAPIResponse(http.StatusOK, &StateAPIResponse{
+			BlockHeight: snapshot.BlockHeight,
+			Data:        snapshot,
+		})
+	}
+	writeStateAPIResponseBytes(ww, statusCode, responseBytes)
+}
+
+func (api *StateAPIServer) getMempoolSnapshot() (*MempoolSnapshot, error) {
+	if api.posMempool == nil {
+		return nil, newStateAPIError(http.StatusNotFound, "Mempool snapshots are not enabled on this node")
+	}
+	snapshot, err := api.posMempool.ExportSnapshot()
+	if err != nil {
+		return nil, newStateAPIError(http.StatusServiceUnavailable, "Problem exporting mempool snapshot: %v", err)
+	}
+	return snapshot, nil
+}
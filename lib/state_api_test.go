@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginateStateAPIResults(t *testing.T) {
+	items := []int{0, 1, 2, 3, 4}
+
+	// First page with more results after it.
+	req := &stateAPIRequest{offset: 0, limit: 2}
+	require.Equal(t, []int{0, 1}, paginateStateAPIResults(req, items))
+	require.NotNil(t, req.nextOffset)
+	require.Equal(t, uint64(2), *req.nextOffset)
+
+	// Last page, which is exactly filled.
+	req = &stateAPIRequest{offset: 3, limit: 2}
+	require.Equal(t, []int{3, 4}, paginateStateAPIResults(req, items))
+	require.Nil(t, req.nextOffset)
+
+	// Last page, which is partially filled.
+	req = &stateAPIRequest{offset: 4, limit: 2}
+	require.Equal(t, []int{4}, paginateStateAPIResults(req, items))
+	require.Nil(t, req.nextOffset)
+
+	// Offset past the end.
+	req = &stateAPIRequest{offset: 10, limit: 2}
+	require.Empty(t, paginateStateAPIResults(req, items))
+	require.Nil(t, req.nextOffset)
+}
+
+// blockingResponseWriter blocks writes until unblock is closed, to simulate a slow client.
+type blockingResponseWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	unblock chan struct{}
+}
+
+func (ww *blockingResponseWriter) Write(data []byte) (int, error) {
+	close(ww.writing)
+	<-ww.unblock
+	return ww.ResponseRecorder.Write(data)
+}
+
+func TestStateAPIServer(t *testing.T) {
+	chain, params, _ := NewLowDifficultyBlockchain(t)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+	require.NoError(t, err)
+
+	router := NewStateAPIServer(chain, params, "").Router()
+	get := func(path string) (*httptest.ResponseRecorder, *StateAPIResponse) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		response := &StateAPIResponse{}
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+		}
+		return recorder, response
+	}
+
+	committedTip, _ := chain.GetCommittedTip()
+
+	// The balance should match what a view at the committed tip reports.
+	{
+		senderPkBytes, _, err := Base58CheckDecode(senderPkString)
+		require.NoError(t, err)
+		expectedBalance, err := chain.GetCommittedTipView().GetDeSoBalanceNanosForPublicKey(senderPkBytes)
+		require.NoError(t, err)
+
+		recorder, response := get("/api/v0/balance/" + senderPkString)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, uint64(committedTip.Height), response.BlockHeight)
+		balance := response.Data.(map[string]interface{})
+		require.Equal(t, senderPkString, balance["PublicKeyBase58Check"])
+		require.Equal(t, float64(expectedBalance), balance["BalanceNanos"])
+	}
+
+	// Requesting the current height succeeds, while a stale height is rejected.
+	{
+		recorder, _ := get(fmt.Sprintf("/api/v0/balance/%v?BlockHeight=%d", senderPkString, committedTip.Height))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		recorder, _ = get(fmt.Sprintf("/api/v0/balance/%v?BlockHeight=%d", senderPkString, committedTip.Height+1))
+		require.Equal(t, http.StatusConflict, recorder.Code)
+	}
+
+	// Invalid inputs are rejected.
+	{
+		recorder, _ := get("/api/v0/balance/not-a-public-key")
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		recorder, _ = get("/api/v0/validators?Limit=0")
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		recorder, _ = get(fmt.Sprintf("/api/v0/posts/%v?Offset=%d", senderPkString, StateAPIMaxOffset+1))
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		recorder, _ = get("/api/v0/post/00")
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+
+	// The sender has no profile.
+	{
+		recorder, _ := get("/api/v0/profile/" + senderPkString)
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+	}
+
+	// The chain lock is released before the response is written, so a slow client doesn't stall block processing.
+	{
+		writer := &blockingResponseWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			writing:          make(chan struct{}),
+			unblock:          make(chan struct{}),
+		}
+		served := make(chan struct{})
+		go func() {
+			router.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/api/v0/balance/"+senderPkString, nil))
+			close(served)
+		}()
+		<-writer.writing
+		locked := make(chan struct{})
+		go func() {
+			chain.ChainLock.Lock()
+			chain.ChainLock.Unlock()
+			close(locked)
+		}()
+		select {
+		case <-locked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Chain lock is held while the response is written")
+		}
+		close(writer.unblock)
+		<-served
+		require.Equal(t, http.StatusOK, writer.Code)
+	}
+
+	// The mempool snapshot endpoint doesn't take the chain lock, so it's served while a block is being processed.
+	{
+		chain.ChainLock.Lock()
+		served := make(chan *httptest.ResponseRecorder)
+		go func() {
+			recorder, _ := get("/api/v0/mempool/snapshot")
+			served <- recorder
+		}()
+		select {
+		case recorder := <-served:
+			// No PosMempool is set on this server.
+			require.Equal(t, http.StatusNotFound, recorder.Code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Mempool snapshot endpoint waited for the chain lock")
+		}
+		chain.ChainLock.Unlock()
+	}
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// StateChangeCheckpointFilePrefix is the prefix of the checkpoint files written beside the state change index file.
+// A checkpoint named "indexer" is stored in state-changes-checkpoint-indexer.json.
+const StateChangeCheckpointFilePrefix = "state-changes-checkpoint-"
+
+// ErrStateChangeCheckpointInvalidated is returned when the entries a checkpoint refers to are no longer in the
+// state change file, because the node reset the file since the checkpoint was saved. A consumer that gets this
+// error should discard everything it derived from the state change file and start again from index 0.
+var ErrStateChangeCheckpointInvalidated = errors.New("state change checkpoint invalidated")
+
+var stateChangeCheckpointNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// StateChangeConsumerCheckpoint is a named cursor into the committed state change file. It allows a consumer to
+// stop and resume processing without tracking byte offsets itself, and to detect when the entries it has already
+// processed were rewritten.
+//
+// The checkpoint records the log ID of the file and the sequence number of the last processed entry. If the node
+// resets the file, the log ID changes. Validate also confirms that the entry before NextIndex still has the
+// recorded sequence number, which catches a reset even if the log ID file was lost.
+//
+// Checkpoints only apply to the committed state change file. The mempool file is rewritten too often for a
+// cursor into it to be meaningful.
+type StateChangeConsumerCheckpoint struct {
+	Name string
+	// The log ID of the state change file when the checkpoint was saved. uuid.Nil for a new checkpoint.
+	LogId uuid.UUID
+	// The index of the next entry to process.
+	NextIndex uint64
+	// The sequence number of the entry at NextIndex-1. Only meaningful if NextIndex > 0.
+	LastSequenceNumber uint64
+}
+
+func getStateChangeCheckpointPath(stateChangeDir string, name string) (string, error) {
+	if !stateChangeCheckpointNameRegex.MatchString(name) {
+		return "", fmt.Errorf("getStateChangeCheckpointPath: Invalid checkpoint name %q, must only contain "+
+			"letters, numbers, underscores and dashes", name)
+	}
+	return filepath.Join(stateChangeDir, StateChangeCheckpointFilePrefix+name+".json"), nil
+}
+
+// LoadStateChangeConsumerCheckpoint loads the named checkpoint from stateChangeDir. If the checkpoint doesn't exist
+// yet, a new checkpoint positioned at the start of the file is returned.
+func LoadStateChangeConsumerCheckpoint(stateChangeDir string, name string) (*StateChangeConsumerCheckpoint, error) {
+	checkpointPath, err := getStateChangeCheckpointPath(stateChangeDir, name)
+	if err != nil {
+		return nil, err
+	}
+	checkpointBytes, err := os.ReadFile(checkpointPath)
+	if os.IsNotExist(err) {
+		return &StateChangeConsumerCheckpoint{Name: name}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "LoadStateChangeConsumerCheckpoint: Error reading checkpoint %v", name)
+	}
+	checkpoint := &StateChangeConsumerCheckpoint{}
+	if err = json.Unmarshal(checkpointBytes, checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "LoadStateChangeConsumerCheckpoint: Error decoding checkpoint %v", name)
+	}
+	if checkpoint.Name != name {
+		return nil, fmt.Errorf("LoadStateChangeConsumerCheckpoint: Checkpoint file for %v has name %v",
+			name, checkpoint.Name)
+	}
+	return checkpoint, nil
+}
+
+// DeleteStateChangeConsumerCheckpoint deletes the named checkpoint from stateChangeDir, if it exists.
+func DeleteStateChangeConsumerCheckpoint(stateChangeDir string, name string) error {
+	checkpointPath, err := getStateChangeCheckpointPath(stateChangeDir, name)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "DeleteStateChangeConsumerCheckpoint: Error deleting checkpoint %v", name)
+	}
+	return nil
+}
+
+// Save atomically writes the checkpoint to stateChangeDir.
+func (checkpoint *StateChangeConsumerCheckpoint) Save(stateChangeDir string) error {
+	checkpointPath, err := getStateChangeCheckpointPath(stateChangeDir, checkpoint.Name)
+	if err != nil {
+		return err
+	}
+	checkpointBytes, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeConsumerCheckpoint.Save: Error encoding checkpoint %v", checkpoint.Name)
+	}
+	if err = writeFileAtomically(checkpointPath, checkpointBytes); err != nil {
+		return errors.Wrapf(err, "StateChangeConsumerCheckpoint.Save: Error writing checkpoint %v", checkpoint.Name)
+	}
+	return nil
+}
+
+// Advance moves the checkpoint past the entry at the given index.
+func (checkpoint *StateChangeConsumerCheckpoint) Advance(index uint64, entry *StateChangeEntry) {
+	checkpoint.NextIndex = index + 1
+	checkpoint.LastSequenceNumber = entry.SequenceNumber
+}
+
+// Validate checks that the entries the checkpoint refers to are still in the committed state change file read by
+// reader. It returns ErrStateChangeCheckpointInvalidated if they're not. A new checkpoint adopts the file's log ID.
+func (checkpoint *StateChangeConsumerCheckpoint) Validate(reader *StateChangeFileReader) error {
+	if reader.IsMempool() {
+		return fmt.Errorf("StateChangeConsumerCheckpoint.Validate: Checkpoints can't be used with the mempool files")
+	}
+
+	logId, err := reader.LogId()
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeConsumerCheckpoint.Validate: Error reading log ID")
+	}
+	if checkpoint.LogId == uuid.Nil && checkpoint.NextIndex == 0 {
+		checkpoint.LogId = logId
+	}
+	if checkpoint.LogId != logId {
+		return errors.Wrapf(ErrStateChangeCheckpointInvalidated, "StateChangeConsumerCheckpoint.Validate: "+
+			"Checkpoint %v has log ID %v but the state change file has log ID %v", checkpoint.Name, checkpoint.LogId, logId)
+	}
+
+	if checkpoint.NextIndex == 0 {
+		return nil
+	}
+	numEntries, err := reader.NumEntries()
+	if err != nil {
+		return err
+	}
+	if checkpoint.NextIndex > numEntries {
+		return errors.Wrapf(ErrStateChangeCheckpointInvalidated, "StateChangeConsumerCheckpoint.Validate: "+
+			"Checkpoint %v is at index %d but the state change file only has %d entries",
+			checkpoint.Name, checkpoint.NextIndex, numEntries)
+	}
+	lastEntry, err := reader.ReadEntry(checkpoint.NextIndex - 1)
+	if err != nil {
+		return err
+	}
+	if lastEntry.SequenceNumber != checkpoint.LastSequenceNumber {
+		return errors.Wrapf(ErrStateChangeCheckpointInvalidated, "StateChangeConsumerCheckpoint.Validate: "+
+			"Checkpoint %v expected sequence number %d at index %d but found %d", checkpoint.Name,
+			checkpoint.LastSequenceNumber, checkpoint.NextIndex-1, lastEntry.SequenceNumber)
+	}
+	return nil
+}
+
+// IterateFromCheckpoint validates the checkpoint, then calls fn for every entry from the checkpoint onwards,
+// advancing the checkpoint after each call to fn that succeeds. The checkpoint isn't saved, so the caller should
+// call Save periodically, e.g. after committing the results of processing a batch of entries.
+func (reader *StateChangeFileReader) IterateFromCheckpoint(checkpoint *StateChangeConsumerCheckpoint,
+	fn func(index uint64, entry *StateChangeEntry) error) error {
+
+	if err := checkpoint.Validate(reader); err != nil {
+		return err
+	}
+	return reader.Iterate(checkpoint.NextIndex, func(index uint64, entry *StateChangeEntry) error {
+		if err := fn(index, entry); err != nil {
+			return err
+		}
+		checkpoint.Advance(index, entry)
+		return nil
+	})
+}
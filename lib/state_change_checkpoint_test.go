@@ -0,0 +1,250 @@
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateChangeSyncerSequenceNumbersAndRevertRecords(t *testing.T) {
+	require := require.New(t)
+	stateChangeDir := t.TempDir()
+
+	stateChangeSyncer := NewStateChangeSyncer(stateChangeDir, NodeSyncTypeHyperSync, 0)
+	require.Equal(uint64(0), stateChangeSyncer.NextSequenceNumber)
+	stateChangeSyncer.BlockHeight = _testStateChangeBlockHeight()
+
+	// Queue entries for two flushes, interleaving them as happens during hypersync.
+	entries := _testStateChangeEntries()
+	flushIdA := uuid.New()
+	flushIdB := uuid.New()
+	for _, entry := range entries {
+		for _, flushId := range []uuid.UUID{flushIdA, flushIdB} {
+			entry.FlushId = flushId
+			stateChangeSyncer.addTransactionToQueue(
+				flushId, EncodeByteArray(EncodeToBytes(_testStateChangeBlockHeight(), entry, false)), false)
+		}
+	}
+
+	// Flush B first, then fail flush A, then try to fail a flush that never had any entries.
+	require.NoError(stateChangeSyncer.FlushTransactionsToFile(
+		&StateSyncerFlushedEvent{FlushId: flushIdB, Succeeded: true}))
+	require.NoError(stateChangeSyncer.FlushTransactionsToFile(
+		&StateSyncerFlushedEvent{FlushId: flushIdA, Succeeded: false}))
+	require.NoError(stateChangeSyncer.FlushTransactionsToFile(
+		&StateSyncerFlushedEvent{FlushId: uuid.New(), Succeeded: false}))
+
+	reader, err := OpenStateChangeFileReader(stateChangeDir, false)
+	require.NoError(err)
+	defer reader.Close()
+
+	// Sequence numbers follow the order in which entries were flushed, and the failed flush is marked by a
+	// single revert record.
+	var writtenEntries []*StateChangeEntry
+	require.NoError(reader.Iterate(0, func(index uint64, entry *StateChangeEntry) error {
+		require.Equal(index, entry.SequenceNumber)
+		writtenEntries = append(writtenEntries, entry)
+		return nil
+	}))
+	require.Len(writtenEntries, len(entries)+1)
+	for ii := range entries {
+		require.Equal(flushIdB, writtenEntries[ii].FlushId)
+		require.Equal(entries[ii].KeyBytes, writtenEntries[ii].KeyBytes)
+	}
+	revertRecord := writtenEntries[len(entries)]
+	require.Equal(DbOperationTypeRevertFlush, revertRecord.OperationType)
+	require.Equal(flushIdA, revertRecord.FlushId)
+	require.True(revertRecord.IsReverted)
+
+	// A new syncer picks up the sequence numbers where the last one left off.
+	stateChangeSyncer.Close()
+	stateChangeSyncer = NewStateChangeSyncer(stateChangeDir, NodeSyncTypeHyperSync, 0)
+	require.Equal(uint64(len(entries)+1), stateChangeSyncer.NextSequenceNumber)
+
+	// Sequence numbers handed out to mempool entries aren't reused after the mempool file is truncated and
+	// the node restarts.
+	mempoolFlushId := uuid.New()
+	for _, entry := range entries {
+		entry.FlushId = mempoolFlushId
+		stateChangeSyncer.addTransactionToQueue(
+			mempoolFlushId, EncodeByteArray(EncodeToBytes(_testStateChangeBlockHeight(), entry, false)), true)
+	}
+	require.NoError(stateChangeSyncer.FlushTransactionsToFile(
+		&StateSyncerFlushedEvent{FlushId: mempoolFlushId, Succeeded: true, IsMempoolFlush: true}))
+	nextSequenceNumber := stateChangeSyncer.NextSequenceNumber
+	require.Equal(uint64(2*len(entries)+1), nextSequenceNumber)
+	stateChangeSyncer.ResetMempool()
+	stateChangeSyncer.Close()
+	stateChangeSyncer = NewStateChangeSyncer(stateChangeDir, NodeSyncTypeHyperSync, 0)
+	defer stateChangeSyncer.Close()
+	require.Equal(nextSequenceNumber, stateChangeSyncer.NextSequenceNumber)
+}
+
+func TestStateChangeEntrySequenceNumberMigration(t *testing.T) {
+	require := require.New(t)
+	oldParams := GlobalDeSoParams
+	GlobalDeSoParams = DeSoTestnetParams
+	defer func() { GlobalDeSoParams = oldParams }()
+
+	// Entries encoded before the ProofOfStake1StateSetupMigration don't have a sequence number, so they're left as
+	// they are when sequence numbers are assigned, while the entries around them get theirs.
+	entries := append(_testStateChangeEntries(), _testStateChangeEntries()[0])
+	migrationHeight := uint64(GlobalDeSoParams.ForkHeights.ProofOfStake1StateSetupBlockHeight)
+	var stateChangeBytes []byte
+	var entryOffsets []uint64
+	for ii, blockHeight := range []uint64{migrationHeight, migrationHeight - 1, migrationHeight} {
+		entryOffsets = append(entryOffsets, uint64(len(stateChangeBytes)))
+		stateChangeBytes = append(stateChangeBytes, EncodeByteArray(EncodeToBytes(blockHeight, entries[ii], false))...)
+	}
+	legacyEntryBytes := EncodeByteArray(EncodeToBytes(migrationHeight-1, entries[1], false))
+	require.NoError(setStateChangeSequenceNumbers(stateChangeBytes, entryOffsets, 10))
+	require.Equal(legacyEntryBytes, stateChangeBytes[entryOffsets[1]:entryOffsets[2]])
+
+	for ii, expectedSequenceNumber := range []uint64{10, 0, 12} {
+		rr := bytes.NewReader(stateChangeBytes[entryOffsets[ii]:])
+		entryBytes, err := DecodeByteArray(rr)
+		require.NoError(err)
+		entry := &StateChangeEntry{}
+		exists, err := DecodeFromBytes(entry, bytes.NewReader(entryBytes))
+		require.NoError(err)
+		require.True(exists)
+		require.Equal(entries[ii].KeyBytes, entry.KeyBytes)
+		require.Equal(expectedSequenceNumber, entry.SequenceNumber)
+	}
+}
+
+func TestStateChangeSyncerInitialFlushPerSink(t *testing.T) {
+	require := require.New(t)
+	stateChangeDir := t.TempDir()
+	existingSinkDir := t.TempDir()
+
+	// The additional sink already holds committed state changes from a previous run, while the state change dir is new.
+	existingSink, err := NewStateChangeFileSink(existingSinkDir)
+	require.NoError(err)
+	stateChangeBytes, entryOffsets := _testStateChangeBytes(_testStateChangeEntries())
+	require.NoError(existingSink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	existingSize := existingSink.StateChangeFileSize
+
+	stateChangeSyncer := NewStateChangeSyncer(stateChangeDir, NodeSyncTypeBlockSync, 0, existingSink)
+	defer stateChangeSyncer.Close()
+	require.True(stateChangeSyncer.BlocksyncCompleteEntriesFlushed)
+	require.True(stateChangeSyncer.hasSinksAwaitingInitialFlush())
+	fileSink := stateChangeSyncer.StateChangeSinks[0].(*StateChangeFileSink)
+
+	flush := func() {
+		flushId := uuid.New()
+		for _, entry := range _testStateChangeEntries() {
+			stateChangeSyncer.addTransactionToQueue(flushId, EncodeByteArray(EncodeToBytes(_testStateChangeBlockHeight(), entry, false)), false)
+		}
+		require.NoError(stateChangeSyncer.FlushTransactionsToFile(
+			&StateSyncerFlushedEvent{FlushId: flushId, Succeeded: true}))
+	}
+
+	// Until the initial flush, only the existing sink receives committed state changes.
+	flush()
+	require.Equal(uint64(0), fileSink.StateChangeFileSize)
+	require.Equal(2*existingSize, existingSink.StateChangeFileSize)
+
+	// During the initial flush, only the new sink receives committed state changes.
+	stateChangeSyncer.setInitialFlushInProgress(true)
+	flush()
+	stateChangeSyncer.setInitialFlushInProgress(false)
+	stateChangeSyncer.completeInitialFlush()
+	require.Equal(existingSize, fileSink.StateChangeFileSize)
+	require.Equal(2*existingSize, existingSink.StateChangeFileSize)
+	require.False(stateChangeSyncer.hasSinksAwaitingInitialFlush())
+
+	// Afterwards, both sinks receive committed state changes.
+	flush()
+	require.Equal(2*existingSize, fileSink.StateChangeFileSize)
+	require.Equal(3*existingSize, existingSink.StateChangeFileSize)
+}
+
+func TestStateChangeConsumerCheckpoint(t *testing.T) {
+	require := require.New(t)
+	stateChangeDir := t.TempDir()
+
+	sink, err := NewStateChangeFileSink(stateChangeDir)
+	require.NoError(err)
+	defer sink.Close()
+	require.NotEqual(uuid.Nil, sink.LogId)
+
+	entries := _testStateChangeEntries()
+	writeEntries := func(firstSequenceNumber uint64) {
+		stateChangeBytes, entryOffsets := _testStateChangeBytes(entries)
+		require.NoError(setStateChangeSequenceNumbers(stateChangeBytes, entryOffsets, firstSequenceNumber))
+		require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	}
+	writeEntries(0)
+
+	reader, err := OpenStateChangeFileReader(stateChangeDir, false)
+	require.NoError(err)
+	defer reader.Close()
+
+	// Names are restricted so that they're safe to use in file names.
+	_, err = LoadStateChangeConsumerCheckpoint(stateChangeDir, "../indexer")
+	require.Error(err)
+
+	// Process the first batch of entries and save the checkpoint.
+	checkpoint, err := LoadStateChangeConsumerCheckpoint(stateChangeDir, "indexer")
+	require.NoError(err)
+	require.Equal(uint64(0), checkpoint.NextIndex)
+	numProcessed := 0
+	require.NoError(reader.IterateFromCheckpoint(checkpoint, func(index uint64, entry *StateChangeEntry) error {
+		numProcessed++
+		return nil
+	}))
+	require.Equal(len(entries), numProcessed)
+	require.Equal(sink.LogId, checkpoint.LogId)
+	require.Equal(uint64(len(entries)), checkpoint.NextIndex)
+	require.Equal(uint64(len(entries)-1), checkpoint.LastSequenceNumber)
+	require.NoError(checkpoint.Save(stateChangeDir))
+
+	// Resuming from the saved checkpoint only visits the new entries.
+	writeEntries(uint64(len(entries)))
+	checkpoint, err = LoadStateChangeConsumerCheckpoint(stateChangeDir, "indexer")
+	require.NoError(err)
+	var visitedIndexes []uint64
+	require.NoError(reader.IterateFromCheckpoint(checkpoint, func(index uint64, entry *StateChangeEntry) error {
+		visitedIndexes = append(visitedIndexes, index)
+		return nil
+	}))
+	require.Equal([]uint64{2, 3}, visitedIndexes)
+	require.NoError(checkpoint.Save(stateChangeDir))
+
+	// If fn fails, the checkpoint isn't advanced past the failed entry.
+	writeEntries(uint64(2 * len(entries)))
+	fnErr := errors.New("fn failed")
+	err = reader.IterateFromCheckpoint(checkpoint, func(index uint64, entry *StateChangeEntry) error {
+		if index == 5 {
+			return fnErr
+		}
+		return nil
+	})
+	require.Equal(fnErr, err)
+	require.Equal(uint64(5), checkpoint.NextIndex)
+
+	// Resetting the file invalidates the saved checkpoint, even once the file has grown past it again.
+	require.NoError(sink.Reset())
+	for ii := 0; ii < 4; ii++ {
+		writeEntries(uint64(100 + ii*len(entries)))
+	}
+	checkpoint, err = LoadStateChangeConsumerCheckpoint(stateChangeDir, "indexer")
+	require.NoError(err)
+	err = reader.IterateFromCheckpoint(checkpoint, func(index uint64, entry *StateChangeEntry) error {
+		return nil
+	})
+	require.True(errors.Is(err, ErrStateChangeCheckpointInvalidated))
+
+	// A checkpoint that has lost track of the log ID is still invalidated by the sequence number check.
+	checkpoint.LogId = sink.LogId
+	require.True(errors.Is(checkpoint.Validate(reader), ErrStateChangeCheckpointInvalidated))
+
+	require.NoError(DeleteStateChangeConsumerCheckpoint(stateChangeDir, "indexer"))
+	checkpoint, err = LoadStateChangeConsumerCheckpoint(stateChangeDir, "indexer")
+	require.NoError(err)
+	require.Equal(uint64(0), checkpoint.NextIndex)
+}
@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// stateChangeIndexEntrySize is the size of each entry in a state change index file, which is a little-endian uint64
+// holding the offset of the corresponding StateChangeEntry record in the state change file.
+const stateChangeIndexEntrySize = 8
+
+// StateChangeFileReader reads the StateChangeEntry records written by the StateChangeFileSink. It opens the files
+// read-only, so it can be used while the node is running and still appending to them.
+//
+// The node writes each record to the state change file before writing its offset to the index file, so every
+// record counted by NumEntries is guaranteed to be complete. Note that the mempool files are truncated by the node
+// whenever it resets its mempool state, so a reader of the mempool files should expect reads to start failing,
+// or NumEntries to shrink, at any time.
+type StateChangeFileReader struct {
+	stateChangeFile *os.File
+	indexFile       *os.File
+	stateChangeDir  string
+	isMempool       bool
+}
+
+// OpenStateChangeFileReader opens the state change files in stateChangeDir. If isMempool is true, the mempool
+// state change files are read rather than the committed ones.
+func OpenStateChangeFileReader(stateChangeDir string, isMempool bool) (*StateChangeFileReader, error) {
+	stateChangeFileName := StateChangeFileName
+	indexFileName := StateChangeIndexFileName
+	if isMempool {
+		stateChangeFileName = StateChangeMempoolFileName
+		indexFileName = StateChangeMempoolIndexFileName
+	}
+
+	stateChangeFile, err := os.Open(filepath.Join(stateChangeDir, stateChangeFileName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "OpenStateChangeFileReader: Error opening state change file")
+	}
+	indexFile, err := os.Open(filepath.Join(stateChangeDir, indexFileName))
+	if err != nil {
+		stateChangeFile.Close()
+		return nil, errors.Wrapf(err, "OpenStateChangeFileReader: Error opening state change index file")
+	}
+	return &StateChangeFileReader{
+		stateChangeFile: stateChangeFile,
+		indexFile:       indexFile,
+		stateChangeDir:  stateChangeDir,
+		isMempool:       isMempool,
+	}, nil
+}
+
+// LogId returns the current log ID of the committed state change file. The log ID changes whenever the node
+// resets the file.
+func (reader *StateChangeFileReader) LogId() (uuid.UUID, error) {
+	return ReadStateChangeLogId(reader.stateChangeDir)
+}
+
+// StateChangeDir returns the state change dir that the reader was opened on.
+func (reader *StateChangeFileReader) StateChangeDir() string {
+	return reader.stateChangeDir
+}
+
+// IsMempool returns true if the reader is reading the mempool state change files.
+func (reader *StateChangeFileReader) IsMempool() bool {
+	return reader.isMempool
+}
+
+// NumEntries returns the number of StateChangeEntry records that have been fully written to the state change file.
+func (reader *StateChangeFileReader) NumEntries() (uint64, error) {
+	indexFileInfo, err := reader.indexFile.Stat()
+	if err != nil {
+		return 0, errors.Wrapf(err, "StateChangeFileReader.NumEntries: Error getting index file info")
+	}
+	return uint64(indexFileInfo.Size()) / stateChangeIndexEntrySize, nil
+}
+
+// getEntryOffset returns the offset of the entry at the given index in the state change file.
+func (reader *StateChangeFileReader) getEntryOffset(index uint64) (uint64, error) {
+	if index > math.MaxInt64/stateChangeIndexEntrySize {
+		return 0, fmt.Errorf("StateChangeFileReader.getEntryOffset: Index %d out of range", index)
+	}
+	offsetBytes := make([]byte, stateChangeIndexEntrySize)
+	if _, err := reader.indexFile.ReadAt(offsetBytes, int64(index*stateChangeIndexEntrySize)); err != nil {
+		return 0, errors.Wrapf(err, "StateChangeFileReader.getEntryOffset: Error reading offset for index %d", index)
+	}
+	offset := binary.LittleEndian.Uint64(offsetBytes)
+	if offset > math.MaxInt64 {
+		return 0, fmt.Errorf("StateChangeFileReader.getEntryOffset: Offset %d for index %d out of range", offset, index)
+	}
+	return offset, nil
+}
+
+// readerFromIndex returns a buffered reader over the state change file, positioned at the entry with the given index.
+func (reader *StateChangeFileReader) readerFromIndex(index uint64) (*bufio.Reader, error) {
+	offset, err := reader.getEntryOffset(index)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(io.NewSectionReader(reader.stateChangeFile, int64(offset), math.MaxInt64-int64(offset))), nil
+}
+
+// ReadEntryBytes returns the encoded StateChangeEntry at the given index. The bytes can be decoded with
+// DecodeStateChangeEntry.
+func (reader *StateChangeFileReader) ReadEntryBytes(index uint64) ([]byte, error) {
+	numEntries, err := reader.NumEntries()
+	if err != nil {
+		return nil, err
+	}
+	if index >= numEntries {
+		return nil, fmt.Errorf("StateChangeFileReader.ReadEntryBytes: Index %d out of range, the file has %d entries",
+			index, numEntries)
+	}
+	entryReader, err := reader.readerFromIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	entryBytes, err := DecodeByteArray(entryReader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeFileReader.ReadEntryBytes: Error reading entry at index %d", index)
+	}
+	return entryBytes, nil
+}
+
+// ReadEntry returns the decoded StateChangeEntry at the given index.
+func (reader *StateChangeFileReader) ReadEntry(index uint64) (*StateChangeEntry, error) {
+	entryBytes, err := reader.ReadEntryBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	stateChangeEntry, err := DecodeStateChangeEntry(entryBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "StateChangeFileReader.ReadEntry: Error decoding entry at index %d", index)
+	}
+	return stateChangeEntry, nil
+}
+
+// ReadLastEntry returns the last entry in the file, or nil if the file is empty.
+func (reader *StateChangeFileReader) ReadLastEntry() (*StateChangeEntry, error) {
+	numEntries, err := reader.NumEntries()
+	if err != nil {
+		return nil, err
+	}
+	if numEntries == 0 {
+		return nil, nil
+	}
+	return reader.ReadEntry(numEntries - 1)
+}
+
+// Iterate calls fn for every entry from fromIndex up to the number of entries in the file at the time Iterate is
+// called. Entries are read sequentially, which is much faster than calling ReadEntry for each index. If fn returns
+// an error, iteration stops and the error is returned.
+func (reader *StateChangeFileReader) Iterate(fromIndex uint64, fn func(index uint64, entry *StateChangeEntry) error) error {
+	numEntries, err := reader.NumEntries()
+	if err != nil {
+		return err
+	}
+	if fromIndex >= numEntries {
+		return nil
+	}
+	entryReader, err := reader.readerFromIndex(fromIndex)
+	if err != nil {
+		return err
+	}
+	for index := fromIndex; index < numEntries; index++ {
+		entryBytes, err := DecodeByteArray(entryReader)
+		if err != nil {
+			return errors.Wrapf(err, "StateChangeFileReader.Iterate: Error reading entry at index %d", index)
+		}
+		stateChangeEntry, err := DecodeStateChangeEntry(entryBytes)
+		if err != nil {
+			return errors.Wrapf(err, "StateChangeFileReader.Iterate: Error decoding entry at index %d", index)
+		}
+		if err = fn(index, stateChangeEntry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the state change files.
+func (reader *StateChangeFileReader) Close() error {
+	if err := reader.stateChangeFile.Close(); err != nil {
+		return errors.Wrapf(err, "StateChangeFileReader.Close: Error closing state change file")
+	}
+	if err := reader.indexFile.Close(); err != nil {
+		return errors.Wrapf(err, "StateChangeFileReader.Close: Error closing state change index file")
+	}
+	return nil
+}
+
+// DecodeStateChangeEntry decodes a single StateChangeEntry record, as written by the StateChangeSyncer. The
+// entry's Encoder and AncestralRecord are decoded into the concrete DeSoEncoder for its EncoderType.
+func DecodeStateChangeEntry(entryBytes []byte) (*StateChangeEntry, error) {
+	stateChangeEntry := &StateChangeEntry{}
+	exists, err := DecodeFromBytes(stateChangeEntry, bytes.NewReader(entryBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "DecodeStateChangeEntry: Error decoding entry")
+	}
+	if !exists {
+		return nil, fmt.Errorf("DecodeStateChangeEntry: Entry is empty")
+	}
+	return stateChangeEntry, nil
+}
+
+// DecodeStateChangeEntries decodes a concatenation of uvarint length-prefixed StateChangeEntry records. This is
+// the format of the state change file, the payload of StateChangeSocketSink messages, and the StateChangeBytes
+// buffered in UnflushedStateSyncerBytes.
+func DecodeStateChangeEntries(stateChangeBytes []byte) ([]*StateChangeEntry, error) {
+	var stateChangeEntries []*StateChangeEntry
+	rr := bytes.NewReader(stateChangeBytes)
+	for rr.Len() > 0 {
+		entryBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DecodeStateChangeEntries: Error reading entry %d", len(stateChangeEntries))
+		}
+		stateChangeEntry, err := DecodeStateChangeEntry(entryBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "DecodeStateChangeEntries: Error decoding entry %d", len(stateChangeEntries))
+		}
+		stateChangeEntries = append(stateChangeEntries, stateChangeEntry)
+	}
+	return stateChangeEntries, nil
+}
+
+// GetStateChangeEntries decodes the StateChangeEntry records that are waiting to be flushed.
+func (unflushedBytes *UnflushedStateSyncerBytes) GetStateChangeEntries() ([]*StateChangeEntry, error) {
+	stateChangeEntries, err := DecodeStateChangeEntries(unflushedBytes.StateChangeBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(stateChangeEntries) != len(unflushedBytes.StateChangeOperationIndexes) {
+		return nil, fmt.Errorf("UnflushedStateSyncerBytes.GetStateChangeEntries: Decoded %d entries but have %d "+
+			"operation indexes", len(stateChangeEntries), len(unflushedBytes.StateChangeOperationIndexes))
+	}
+	return stateChangeEntries, nil
+}
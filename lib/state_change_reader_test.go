@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateChangeFileReader(t *testing.T) {
+	require := require.New(t)
+	stateChangeDir := t.TempDir()
+
+	sink, err := NewStateChangeFileSink(stateChangeDir)
+	require.NoError(err)
+	defer sink.Close()
+
+	// Write two committed flushes and one mempool flush.
+	entries := _testStateChangeEntries()
+	stateChangeBytes, entryOffsets := _testStateChangeBytes(entries)
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	require.NoError(sink.WriteStateChanges(stateChangeBytes[:entryOffsets[1]], entryOffsets[:1], true))
+
+	reader, err := OpenStateChangeFileReader(stateChangeDir, false)
+	require.NoError(err)
+	defer reader.Close()
+	require.False(reader.IsMempool())
+
+	numEntries, err := reader.NumEntries()
+	require.NoError(err)
+	require.Equal(uint64(2*len(entries)), numEntries)
+
+	requireEntryEqual := func(expected *StateChangeEntry, actual *StateChangeEntry) {
+		require.Equal(expected.OperationType, actual.OperationType)
+		require.Equal(expected.KeyBytes, actual.KeyBytes)
+		require.Equal(expected.EncoderType, actual.EncoderType)
+		require.Equal(expected.FlushId, actual.FlushId)
+		if expected.Encoder == nil {
+			require.Nil(actual.Encoder)
+		} else {
+			require.Equal(EncodeToBytes(0, expected.Encoder), EncodeToBytes(0, actual.Encoder))
+		}
+	}
+
+	// Random access decodes the encoder into its concrete type.
+	entry, err := reader.ReadEntry(2)
+	require.NoError(err)
+	requireEntryEqual(entries[0], entry)
+	postEntry, ok := entry.Encoder.(*PostEntry)
+	require.True(ok)
+	require.Equal([]byte("first"), postEntry.Body)
+	_, err = reader.ReadEntry(numEntries)
+	require.Error(err)
+
+	// Iterating from an index visits every remaining entry in order.
+	var visitedIndexes []uint64
+	require.NoError(reader.Iterate(1, func(index uint64, entry *StateChangeEntry) error {
+		visitedIndexes = append(visitedIndexes, index)
+		requireEntryEqual(entries[index%uint64(len(entries))], entry)
+		return nil
+	}))
+	require.Equal([]uint64{1, 2, 3}, visitedIndexes)
+
+	// The mempool files are read separately.
+	mempoolReader, err := OpenStateChangeFileReader(stateChangeDir, true)
+	require.NoError(err)
+	defer mempoolReader.Close()
+	numEntries, err = mempoolReader.NumEntries()
+	require.NoError(err)
+	require.Equal(uint64(1), numEntries)
+	entry, err = mempoolReader.ReadEntry(0)
+	require.NoError(err)
+	requireEntryEqual(entries[0], entry)
+
+	// Unflushed bytes decode to the same entries.
+	unflushedBytes := &UnflushedStateSyncerBytes{
+		StateChangeBytes:            stateChangeBytes,
+		StateChangeOperationIndexes: entryOffsets,
+	}
+	decodedEntries, err := unflushedBytes.GetStateChangeEntries()
+	require.NoError(err)
+	require.Len(decodedEntries, len(entries))
+	for ii := range entries {
+		requireEntryEqual(entries[ii], decodedEntries[ii])
+	}
+}
@@ -0,0 +1,295 @@
+package lib
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// StateChangeSink is the destination that the StateChangeSyncer writes state changes to. Every time a flush
+// completes, the syncer hands the encoded StateChangeEntry records for that flush to each of its sinks.
+//
+// The records are passed in the same format that's written to the state change file: a concatenation of
+// byte arrays, each prefixed by its uvarint length, where each byte array is a StateChangeEntry encoded with
+// EncodeToBytes. entryOffsets holds the offset of each record within stateChangeBytes, which allows a sink to
+// split the records without decoding them.
+//
+// All methods are called while the StateChangeSyncer holds its StateSyncerMutex, so sinks don't need to guard
+// against concurrent calls from the syncer.
+type StateChangeSink interface {
+	// WriteStateChanges writes the state change records from a single flush. isMempool is true if the records
+	// came from a mempool flush, in which case they can be discarded by a subsequent call to ResetMempool.
+	WriteStateChanges(stateChangeBytes []byte, entryOffsets []uint64, isMempool bool) error
+	// ResetMempool discards all mempool state changes that were written to the sink. It's called whenever
+	// the syncer decides that consumers should revert their mempool state and sync it from scratch.
+	ResetMempool() error
+	// Reset discards all committed state changes that were written to the sink. It's called when the node
+	// needs to resync from scratch.
+	Reset() error
+	// HasCommittedStateChanges returns true if the sink already holds committed state changes from a previous
+	// run. Sinks that don't retain state changes, such as streams, should always return false.
+	HasCommittedStateChanges() (bool, error)
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// StateChangeFileSink writes state changes to a flat file, alongside an index file that allows quick lookup of a
+// StateChangeEntry given its index in the file. Committed and mempool state changes are written to separate files.
+// This is the sink that's always used when a state change directory is provided to the node.
+//
+// The sink also maintains a log ID, which is a random identifier for the current contents of the committed state
+// change file. A new log ID is generated whenever the file is reset, which lets consumers that checkpoint their
+// position in the file detect that the entries they've processed were rewritten. See StateChangeConsumerCheckpoint.
+type StateChangeFileSink struct {
+	stateChangeDir string
+	LogId          uuid.UUID
+
+	// The file that the state changes are written to.
+	StateChangeFile        *os.File
+	StateChangeMempoolFile *os.File
+	// The file that allows quick lookup of a StateChangeEntry given its index in the file.
+	// This is represented by a list of uint64s, where each uint64 is the offset of the state change entry in the
+	// state change file.
+	StateChangeIndexFile        *os.File
+	StateChangeFileSize         uint64
+	StateChangeMempoolIndexFile *os.File
+	StateChangeMempoolFileSize  uint64
+}
+
+// Open a file, create if it doesn't exist.
+func openOrCreateLogFile(filePath string) (*os.File, error) {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating directory: %v", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// NewStateChangeFileSink opens, or creates, the state change files in stateChangeDir.
+func NewStateChangeFileSink(stateChangeDir string) (*StateChangeFileSink, error) {
+	stateChangeFile, err := openOrCreateLogFile(filepath.Join(stateChangeDir, StateChangeFileName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error opening stateChangeFile")
+	}
+	stateChangeIndexFile, err := openOrCreateLogFile(filepath.Join(stateChangeDir, StateChangeIndexFileName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error opening stateChangeIndexFile")
+	}
+	stateChangeMempoolFile, err := openOrCreateLogFile(filepath.Join(stateChangeDir, StateChangeMempoolFileName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error opening stateChangeMempoolFile")
+	}
+	stateChangeMempoolIndexFile, err := openOrCreateLogFile(filepath.Join(stateChangeDir, StateChangeMempoolIndexFileName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error opening stateChangeMempoolIndexFile")
+	}
+
+	stateChangeFileInfo, err := stateChangeFile.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error getting stateChangeFileInfo")
+	}
+	stateChangeMempoolFileInfo, err := stateChangeMempoolFile.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error getting stateChangeMempoolFileInfo")
+	}
+
+	// Generate a log ID if this is a new state change dir, or one created before log IDs were introduced.
+	logId, err := ReadStateChangeLogId(stateChangeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error reading log ID")
+	}
+	if logId == uuid.Nil {
+		if logId, err = writeNewStateChangeLogId(stateChangeDir); err != nil {
+			return nil, errors.Wrapf(err, "NewStateChangeFileSink: Error writing log ID")
+		}
+	}
+
+	return &StateChangeFileSink{
+		stateChangeDir:              stateChangeDir,
+		LogId:                       logId,
+		StateChangeFile:             stateChangeFile,
+		StateChangeIndexFile:        stateChangeIndexFile,
+		StateChangeFileSize:         uint64(stateChangeFileInfo.Size()),
+		StateChangeMempoolFile:      stateChangeMempoolFile,
+		StateChangeMempoolIndexFile: stateChangeMempoolIndexFile,
+		StateChangeMempoolFileSize:  uint64(stateChangeMempoolFileInfo.Size()),
+	}, nil
+}
+
+// WriteStateChanges appends the state change records to the relevant state change file, and writes the offset of
+// each record in that file to the corresponding index file.
+func (sink *StateChangeFileSink) WriteStateChanges(stateChangeBytes []byte, entryOffsets []uint64, isMempool bool) error {
+	var flushFile *os.File
+	var flushFileSize uint64
+	var indexFile *os.File
+	stateChangeType := "committed"
+	if isMempool {
+		flushFile = sink.StateChangeMempoolFile
+		flushFileSize = sink.StateChangeMempoolFileSize
+		indexFile = sink.StateChangeMempoolIndexFile
+		stateChangeType = "mempool"
+	} else {
+		flushFile = sink.StateChangeFile
+		flushFileSize = sink.StateChangeFileSize
+		indexFile = sink.StateChangeIndexFile
+	}
+
+	// Write the encoded StateChangeEntry bytes to the state changer file.
+	if _, err := flushFile.Write(stateChangeBytes); err != nil {
+		return fmt.Errorf("Error writing to %s state change file: %v", stateChangeType, err)
+	}
+
+	// Buffer to hold bytes for index file
+	stateChangeIndexBuf := make([]byte, 0, 8*len(entryOffsets))
+
+	// Loop through the index bytes of the state change file and write them to the index file.
+	// The entryOffsets array contains the byte index of where each transaction occurs within the
+	// unflushed state change bytes (e.g. the first value in the slice will always be 0).
+	// We need to add the size of the state change file to each of these values to get the byte index
+	// in the state change file.
+	for _, indexBytes := range entryOffsets {
+		// Get the byte index of where this transaction occurs in the state change file.
+		dbOperationIndex, err := SafeUint64().Add(indexBytes, flushFileSize)
+		if err != nil {
+			return fmt.Errorf("Error writing to %s state change index file: %v", stateChangeType, err)
+		}
+		// Convert the byte index value to a uint64 byte slice.
+		dbOperationIndexBytes := make([]byte, 8)
+		binary.LittleEndian.PutUint64(dbOperationIndexBytes, dbOperationIndex)
+
+		stateChangeIndexBuf = append(stateChangeIndexBuf, dbOperationIndexBytes...)
+	}
+
+	// Write the encoded uint64 indexes to the index file.
+	if _, err := indexFile.Write(stateChangeIndexBuf); err != nil {
+		return fmt.Errorf("Error writing to %s state change index file: %v", stateChangeType, err)
+	}
+	if isMempool {
+		sink.StateChangeMempoolFileSize += uint64(len(stateChangeBytes))
+	} else {
+		sink.StateChangeFileSize += uint64(len(stateChangeBytes))
+	}
+	return nil
+}
+
+// ResetMempool truncates the mempool state change file and its index file.
+func (sink *StateChangeFileSink) ResetMempool() error {
+	if err := sink.StateChangeMempoolFile.Truncate(0); err != nil {
+		return errors.Wrapf(err, "StateChangeFileSink.ResetMempool: Error truncating stateChangeMempoolFile")
+	}
+	if err := sink.StateChangeMempoolIndexFile.Truncate(0); err != nil {
+		return errors.Wrapf(err, "StateChangeFileSink.ResetMempool: Error truncating stateChangeMempoolIndexFile")
+	}
+	sink.StateChangeMempoolFileSize = 0
+	return nil
+}
+
+// Reset truncates the committed state change file and its index file. A new log ID is written before the files
+// are truncated, so that a consumer can never observe the truncated files under the old log ID.
+func (sink *StateChangeFileSink) Reset() error {
+	logId, err := writeNewStateChangeLogId(sink.stateChangeDir)
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeFileSink.Reset: Error writing log ID")
+	}
+	sink.LogId = logId
+
+	if err := sink.StateChangeFile.Truncate(0); err != nil {
+		return errors.Wrapf(err, "StateChangeFileSink.Reset: Error truncating stateChangeFile")
+	}
+	if err := sink.StateChangeIndexFile.Truncate(0); err != nil {
+		return errors.Wrapf(err, "StateChangeFileSink.Reset: Error truncating stateChangeIndexFile")
+	}
+	sink.StateChangeFileSize = 0
+	return nil
+}
+
+// HasCommittedStateChanges returns true if the committed state change file is non-empty.
+func (sink *StateChangeFileSink) HasCommittedStateChanges() (bool, error) {
+	stateChangeFileInfo, err := sink.StateChangeFile.Stat()
+	if err != nil {
+		return false, errors.Wrapf(err, "StateChangeFileSink.HasCommittedStateChanges: Error getting stateChangeFileInfo")
+	}
+	return stateChangeFileInfo.Size() > 0, nil
+}
+
+// Close closes all the state change files.
+func (sink *StateChangeFileSink) Close() error {
+	for _, file := range []*os.File{
+		sink.StateChangeFile,
+		sink.StateChangeIndexFile,
+		sink.StateChangeMempoolFile,
+		sink.StateChangeMempoolIndexFile,
+	} {
+		if err := file.Close(); err != nil {
+			return errors.Wrapf(err, "StateChangeFileSink.Close: Error closing %v", file.Name())
+		}
+	}
+	return nil
+}
+
+// ReadStateChangeLogId returns the log ID of the committed state change file in stateChangeDir, or uuid.Nil if the
+// dir doesn't have one yet.
+func ReadStateChangeLogId(stateChangeDir string) (uuid.UUID, error) {
+	logIdBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeLogIdFileName))
+	if os.IsNotExist(err) {
+		return uuid.Nil, nil
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+	if len(logIdBytes) != 16 {
+		return uuid.Nil, nil
+	}
+	return uuid.FromBytes(logIdBytes)
+}
+
+// writeNewStateChangeLogId generates a new log ID and atomically writes it to stateChangeDir.
+func writeNewStateChangeLogId(stateChangeDir string) (uuid.UUID, error) {
+	logId := uuid.New()
+	logIdBytes, _ := logId.MarshalBinary()
+	if err := writeFileAtomically(filepath.Join(stateChangeDir, StateChangeLogIdFileName), logIdBytes); err != nil {
+		return uuid.Nil, err
+	}
+	return logId, nil
+}
+
+// ReadStateChangeSequenceNumberHighWaterMark returns the sequence number high-water mark persisted in stateChangeDir,
+// or 0 if the dir doesn't have one yet.
+func ReadStateChangeSequenceNumberHighWaterMark(stateChangeDir string) (uint64, error) {
+	highWaterMarkBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeSequenceNumberFileName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(highWaterMarkBytes) != 8 {
+		return 0, fmt.Errorf("ReadStateChangeSequenceNumberHighWaterMark: Expected 8 bytes, got %d",
+			len(highWaterMarkBytes))
+	}
+	return binary.LittleEndian.Uint64(highWaterMarkBytes), nil
+}
+
+// writeStateChangeSequenceNumberHighWaterMark atomically writes the sequence number high-water mark to stateChangeDir.
+func writeStateChangeSequenceNumberHighWaterMark(stateChangeDir string, nextSequenceNumber uint64) error {
+	highWaterMarkBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(highWaterMarkBytes, nextSequenceNumber)
+	return writeFileAtomically(filepath.Join(stateChangeDir, StateChangeSequenceNumberFileName), highWaterMarkBytes)
+}
+
+// writeFileAtomically writes data to a temporary file and renames it to filePath, so that readers see either the
+// old contents or the new contents, never a partial write.
+func writeFileAtomically(filePath string, data []byte) error {
+	tempFilePath := filePath + ".tmp"
+	if err := os.WriteFile(tempFilePath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, filePath)
+}
@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// _testStateChangeBlockHeight returns a block height at which StateChangeEntries are encoded with a sequence number.
+func _testStateChangeBlockHeight() uint64 {
+	return uint64(GlobalDeSoParams.ForkHeights.ProofOfStake1StateSetupBlockHeight)
+}
+
+// _testStateChangeBytes encodes the entries in the same format the StateChangeSyncer hands to its sinks.
+func _testStateChangeBytes(entries []*StateChangeEntry) (_stateChangeBytes []byte, _entryOffsets []uint64) {
+	var stateChangeBytes []byte
+	var entryOffsets []uint64
+	for _, entry := range entries {
+		entryOffsets = append(entryOffsets, uint64(len(stateChangeBytes)))
+		stateChangeBytes = append(stateChangeBytes, EncodeByteArray(EncodeToBytes(_testStateChangeBlockHeight(), entry, false))...)
+	}
+	return stateChangeBytes, entryOffsets
+}
+
+func _testStateChangeEntries() []*StateChangeEntry {
+	flushId := uuid.New()
+	return []*StateChangeEntry{
+		{
+			OperationType: DbOperationTypeUpsert,
+			KeyBytes:      []byte{1, 2, 3},
+			Encoder:       &PostEntry{Body: []byte("first")},
+			EncoderType:   EncoderTypePostEntry,
+			FlushId:       flushId,
+		},
+		{
+			OperationType: DbOperationTypeDelete,
+			KeyBytes:      []byte{4, 5, 6},
+			EncoderType:   EncoderTypePostEntry,
+			FlushId:       flushId,
+		},
+	}
+}
+
+func TestStateChangeFileSink(t *testing.T) {
+	require := require.New(t)
+	stateChangeDir := t.TempDir()
+
+	sink, err := NewStateChangeFileSink(stateChangeDir)
+	require.NoError(err)
+	hasStateChanges, err := sink.HasCommittedStateChanges()
+	require.NoError(err)
+	require.False(hasStateChanges)
+
+	stateChangeBytes, entryOffsets := _testStateChangeBytes(_testStateChangeEntries())
+
+	// Write the same flush twice, so the offsets in the index file have to account for the existing file size.
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, true))
+	hasStateChanges, err = sink.HasCommittedStateChanges()
+	require.NoError(err)
+	require.True(hasStateChanges)
+
+	fileBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeFileName))
+	require.NoError(err)
+	require.Equal(append(append([]byte{}, stateChangeBytes...), stateChangeBytes...), fileBytes)
+
+	indexBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeIndexFileName))
+	require.NoError(err)
+	require.Len(indexBytes, 8*2*len(entryOffsets))
+	for ii := 0; ii < 2*len(entryOffsets); ii++ {
+		expectedOffset := entryOffsets[ii%len(entryOffsets)] + uint64(ii/len(entryOffsets)*len(stateChangeBytes))
+		require.Equal(expectedOffset, binary.LittleEndian.Uint64(indexBytes[8*ii:8*(ii+1)]))
+	}
+
+	// Resetting the mempool only truncates the mempool files.
+	require.NoError(sink.ResetMempool())
+	mempoolBytes, err := os.ReadFile(filepath.Join(stateChangeDir, StateChangeMempoolFileName))
+	require.NoError(err)
+	require.Empty(mempoolBytes)
+	require.Equal(uint64(0), sink.StateChangeMempoolFileSize)
+	require.Equal(uint64(2*len(stateChangeBytes)), sink.StateChangeFileSize)
+
+	// Reopening the sink picks up the existing file sizes.
+	require.NoError(sink.Close())
+	sink, err = NewStateChangeFileSink(stateChangeDir)
+	require.NoError(err)
+	require.Equal(uint64(2*len(stateChangeBytes)), sink.StateChangeFileSize)
+
+	require.NoError(sink.Reset())
+	hasStateChanges, err = sink.HasCommittedStateChanges()
+	require.NoError(err)
+	require.False(hasStateChanges)
+	require.NoError(sink.Close())
+}
+
+func TestStateChangeSocketSink(t *testing.T) {
+	require := require.New(t)
+
+	// Unix socket paths are limited in length, so avoid the long paths returned by t.TempDir.
+	socketDir, err := os.MkdirTemp("", "scs")
+	require.NoError(err)
+	defer os.RemoveAll(socketDir)
+
+	sink, err := NewStateChangeSocketSink(filepath.Join(socketDir, "state-changes.sock"))
+	require.NoError(err)
+	defer sink.Close()
+
+	conn, err := net.Dial("unix", sink.SocketPath())
+	require.NoError(err)
+	defer conn.Close()
+	require.Eventually(func() bool { return sink.NumClients() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	entries := _testStateChangeEntries()
+	stateChangeBytes, entryOffsets := _testStateChangeBytes(entries)
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, true))
+	require.NoError(sink.ResetMempool())
+
+	reader := bufio.NewReader(conn)
+	require.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	readMessage := func() (StateChangeStreamMessageType, []byte) {
+		messageType, err := reader.ReadByte()
+		require.NoError(err)
+		payload, err := DecodeByteArray(reader)
+		require.NoError(err)
+		return StateChangeStreamMessageType(messageType), payload
+	}
+
+	// The first message carries the mempool records, which decode back into the original entries.
+	messageType, payload := readMessage()
+	require.Equal(StateChangeStreamMessageTypeMempool, messageType)
+	require.Equal(stateChangeBytes, payload)
+	payloadReader := bytes.NewReader(payload)
+	for _, entry := range entries {
+		entryBytes, err := DecodeByteArray(payloadReader)
+		require.NoError(err)
+		decodedEntry := &StateChangeEntry{}
+		exists, err := DecodeFromBytes(decodedEntry, bytes.NewReader(entryBytes))
+		require.NoError(err)
+		require.True(exists)
+		require.Equal(entry.OperationType, decodedEntry.OperationType)
+		require.Equal(entry.KeyBytes, decodedEntry.KeyBytes)
+		require.Equal(entry.FlushId, decodedEntry.FlushId)
+	}
+
+	// The second message tells the consumer to revert its mempool state.
+	messageType, payload = readMessage()
+	require.Equal(StateChangeStreamMessageTypeResetMempool, messageType)
+	require.Empty(payload)
+
+	// Closing the sink disconnects the consumer.
+	require.NoError(sink.Close())
+	_, err = reader.ReadByte()
+	require.Error(err)
+}
+
+func TestStateChangeSocketSinkSlowConsumer(t *testing.T) {
+	require := require.New(t)
+
+	socketDir, err := os.MkdirTemp("", "scs")
+	require.NoError(err)
+	defer os.RemoveAll(socketDir)
+
+	sink, err := NewStateChangeSocketSink(filepath.Join(socketDir, "state-changes.sock"))
+	require.NoError(err)
+	defer sink.Close()
+
+	conn, err := net.Dial("unix", sink.SocketPath())
+	require.NoError(err)
+	defer conn.Close()
+	require.Eventually(func() bool { return sink.NumClients() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// A consumer that stops reading falls behind once the socket buffer and its queue fill up, and is disconnected.
+	payload := bytes.Repeat([]byte{0x01}, 16*1024)
+	for ii := 0; ii < stateChangeSocketClientBufferSize+256; ii++ {
+		require.NoError(sink.WriteStateChanges(payload, []uint64{0}, true))
+	}
+	require.Equal(0, sink.NumClients())
+
+	// Its connection is closed, so it sees the end of the stream once it catches up on what was already sent.
+	require.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	reader := bufio.NewReader(conn)
+	for {
+		if _, err = reader.ReadByte(); err != nil {
+			break
+		}
+	}
+	require.NotContains(err.Error(), "timeout")
+}
+
+func TestStateChangeSQLiteSink(t *testing.T) {
+	require := require.New(t)
+
+	sink, err := NewStateChangeSQLiteSink(filepath.Join(t.TempDir(), "state-changes.db"))
+	require.NoError(err)
+	defer sink.Close()
+
+	entries := _testStateChangeEntries()
+	stateChangeBytes, entryOffsets := _testStateChangeBytes(entries)
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, false))
+	require.NoError(sink.WriteStateChanges(stateChangeBytes, entryOffsets, true))
+	hasStateChanges, err := sink.HasCommittedStateChanges()
+	require.NoError(err)
+	require.True(hasStateChanges)
+
+	rows, err := sink.db.Query(`SELECT operation_type, key_bytes, block_height, entry_bytes FROM ` +
+		StateChangeSQLiteCommittedTable + ` ORDER BY id`)
+	require.NoError(err)
+	ii := 0
+	for rows.Next() {
+		var operationType uint8
+		var keyBytes, entryBytes []byte
+		var blockHeight uint64
+		require.NoError(rows.Scan(&operationType, &keyBytes, &blockHeight, &entryBytes))
+		require.Equal(uint8(entries[ii].OperationType), operationType)
+		require.Equal(entries[ii].KeyBytes, keyBytes)
+		require.Equal(_testStateChangeBlockHeight(), blockHeight)
+		require.Equal(EncodeToBytes(_testStateChangeBlockHeight(), entries[ii], false), entryBytes)
+		ii++
+	}
+	require.NoError(rows.Err())
+	require.NoError(rows.Close())
+	require.Equal(len(entries), ii)
+
+	countRows := func(table string) int {
+		var count int
+		require.NoError(sink.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count))
+		return count
+	}
+	require.NoError(sink.ResetMempool())
+	require.Equal(0, countRows(StateChangeSQLiteMempoolTable))
+	require.Equal(len(entries), countRows(StateChangeSQLiteCommittedTable))
+
+	require.NoError(sink.Reset())
+	hasStateChanges, err = sink.HasCommittedStateChanges()
+	require.NoError(err)
+	require.False(hasStateChanges)
+}
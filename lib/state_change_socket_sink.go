@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// StateChangeStreamMessageType is the type of a message sent by the StateChangeSocketSink.
+type StateChangeStreamMessageType uint8
+
+const (
+	// StateChangeStreamMessageTypeCommitted carries the state change records from a committed flush.
+	StateChangeStreamMessageTypeCommitted StateChangeStreamMessageType = 0
+	// StateChangeStreamMessageTypeMempool carries the state change records from a mempool flush.
+	StateChangeStreamMessageTypeMempool StateChangeStreamMessageType = 1
+	// StateChangeStreamMessageTypeResetMempool tells the consumer to revert all the mempool state changes
+	// it has received so far.
+	StateChangeStreamMessageTypeResetMempool StateChangeStreamMessageType = 2
+	// StateChangeStreamMessageTypeReset tells the consumer that the node is resyncing from scratch, and that
+	// all the committed state changes it has received so far should be discarded.
+	StateChangeStreamMessageTypeReset StateChangeStreamMessageType = 3
+)
+
+// stateChangeSocketClientBufferSize is the number of messages that can be queued for a single client. If a client
+// falls this far behind, it's disconnected rather than allowing it to hold up the node.
+const stateChangeSocketClientBufferSize = 1024
+
+// stateChangeSocketWriteTimeout is how long a single write to a client can block before the client is disconnected.
+const stateChangeSocketWriteTimeout = 30 * time.Second
+
+// StateChangeSocketSink streams state changes to every consumer connected to a local Unix socket. This lets
+// a consumer follow the node's state changes as they happen, without tailing and parsing the state change file.
+//
+// Each message is encoded as:
+// [message type (1 byte)][payload length (uvarint)][payload]
+// For committed and mempool messages the payload is in the same format as the state change file, i.e. a
+// concatenation of uvarint length-prefixed StateChangeEntry records. Reset messages have an empty payload.
+//
+// The stream only carries the state changes that are flushed while a consumer is connected. A consumer that
+// needs the full history should bootstrap from the state change file, and then use the stream to stay current.
+type StateChangeSocketSink struct {
+	socketPath string
+	listener   net.Listener
+
+	// clients maps each connected consumer to the queue of messages waiting to be written to it.
+	clients  map[net.Conn]chan []byte
+	isClosed bool
+	mtx      sync.Mutex
+
+	wg sync.WaitGroup
+}
+
+// NewStateChangeSocketSink starts listening for consumers on the Unix socket at socketPath. Any stale socket
+// file left behind by a previous run is removed.
+func NewStateChangeSocketSink(socketPath string) (*StateChangeSocketSink, error) {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "NewStateChangeSocketSink: Error removing stale socket %v", socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeSocketSink: Error listening on %v", socketPath)
+	}
+
+	sink := &StateChangeSocketSink{
+		socketPath: socketPath,
+		listener:   listener,
+		clients:    make(map[net.Conn]chan []byte),
+	}
+	sink.wg.Add(1)
+	go sink.acceptConnections()
+	return sink, nil
+}
+
+// SocketPath returns the path of the Unix socket that consumers connect to.
+func (sink *StateChangeSocketSink) SocketPath() string {
+	return sink.socketPath
+}
+
+func (sink *StateChangeSocketSink) acceptConnections() {
+	defer sink.wg.Done()
+	for {
+		conn, err := sink.listener.Accept()
+		if err != nil {
+			sink.mtx.Lock()
+			isClosed := sink.isClosed
+			sink.mtx.Unlock()
+			if !isClosed {
+				glog.Errorf("StateChangeSocketSink.acceptConnections: Error accepting connection: %v", err)
+			}
+			return
+		}
+
+		sink.mtx.Lock()
+		if sink.isClosed {
+			sink.mtx.Unlock()
+			conn.Close()
+			return
+		}
+		messages := make(chan []byte, stateChangeSocketClientBufferSize)
+		sink.clients[conn] = messages
+		sink.wg.Add(1)
+		sink.mtx.Unlock()
+
+		glog.V(1).Infof("StateChangeSocketSink: Consumer connected to %v", sink.socketPath)
+		go sink.writeToClient(conn, messages)
+	}
+}
+
+// writeToClient writes queued messages to a single consumer until its queue is closed or a write fails.
+func (sink *StateChangeSocketSink) writeToClient(conn net.Conn, messages chan []byte) {
+	defer sink.wg.Done()
+	defer conn.Close()
+	for message := range messages {
+		// Bound every write, so that a consumer that stops reading can't hold this goroutine forever.
+		if err := conn.SetWriteDeadline(time.Now().Add(stateChangeSocketWriteTimeout)); err != nil {
+			glog.V(1).Infof("StateChangeSocketSink: Disconnecting consumer after error setting deadline: %v", err)
+			sink.removeClient(conn)
+			return
+		}
+		if _, err := conn.Write(message); err != nil {
+			glog.V(1).Infof("StateChangeSocketSink: Disconnecting consumer after write error: %v", err)
+			sink.removeClient(conn)
+			return
+		}
+	}
+}
+
+func (sink *StateChangeSocketSink) removeClient(conn net.Conn) {
+	sink.mtx.Lock()
+	defer sink.mtx.Unlock()
+	if messages, exists := sink.clients[conn]; exists {
+		delete(sink.clients, conn)
+		close(messages)
+	}
+}
+
+// broadcast queues a message for every connected consumer. Consumers whose queue is full are disconnected. Their
+// connection is closed right away, rather than once the queue drains, so that the consumer can't mistake the
+// truncated stream for a complete one.
+func (sink *StateChangeSocketSink) broadcast(messageType StateChangeStreamMessageType, payload []byte) {
+	message := append([]byte{byte(messageType)}, UintToBuf(uint64(len(payload)))...)
+	message = append(message, payload...)
+
+	sink.mtx.Lock()
+	defer sink.mtx.Unlock()
+	for conn, messages := range sink.clients {
+		select {
+		case messages <- message:
+		default:
+			glog.Warningf("StateChangeSocketSink.broadcast: Disconnecting consumer that fell more than %d "+
+				"messages behind", stateChangeSocketClientBufferSize)
+			delete(sink.clients, conn)
+			close(messages)
+			conn.Close()
+		}
+	}
+}
+
+// NumClients returns the number of consumers currently connected to the socket.
+func (sink *StateChangeSocketSink) NumClients() int {
+	sink.mtx.Lock()
+	defer sink.mtx.Unlock()
+	return len(sink.clients)
+}
+
+func (sink *StateChangeSocketSink) WriteStateChanges(stateChangeBytes []byte, entryOffsets []uint64, isMempool bool) error {
+	messageType := StateChangeStreamMessageTypeCommitted
+	if isMempool {
+		messageType = StateChangeStreamMessageTypeMempool
+	}
+	sink.broadcast(messageType, stateChangeBytes)
+	return nil
+}
+
+func (sink *StateChangeSocketSink) ResetMempool() error {
+	sink.broadcast(StateChangeStreamMessageTypeResetMempool, nil)
+	return nil
+}
+
+func (sink *StateChangeSocketSink) Reset() error {
+	sink.broadcast(StateChangeStreamMessageTypeReset, nil)
+	return nil
+}
+
+// HasCommittedStateChanges always returns false, as the stream doesn't retain any state changes.
+func (sink *StateChangeSocketSink) HasCommittedStateChanges() (bool, error) {
+	return false, nil
+}
+
+// Close stops accepting consumers, disconnects the connected ones, and removes the socket file.
+func (sink *StateChangeSocketSink) Close() error {
+	sink.mtx.Lock()
+	if sink.isClosed {
+		sink.mtx.Unlock()
+		return nil
+	}
+	sink.isClosed = true
+	for conn, messages := range sink.clients {
+		delete(sink.clients, conn)
+		close(messages)
+		// Closing the connection unblocks any write that's stuck on a consumer that stopped reading.
+		conn.Close()
+	}
+	sink.mtx.Unlock()
+
+	err := sink.listener.Close()
+	sink.wg.Wait()
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeSocketSink.Close: Error closing listener")
+	}
+	return nil
+}
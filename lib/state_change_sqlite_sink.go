@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	// Registers the pure-Go "sqlite" driver with database/sql.
+	_ "modernc.org/sqlite"
+)
+
+const (
+	StateChangeSQLiteCommittedTable = "committed_state_changes"
+	StateChangeSQLiteMempoolTable   = "mempool_state_changes"
+)
+
+// StateChangeSQLiteSink writes state changes to a SQLite database, with one row per StateChangeEntry. This lets
+// consumers query the node's state changes with SQL rather than parsing the binary state change file.
+//
+// Committed and mempool state changes are written to separate tables with the same schema. Each row contains the
+// fields of the entry that consumers typically filter on, along with the full encoded entry in entry_bytes, which
+// can be decoded with DecodeFromBytes into a StateChangeEntry.
+type StateChangeSQLiteSink struct {
+	db *sql.DB
+}
+
+// NewStateChangeSQLiteSink opens, or creates, the SQLite database at dbPath and creates the state change tables
+// if they don't already exist.
+func NewStateChangeSQLiteSink(dbPath string) (*StateChangeSQLiteSink, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeSQLiteSink: Error creating directory")
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewStateChangeSQLiteSink: Error opening %v", dbPath)
+	}
+	// SQLite only supports a single writer, and all writes come from the StateChangeSyncer anyway.
+	db.SetMaxOpenConns(1)
+
+	// WAL mode allows consumers to read the database while the node is writing to it.
+	statements := []string{`PRAGMA journal_mode=WAL`}
+	for _, table := range []string{StateChangeSQLiteCommittedTable, StateChangeSQLiteMempoolTable} {
+		statements = append(statements,
+			fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %[1]s (
+					id             INTEGER PRIMARY KEY AUTOINCREMENT,
+					operation_type INTEGER NOT NULL,
+					is_reverted    INTEGER NOT NULL,
+					encoder_type   INTEGER NOT NULL,
+					key_bytes      BLOB    NOT NULL,
+					block_height   INTEGER NOT NULL,
+					flush_id       TEXT    NOT NULL,
+					entry_bytes    BLOB    NOT NULL
+				)`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_encoder_type_idx ON %[1]s (encoder_type)`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_block_height_idx ON %[1]s (block_height)`, table),
+		)
+	}
+	for _, statement := range statements {
+		if _, err = db.Exec(statement); err != nil {
+			db.Close()
+			return nil, errors.Wrapf(err, "NewStateChangeSQLiteSink: Error initializing database")
+		}
+	}
+
+	return &StateChangeSQLiteSink{db: db}, nil
+}
+
+// WriteStateChanges decodes each state change record and inserts it into the relevant table. All the records
+// from a flush are inserted in a single SQLite transaction.
+func (sink *StateChangeSQLiteSink) WriteStateChanges(stateChangeBytes []byte, entryOffsets []uint64, isMempool bool) error {
+	table := StateChangeSQLiteCommittedTable
+	if isMempool {
+		table = StateChangeSQLiteMempoolTable
+	}
+
+	tx, err := sink.db.Begin()
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error starting transaction")
+	}
+	defer tx.Rollback()
+
+	insertStatement, err := tx.Prepare(fmt.Sprintf(`
+		INSERT INTO %s (operation_type, is_reverted, encoder_type, key_bytes, block_height, flush_id, entry_bytes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, table))
+	if err != nil {
+		return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error preparing insert")
+	}
+	defer insertStatement.Close()
+
+	for _, entryOffset := range entryOffsets {
+		if entryOffset >= uint64(len(stateChangeBytes)) {
+			return fmt.Errorf("StateChangeSQLiteSink.WriteStateChanges: Entry offset %d out of range", entryOffset)
+		}
+		entryBytes, err := DecodeByteArray(bytes.NewReader(stateChangeBytes[entryOffset:]))
+		if err != nil {
+			return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error reading entry at offset %d", entryOffset)
+		}
+		stateChangeEntry, err := DecodeStateChangeEntry(entryBytes)
+		if err != nil {
+			return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error decoding entry at offset %d", entryOffset)
+		}
+
+		_, err = insertStatement.Exec(
+			uint8(stateChangeEntry.OperationType),
+			stateChangeEntry.IsReverted,
+			uint32(stateChangeEntry.EncoderType),
+			stateChangeEntry.KeyBytes,
+			stateChangeEntry.BlockHeight,
+			stateChangeEntry.FlushId.String(),
+			entryBytes,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error inserting entry")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrapf(err, "StateChangeSQLiteSink.WriteStateChanges: Error committing transaction")
+	}
+	return nil
+}
+
+// ResetMempool deletes all rows from the mempool state change table.
+func (sink *StateChangeSQLiteSink) ResetMempool() error {
+	if _, err := sink.db.Exec(fmt.Sprintf(`DELETE FROM %s`, StateChangeSQLiteMempoolTable)); err != nil {
+		return errors.Wrapf(err, "StateChangeSQLiteSink.ResetMempool: Error deleting mempool state changes")
+	}
+	return nil
+}
+
+// Reset deletes all rows from the committed state change table.
+func (sink *StateChangeSQLiteSink) Reset() error {
+	if _, err := sink.db.Exec(fmt.Sprintf(`DELETE FROM %s`, StateChangeSQLiteCommittedTable)); err != nil {
+		return errors.Wrapf(err, "StateChangeSQLiteSink.Reset: Error deleting committed state changes")
+	}
+	return nil
+}
+
+// HasCommittedStateChanges returns true if the committed state change table has any rows.
+func (sink *StateChangeSQLiteSink) HasCommittedStateChanges() (bool, error) {
+	var hasRows bool
+	err := sink.db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, StateChangeSQLiteCommittedTable)).Scan(&hasRows)
+	if err != nil {
+		return false, errors.Wrapf(err, "StateChangeSQLiteSink.HasCommittedStateChanges: Error querying state changes")
+	}
+	return hasRows, nil
+}
+
+// Close closes the SQLite database.
+func (sink *StateChangeSQLiteSink) Close() error {
+	return sink.db.Close()
+}
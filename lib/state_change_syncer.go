@@ -5,8 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/deso-protocol/go-deadlock"
-	"os"
-	"path/filepath"
+	"io"
+	"math"
 	"sync"
 	"time"
 
@@ -23,15 +23,43 @@ const (
 	DbOperationTypeInsert StateSyncerOperationType = 0
 	DbOperationTypeDelete StateSyncerOperationType = 1
 	DbOperationTypeUpsert StateSyncerOperationType = 2
+	// DbOperationTypeRevertFlush marks a flush that failed. The record carries the FlushId of the failed flush, and
+	// no key or encoder. None of the entries queued for that flush are written, so a consumer should discard
+	// anything it has buffered or applied for that FlushId.
+	DbOperationTypeRevertFlush StateSyncerOperationType = 3
 )
 
+func (operationType StateSyncerOperationType) String() string {
+	switch operationType {
+	case DbOperationTypeInsert:
+		return "Insert"
+	case DbOperationTypeDelete:
+		return "Delete"
+	case DbOperationTypeUpsert:
+		return "Upsert"
+	case DbOperationTypeRevertFlush:
+		return "RevertFlush"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(operationType))
+	}
+}
+
 const (
 	StateChangeFileName             = "state-changes.bin"
 	StateChangeIndexFileName        = "state-changes-index.bin"
 	StateChangeMempoolFileName      = "mempool.bin"
 	StateChangeMempoolIndexFileName = "mempool-index.bin"
+	StateChangeLogIdFileName        = "state-changes-log-id.bin"
+	// StateChangeSequenceNumberFileName holds a high-water mark for the sequence numbers that have been handed out.
+	// It's written before the state change files are truncated, so that entries written after a restart never
+	// reuse the sequence numbers of entries that were discarded.
+	StateChangeSequenceNumberFileName = "state-changes-sequence-number.bin"
 )
 
+// stateChangeSequenceNumberSize is the size of the fixed-width sequence number at the end of an encoded
+// StateChangeEntry. Entries are only encoded with a sequence number from the ProofOfStake1StateSetupMigration on.
+const stateChangeSequenceNumberSize = 8
+
 // StateChangeEntry is used to capture the state of the database. These changes are then written to a file, which is
 // then used to sync data consumers who subscribe to changes to that file.
 type StateChangeEntry struct {
@@ -63,12 +91,21 @@ type StateChangeEntry struct {
 	// For mempool state changes, whether this operation has been booted from the mempool and should be reverted
 	// from the state change record.
 	IsReverted bool
+	// A number that increases monotonically with every entry the StateChangeSyncer writes, across both the
+	// committed and mempool state changes and across restarts. It's assigned when the entry is flushed, so
+	// consumers can rely on entries appearing in sequence number order. Entries encoded before the
+	// ProofOfStake1StateSetupMigration, including entries written before sequence numbers were introduced, don't
+	// have one and decode with a sequence number of 0.
+	SequenceNumber uint64
 }
 
 // RawEncodeWithoutMetadata constructs the bytes to represent a StateChangeEntry.
 // The format is:
 // [operation type (varint)][is reverted bool][encoder type (varint)][key length (varint)][key bytes]
 // [encoder length (varint)][encoder bytes][is mempool (1 byte)][utxo ops length (varint)][utxo ops bytes]
+// [sequence number (8 bytes, little-endian), from the ProofOfStake1StateSetupMigration on]
+// The sequence number is always the last 8 bytes of the entry, so that it can be assigned at flush time without
+// re-encoding the entry. See setStateChangeSequenceNumbers.
 func (stateChangeEntry *StateChangeEntry) RawEncodeWithoutMetadata(blockHeight uint64, skipMetadata ...bool) []byte {
 	// Get byte length of keyBytes (will be nil for mempool transactions)
 	var data []byte
@@ -129,6 +166,13 @@ func (stateChangeEntry *StateChangeEntry) RawEncodeWithoutMetadata(blockHeight u
 		data = append(data, EncodeToBytes(blockHeight, stateChangeEntry.Block)...)
 	}
 
+	// Encode the sequence number.
+	if MigrationTriggered(blockHeight, ProofOfStake1StateSetupMigration) {
+		sequenceNumberBytes := make([]byte, stateChangeSequenceNumberSize)
+		binary.LittleEndian.PutUint64(sequenceNumberBytes, stateChangeEntry.SequenceNumber)
+		data = append(data, sequenceNumberBytes...)
+	}
+
 	return data
 }
 
@@ -197,22 +241,78 @@ func (stateChangeEntry *StateChangeEntry) RawDecodeWithoutMetadata(blockHeight u
 	}
 	stateChangeEntry.BlockHeight = entryBlockHeight
 
-	// Don't decode the block if the encoder type is not a utxo operation.
-	if stateChangeEntry.EncoderType != EncoderTypeUtxoOperation && stateChangeEntry.EncoderType != EncoderTypeUtxoOperationBundle {
-		return nil
+	// Only decode the block if the encoder type is a utxo operation.
+	if stateChangeEntry.EncoderType == EncoderTypeUtxoOperation || stateChangeEntry.EncoderType == EncoderTypeUtxoOperationBundle {
+		block := &MsgDeSoBlock{}
+		if exist, err := DecodeFromBytes(block, rr); exist && err == nil {
+			stateChangeEntry.Block = block
+		} else if err != nil {
+			return errors.Wrapf(err, "StateChangeEntry.RawDecodeWithoutMetadata: error decoding block")
+		}
 	}
 
-	block := &MsgDeSoBlock{}
-	if exist, err := DecodeFromBytes(block, rr); exist && err == nil {
-		stateChangeEntry.Block = block
-	} else if err != nil {
-		return errors.Wrapf(err, "StateChangeEntry.RawDecodeWithoutMetadata: error decoding block")
+	// Decode the sequence number.
+	if MigrationTriggered(blockHeight, ProofOfStake1StateSetupMigration) {
+		sequenceNumberBytes := make([]byte, stateChangeSequenceNumberSize)
+		if _, err = io.ReadFull(rr, sequenceNumberBytes); err != nil {
+			return errors.Wrapf(err, "StateChangeEntry.RawDecodeWithoutMetadata: error decoding sequence number")
+		}
+		stateChangeEntry.SequenceNumber = binary.LittleEndian.Uint64(sequenceNumberBytes)
 	}
 	return nil
 }
 
+// setStateChangeSequenceNumbers assigns consecutive sequence numbers, starting at firstSequenceNumber, to the
+// encoded entries in stateChangeBytes. The bytes are in the format buffered in UnflushedStateSyncerBytes, and
+// entryOffsets holds the offset of each length-prefixed entry. Each entry's sequence number occupies its last
+// 8 bytes, which are overwritten in place. Entries encoded without a sequence number are left as they are, but
+// still use up their sequence number.
+func setStateChangeSequenceNumbers(stateChangeBytes []byte, entryOffsets []uint64, firstSequenceNumber uint64) error {
+	for ii := range entryOffsets {
+		entryEnd := uint64(len(stateChangeBytes))
+		if ii+1 < len(entryOffsets) {
+			entryEnd = entryOffsets[ii+1]
+		}
+		if entryEnd > uint64(len(stateChangeBytes)) || entryEnd < entryOffsets[ii]+stateChangeSequenceNumberSize {
+			return fmt.Errorf("setStateChangeSequenceNumbers: Invalid bounds [%d, %d) for entry %d",
+				entryOffsets[ii], entryEnd, ii)
+		}
+		hasSequenceNumber, err := stateChangeEntryHasSequenceNumber(stateChangeBytes[entryOffsets[ii]:entryEnd])
+		if err != nil {
+			return errors.Wrapf(err, "setStateChangeSequenceNumbers: Problem reading entry %d", ii)
+		}
+		if !hasSequenceNumber {
+			continue
+		}
+		binary.LittleEndian.PutUint64(
+			stateChangeBytes[entryEnd-stateChangeSequenceNumberSize:entryEnd], firstSequenceNumber+uint64(ii))
+	}
+	return nil
+}
+
+// stateChangeEntryHasSequenceNumber returns whether the length-prefixed entry at the start of entryBytes was encoded
+// with a sequence number, which depends on the version byte in its encoder metadata.
+func stateChangeEntryHasSequenceNumber(entryBytes []byte) (bool, error) {
+	rr := bytes.NewReader(entryBytes)
+	if _, err := ReadUvarint(rr); err != nil {
+		return false, errors.Wrapf(err, "stateChangeEntryHasSequenceNumber: Problem reading entry length")
+	}
+	if exists, err := ReadBoolByte(rr); err != nil || !exists {
+		return false, fmt.Errorf("stateChangeEntryHasSequenceNumber: Entry is empty")
+	}
+	if _, err := ReadUvarint(rr); err != nil {
+		return false, errors.Wrapf(err, "stateChangeEntryHasSequenceNumber: Problem reading encoder type")
+	}
+	versionByte, err := ReadUvarint(rr)
+	if err != nil || versionByte > math.MaxUint8 {
+		return false, fmt.Errorf("stateChangeEntryHasSequenceNumber: Invalid version byte %d", versionByte)
+	}
+	blockHeight := VersionByteToMigrationHeight(uint8(versionByte), &GlobalDeSoParams)
+	return MigrationTriggered(blockHeight, ProofOfStake1StateSetupMigration), nil
+}
+
 func (stateChangeEntry *StateChangeEntry) GetVersionByte(blockHeight uint64) byte {
-	return 0
+	return GetMigrationVersion(blockHeight, ProofOfStake1StateSetupMigration)
 }
 
 func (stateChangeEntry *StateChangeEntry) GetEncoderType() EncoderType {
@@ -230,16 +330,14 @@ type UnflushedStateSyncerBytes struct {
 }
 
 // StateChangeSyncer is used to keep track of the state changes that should be written to the state change file.
+//
+// Every sink must hold the same state changes, so a sink that fails to write or discard state changes is fatal. By
+// then, the other sinks may already have done so, and carrying on would leave the sinks permanently out of sync
+// with each other, with consumers of different sinks seeing different state.
 type StateChangeSyncer struct {
-	// The file that the state changes are written to.
-	StateChangeFile        *os.File
-	StateChangeMempoolFile *os.File
-	// The file that allows quick lookup of a StateChangeEntry given its index in the file.
-	// This is represented by a list of uint32s, where each uint32 is the offset of the state change entry in the state change file.
-	StateChangeIndexFile        *os.File
-	StateChangeFileSize         uint64
-	StateChangeMempoolIndexFile *os.File
-	StateChangeMempoolFileSize  uint64
+	// The sinks that state changes are written to upon each flush. The first sink is always the
+	// StateChangeFileSink, which writes to the state change directory.
+	StateChangeSinks []StateChangeSink
 
 	// This map is used to keep track of the bytes should be written to the state change file upon a db flush.
 	// The ID of the flush is to track which entries should be written to the state change file upon flush completion.
@@ -290,98 +388,152 @@ type StateChangeSyncer struct {
 	// insert each individual entry into the db, which is much slower.
 	// 2. Only one state change entry is required for each entry in the database. Rather than following each iteration
 	// of each entry, the consumer only has to sync the most recent version of each entry.
-	// BlocksyncCompleteEntriesFlushed is used to track whether this one time flush has been completed.
+	// BlocksyncCompleteEntriesFlushed is used to track whether this one time flush has been completed for at least
+	// one of the sinks, and so whether entries should be recorded as they're flushed.
 	BlocksyncCompleteEntriesFlushed bool
+	// sinkAwaitingInitialFlush[ii] is true if StateChangeSinks[ii] didn't hold any committed state changes when the
+	// syncer was created during blocksync. Such a sink only starts receiving state changes once FlushAllEntriesToFile
+	// has written every entry in the db to it, while the other sinks carry on from where they left off.
+	sinkAwaitingInitialFlush []bool
+	// initialFlushInProgress is true while FlushAllEntriesToFile is writing every entry in the db, in which case
+	// committed state changes are only written to the sinks that are awaiting the initial flush.
+	initialFlushInProgress bool
 
 	MempoolTxnSyncLimit uint64
-}
 
-// Open a file, create if it doesn't exist.
-func openOrCreateLogFile(filePath string) (*os.File, error) {
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("Error creating directory: %v", err)
-	}
+	// The sequence number that will be assigned to the next StateChangeEntry that's flushed. This is recovered from
+	// the state change files and the sequence number high-water mark on startup, so that sequence numbers keep
+	// increasing across restarts.
+	NextSequenceNumber uint64
 
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
-	return file, nil
+	stateChangeDir string
 }
 
-// NewStateChangeSyncer initializes necessary log files and returns a StateChangeSyncer.
+// NewStateChangeSyncer initializes necessary log files and returns a StateChangeSyncer. State changes are
+// always written to files in stateChangeDir, and are also written to any additionalSinks that are provided.
 func NewStateChangeSyncer(stateChangeDir string, nodeSyncType NodeSyncType, mempoolTxnSyncLimit uint64,
-) *StateChangeSyncer {
-	stateChangeFilePath := filepath.Join(stateChangeDir, StateChangeFileName)
-	stateChangeIndexFilePath := filepath.Join(stateChangeDir, StateChangeIndexFileName)
-	stateChangeMempoolFilePath := filepath.Join(stateChangeDir, StateChangeMempoolFileName)
-	stateChangeMempoolIndexFilePath := filepath.Join(stateChangeDir, StateChangeMempoolIndexFileName)
-	stateChangeFile, err := openOrCreateLogFile(stateChangeFilePath)
+	additionalSinks ...StateChangeSink) *StateChangeSyncer {
+	stateChangeFileSink, err := NewStateChangeFileSink(stateChangeDir)
 	if err != nil {
-		glog.Fatalf("Error opening stateChangeFile: %v", err)
+		glog.Fatalf("Error opening state change files: %v", err)
 	}
-	stateChangeIndexFile, err := openOrCreateLogFile(stateChangeIndexFilePath)
-	if err != nil {
-		glog.Fatalf("Error opening stateChangeIndexFile: %v", err)
+	stateChangeSinks := append([]StateChangeSink{stateChangeFileSink}, additionalSinks...)
+
+	stateChangeSyncer := &StateChangeSyncer{
+		StateChangeSinks:         stateChangeSinks,
+		UnflushedCommittedBytes:  make(map[uuid.UUID]UnflushedStateSyncerBytes),
+		UnflushedMempoolBytes:    make(map[uuid.UUID]UnflushedStateSyncerBytes),
+		MempoolSyncedKeyValueMap: make(map[string]*StateChangeEntry),
+		MempoolNewlyFlushedTxns:  make(map[string]*StateChangeEntry),
+		MempoolFlushKeySet:       make(map[string]bool),
+		MempoolCachedTxns:        make(map[string][]*StateChangeEntry),
+		StateSyncerMutex:         &sync.Mutex{},
+		SyncType:                 nodeSyncType,
+		MempoolTxnSyncLimit:      mempoolTxnSyncLimit,
+		stateChangeDir:           stateChangeDir,
 	}
-	stateChangeMempoolFile, err := openOrCreateLogFile(stateChangeMempoolFilePath)
-	if err != nil {
-		glog.Fatalf("Error opening stateChangeMempoolFile: %v", err)
+
+	// Check which of the sinks already hold committed state changes. During blocksync, the ones that don't need
+	// the initial flush, and if any of them do, BlocksyncCompleteEntriesFlushed should be true.
+	for _, sink := range stateChangeSinks {
+		hasStateChanges, err := sink.HasCommittedStateChanges()
+		if err != nil {
+			glog.Fatalf("Error checking for existing state changes: %v", err)
+		}
+		if hasStateChanges {
+			stateChangeSyncer.BlocksyncCompleteEntriesFlushed = true
+		}
+		stateChangeSyncer.sinkAwaitingInitialFlush = append(stateChangeSyncer.sinkAwaitingInitialFlush,
+			!hasStateChanges && nodeSyncType == NodeSyncTypeBlockSync)
 	}
-	stateChangeFileInfo, err := stateChangeFile.Stat()
+
+	// Pick up the sequence numbers where the last run left off.
+	nextSequenceNumber, err := getNextStateChangeSequenceNumber(stateChangeDir)
 	if err != nil {
-		glog.Fatalf("Error getting stateChangeFileInfo: %v", err)
+		glog.Fatalf("Error recovering state change sequence number: %v", err)
 	}
-	stateChangeMempoolIndexFile, err := openOrCreateLogFile(stateChangeMempoolIndexFilePath)
+	stateChangeSyncer.NextSequenceNumber = nextSequenceNumber
+
+	return stateChangeSyncer
+}
+
+// getNextStateChangeSequenceNumber returns the sequence number following the highest sequence number in the
+// committed and mempool state change files in stateChangeDir, or the persisted high-water mark if it's higher.
+// The files alone aren't enough, since resetting the mempool truncates the mempool file.
+func getNextStateChangeSequenceNumber(stateChangeDir string) (uint64, error) {
+	nextSequenceNumber, err := ReadStateChangeSequenceNumberHighWaterMark(stateChangeDir)
 	if err != nil {
-		glog.Fatalf("Error opening stateChangeMempoolIndexFile: %v", err)
+		return 0, err
 	}
+	for _, isMempool := range []bool{false, true} {
+		reader, err := OpenStateChangeFileReader(stateChangeDir, isMempool)
+		if err != nil {
+			return 0, err
+		}
+		lastEntry, err := reader.ReadLastEntry()
+		reader.Close()
+		if err != nil {
+			return 0, err
+		}
+		if lastEntry != nil && lastEntry.SequenceNumber+1 > nextSequenceNumber {
+			nextSequenceNumber = lastEntry.SequenceNumber + 1
+		}
+	}
+	return nextSequenceNumber, nil
+}
 
-	stateChangeMempoolFileInfo, err := stateChangeMempoolFile.Stat()
-	if err != nil {
-		glog.Fatalf("Error getting stateChangeMempoolFileInfo: %v", err)
-	}
-
-	// Check if the state change file is empty. If not, BlocksyncCompleteEntriesFlushed should be true.
-	blocksyncCompleteEntriesFlushed := false
-	if stateChangeFileInfo.Size() > 0 {
-		blocksyncCompleteEntriesFlushed = true
-	}
-
-	return &StateChangeSyncer{
-		StateChangeFile:                 stateChangeFile,
-		StateChangeIndexFile:            stateChangeIndexFile,
-		StateChangeFileSize:             uint64(stateChangeFileInfo.Size()),
-		StateChangeMempoolFile:          stateChangeMempoolFile,
-		StateChangeMempoolIndexFile:     stateChangeMempoolIndexFile,
-		StateChangeMempoolFileSize:      uint64(stateChangeMempoolFileInfo.Size()),
-		UnflushedCommittedBytes:         make(map[uuid.UUID]UnflushedStateSyncerBytes),
-		UnflushedMempoolBytes:           make(map[uuid.UUID]UnflushedStateSyncerBytes),
-		MempoolSyncedKeyValueMap:        make(map[string]*StateChangeEntry),
-		MempoolNewlyFlushedTxns:         make(map[string]*StateChangeEntry),
-		MempoolFlushKeySet:              make(map[string]bool),
-		MempoolCachedTxns:               make(map[string][]*StateChangeEntry),
-		StateSyncerMutex:                &sync.Mutex{},
-		SyncType:                        nodeSyncType,
-		BlocksyncCompleteEntriesFlushed: blocksyncCompleteEntriesFlushed,
-		MempoolTxnSyncLimit:             mempoolTxnSyncLimit,
+// hasSinksAwaitingInitialFlush returns true if any of the sinks still need every entry in the db written to them.
+func (stateChangeSyncer *StateChangeSyncer) hasSinksAwaitingInitialFlush() bool {
+	for _, awaitingInitialFlush := range stateChangeSyncer.sinkAwaitingInitialFlush {
+		if awaitingInitialFlush {
+			return true
+		}
 	}
+	return false
 }
 
-// Reset resets the state change syncer by truncating the state change file and index file.
-func (stateChangeSyncer *StateChangeSyncer) Reset() {
-	err := stateChangeSyncer.StateChangeFile.Truncate(0)
-	if err != nil {
-		glog.Fatalf("Error truncating stateChangeFile: %v", err)
+// setInitialFlushInProgress marks the start or end of FlushAllEntriesToFile.
+func (stateChangeSyncer *StateChangeSyncer) setInitialFlushInProgress(initialFlushInProgress bool) {
+	stateChangeSyncer.StateSyncerMutex.Lock()
+	defer stateChangeSyncer.StateSyncerMutex.Unlock()
+
+	stateChangeSyncer.initialFlushInProgress = initialFlushInProgress
+	// Allow the state change syncer to flush entries to file.
+	stateChangeSyncer.BlocksyncCompleteEntriesFlushed = true
+}
+
+// completeInitialFlush is called once FlushAllEntriesToFile has written every entry in the db, after which every sink
+// receives state changes.
+func (stateChangeSyncer *StateChangeSyncer) completeInitialFlush() {
+	stateChangeSyncer.StateSyncerMutex.Lock()
+	defer stateChangeSyncer.StateSyncerMutex.Unlock()
+
+	for ii := range stateChangeSyncer.sinkAwaitingInitialFlush {
+		stateChangeSyncer.sinkAwaitingInitialFlush[ii] = false
 	}
+}
 
-	err = stateChangeSyncer.StateChangeIndexFile.Truncate(0)
-	if err != nil {
-		glog.Fatalf("Error truncating stateChangeIndexFile: %v", err)
+// Reset resets the state change syncer by discarding the committed state changes held by each sink, e.g.
+// truncating the state change file and index file.
+func (stateChangeSyncer *StateChangeSyncer) Reset() {
+	stateChangeSyncer.persistSequenceNumberHighWaterMark()
+	for _, sink := range stateChangeSyncer.StateChangeSinks {
+		if err := sink.Reset(); err != nil {
+			glog.Fatalf("Error resetting state change sink: %v", err)
+		}
 	}
+}
 
-	stateChangeSyncer.StateChangeFileSize = 0
+// Close closes all the state change sinks.
+func (stateChangeSyncer *StateChangeSyncer) Close() {
+	stateChangeSyncer.StateSyncerMutex.Lock()
+	defer stateChangeSyncer.StateSyncerMutex.Unlock()
+
+	for _, sink := range stateChangeSyncer.StateChangeSinks {
+		if err := sink.Close(); err != nil {
+			glog.Errorf("StateChangeSyncer.Close: Error closing state change sink: %v", err)
+		}
+	}
 }
 
 // handleDbTransactionConnected is called when a badger db operation takes place.
@@ -600,10 +752,23 @@ func (stateChangeSyncer *StateChangeSyncer) ResetMempool() {
 	delete(stateChangeSyncer.UnflushedMempoolBytes, stateChangeSyncer.MempoolFlushId)
 	stateChangeSyncer.MempoolFlushId = uuid.Nil
 	stateChangeSyncer.MempoolCachedTxns = make(map[string][]*StateChangeEntry)
-	// Truncate the mempool files.
-	stateChangeSyncer.StateChangeMempoolFile.Truncate(0)
-	stateChangeSyncer.StateChangeMempoolIndexFile.Truncate(0)
-	stateChangeSyncer.StateChangeMempoolFileSize = 0
+	// Discard the mempool state changes held by each sink, e.g. truncate the mempool files.
+	stateChangeSyncer.persistSequenceNumberHighWaterMark()
+	for ii, sink := range stateChangeSyncer.StateChangeSinks {
+		if err := sink.ResetMempool(); err != nil {
+			glog.Fatalf("StateChangeSyncer.ResetMempool: Error resetting state change sink %d of %d: %v",
+				ii+1, len(stateChangeSyncer.StateChangeSinks), err)
+		}
+	}
+}
+
+// persistSequenceNumberHighWaterMark writes NextSequenceNumber to the state change dir. It must be called before
+// any sink discards state changes, since the discarded entries may hold the highest sequence numbers handed out.
+func (stateChangeSyncer *StateChangeSyncer) persistSequenceNumberHighWaterMark() {
+	if err := writeStateChangeSequenceNumberHighWaterMark(
+		stateChangeSyncer.stateChangeDir, stateChangeSyncer.NextSequenceNumber); err != nil {
+		glog.Fatalf("StateChangeSyncer: Error persisting sequence number high-water mark: %v", err)
+	}
 }
 
 // Add a transaction to the queue of transactions to be flushed to disk upon badger db flush.
@@ -638,7 +803,8 @@ func (stateChangeSyncer *StateChangeSyncer) addTransactionToQueue(flushId uuid.U
 	}
 }
 
-// FlushTransactionsToFile writes the bytes that have been cached on the StateChangeSyncer to the state change file.
+// FlushTransactionsToFile writes the bytes that have been cached on the StateChangeSyncer to each of the state
+// change sinks, the first of which is the state change file.
 func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *StateSyncerFlushedEvent) error {
 	flushId := event.FlushId
 
@@ -652,23 +818,16 @@ func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *State
 		}
 	}
 
-	var flushFile *os.File
-	var flushFileSize uint64
-	var indexFile *os.File
-	if event.IsMempoolFlush {
-		flushFile = stateChangeSyncer.StateChangeMempoolFile
-		flushFileSize = stateChangeSyncer.StateChangeMempoolFileSize
-		indexFile = stateChangeSyncer.StateChangeMempoolIndexFile
-	} else {
-		flushFile = stateChangeSyncer.StateChangeFile
-		flushFileSize = stateChangeSyncer.StateChangeFileSize
-		indexFile = stateChangeSyncer.StateChangeIndexFile
-	}
-
 	// If the flush failed, delete the unflushed bytes and associated metadata.
 	// Also delete any unconnected mempool txns from our cache.
 	if !event.Succeeded {
 		glog.V(2).Infof("Deleting unflushed bytes for id: %s", flushId)
+		var unflushedBytesExisted bool
+		if event.IsMempoolFlush {
+			_, unflushedBytesExisted = stateChangeSyncer.UnflushedMempoolBytes[flushId]
+		} else {
+			_, unflushedBytesExisted = stateChangeSyncer.UnflushedCommittedBytes[flushId]
+		}
 		if event.IsMempoolFlush {
 			delete(stateChangeSyncer.UnflushedMempoolBytes, flushId)
 			// Loop through the unflushed mempool transactions and delete them from the cache.
@@ -683,6 +842,11 @@ func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *State
 		} else {
 			delete(stateChangeSyncer.UnflushedCommittedBytes, flushId)
 		}
+
+		// If any entries were queued for this flush, let consumers know that they'll never be written.
+		if unflushedBytesExisted {
+			return stateChangeSyncer.writeRevertFlushRecord(flushId, event.IsMempoolFlush)
+		}
 		return nil
 	}
 
@@ -708,44 +872,12 @@ func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *State
 		return fmt.Errorf("Error flushing to %s state change file: FlushId %v has nil bytes\n", stateChangeType, flushId)
 	}
 
-	// Write the encoded StateChangeEntry bytes to the state changer file.
-	_, err := flushFile.Write(unflushedBytes.StateChangeBytes)
-
-	if err != nil {
-		return fmt.Errorf("Error writing to %s state change file: %v", stateChangeType, err)
-	}
-
-	// Buffer to hold bytes for index file
-	stateChangeIndexBuf := make([]byte, 0)
-
-	// Loop through the index bytes of the state change file and write them to the index file.
-	// The StateChangeOperationIndexes array contains the byte index of where each transaction occurs within the
-	// unflushed state change bytes (e.g. the first value in the slice will always be 0).
-	// We need to add the size of the state change file to each of these values to get the byte index
-	// in the state change file.
-	for _, indexBytes := range unflushedBytes.StateChangeOperationIndexes {
-		// Get the byte index of where this transaction occurs in the state change file.
-		dbOperationIndex, err := SafeUint64().Add(indexBytes, flushFileSize)
-		if err != nil {
-			return fmt.Errorf("Error writing to %s state change index file: %v", stateChangeType, err)
-		}
-		// Convert the byte index value to a uint64 byte slice.
-		dbOperationIndexBytes := make([]byte, 8)
-		binary.LittleEndian.PutUint64(dbOperationIndexBytes, dbOperationIndex)
-
-		stateChangeIndexBuf = append(stateChangeIndexBuf, dbOperationIndexBytes...)
-	}
-
-	// Write the encoded uint32 indexes to the index file.
-	_, err = indexFile.Write(stateChangeIndexBuf)
-	if err != nil {
-		return fmt.Errorf("Error writing to state change index file: %v", err)
-	}
-	if event.IsMempoolFlush {
-		stateChangeSyncer.StateChangeMempoolFileSize += uint64(len(unflushedBytes.StateChangeBytes))
-	} else {
-		stateChangeSyncer.StateChangeFileSize += uint64(len(unflushedBytes.StateChangeBytes))
+	if err := stateChangeSyncer.assignSequenceNumbers(
+		unflushedBytes.StateChangeBytes, unflushedBytes.StateChangeOperationIndexes); err != nil {
+		return fmt.Errorf("Error assigning sequence numbers to %s state changes: %v", stateChangeType, err)
 	}
+	stateChangeSyncer.writeToSinks(
+		unflushedBytes.StateChangeBytes, unflushedBytes.StateChangeOperationIndexes, event.IsMempoolFlush)
 
 	// Update unflushed bytes map to remove the flushed bytes.
 	if event.IsMempoolFlush {
@@ -758,6 +890,45 @@ func (stateChangeSyncer *StateChangeSyncer) FlushTransactionsToFile(event *State
 	return nil
 }
 
+// assignSequenceNumbers assigns the next sequence numbers to the encoded entries, now that their order is final.
+func (stateChangeSyncer *StateChangeSyncer) assignSequenceNumbers(stateChangeBytes []byte, entryOffsets []uint64) error {
+	if err := setStateChangeSequenceNumbers(stateChangeBytes, entryOffsets, stateChangeSyncer.NextSequenceNumber); err != nil {
+		return err
+	}
+	stateChangeSyncer.NextSequenceNumber += uint64(len(entryOffsets))
+	return nil
+}
+
+// writeToSinks writes the encoded entries to each of the sinks. While the initial flush is in progress, committed
+// entries are only written to the sinks that are awaiting it. Otherwise, entries are only written to the sinks that
+// aren't.
+func (stateChangeSyncer *StateChangeSyncer) writeToSinks(stateChangeBytes []byte, entryOffsets []uint64, isMempool bool) {
+	for ii, sink := range stateChangeSyncer.StateChangeSinks {
+		if stateChangeSyncer.sinkAwaitingInitialFlush[ii] != (stateChangeSyncer.initialFlushInProgress && !isMempool) {
+			continue
+		}
+		if err := sink.WriteStateChanges(stateChangeBytes, entryOffsets, isMempool); err != nil {
+			glog.Fatalf("StateChangeSyncer.writeToSinks: Error writing to state change sink %d of %d: %v",
+				ii+1, len(stateChangeSyncer.StateChangeSinks), err)
+		}
+	}
+}
+
+// writeRevertFlushRecord writes a DbOperationTypeRevertFlush record for a flush that failed.
+func (stateChangeSyncer *StateChangeSyncer) writeRevertFlushRecord(flushId uuid.UUID, isMempool bool) error {
+	revertFlushEntry := &StateChangeEntry{
+		OperationType: DbOperationTypeRevertFlush,
+		IsReverted:    true,
+		FlushId:       flushId,
+	}
+	writeBytes := EncodeByteArray(EncodeToBytes(stateChangeSyncer.BlockHeight, revertFlushEntry, false))
+	if err := stateChangeSyncer.assignSequenceNumbers(writeBytes, []uint64{0}); err != nil {
+		return errors.Wrapf(err, "StateChangeSyncer.writeRevertFlushRecord: Error writing revert record for flush %v", flushId)
+	}
+	stateChangeSyncer.writeToSinks(writeBytes, []uint64{0}, isMempool)
+	return nil
+}
+
 func createMempoolTxKey(keyBytes []byte) string {
 	return fmt.Sprintf("%v", string(keyBytes))
 }
@@ -1022,7 +1193,7 @@ func (stateChangeSyncer *StateChangeSyncer) StartMempoolSyncRoutine(server *Serv
 			glog.V(2).Infof("Mempool: %v", server.mempool)
 			glog.V(2).Infof("Chain state: %v", server.blockchain.chainState())
 		}
-		if !stateChangeSyncer.BlocksyncCompleteEntriesFlushed && stateChangeSyncer.SyncType == NodeSyncTypeBlockSync {
+		if stateChangeSyncer.hasSinksAwaitingInitialFlush() {
 			err := stateChangeSyncer.FlushAllEntriesToFile(server)
 			if err != nil {
 				glog.Errorf("StateChangeSyncer.StartMempoolSyncRoutine: Error flushing all entries to file: %v", err)
@@ -1043,13 +1214,9 @@ func (stateChangeSyncer *StateChangeSyncer) StartMempoolSyncRoutine(server *Serv
 }
 
 func (stateChangeSyncer *StateChangeSyncer) FlushAllEntriesToFile(server *Server) error {
-	// Check if the state change file already exists and is not empty. If so, return.
-	stateChangeFileInfo, err := stateChangeSyncer.StateChangeFile.Stat()
-	if err == nil {
-		// If the file is non-empty, no need to flush entries to file.
-		if stateChangeFileInfo.Size() > 0 {
-			return nil
-		}
+	// Only the sinks that didn't hold committed state changes when the syncer was created need the initial flush.
+	if !stateChangeSyncer.hasSinksAwaitingInitialFlush() {
+		return nil
 	}
 
 	// Disable deadlock detection, as the process of flushing entries to file can take a long time and
@@ -1062,8 +1229,8 @@ func (stateChangeSyncer *StateChangeSyncer) FlushAllEntriesToFile(server *Server
 	server.blockchain.ChainLock.Lock()
 	defer server.blockchain.ChainLock.Unlock()
 
-	// Allow the state change syncer to flush entries to file.
-	stateChangeSyncer.BlocksyncCompleteEntriesFlushed = true
+	stateChangeSyncer.setInitialFlushInProgress(true)
+	defer stateChangeSyncer.setInitialFlushInProgress(false)
 
 	// Loop through all prefixes that hold state change entries.
 	for _, prefix := range StatePrefixes.CoreStatePrefixesList {
@@ -1121,5 +1288,6 @@ func (stateChangeSyncer *StateChangeSyncer) FlushAllEntriesToFile(server *Server
 			})
 		}
 	}
+	stateChangeSyncer.completeInitialFlush()
 	return nil
 }
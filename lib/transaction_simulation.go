@@ -0,0 +1,369 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TransactionSimulationResult is the result of simulating a sequence of transactions with SimulateTransactionsOnView.
+// Transactions are connected in order, each on top of the state left by the ones before it. Simulation stops at the
+// first transaction that fails to connect.
+type TransactionSimulationResult struct {
+	// BlockHeight and BlockTimestampNanoSecs are the height and timestamp the transactions were connected at.
+	BlockHeight            uint64
+	BlockTimestampNanoSecs int64
+
+	// Transactions has a result for every transaction that was connected, followed by a result for the
+	// transaction that failed to connect, if any.
+	Transactions []*SimulatedTransactionResult
+
+	// TotalFeeNanos is the sum of the fees paid by the transactions that connected.
+	TotalFeeNanos uint64
+
+	// StateDiff is the change in state caused by all the transactions that connected.
+	StateDiff *SimulatedStateDiff
+
+	// FailedTxnIndex is the index of the transaction that failed to connect, or -1 if they all connected.
+	FailedTxnIndex int
+	// Err is the error returned when connecting the transaction at FailedTxnIndex.
+	Err error
+}
+
+// SimulatedTransactionResult is the result of simulating a single transaction.
+type SimulatedTransactionResult struct {
+	TxnHash *BlockHash
+	TxnType TxnType
+
+	UtxoOperations   []*UtxoOperation
+	TotalInputNanos  uint64
+	TotalOutputNanos uint64
+	FeeNanos         uint64
+
+	// StateDiff is the change in state caused by this transaction alone. It is nil if the transaction failed.
+	StateDiff *SimulatedStateDiff
+
+	// Err is the error returned when connecting the transaction, and RuleError is its underlying RuleError, if any.
+	Err       error
+	RuleError RuleError
+}
+
+// SimulatedStateDiff holds the entries that were changed by simulated transactions, with their values before and
+// after. For the entry diffs, Before is nil if the entry was created and After is nil if it was deleted. The diffs
+// are sorted by key so that simulating the same transactions always produces the same diff.
+type SimulatedStateDiff struct {
+	DeSoBalances        []*SimulatedDeSoBalanceDiff
+	CreatorCoinBalances []*SimulatedBalanceEntryDiff
+	DAOCoinBalances     []*SimulatedBalanceEntryDiff
+	// DAOCoinLimitOrders includes orders that were placed, cancelled, and partially or fully filled.
+	DAOCoinLimitOrders []*SimulatedDAOCoinLimitOrderDiff
+	NFTs               []*SimulatedNFTDiff
+	LockedBalances     []*SimulatedLockedBalanceDiff
+}
+
+type SimulatedDeSoBalanceDiff struct {
+	PublicKey          []byte
+	BeforeBalanceNanos uint64
+	AfterBalanceNanos  uint64
+}
+
+type SimulatedBalanceEntryDiff struct {
+	HODLerPKID  *PKID
+	CreatorPKID *PKID
+	Before      *BalanceEntry
+	After       *BalanceEntry
+}
+
+type SimulatedDAOCoinLimitOrderDiff struct {
+	OrderID *BlockHash
+	Before  *DAOCoinLimitOrderEntry
+	After   *DAOCoinLimitOrderEntry
+}
+
+type SimulatedNFTDiff struct {
+	NFTPostHash  *BlockHash
+	SerialNumber uint64
+	Before       *NFTEntry
+	After        *NFTEntry
+}
+
+type SimulatedLockedBalanceDiff struct {
+	Key    LockedBalanceEntryKey
+	Before *LockedBalanceEntry
+	After  *LockedBalanceEntry
+}
+
+// IsEmpty returns true if the diff doesn't contain any changes.
+func (diff *SimulatedStateDiff) IsEmpty() bool {
+	return len(diff.DeSoBalances) == 0 && len(diff.CreatorCoinBalances) == 0 && len(diff.DAOCoinBalances) == 0 &&
+		len(diff.DAOCoinLimitOrders) == 0 && len(diff.NFTs) == 0 && len(diff.LockedBalances) == 0
+}
+
+// SimulateTransactionsOnView connects txns to a copy of view at the given block height and timestamp, and reports
+// the UtxoOperations, fees, and state changes of each one. The view passed in is never modified. Signatures are not
+// verified, so unsigned transactions can be simulated before they're signed. Note that, as with
+// GetAugmentedUniversalViewWithAdditionalTransactions, block-level rules such as the minimum fee for inclusion in
+// a PoS block aren't checked.
+//
+// A transaction that fails to connect is reported in the result rather than as an error. The returned error is
+// only set if the simulation itself couldn't be performed.
+func SimulateTransactionsOnView(view *UtxoView, txns []*MsgDeSoTxn, blockHeight uint64,
+	blockTimestampNanoSecs int64) (*TransactionSimulationResult, error) {
+
+	if view == nil {
+		return nil, errors.New("SimulateTransactionsOnView: view cannot be nil")
+	}
+	result := &TransactionSimulationResult{
+		BlockHeight:            blockHeight,
+		BlockTimestampNanoSecs: blockTimestampNanoSecs,
+		FailedTxnIndex:         -1,
+	}
+
+	// initialView holds the state before any of the txns. It's only read from, to compute the overall diff.
+	initialView := view.CopyUtxoView()
+	currentView := view.CopyUtxoView()
+	for ii, txn := range txns {
+		if txn == nil {
+			return nil, errors.Errorf("SimulateTransactionsOnView: Txn %d is nil", ii)
+		}
+		txnResult := &SimulatedTransactionResult{
+			TxnHash: txn.Hash(),
+			TxnType: txn.TxnMeta.GetTxnType(),
+		}
+		result.Transactions = append(result.Transactions, txnResult)
+
+		// Connect the txn to a copy of the view so that we can diff against the state before it.
+		nextView := currentView.CopyUtxoView()
+		utxoOps, totalInput, totalOutput, fees, err := nextView.ConnectTransaction(
+			txn, txnResult.TxnHash, uint32(blockHeight), blockTimestampNanoSecs, false, true)
+		if err != nil {
+			txnResult.Err = err
+			if ruleErr, ok := errors.Cause(err).(RuleError); ok {
+				txnResult.RuleError = ruleErr
+			}
+			result.FailedTxnIndex = ii
+			result.Err = errors.Wrapf(err, "SimulateTransactionsOnView: Problem connecting txn %d", ii)
+			break
+		}
+		txnResult.UtxoOperations = utxoOps
+		txnResult.TotalInputNanos = totalInput
+		txnResult.TotalOutputNanos = totalOutput
+		txnResult.FeeNanos = fees
+		result.TotalFeeNanos += fees
+
+		if txnResult.StateDiff, err = computeSimulatedStateDiff(currentView, nextView, blockHeight); err != nil {
+			return nil, errors.Wrapf(err, "SimulateTransactionsOnView: Problem computing diff for txn %d", ii)
+		}
+		currentView = nextView
+	}
+
+	var err error
+	if result.StateDiff, err = computeSimulatedStateDiff(initialView, currentView, blockHeight); err != nil {
+		return nil, errors.Wrapf(err, "SimulateTransactionsOnView: Problem computing diff")
+	}
+	return result, nil
+}
+
+// SimulateTransactions simulates txns on top of the uncommitted tip of the chain, without touching the mempool. If
+// atHeight is zero, the txns are connected at the height of the next block. Otherwise atHeight must be above the
+// tip, which makes it possible to check how txns behave after an upcoming fork height.
+func (bc *Blockchain) SimulateTransactions(txns []*MsgDeSoTxn, atHeight uint64) (*TransactionSimulationResult, error) {
+	bc.ChainLock.RLock()
+	defer bc.ChainLock.RUnlock()
+
+	tipHeight := uint64(bc.BlockTip().Height)
+	if atHeight == 0 {
+		atHeight = tipHeight + 1
+	}
+	if atHeight <= tipHeight {
+		return nil, errors.Errorf("Blockchain.SimulateTransactions: Height %d must be above the tip height %d",
+			atHeight, tipHeight)
+	}
+	view, err := bc.GetUncommittedTipView()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Blockchain.SimulateTransactions: Problem getting view at tip")
+	}
+	return SimulateTransactionsOnView(view, txns, atHeight, time.Now().UnixNano())
+}
+
+// SimulateTransactions simulates txns on top of the latest block and the transactions in the mempool, as they
+// would be connected if they were added to the mempool now. The mempool itself is left unchanged. If atHeight is
+// zero, the txns are connected at the height of the next block. Like GetAugmentedUniversalView, this only sees
+// mempool transactions once the mempool has regenerated its augmented view after adding them.
+func (mp *PosMempool) SimulateTransactions(txns []*MsgDeSoTxn, atHeight uint64) (*TransactionSimulationResult, error) {
+	view, err := mp.GetAugmentedUniversalView()
+	if err != nil {
+		return nil, errors.Wrapf(err, "PosMempool.SimulateTransactions: Problem getting augmented view")
+	}
+	tipHeight := mp.GetMempoolTipBlockHeight()
+	if atHeight == 0 {
+		atHeight = tipHeight + 1
+	}
+	if atHeight <= tipHeight {
+		return nil, errors.Errorf("PosMempool.SimulateTransactions: Height %d must be above the tip height %d",
+			atHeight, tipHeight)
+	}
+	return SimulateTransactionsOnView(view, txns, atHeight, time.Now().UnixNano())
+}
+
+// computeSimulatedStateDiff diffs the entries in afterView against their values in beforeView, where afterView was
+// derived from a copy of beforeView. Every entry that a transaction touched is in afterView's maps, so only those
+// need to be compared. Reading from beforeView may cache entries from the db in it, so it must not be used as a
+// source of state afterwards.
+func computeSimulatedStateDiff(beforeView *UtxoView, afterView *UtxoView, blockHeight uint64) (
+	*SimulatedStateDiff, error) {
+
+	diff := &SimulatedStateDiff{}
+
+	for publicKey, afterBalance := range afterView.PublicKeyToDeSoBalanceNanos {
+		beforeBalance, err := beforeView.GetDeSoBalanceNanosForPublicKey(publicKey.ToBytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeSimulatedStateDiff: Problem getting DESO balance")
+		}
+		if beforeBalance == afterBalance {
+			continue
+		}
+		diff.DeSoBalances = append(diff.DeSoBalances, &SimulatedDeSoBalanceDiff{
+			PublicKey:          publicKey.ToBytes(),
+			BeforeBalanceNanos: beforeBalance,
+			AfterBalanceNanos:  afterBalance,
+		})
+	}
+	sort.Slice(diff.DeSoBalances, func(ii, jj int) bool {
+		return bytes.Compare(diff.DeSoBalances[ii].PublicKey, diff.DeSoBalances[jj].PublicKey) < 0
+	})
+
+	for _, isDAOCoin := range []bool{false, true} {
+		var balanceDiffs []*SimulatedBalanceEntryDiff
+		for key, afterEntry := range afterView.GetHODLerPKIDCreatorPKIDToBalanceEntryMap(isDAOCoin) {
+			hodlerPKID, creatorPKID := key.HODLerPKID.NewPKID(), key.CreatorPKID.NewPKID()
+			beforeEntry := beforeView._getBalanceEntryForHODLerPKIDAndCreatorPKID(hodlerPKID, creatorPKID, isDAOCoin)
+			if beforeEntry != nil && beforeEntry.isDeleted {
+				beforeEntry = nil
+			}
+			if afterEntry != nil && afterEntry.isDeleted {
+				afterEntry = nil
+			}
+			if !simulatedEntryChanged(beforeEntry, beforeEntry != nil, afterEntry, afterEntry != nil, blockHeight) {
+				continue
+			}
+			balanceDiffs = append(balanceDiffs, &SimulatedBalanceEntryDiff{
+				HODLerPKID:  hodlerPKID,
+				CreatorPKID: creatorPKID,
+				Before:      beforeEntry,
+				After:       afterEntry,
+			})
+		}
+		sort.Slice(balanceDiffs, func(ii, jj int) bool {
+			left, right := balanceDiffs[ii], balanceDiffs[jj]
+			if cmp := bytes.Compare(left.HODLerPKID.ToBytes(), right.HODLerPKID.ToBytes()); cmp != 0 {
+				return cmp < 0
+			}
+			return bytes.Compare(left.CreatorPKID.ToBytes(), right.CreatorPKID.ToBytes()) < 0
+		})
+		if isDAOCoin {
+			diff.DAOCoinBalances = balanceDiffs
+		} else {
+			diff.CreatorCoinBalances = balanceDiffs
+		}
+	}
+
+	for key, afterEntry := range afterView.DAOCoinLimitOrderMapKeyToDAOCoinLimitOrderEntry {
+		orderID := key.OrderID.NewBlockHash()
+		beforeEntry, err := beforeView.GetDAOCoinLimitOrderEntry(orderID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeSimulatedStateDiff: Problem getting DAO coin limit order")
+		}
+		if beforeEntry != nil && beforeEntry.isDeleted {
+			beforeEntry = nil
+		}
+		if afterEntry != nil && afterEntry.isDeleted {
+			afterEntry = nil
+		}
+		if !simulatedEntryChanged(beforeEntry, beforeEntry != nil, afterEntry, afterEntry != nil, blockHeight) {
+			continue
+		}
+		diff.DAOCoinLimitOrders = append(diff.DAOCoinLimitOrders, &SimulatedDAOCoinLimitOrderDiff{
+			OrderID: orderID,
+			Before:  beforeEntry,
+			After:   afterEntry,
+		})
+	}
+	sort.Slice(diff.DAOCoinLimitOrders, func(ii, jj int) bool {
+		return bytes.Compare(diff.DAOCoinLimitOrders[ii].OrderID[:], diff.DAOCoinLimitOrders[jj].OrderID[:]) < 0
+	})
+
+	for key, afterEntry := range afterView.NFTKeyToNFTEntry {
+		nftKey := key
+		beforeEntry := beforeView.GetNFTEntryForNFTKey(&nftKey)
+		if beforeEntry != nil && beforeEntry.isDeleted {
+			beforeEntry = nil
+		}
+		if afterEntry != nil && afterEntry.isDeleted {
+			afterEntry = nil
+		}
+		if !simulatedEntryChanged(beforeEntry, beforeEntry != nil, afterEntry, afterEntry != nil, blockHeight) {
+			continue
+		}
+		diff.NFTs = append(diff.NFTs, &SimulatedNFTDiff{
+			NFTPostHash:  nftKey.NFTPostHash.NewBlockHash(),
+			SerialNumber: nftKey.SerialNumber,
+			Before:       beforeEntry,
+			After:        afterEntry,
+		})
+	}
+	sort.Slice(diff.NFTs, func(ii, jj int) bool {
+		left, right := diff.NFTs[ii], diff.NFTs[jj]
+		if cmp := bytes.Compare(left.NFTPostHash[:], right.NFTPostHash[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return left.SerialNumber < right.SerialNumber
+	})
+
+	for key, afterEntry := range afterView.LockedBalanceEntryKeyToLockedBalanceEntry {
+		// GetLockedBalanceEntryForLockedBalanceEntryKey already returns nil for deleted entries.
+		beforeEntry, err := beforeView.GetLockedBalanceEntryForLockedBalanceEntryKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "computeSimulatedStateDiff: Problem getting locked balance entry")
+		}
+		if afterEntry != nil && afterEntry.isDeleted {
+			afterEntry = nil
+		}
+		if !simulatedEntryChanged(beforeEntry, beforeEntry != nil, afterEntry, afterEntry != nil, blockHeight) {
+			continue
+		}
+		diff.LockedBalances = append(diff.LockedBalances, &SimulatedLockedBalanceDiff{
+			Key:    key,
+			Before: beforeEntry,
+			After:  afterEntry,
+		})
+	}
+	sort.Slice(diff.LockedBalances, func(ii, jj int) bool {
+		left, right := diff.LockedBalances[ii].Key, diff.LockedBalances[jj].Key
+		if cmp := bytes.Compare(left.HODLerPKID[:], right.HODLerPKID[:]); cmp != 0 {
+			return cmp < 0
+		}
+		if cmp := bytes.Compare(left.ProfilePKID[:], right.ProfilePKID[:]); cmp != 0 {
+			return cmp < 0
+		}
+		if left.UnlockTimestampNanoSecs != right.UnlockTimestampNanoSecs {
+			return left.UnlockTimestampNanoSecs < right.UnlockTimestampNanoSecs
+		}
+		return left.VestingEndTimestampNanoSecs < right.VestingEndTimestampNanoSecs
+	})
+
+	return diff, nil
+}
+
+// simulatedEntryChanged returns true if an entry was created, deleted, or modified. The exists flags are passed
+// separately because a nil entry pointer converted to a DeSoEncoder isn't a nil interface.
+func simulatedEntryChanged(beforeEntry DeSoEncoder, beforeExists bool, afterEntry DeSoEncoder, afterExists bool,
+	blockHeight uint64) bool {
+
+	if !beforeExists || !afterExists {
+		return beforeExists != afterExists
+	}
+	return !bytes.Equal(EncodeToBytes(blockHeight, beforeEntry), EncodeToBytes(blockHeight, afterEntry))
+}
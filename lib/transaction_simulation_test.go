@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateTransactions(t *testing.T) {
+	require := require.New(t)
+	seed := int64(1023)
+	rand := rand.New(rand.NewSource(seed))
+	feeMin := uint64(1000)
+	feeMax := uint64(2000)
+
+	chain, params, db := NewLowDifficultyBlockchain(t)
+	params.ForkHeights.BalanceModelBlockHeight = 1
+	oldPool, miner := NewTestMiner(t, chain, params, true)
+	_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, oldPool)
+	require.NoError(err)
+	_, err = miner.MineAndProcessSingleBlock(0 /*threadIndex*/, oldPool)
+	require.NoError(err)
+
+	m0PubBytes, _, _ := Base58CheckDecode(m0Pub)
+	m1PubBytes, _, _ := Base58CheckDecode(m1Pub)
+	_, _, _ = _doBasicTransferWithViewFlush(t, chain, db, params, senderPkString,
+		Base58CheckEncode(m0PubBytes, false, params), senderPrivString, 200000, 11)
+	_, _, _ = _doBasicTransferWithViewFlush(t, chain, db, params, senderPkString,
+		Base58CheckEncode(m1PubBytes, false, params), senderPrivString, 200000, 11)
+
+	getBalance := func(publicKey []byte) uint64 {
+		balance, err := chain.GetCommittedTipView().GetDeSoBalanceNanosForPublicKey(publicKey)
+		require.NoError(err)
+		return balance
+	}
+	m0Balance := getBalance(m0PubBytes)
+	m1Balance := getBalance(m1PubBytes)
+
+	// m0 sends 1000 nanos to m1.
+	txn1 := _generateTestTxnWithOutputs(t, rand, feeMin, feeMax, m0PubBytes, m0Priv, 100, 0,
+		[]*DeSoOutput{{PublicKey: m1PubBytes, AmountNanos: 1000}})
+	result, err := chain.SimulateTransactions([]*MsgDeSoTxn{txn1}, 0)
+	require.NoError(err)
+	require.NoError(result.Err)
+	require.Equal(-1, result.FailedTxnIndex)
+	require.Equal(uint64(chain.BlockTip().Height)+1, result.BlockHeight)
+	require.Equal(1, len(result.Transactions))
+	txnResult := result.Transactions[0]
+	require.Equal(txn1.Hash(), txnResult.TxnHash)
+	require.Equal(TxnTypeBasicTransfer, txnResult.TxnType)
+	require.NotEmpty(txnResult.UtxoOperations)
+	require.Equal(txn1.TxnFeeNanos, txnResult.FeeNanos)
+	require.Equal(txn1.TxnFeeNanos, result.TotalFeeNanos)
+
+	// The diff has the before and after balances of both public keys.
+	expectedBalanceDiffs := map[PublicKey]*SimulatedDeSoBalanceDiff{
+		*NewPublicKey(m0PubBytes): {
+			PublicKey:          m0PubBytes,
+			BeforeBalanceNanos: m0Balance,
+			AfterBalanceNanos:  m0Balance - 1000 - txn1.TxnFeeNanos,
+		},
+		*NewPublicKey(m1PubBytes): {
+			PublicKey:          m1PubBytes,
+			BeforeBalanceNanos: m1Balance,
+			AfterBalanceNanos:  m1Balance + 1000,
+		},
+	}
+	require.Equal(len(expectedBalanceDiffs), len(result.StateDiff.DeSoBalances))
+	for _, balanceDiff := range result.StateDiff.DeSoBalances {
+		require.Equal(expectedBalanceDiffs[*NewPublicKey(balanceDiff.PublicKey)], balanceDiff)
+	}
+	require.Equal(result.StateDiff, txnResult.StateDiff)
+	require.Empty(result.StateDiff.CreatorCoinBalances)
+	require.Empty(result.StateDiff.DAOCoinLimitOrders)
+
+	// Simulating doesn't change the chain's state.
+	require.Equal(m0Balance, getBalance(m0PubBytes))
+	require.Equal(m1Balance, getBalance(m1PubBytes))
+
+	// m1 spends the 1000 nanos it receives from txn1, so txn2 only connects after txn1.
+	txn2 := _generateTestTxn(t, rand, feeMin, feeMax, m1PubBytes, m1Priv, 100, 0)
+	txn2.TxOutputs = []*DeSoOutput{{PublicKey: m0PubBytes, AmountNanos: m1Balance + 500 - txn2.TxnFeeNanos}}
+	_signTxn(t, txn2, m1Priv)
+	result, err = chain.SimulateTransactions([]*MsgDeSoTxn{txn1, txn2}, 0)
+	require.NoError(err)
+	require.NoError(result.Err)
+	require.Equal(2, len(result.Transactions))
+	require.Equal(txn1.TxnFeeNanos+txn2.TxnFeeNanos, result.TotalFeeNanos)
+
+	// Without txn1, txn2 fails and the failure is reported along with its rule error.
+	result, err = chain.SimulateTransactions([]*MsgDeSoTxn{txn2, txn1}, 0)
+	require.NoError(err)
+	require.Error(result.Err)
+	require.Equal(0, result.FailedTxnIndex)
+	require.Equal(1, len(result.Transactions))
+	require.Error(result.Transactions[0].Err)
+	require.NotEmpty(result.Transactions[0].RuleError)
+	require.Nil(result.Transactions[0].StateDiff)
+	require.True(result.StateDiff.IsEmpty())
+
+	// Heights at or below the tip are rejected.
+	_, err = chain.SimulateTransactions([]*MsgDeSoTxn{txn1}, uint64(chain.BlockTip().Height))
+	require.Error(err)
+
+	// Once txn1 is in the mempool, txn2 connects on its own when simulated against the mempool.
+	globalParams := _testGetDefaultGlobalParams()
+	globalParams.MempoolMaxSizeBytes = uint64(3000000000)
+	mempool := NewPosMempool()
+	require.NoError(mempool.Init(
+		params, globalParams, chain.GetCommittedTipView(), uint64(chain.BlockTip().Height), "", true, 30000,
+		nil, 1000, 100,
+	))
+	require.NoError(mempool.Start())
+	defer mempool.Stop()
+	_wrappedPosMempoolAddTransaction(t, mempool, txn1)
+	mempool.BlockUntilReadOnlyViewRegenerated()
+	result, err = mempool.SimulateTransactions([]*MsgDeSoTxn{txn2}, 0)
+	require.NoError(err)
+	require.NoError(result.Err)
+	require.Equal(1, len(mempool.GetTransactions()))
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
@@ -36,8 +37,17 @@ type TXIndex struct {
 	// Shutdown channel
 	stopUpdateChannel chan struct{}
 	killed            bool
+
+	// Whether the secondary indexes (txn type and height, coin activity and NFT activity)
+	// cover every transaction in the txindex. This is false for txindexes created before the
+	// secondary indexes existed, until buildSecondaryIndexes has run. Accessed atomically.
+	secondaryIndexesBuilt int32
 }
 
+// NewTXIndex opens, or creates, the txindex in its own Badger DB under dataDirectory. The txindex
+// only reads blocks from the coreChain's Badger DB, and replays them on a separate Badger-backed
+// chain to compute transaction metadata. This means it works the same way whether the coreChain's
+// state is stored in Badger or in Postgres, since blocks are always stored in Badger.
 func NewTXIndex(coreChain *Blockchain, params *DeSoParams, dataDirectory string) (
 	_txindex *TXIndex, _error error) {
 	// Initialize database
@@ -57,6 +67,11 @@ func NewTXIndex(coreChain *Blockchain, params *DeSoParams, dataDirectory string)
 	// If we haven't initialized the txIndexChain before, set up the
 	// seed mappings.
 	if bestBlockHashBeforeInit == nil {
+		// A new txindex builds its secondary indexes as it goes.
+		if err := DbPutTxindexSecondaryIndexesBuilt(txIndexDb, nil, coreChain.eventManager); err != nil {
+			return nil, fmt.Errorf("NewTXIndex: Error marking secondary indexes as built: %v", err)
+		}
+
 		{
 			dummyPk := ArchitectPubKeyBase58Check
 			dummyTxn := &MsgDeSoTxn{
@@ -140,13 +155,23 @@ func NewTXIndex(coreChain *Blockchain, params *DeSoParams, dataDirectory string)
 	// correctly. Attaching blocks to our txnindex blockchain or adding
 	// txns to our txindex should work smoothly now.
 
-	return &TXIndex{
+	txi := &TXIndex{
 		TXIndexChain:      txIndexChain,
 		CoreChain:         coreChain,
 		Params:            params,
 		stopUpdateChannel: make(chan struct{}),
 		killed:            false,
-	}, nil
+	}
+	if DbGetTxindexSecondaryIndexesBuilt(txIndexDb, nil) {
+		txi.secondaryIndexesBuilt = 1
+	}
+	return txi, nil
+}
+
+// SecondaryIndexesBuilt returns true if the secondary indexes cover every transaction in
+// the txindex, and can therefore be queried.
+func (txi *TXIndex) SecondaryIndexesBuilt() bool {
+	return atomic.LoadInt32(&txi.secondaryIndexesBuilt) != 0
 }
 
 func (txi *TXIndex) FinishedSyncing() bool {
@@ -247,6 +272,91 @@ func (txi *TXIndex) GetTxindexUpdateBlockNodes() (
 	return txindexTipNode, committedTip, commonAncestor, detachBlocks, attachBlocks
 }
 
+// buildSecondaryIndexes adds every transaction in the blocks attached to the txindex
+// chain to the secondary indexes. It's only needed for txindexes created before the
+// secondary indexes existed, and is safe to re-run if it's interrupted. Note that the
+// seed txns aren't in any block, so they're not added to the secondary indexes.
+func (txi *TXIndex) buildSecondaryIndexes() error {
+	bestChain, _ := txi.TXIndexChain.CopyBestChain()
+	glog.Infof("buildSecondaryIndexes: Building txindex secondary indexes for %d blocks", len(bestChain))
+
+	for _, blockNode := range bestChain {
+		if txi.killed {
+			glog.Infof(CLog(Yellow, "TxIndex: buildSecondaryIndexes: Killed while building secondary indexes"))
+			return nil
+		}
+		if blockNode.Height%10000 == 0 {
+			glog.Infof("buildSecondaryIndexes: Progress: block %d / %d",
+				blockNode.Height, len(bestChain))
+		}
+		blockMsg, err := GetBlock(blockNode.Hash, txi.TXIndexChain.DB(), nil)
+		if err != nil {
+			return fmt.Errorf("buildSecondaryIndexes: Problem fetching block "+
+				"with hash %v: %v", blockNode.Hash, err)
+		}
+		err = txi.TXIndexChain.DB().Update(func(dbTxn *badger.Txn) error {
+			for _, txn := range blockMsg.Txns {
+				txnMeta := DbGetTxindexTransactionRefByTxIDWithTxn(dbTxn, nil, txn.Hash())
+				if txnMeta == nil {
+					return fmt.Errorf("buildSecondaryIndexes: Missing txnMeta for txn %v", txn.Hash())
+				}
+				if err := DbPutTxindexSecondaryIndexMappingsWithTxn(dbTxn, nil,
+					uint64(blockNode.Height), txn, txnMeta, txi.CoreChain.eventManager); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := DbPutTxindexSecondaryIndexesBuilt(txi.TXIndexChain.DB(), nil, txi.CoreChain.eventManager); err != nil {
+		return fmt.Errorf("buildSecondaryIndexes: Problem marking secondary indexes as built: %v", err)
+	}
+	atomic.StoreInt32(&txi.secondaryIndexesBuilt, 1)
+	glog.Infof("buildSecondaryIndexes: Finished building txindex secondary indexes")
+	return nil
+}
+
+// GetTxnsByTypeAndHeight returns a page of the txIDs of transactions of the given type with
+// block heights in [minHeight, maxHeight]. See DbGetTxindexTxnsByTypeAndHeight.
+func (txi *TXIndex) GetTxnsByTypeAndHeight(txnType TxnType, minHeight uint64, maxHeight uint64,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+	if !txi.SecondaryIndexesBuilt() {
+		return nil, nil, fmt.Errorf("GetTxnsByTypeAndHeight: Secondary indexes are still being built")
+	}
+	return DbGetTxindexTxnsByTypeAndHeight(txi.TXIndexChain.DB(), txnType, minHeight, maxHeight, startKey, limit, reverse)
+}
+
+// GetCoinActivity returns a page of the txIDs of transactions of the given type that involve
+// the creator coin or DAO coin of the given creator. See DbGetTxindexCoinActivity.
+func (txi *TXIndex) GetCoinActivity(creatorPublicKey []byte, txnType TxnType,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+	if !txi.SecondaryIndexesBuilt() {
+		return nil, nil, fmt.Errorf("GetCoinActivity: Secondary indexes are still being built")
+	}
+	return DbGetTxindexCoinActivity(txi.TXIndexChain.DB(), creatorPublicKey, txnType, startKey, limit, reverse)
+}
+
+// GetNFTActivity returns a page of the txIDs of transactions involving the NFTs of the given
+// post. See DbGetTxindexNFTActivity.
+func (txi *TXIndex) GetNFTActivity(nftPostHash *BlockHash,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+	if !txi.SecondaryIndexesBuilt() {
+		return nil, nil, fmt.Errorf("GetNFTActivity: Secondary indexes are still being built")
+	}
+	return DbGetTxindexNFTActivity(txi.TXIndexChain.DB(), nftPostHash, startKey, limit, reverse)
+}
+
+// GetTxnsForPublicKey returns a page of the txIDs of transactions that affected the given
+// public key. See DbGetTxindexTxnsForPublicKeyPaginated.
+func (txi *TXIndex) GetTxnsForPublicKey(publicKey []byte,
+	startKey []byte, limit int, reverse bool) (_txIDs []*BlockHash, _nextStartKey []byte, _err error) {
+	return DbGetTxindexTxnsForPublicKeyPaginated(txi.TXIndexChain.DB(), publicKey, startKey, limit, reverse)
+}
+
 // Update syncs the transaction index with the blockchain.
 // Specifically, it reads in all the blocks that have come in since the last
 // time this function was called and adds the new transactions to the txindex.
@@ -264,6 +374,17 @@ func (txi *TXIndex) Update() error {
 	// done with the rest of the function.
 	txi.TXIndexLock.Lock()
 	defer txi.TXIndexLock.Unlock()
+
+	// Build the secondary indexes for txindexes created before they existed.
+	if !txi.SecondaryIndexesBuilt() {
+		if err := txi.buildSecondaryIndexes(); err != nil {
+			return fmt.Errorf("Update: Problem building secondary indexes: %v", err)
+		}
+		if txi.killed {
+			return nil
+		}
+	}
+
 	txindexTipNode, blockTipNode, commonAncestor, detachBlocks, attachBlocks := txi.GetTxindexUpdateBlockNodes()
 
 	// Note that the blockchain's ChainLock does not need to be held at this
@@ -311,7 +432,7 @@ func (txi *TXIndex) Update() error {
 		err = txi.TXIndexChain.DB().Update(func(dbTxn *badger.Txn) error {
 			for _, txn := range blockMsg.Txns {
 				if err := DbDeleteTxindexTransactionMappingsWithTxn(dbTxn, nil,
-					blockHeight, txn, txi.Params, txi.CoreChain.eventManager, true); err != nil {
+					uint64(blockToDetach.Height), txn, txi.Params, txi.CoreChain.eventManager, true); err != nil {
 
 					return fmt.Errorf("Update: Problem deleting "+
 						"transaction mappings for transaction %v: %v", txn.Hash(), err)
@@ -461,6 +582,8 @@ func (txi *TXIndex) Update() error {
 	return nil
 }
 
+// ConnectTxnAndComputeTransactionMetadata connects the txn to the utxoView and computes the
+// metadata stored in the txindex.
 func ConnectTxnAndComputeTransactionMetadata(
 	txn *MsgDeSoTxn, utxoView *UtxoView, blockHash *BlockHash,
 	blockHeight uint32, blockTimestampNanoSecs int64, txnIndexInBlock uint64) (*TransactionMetadata, error) {
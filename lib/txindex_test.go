@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"encoding/hex"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTXIndexUpdate checks that the txindex can be built from a chain stored in Badger, and from a chain
+// stored in Postgres when a POSTGRES_URI is provided.
+func TestTXIndexUpdate(t *testing.T) {
+	for _, usePostgres := range []bool{false, true} {
+		// We skip the postgres case in buildkite CI, but include it in GH actions postgres testing.
+		if usePostgres && len(os.Getenv("POSTGRES_URI")) == 0 {
+			continue
+		}
+		_testTXIndexUpdate(t, usePostgres)
+	}
+}
+
+func _testTXIndexUpdate(t *testing.T, usePostgres bool) {
+	require := require.New(t)
+
+	chain, params, _ := NewLowDifficultyBlockchainWithParamsAndDb(t, &DeSoTestnetParams, usePostgres, 5436, false)
+	mempool, miner := NewTestMiner(t, chain, params, true /*isSender*/)
+
+	// Mine a few blocks to give the txindex something to index.
+	numBlocks := 3
+	for ii := 0; ii < numBlocks; ii++ {
+		_, err := miner.MineAndProcessSingleBlock(0 /*threadIndex*/, mempool)
+		require.NoError(err)
+	}
+
+	txi, err := NewTXIndex(chain, params, t.TempDir())
+	require.NoError(err)
+	t.Cleanup(func() {
+		txi.TXIndexChain.DB().Close()
+	})
+	require.True(txi.SecondaryIndexesBuilt())
+	require.NoError(txi.Update())
+	require.Equal(chain.BlockTip().Hash, txi.TXIndexChain.BlockTip().Hash)
+
+	// Every block reward should be in the txindex.
+	bestChain, _ := chain.CopyBestChain()
+	require.Len(bestChain, numBlocks+1)
+	for _, blockNode := range bestChain[1:] {
+		block, err := GetBlock(blockNode.Hash, chain.DB(), nil)
+		require.NoError(err)
+		for _, txn := range block.Txns {
+			txnMeta := DbGetTxindexTransactionRefByTxID(txi.TXIndexChain.DB(), nil, txn.Hash())
+			require.NotNil(txnMeta)
+			require.Equal(hex.EncodeToString(blockNode.Hash[:]), txnMeta.BlockHashHex)
+		}
+	}
+	txIDs, nextStartKey, err := txi.GetTxnsByTypeAndHeight(TxnTypeBlockReward, 1, math.MaxUint64, nil, 100, false)
+	require.NoError(err)
+	require.Len(txIDs, numBlocks)
+	require.Nil(nextStartKey)
+}
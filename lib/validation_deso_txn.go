@@ -208,3 +208,37 @@ func ValidateDeSoTxnMinimalNetworkFee(txn *MsgDeSoTxn, globalParams *GlobalParam
 	}
 	return nil
 }
+
+// GetMinInclusionBlockHeight returns the minimum block height that the transaction can be included in, as declared
+// by the MinInclusionBlockHeightKey in its ExtraData. Transactions that don't declare one can be included at any
+// height, and return zero.
+func (msg *MsgDeSoTxn) GetMinInclusionBlockHeight() (uint64, error) {
+	minInclusionBlockHeightBytes, exists := msg.ExtraData[MinInclusionBlockHeightKey]
+	if !exists {
+		return 0, nil
+	}
+	minInclusionBlockHeight, bytesRead := Uvarint(minInclusionBlockHeightBytes)
+	if bytesRead <= 0 || bytesRead != len(minInclusionBlockHeightBytes) {
+		return 0, errors.Wrapf(RuleErrorInvalidMinInclusionBlockHeight, "GetMinInclusionBlockHeight: Problem "+
+			"decoding min inclusion block height %v", minInclusionBlockHeightBytes)
+	}
+	return minInclusionBlockHeight, nil
+}
+
+// ValidateDeSoTxnMinInclusionBlockHeight validates that the transaction can be included in a block at blockHeight.
+func ValidateDeSoTxnMinInclusionBlockHeight(txn *MsgDeSoTxn, blockHeight uint64) error {
+	if txn == nil {
+		return fmt.Errorf("ValidateDeSoTxnMinInclusionBlockHeight: Transaction cannot be nil")
+	}
+
+	minInclusionBlockHeight, err := txn.GetMinInclusionBlockHeight()
+	if err != nil {
+		return errors.Wrapf(err, "ValidateDeSoTxnMinInclusionBlockHeight: ")
+	}
+	if blockHeight < minInclusionBlockHeight {
+		return errors.Wrapf(RuleErrorTxnBeforeMinInclusionBlockHeight, "ValidateDeSoTxnMinInclusionBlockHeight: "+
+			"Transaction can't be included before block height %d, got block height %d",
+			minInclusionBlockHeight, blockHeight)
+	}
+	return nil
+}
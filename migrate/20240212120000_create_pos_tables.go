@@ -0,0 +1,186 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+
+		//
+		// Validators
+		//
+		_, err := db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_validators (
+				validator_pkid                          BYTEA PRIMARY KEY,
+				domains                                 TEXT[],
+				disable_delegated_stake                 BOOL NOT NULL,
+				delegated_stake_commission_basis_points BIGINT NOT NULL,
+				voting_public_key                       BYTEA,
+				voting_authorization                    BYTEA,
+				total_stake_amount_nanos                TEXT NOT NULL,
+				last_active_at_epoch_number             BIGINT NOT NULL,
+				jailed_at_epoch_number                  BIGINT NOT NULL,
+				status                                  SMALLINT NOT NULL,
+				extra_data                              JSONB
+			);
+
+			CREATE INDEX pg_validators_status_total_stake_amount_nanos
+			ON pg_validators(status, total_stake_amount_nanos DESC, validator_pkid DESC);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_snapshot_validators (
+				snapshot_at_epoch_number                BIGINT NOT NULL,
+				validator_pkid                          BYTEA NOT NULL,
+				domains                                 TEXT[],
+				disable_delegated_stake                 BOOL NOT NULL,
+				delegated_stake_commission_basis_points BIGINT NOT NULL,
+				voting_public_key                       BYTEA,
+				voting_authorization                    BYTEA,
+				total_stake_amount_nanos                TEXT NOT NULL,
+				last_active_at_epoch_number             BIGINT NOT NULL,
+				jailed_at_epoch_number                  BIGINT NOT NULL,
+				status                                  SMALLINT NOT NULL,
+				extra_data                              JSONB,
+
+				PRIMARY KEY (snapshot_at_epoch_number, validator_pkid)
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		//
+		// Stakes
+		//
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_stakes (
+				validator_pkid     BYTEA NOT NULL,
+				staker_pkid        BYTEA NOT NULL,
+				reward_method      SMALLINT NOT NULL,
+				stake_amount_nanos TEXT NOT NULL,
+				extra_data         JSONB,
+
+				PRIMARY KEY (validator_pkid, staker_pkid)
+			);
+
+			CREATE INDEX pg_stakes_staker_pkid
+			ON pg_stakes(staker_pkid);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_locked_stakes (
+				validator_pkid         BYTEA NOT NULL,
+				staker_pkid            BYTEA NOT NULL,
+				locked_at_epoch_number BIGINT NOT NULL,
+				locked_amount_nanos    TEXT NOT NULL,
+				extra_data             JSONB,
+
+				PRIMARY KEY (validator_pkid, staker_pkid, locked_at_epoch_number)
+			);
+
+			CREATE INDEX pg_locked_stakes_staker_pkid
+			ON pg_locked_stakes(staker_pkid);
+		`)
+		if err != nil {
+			return err
+		}
+
+		//
+		// Epochs
+		//
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_epochs (
+				epoch_number                         BIGINT PRIMARY KEY,
+				initial_block_height                 BIGINT NOT NULL,
+				initial_view                         BIGINT NOT NULL,
+				final_block_height                   BIGINT NOT NULL,
+				initial_leader_index_offset          BIGINT NOT NULL,
+				created_at_block_timestamp_nano_secs BIGINT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		//
+		// Transaction metadata
+		//
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_register_as_validators (
+				transaction_hash                        BYTEA PRIMARY KEY,
+				domains                                 TEXT[],
+				disable_delegated_stake                 BOOL NOT NULL,
+				delegated_stake_commission_basis_points BIGINT NOT NULL,
+				voting_public_key                       BYTEA,
+				voting_authorization                    BYTEA
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_stakes (
+				transaction_hash     BYTEA PRIMARY KEY,
+				validator_public_key BYTEA NOT NULL,
+				reward_method        SMALLINT NOT NULL,
+				stake_amount_nanos   TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_unstakes (
+				transaction_hash     BYTEA PRIMARY KEY,
+				validator_public_key BYTEA NOT NULL,
+				unstake_amount_nanos TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_unlock_stakes (
+				transaction_hash     BYTEA PRIMARY KEY,
+				validator_public_key BYTEA NOT NULL,
+				start_epoch_number   BIGINT NOT NULL,
+				end_epoch_number     BIGINT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS pg_validators;
+			DROP TABLE IF EXISTS pg_snapshot_validators;
+			DROP TABLE IF EXISTS pg_stakes;
+			DROP TABLE IF EXISTS pg_locked_stakes;
+			DROP TABLE IF EXISTS pg_epochs;
+			DROP TABLE IF EXISTS pg_metadata_register_as_validators;
+			DROP TABLE IF EXISTS pg_metadata_stakes;
+			DROP TABLE IF EXISTS pg_metadata_unstakes;
+			DROP TABLE IF EXISTS pg_metadata_unlock_stakes;
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20240212120000_create_pos_tables", up, down, opts)
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+
+		//
+		// Lockups
+		//
+		_, err := db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_locked_balance_entries (
+				holder_pkid                     BYTEA NOT NULL,
+				profile_pkid                    BYTEA NOT NULL,
+				unlock_timestamp_nano_secs      BIGINT NOT NULL,
+				vesting_end_timestamp_nano_secs BIGINT NOT NULL,
+				balance_base_units              TEXT NOT NULL,
+
+				PRIMARY KEY (holder_pkid, profile_pkid, unlock_timestamp_nano_secs, vesting_end_timestamp_nano_secs)
+			);
+
+			CREATE INDEX pg_locked_balance_entries_profile_pkid
+			ON pg_locked_balance_entries(profile_pkid);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_lockup_yield_curve_points (
+				profile_pkid                  BYTEA NOT NULL,
+				lockup_duration_nano_secs     BIGINT NOT NULL,
+				lockup_yield_apy_basis_points BIGINT NOT NULL,
+
+				PRIMARY KEY (profile_pkid, lockup_duration_nano_secs)
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			ALTER TABLE IF EXISTS pg_profiles
+				ADD dao_coin_lockup_transfer_restriction_status SMALLINT;
+		`)
+		if err != nil {
+			return err
+		}
+
+		//
+		// Transaction metadata
+		//
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_coin_lockups (
+				transaction_hash                BYTEA PRIMARY KEY,
+				profile_public_key              BYTEA NOT NULL,
+				recipient_public_key            BYTEA NOT NULL,
+				unlock_timestamp_nano_secs      BIGINT NOT NULL,
+				vesting_end_timestamp_nano_secs BIGINT NOT NULL,
+				lockup_amount_base_units        TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_update_coin_lockup_params (
+				transaction_hash                   BYTEA PRIMARY KEY,
+				lockup_yield_duration_nano_secs    BIGINT NOT NULL,
+				lockup_yield_apy_basis_points      BIGINT NOT NULL,
+				remove_yield_curve_point           BOOL NOT NULL,
+				new_lockup_transfer_restrictions   BOOL NOT NULL,
+				lockup_transfer_restriction_status SMALLINT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_coin_lockup_transfers (
+				transaction_hash                    BYTEA PRIMARY KEY,
+				recipient_public_key                BYTEA NOT NULL,
+				profile_public_key                  BYTEA NOT NULL,
+				unlock_timestamp_nano_secs          BIGINT NOT NULL,
+				locked_coins_to_transfer_base_units TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			CREATE TABLE IF NOT EXISTS pg_metadata_coin_unlocks (
+				transaction_hash   BYTEA PRIMARY KEY,
+				profile_public_key BYTEA NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS pg_locked_balance_entries;
+			DROP TABLE IF EXISTS pg_lockup_yield_curve_points;
+			ALTER TABLE pg_profiles DROP COLUMN dao_coin_lockup_transfer_restriction_status;
+			DROP TABLE IF EXISTS pg_metadata_coin_lockups;
+			DROP TABLE IF EXISTS pg_metadata_update_coin_lockup_params;
+			DROP TABLE IF EXISTS pg_metadata_coin_lockup_transfers;
+			DROP TABLE IF EXISTS pg_metadata_coin_unlocks;
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20240212130000_create_lockup_tables", up, down, opts)
+}
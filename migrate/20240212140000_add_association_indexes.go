@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		// Association queries match association_type case-insensitively, so the
+		// existing index on the raw column is never used. Replace it with an index
+		// on LOWER(association_type) that also supports LIKE prefix matching, and
+		// index the PKID/post hash columns we filter by.
+		//
+		// Associations without ExtraData are flushed with a NULL extra_data, so we
+		// also drop the NOT NULL constraint on that column.
+		_, err := db.Exec(`
+			DROP INDEX IF EXISTS pg_user_associations_association_type;
+
+			CREATE INDEX pg_user_associations_lower_association_type
+			ON pg_user_associations(LOWER(association_type) text_pattern_ops);
+
+			CREATE INDEX pg_user_associations_transactor_pkid
+			ON pg_user_associations(transactor_pkid);
+
+			CREATE INDEX pg_user_associations_target_user_pkid
+			ON pg_user_associations(target_user_pkid);
+
+			CREATE INDEX pg_user_associations_app_pkid
+			ON pg_user_associations(app_pkid);
+
+			ALTER TABLE pg_user_associations
+				ALTER COLUMN extra_data DROP NOT NULL;
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			DROP INDEX IF EXISTS pg_post_associations_association_type;
+
+			CREATE INDEX pg_post_associations_lower_association_type
+			ON pg_post_associations(LOWER(association_type) text_pattern_ops);
+
+			CREATE INDEX pg_post_associations_transactor_pkid
+			ON pg_post_associations(transactor_pkid);
+
+			CREATE INDEX pg_post_associations_post_hash
+			ON pg_post_associations(post_hash);
+
+			CREATE INDEX pg_post_associations_app_pkid
+			ON pg_post_associations(app_pkid);
+
+			ALTER TABLE pg_post_associations
+				ALTER COLUMN extra_data DROP NOT NULL;
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	down := func(db orm.DB) error {
+		_, err := db.Exec(`
+			DROP INDEX IF EXISTS pg_user_associations_lower_association_type;
+			DROP INDEX IF EXISTS pg_user_associations_transactor_pkid;
+			DROP INDEX IF EXISTS pg_user_associations_target_user_pkid;
+			DROP INDEX IF EXISTS pg_user_associations_app_pkid;
+			CREATE INDEX pg_user_associations_association_type ON pg_user_associations(association_type);
+
+			DROP INDEX IF EXISTS pg_post_associations_lower_association_type;
+			DROP INDEX IF EXISTS pg_post_associations_transactor_pkid;
+			DROP INDEX IF EXISTS pg_post_associations_post_hash;
+			DROP INDEX IF EXISTS pg_post_associations_app_pkid;
+			CREATE INDEX pg_post_associations_association_type ON pg_post_associations(association_type);
+		`)
+		return err
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20240212140000_add_association_indexes", up, down, opts)
+}
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	migrations "github.com/robinjoseph08/go-pg-migrations/v3"
+)
+
+func init() {
+	up := func(db orm.DB) error {
+		// Legacy private messages used to be keyed by the hash of the transaction that
+		// created them, which isn't available when messages are loaded from a hypersync
+		// snapshot. They're now keyed by the double SHA-256 of the sender public key,
+		// recipient public key and big-endian timestamp, which both paths can compute,
+		// so we rekey the messages that were stored before. A message that was loaded
+		// from a snapshot and then connected again from a block is already stored under
+		// the new key, so the copy keyed by transaction hash is dropped first.
+		_, err := db.Exec(`
+			DELETE FROM pg_messages AS message
+			WHERE EXISTS (
+				SELECT 1 FROM pg_messages AS rekeyed
+				WHERE rekeyed.message_hash <> message.message_hash
+				AND rekeyed.message_hash = sha256(sha256(
+					message.sender_public_key || message.recipient_public_key ||
+					int8send(message.timestamp_nanos::BIGINT)
+				))
+			);
+
+			UPDATE pg_messages
+			SET message_hash = sha256(sha256(
+				sender_public_key || recipient_public_key || int8send(timestamp_nanos::BIGINT)
+			));
+		`)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	down := func(db orm.DB) error {
+		// The transaction hashes can't be recovered from the messages, so there's nothing to undo.
+		return nil
+	}
+
+	opts := migrations.MigrationOptions{}
+	migrations.Register("20240212150000_rekey_pg_messages", up, down, opts)
+}